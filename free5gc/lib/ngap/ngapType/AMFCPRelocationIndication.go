@@ -0,0 +1,7 @@
+package ngapType
+
+// Need to import "free5gc/lib/aper" if it uses "aper"
+
+type AMFCPRelocationIndication struct {
+	ProtocolIEs ProtocolIEContainerAMFCPRelocationIndicationIEs
+}
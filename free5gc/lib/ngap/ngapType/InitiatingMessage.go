@@ -62,6 +62,7 @@ const (
 	InitiatingMessagePresentUplinkRANConfigurationTransfer
 	InitiatingMessagePresentUplinkRANStatusTransfer
 	InitiatingMessagePresentUplinkUEAssociatedNRPPaTransport
+	InitiatingMessagePresentAMFCPRelocationIndication
 )
 
 type InitiatingMessageValue struct {
@@ -118,4 +119,5 @@ type InitiatingMessageValue struct {
 	UplinkRANConfigurationTransfer        *UplinkRANConfigurationTransfer        `aper:"valueExt,referenceFieldValue:48"`
 	UplinkRANStatusTransfer               *UplinkRANStatusTransfer               `aper:"valueExt,referenceFieldValue:49"`
 	UplinkUEAssociatedNRPPaTransport      *UplinkUEAssociatedNRPPaTransport      `aper:"valueExt,referenceFieldValue:50"`
+	AMFCPRelocationIndication             *AMFCPRelocationIndication             `aper:"valueExt,referenceFieldValue:64"`
 }
@@ -58,3 +58,4 @@ const ProcedureCodeUplinkRANConfigurationTransfer int64 = 48
 const ProcedureCodeUplinkRANStatusTransfer int64 = 49
 const ProcedureCodeUplinkUEAssociatedNRPPaTransport int64 = 50
 const ProcedureCodeWriteReplaceWarning int64 = 51
+const ProcedureCodeAMFCPRelocationIndication int64 = 64
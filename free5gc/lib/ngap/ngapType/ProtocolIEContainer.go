@@ -441,6 +441,11 @@ type ProtocolIEContainerLocationReportIEs struct {
 }
 
 /* Sequence of = 35, FULL Name = struct ProtocolIE_Container_6449P73 */
+/* AMFCPRelocationIndicationIEs */
+type ProtocolIEContainerAMFCPRelocationIndicationIEs struct {
+	List []AMFCPRelocationIndicationIEs `aper:"sizeLB:0,sizeUB:65535"`
+}
+
 /* UETNLABindingReleaseRequestIEs */
 type ProtocolIEContainerUETNLABindingReleaseRequestIEs struct {
 	List []UETNLABindingReleaseRequestIEs `aper:"sizeLB:0,sizeUB:65535"`
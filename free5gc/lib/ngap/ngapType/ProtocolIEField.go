@@ -2119,6 +2119,28 @@ type LocationReportIEsValue struct {
 	LocationReportingRequestType   *LocationReportingRequestType   `aper:"valueExt,referenceFieldValue:33"`
 }
 
+type AMFCPRelocationIndicationIEs struct {
+	Id          ProtocolIEID
+	Criticality Criticality
+	Value       AMFCPRelocationIndicationIEsValue `aper:"openType,referenceFieldName:Id"`
+}
+
+const (
+	AMFCPRelocationIndicationIEsPresentNothing int = iota /* No components present */
+	AMFCPRelocationIndicationIEsPresentAMFUENGAPID
+	AMFCPRelocationIndicationIEsPresentRANUENGAPID
+	AMFCPRelocationIndicationIEsPresentSNSSAI
+	AMFCPRelocationIndicationIEsPresentAllowedNSSAI
+)
+
+type AMFCPRelocationIndicationIEsValue struct {
+	Present      int
+	AMFUENGAPID  *AMFUENGAPID  `aper:"referenceFieldValue:10"`
+	RANUENGAPID  *RANUENGAPID  `aper:"referenceFieldValue:85"`
+	SNSSAI       *SNSSAI       `aper:"valueExt,referenceFieldValue:148"`
+	AllowedNSSAI *AllowedNSSAI `aper:"referenceFieldValue:0"`
+}
+
 type UETNLABindingReleaseRequestIEs struct {
 	Id          ProtocolIEID
 	Criticality Criticality
@@ -147,6 +147,7 @@ const ProtocolIEIDSecurityIndication int64 = 138
 const ProtocolIEIDULNGUUPTNLInformation int64 = 139
 const ProtocolIEIDULNGUUPTNLModifyList int64 = 140
 const ProtocolIEIDWarningAreaCoordinates int64 = 141
+const ProtocolIEIDSNSSAI int64 = 148
 const ProtocolIEIDWAGFIdentiftyInformation int64 = 239
 const ProtocolIEIDGlobalTNGFID int64 = 240
 const ProtocolIEIDGlobalTWIFID int64 = 241
@@ -0,0 +1,370 @@
+// Package api defines the gRPC control API of sim-amf.
+//
+// The messages are plain Go structs carried as JSON (content-subtype "json"), so a test runner only needs a gRPC
+// client able to send "application/grpc+json" to the methods of ServiceName, e.g. "/simamf.SimAMF/Page", or the Go
+// client returned by NewSimAMFClient.
+//
+// Wire format: each request and response is the length-prefixed gRPC message of the standard HTTP/2 framing, of which
+// the payload is the UTF-8 JSON object of the Go struct, with the field names of its json tags, e.g.
+// {"amfUeNgapId":1,"newNgKsi":true} for a RekeyNASRequest, the times being in RFC 3339. The server is forced to the
+// JSON codec: a request sent as "application/grpc" or "application/grpc+proto" is decoded as JSON all the same, there
+// being no .proto of the service.
+package api
+
+import "time"
+
+// AMF is an AMF of the AMF set emulated by sim-amf
+type AMF struct {
+	Name          string `json:"name"`
+	SCTPAddr      string `json:"sctpAddr"`
+	AmfID         string `json:"amfId"`
+	Capacity      int64  `json:"capacity"`
+	Reroute       bool   `json:"reroute,omitempty"`
+	Unavailable   bool   `json:"unavailable,omitempty"`
+	BackupAMFName string `json:"backupAmfName,omitempty"`
+	AGFCount      int    `json:"agfCount"`
+}
+
+// AGF is an AGF connected to sim-amf
+type AGF struct {
+	SCTPAddr    string `json:"sctpAddr"`
+	AMF         string `json:"amf"`
+	RANNodeName string `json:"ranNodeName,omitempty"`
+	GlobalAGFID string `json:"globalAgfId,omitempty"`
+	NGSetupDone bool   `json:"ngSetupDone"`
+	UECount     int    `json:"ueCount"`
+}
+
+// PDUSession is a PDU session of a UE
+type PDUSession struct {
+	PduSessionID int64  `json:"pduSessionId"`
+	Type         string `json:"type,omitempty"`
+	State        string `json:"state,omitempty"`
+	Sst          int32  `json:"sst"`
+	Sd           string `json:"sd,omitempty"`
+	Dnn          string `json:"dnn,omitempty"`
+	IPv4Address  string `json:"ipv4Address,omitempty"` // allocated from the pool of the DNN or static
+	IPv6Address  string `json:"ipv6Address,omitempty"`
+}
+
+// UE is a UE context held by sim-amf
+type UE struct {
+	AmfUeNgapID   int64        `json:"amfUeNgapId"`
+	RanUeNgapID   int64        `json:"ranUeNgapId"`
+	AGF           string       `json:"agf"`
+	AMF           string       `json:"amf"`
+	RGType        string       `json:"rgType"`
+	Registered    bool         `json:"registered"`
+	GmmState      string       `json:"gmmState"`
+	CmState       string       `json:"cmState"`
+	MAC           string       `json:"mac,omitempty"`
+	GlobalLineID  string       `json:"globalLineId,omitempty"`
+	GlobalCableID string       `json:"globalCableId,omitempty"`
+	HFCNodeID     string       `json:"hfcNodeId,omitempty"`
+	LineType      string       `json:"lineType,omitempty"`
+	Supi          string       `json:"supi,omitempty"`
+	Suci          string       `json:"suci,omitempty"`
+	Guti          string       `json:"guti,omitempty"`
+	PduSessions   []PDUSession `json:"pduSessions,omitempty"`
+	UeAmbrUL      int64        `json:"ueAmbrUl,omitempty"`
+	UeAmbrDL      int64        `json:"ueAmbrDl,omitempty"`
+	IndexToRfsp   int64        `json:"indexToRfsp,omitempty"`
+	TraceID       string       `json:"traceId,omitempty"`
+	Locations     []Location   `json:"locations,omitempty"`
+}
+
+// Location is a line identity of a UE reported by the AGF, with the UE presence, in, out or unknown, in the areas of
+// interest by Location Reporting Reference ID
+type Location struct {
+	Time         time.Time        `json:"time"`
+	Procedure    string           `json:"procedure"`
+	GlobalLineID string           `json:"globalLineId,omitempty"`
+	HFCNodeID    string           `json:"hfcNodeId,omitempty"`
+	LineType     string           `json:"lineType,omitempty"`
+	Presence     map[int64]string `json:"presence,omitempty"`
+}
+
+// UESelector selects a UE by its AMF UE NGAP ID, MAC address, Global Line ID or Global Cable ID, in this order of
+// precedence
+type UESelector struct {
+	AmfUeNgapID   int64  `json:"amfUeNgapId,omitempty"`
+	MAC           string `json:"mac,omitempty"`
+	GlobalLineID  string `json:"globalLineId,omitempty"`
+	GlobalCableID string `json:"globalCableId,omitempty"`
+}
+
+// Empty is the response of the procedures which only report success or failure
+type Empty struct{}
+
+type ListAMFsRequest struct{}
+
+type ListAMFsResponse struct {
+	AMFs []AMF `json:"amfs"`
+}
+
+type ListAGFsRequest struct{}
+
+type ListAGFsResponse struct {
+	AGFs []AGF `json:"agfs"`
+}
+
+// ListUEsRequest lists the UEs, optionally restricted to the ones served by the AGF at SCTPAddr
+type ListUEsRequest struct {
+	SCTPAddr string `json:"sctpAddr,omitempty"`
+}
+
+type ListUEsResponse struct {
+	UEs []UE `json:"ues"`
+}
+
+type GetUERequest struct {
+	UESelector
+}
+
+// DeregisterRequest triggers a network-initiated Deregistration Request
+//
+// TS 24.501 5.5.2.3 Network-initiated de-registration procedure
+type DeregisterRequest struct {
+	UESelector
+	ReRegistrationRequired bool  `json:"reRegistrationRequired,omitempty"`
+	Cause5GMM              uint8 `json:"cause5gmm,omitempty"`
+}
+
+// ReleaseUEContextRequest triggers a UE Context Release Command, the cause defaults to nas/normal-release
+//
+// TS 38.413 8.3.3 UE Context Release
+type ReleaseUEContextRequest struct {
+	UESelector
+	CausePresent int   `json:"causePresent,omitempty"`
+	CauseValue   int64 `json:"causeValue,omitempty"`
+}
+
+// ModifyUEContextRequest triggers a UE Context Modification Request of the given parameters: a new Security Key derived
+// from the KAMF, the UE-AMBR in bps, the UE security capabilities as the supported algorithms among nea1, nea2, nea3,
+// nia1, nia2, nia3, eea1, eea2, eea3, eia1, eia2 and eia3, the index to RFSP from 1 to 256, and the Core Network
+// Assistance Information of the UE
+//
+// TS 38.413 8.3.4 UE Context Modification
+type ModifyUEContextRequest struct {
+	UESelector
+	NewSecurityKey                   bool     `json:"newSecurityKey,omitempty"`
+	UeAmbrUL                         int64    `json:"ueAmbrUl,omitempty"`
+	UeAmbrDL                         int64    `json:"ueAmbrDl,omitempty"`
+	SecurityAlgorithms               []string `json:"securityAlgorithms,omitempty"`
+	IndexToRfsp                      int64    `json:"indexToRfsp,omitempty"`
+	CoreNetworkAssistanceInformation bool     `json:"coreNetworkAssistanceInformation,omitempty"`
+}
+
+// RekeyNASRequest triggers a Security Mode Command on a registered UE taking into use a K'AMF derived horizontally with
+// a new ngKSI, or new NAS security algorithms among nia1, nia2 and nea0, nea1, nea2, the new Security Key being then
+// sent to the AGF in a UE Context Modification
+//
+// TS 24.501 5.4.2 Security mode control procedure, TS 33.501 6.9.3 Key-change-on-the-fly
+type RekeyNASRequest struct {
+	UESelector
+	NewNgKsi           bool   `json:"newNgKsi,omitempty"`
+	IntegrityAlgorithm string `json:"integrityAlgorithm,omitempty"`
+	CipheringAlgorithm string `json:"cipheringAlgorithm,omitempty"`
+}
+
+// ModifyPDUSessionRequest triggers a PDU Session Resource Modify Request updating the Session-AMBR in bps
+//
+// TS 38.413 8.2.3 PDU Session Resource Modify
+type ModifyPDUSessionRequest struct {
+	UESelector
+	PduSessionID  int64 `json:"pduSessionId"`
+	SessionAmbrUL int64 `json:"sessionAmbrUl"`
+	SessionAmbrDL int64 `json:"sessionAmbrDl"`
+}
+
+// ReleasePDUSessionRequest triggers a network-requested PDU session release, the cause defaults to #36 regular
+// deactivation
+//
+// TS 24.501 6.3.3 PDU session release procedure
+type ReleasePDUSessionRequest struct {
+	UESelector
+	PduSessionID int64 `json:"pduSessionId"`
+	Cause5GSM    uint8 `json:"cause5gsm,omitempty"`
+}
+
+// PageRequest triggers a Paging of the UE in the tracking areas supported by its AGF
+//
+// TS 38.413 8.5.1 Paging
+type PageRequest struct {
+	UESelector
+}
+
+// ResetRequest triggers an NG Reset towards the AGF at SCTPAddr, resetting the listed UEs or the whole NG interface
+// if none is listed. The cause defaults to misc/om-intervention.
+//
+// TS 38.413 8.7.4 NG Reset
+type ResetRequest struct {
+	SCTPAddr     string       `json:"sctpAddr"`
+	UEs          []UESelector `json:"ues,omitempty"`
+	CausePresent int          `json:"causePresent,omitempty"`
+	CauseValue   int64        `json:"causeValue,omitempty"`
+}
+
+// AMFStatusIndicationRequest marks the GUAMIs served by the AMF named AMFName unavailable and triggers an AMF Status
+// Indication of them, with the BackupAMFName if not empty, towards all the AGFs connected to the AMF set
+//
+// TS 38.413 8.7.6 AMF Status Indication
+type AMFStatusIndicationRequest struct {
+	AMFName       string `json:"amfName"`
+	BackupAMFName string `json:"backupAmfName,omitempty"`
+}
+
+// TNLEndpointUpdate changes the TNL association usage, ue, non-ue or both, and the TNL address weight factor of the
+// endpoint of an AMF at Address, the zero values keep the current settings
+type TNLEndpointUpdate struct {
+	Address string `json:"address"`
+	Usage   string `json:"usage,omitempty"`
+	Weight  *int64 `json:"weight,omitempty"`
+}
+
+// AMFConfigurationUpdateRequest triggers an AMF Configuration Update of the endpoints of the AMF named AMFName
+// towards its AGFs. The endpoints are given by the SCTP addresses they are configured to listen on. The TNL
+// associations to the removed endpoints are aborted if AbortRemoved is set.
+//
+// TS 38.413 8.7.3 AMF Configuration Update
+type AMFConfigurationUpdateRequest struct {
+	AMFName      string              `json:"amfName"`
+	Add          []string            `json:"add,omitempty"`
+	Remove       []string            `json:"remove,omitempty"`
+	Update       []TNLEndpointUpdate `json:"update,omitempty"`
+	AbortRemoved bool                `json:"abortRemoved,omitempty"`
+}
+
+// ReleaseUETNLABindingRequest triggers a UE TNLA Binding Release Request, the UE being unbound from its TNL
+// association
+//
+// TS 38.413 8.3.6 UE TNLA Binding Release
+type ReleaseUETNLABindingRequest struct {
+	UESelector
+}
+
+// AMFCPRelocationIndicationRequest triggers an AMF CP Relocation Indication of the UE
+//
+// TS 38.413 8.3.7 AMF CP Relocation Indication
+type AMFCPRelocationIndicationRequest struct {
+	UESelector
+}
+
+// TraceStartRequest triggers a Trace Start of the UE. The trace parameters default to the ones of the subscriber if
+// TraceID is empty: the NG-RAN Trace ID as 16 hex digits, the interfaces to trace among ng-c, xn-c, uu, f1-c and e1,
+// the trace depth, e.g. minimum, medium or maximum, and the IP address of the trace collection entity.
+//
+// TS 38.413 8.12.1 Trace Start
+type TraceStartRequest struct {
+	UESelector
+	TraceID          string   `json:"traceId,omitempty"`
+	Interfaces       []string `json:"interfaces,omitempty"`
+	Depth            string   `json:"depth,omitempty"`
+	CollectionEntity string   `json:"collectionEntity,omitempty"`
+}
+
+// DeactivateTraceRequest triggers a Deactivate Trace of the trace session of the UE
+//
+// TS 38.413 8.12.3 Deactivate Trace
+type DeactivateTraceRequest struct {
+	UESelector
+}
+
+// LocationReportingControlRequest triggers a Location Reporting Control of the UE. The event type is one of direct,
+// change-of-serve-cell, ue-presence-in-area-of-interest, stop-change-of-serve-cell,
+// stop-ue-presence-in-area-of-interest and cancel-location-reporting-for-the-ue. The areas of interest are given for
+// ue-presence-in-area-of-interest, the reference ID to be cancelled for stop-ue-presence-in-area-of-interest.
+//
+// TS 38.413 8.17.1 Location Reporting Control
+type LocationReportingControlRequest struct {
+	UESelector
+	EventType                string           `json:"eventType"`
+	AreasOfInterest          []AreaOfInterest `json:"areasOfInterest,omitempty"`
+	ReferenceIDToBeCancelled int64            `json:"referenceIdToBeCancelled,omitempty"`
+}
+
+// AreaOfInterest is an area of interest identified by its Location Reporting Reference ID, 1 to 64, made of TAIs,
+// <MCC><MNC>-<TAC> with the TAC in hex, e.g. 20893-000001, and of the W-AGF serving the UE
+//
+// TS 38.413 9.3.1.66 Area of Interest
+type AreaOfInterest struct {
+	ReferenceID int64    `json:"referenceId"`
+	TAIs        []string `json:"tais,omitempty"`
+	ServingAGF  bool     `json:"servingAgf,omitempty"`
+}
+
+// SetTraceRequest adds the UE to or removes it from the UEs of the message trace. All the UEs are traced until one is
+// added.
+type SetTraceRequest struct {
+	UESelector
+	Enable bool `json:"enable"`
+}
+
+// SetNASTimerRequest sets a network side 5GMM timer of the UE, T3522, T3550, T3560 or T3570, for the next procedures.
+// Value is in seconds, the zero values keep the current settings.
+//
+// TS 24.501 10.2 Timers of 5GS mobility management
+type SetNASTimerRequest struct {
+	UESelector
+	Timer              string `json:"timer"`
+	Value              int    `json:"value,omitempty"`
+	MaxRetransmissions *int   `json:"maxRetransmissions,omitempty"`
+}
+
+// Fault is a fault injected in the NGAP and NAS messages of the NGAP procedures or NAS message types named as in the
+// metrics, e.g. initial_context_setup or registration_accept, exchanged with the UEs with the AMF UE NGAP IDs or MAC
+// addresses, with a probability defaulting to 1. The action is one of delay, drop, duplicate, reorder, corrupt, and
+// for the sent messages only wrong_amf_ue_ngap_id, wrong_ran_ue_ngap_id, bad_mac and wrong_sqn. The direction is sent
+// or received, sent if empty. The delay also bounds the hold of a reordered message. The rule is removed after Count
+// injections, unlimited if zero.
+type Fault struct {
+	ID          int64    `json:"id,omitempty"`
+	Action      string   `json:"action"`
+	Direction   string   `json:"direction,omitempty"`
+	Messages    []string `json:"messages,omitempty"`
+	UEs         []string `json:"ues,omitempty"`
+	Probability float64  `json:"probability,omitempty"`
+	DelayMs     int64    `json:"delayMs,omitempty"`
+	Count       int64    `json:"count,omitempty"`
+	Injected    int64    `json:"injected,omitempty"`
+}
+
+// RemoveFaultsRequest removes the faults with the IDs, or all the faults if none is given
+type RemoveFaultsRequest struct {
+	IDs []int64 `json:"ids,omitempty"`
+}
+
+type ListFaultsRequest struct{}
+
+type ListFaultsResponse struct {
+	Faults []Fault `json:"faults"`
+}
+
+// ReloadSubscribersRequest reloads the subscriber database, as on SIGHUP
+type ReloadSubscribersRequest struct{}
+
+// ReloadSubscribersResponse reports the number of subscriber identities loaded
+type ReloadSubscribersResponse struct {
+	Subscribers int `json:"subscribers"`
+}
+
+// WatchEventsRequest streams the events of all the UEs, or of the UE selected if any
+type WatchEventsRequest struct {
+	UESelector
+}
+
+// Event is an outcome of a UE procedure, e.g. a UE registered (registered), a PDU session established
+// (pdu_session_established), a NAS retransmission on a 5GMM timer expiry (nas_timer_expired) or a procedure aborted after
+// the maximum retransmissions (procedure_aborted), or an AGF message differing from the recording being replayed
+// (replay_divergence)
+type Event struct {
+	Time         time.Time `json:"time"`
+	Type         string    `json:"type"`
+	AmfUeNgapID  int64     `json:"amfUeNgapId"`
+	MAC          string    `json:"mac,omitempty"`
+	Timer        string    `json:"timer,omitempty"`
+	ExpireTimes  int       `json:"expireTimes,omitempty"`
+	Procedure    string    `json:"procedure,omitempty"`
+	PDUSessionID int64     `json:"pduSessionId,omitempty"`
+	Detail       string    `json:"detail,omitempty"`
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"encoding/json"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// Name is the content-subtype of the codec, i.e. requests are sent as "application/grpc+json"
+const Name = "json"
+
+// ServerCodec is the codec the control API server is forced to, so that every request and response is JSON whatever
+// the content-subtype of the request, sim-amf shipping no .proto of the service
+var ServerCodec grpc.Codec = codec{}
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
+
+// codec marshals the control API messages as JSON so that the service can be used without generated protobuf code
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (codec) Name() string {
+	return Name
+}
+
+// String returns the name of the codec, for grpc.CustomCodec
+func (codec) String() string {
+	return Name
+}
@@ -0,0 +1,26 @@
+package api
+
+import "testing"
+
+func TestServerCodec(t *testing.T) {
+	req := &RekeyNASRequest{UESelector: UESelector{AmfUeNgapID: 1}, NewNgKsi: true}
+	data, err := ServerCodec.Marshal(req)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if want := `{"amfUeNgapId":1,"newNgKsi":true}`; string(data) != want {
+		t.Errorf("Marshal() = %s, want %s", data, want)
+	}
+
+	got := new(RekeyNASRequest)
+	if err := ServerCodec.Unmarshal(data, got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if *got != *req {
+		t.Errorf("Unmarshal() = %+v, want %+v", got, req)
+	}
+	// the empty message of a request without fields
+	if err := ServerCodec.Unmarshal(nil, new(ListAMFsRequest)); err != nil {
+		t.Errorf("Unmarshal() of an empty message error = %v", err)
+	}
+}
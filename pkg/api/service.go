@@ -0,0 +1,759 @@
+package api
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// ServiceName is the full name of the control API service
+const ServiceName = "simamf.SimAMF"
+
+// SimAMFServer is the server API of the control API service
+type SimAMFServer interface {
+	ListAMFs(context.Context, *ListAMFsRequest) (*ListAMFsResponse, error)
+	ListAGFs(context.Context, *ListAGFsRequest) (*ListAGFsResponse, error)
+	ListUEs(context.Context, *ListUEsRequest) (*ListUEsResponse, error)
+	GetUE(context.Context, *GetUERequest) (*UE, error)
+	Deregister(context.Context, *DeregisterRequest) (*Empty, error)
+	ReleaseUEContext(context.Context, *ReleaseUEContextRequest) (*Empty, error)
+	ModifyUEContext(context.Context, *ModifyUEContextRequest) (*Empty, error)
+	RekeyNAS(context.Context, *RekeyNASRequest) (*Empty, error)
+	ModifyPDUSession(context.Context, *ModifyPDUSessionRequest) (*Empty, error)
+	ReleasePDUSession(context.Context, *ReleasePDUSessionRequest) (*Empty, error)
+	Page(context.Context, *PageRequest) (*Empty, error)
+	Reset(context.Context, *ResetRequest) (*Empty, error)
+	AMFStatusIndication(context.Context, *AMFStatusIndicationRequest) (*Empty, error)
+	AMFConfigurationUpdate(context.Context, *AMFConfigurationUpdateRequest) (*Empty, error)
+	ReleaseUETNLABinding(context.Context, *ReleaseUETNLABindingRequest) (*Empty, error)
+	AMFCPRelocationIndication(context.Context, *AMFCPRelocationIndicationRequest) (*Empty, error)
+	TraceStart(context.Context, *TraceStartRequest) (*Empty, error)
+	DeactivateTrace(context.Context, *DeactivateTraceRequest) (*Empty, error)
+	LocationReportingControl(context.Context, *LocationReportingControlRequest) (*Empty, error)
+	SetTrace(context.Context, *SetTraceRequest) (*Empty, error)
+	SetNASTimer(context.Context, *SetNASTimerRequest) (*Empty, error)
+	AddFault(context.Context, *Fault) (*Fault, error)
+	RemoveFaults(context.Context, *RemoveFaultsRequest) (*Empty, error)
+	ListFaults(context.Context, *ListFaultsRequest) (*ListFaultsResponse, error)
+	ReloadSubscribers(context.Context, *ReloadSubscribersRequest) (*ReloadSubscribersResponse, error)
+	WatchEvents(*WatchEventsRequest, SimAMFWatchEventsServer) error
+}
+
+// SimAMFWatchEventsServer is the server side of the WatchEvents stream
+type SimAMFWatchEventsServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+// RegisterSimAMFServer registers the control API service on s
+func RegisterSimAMFServer(s *grpc.Server, srv SimAMFServer) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*SimAMFServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "ListAMFs", Handler: listAMFsHandler},
+		{MethodName: "ListAGFs", Handler: listAGFsHandler},
+		{MethodName: "ListUEs", Handler: listUEsHandler},
+		{MethodName: "GetUE", Handler: getUEHandler},
+		{MethodName: "Deregister", Handler: deregisterHandler},
+		{MethodName: "ReleaseUEContext", Handler: releaseUEContextHandler},
+		{MethodName: "ModifyUEContext", Handler: modifyUEContextHandler},
+		{MethodName: "RekeyNAS", Handler: rekeyNASHandler},
+		{MethodName: "ModifyPDUSession", Handler: modifyPDUSessionHandler},
+		{MethodName: "ReleasePDUSession", Handler: releasePDUSessionHandler},
+		{MethodName: "Page", Handler: pageHandler},
+		{MethodName: "Reset", Handler: resetHandler},
+		{MethodName: "AMFStatusIndication", Handler: amfStatusIndicationHandler},
+		{MethodName: "AMFConfigurationUpdate", Handler: amfConfigurationUpdateHandler},
+		{MethodName: "ReleaseUETNLABinding", Handler: releaseUETNLABindingHandler},
+		{MethodName: "AMFCPRelocationIndication", Handler: amfCPRelocationIndicationHandler},
+		{MethodName: "TraceStart", Handler: traceStartHandler},
+		{MethodName: "DeactivateTrace", Handler: deactivateTraceHandler},
+		{MethodName: "LocationReportingControl", Handler: locationReportingControlHandler},
+		{MethodName: "SetTrace", Handler: setTraceHandler},
+		{MethodName: "SetNASTimer", Handler: setNASTimerHandler},
+		{MethodName: "AddFault", Handler: addFaultHandler},
+		{MethodName: "RemoveFaults", Handler: removeFaultsHandler},
+		{MethodName: "ListFaults", Handler: listFaultsHandler},
+		{MethodName: "ReloadSubscribers", Handler: reloadSubscribersHandler},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "WatchEvents", Handler: watchEventsHandler, ServerStreams: true},
+	},
+}
+
+func fullMethod(method string) string {
+	return "/" + ServiceName + "/" + method
+}
+
+func listAMFsHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListAMFsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimAMFServer).ListAMFs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod("ListAMFs")}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimAMFServer).ListAMFs(ctx, req.(*ListAMFsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func listAGFsHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListAGFsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimAMFServer).ListAGFs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod("ListAGFs")}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimAMFServer).ListAGFs(ctx, req.(*ListAGFsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func listUEsHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListUEsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimAMFServer).ListUEs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod("ListUEs")}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimAMFServer).ListUEs(ctx, req.(*ListUEsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func getUEHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUERequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimAMFServer).GetUE(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod("GetUE")}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimAMFServer).GetUE(ctx, req.(*GetUERequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func deregisterHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeregisterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimAMFServer).Deregister(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod("Deregister")}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimAMFServer).Deregister(ctx, req.(*DeregisterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func releaseUEContextHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReleaseUEContextRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimAMFServer).ReleaseUEContext(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod("ReleaseUEContext")}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimAMFServer).ReleaseUEContext(ctx, req.(*ReleaseUEContextRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func modifyUEContextHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ModifyUEContextRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimAMFServer).ModifyUEContext(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod("ModifyUEContext")}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimAMFServer).ModifyUEContext(ctx, req.(*ModifyUEContextRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func rekeyNASHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RekeyNASRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimAMFServer).RekeyNAS(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod("RekeyNAS")}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimAMFServer).RekeyNAS(ctx, req.(*RekeyNASRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func modifyPDUSessionHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ModifyPDUSessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimAMFServer).ModifyPDUSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod("ModifyPDUSession")}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimAMFServer).ModifyPDUSession(ctx, req.(*ModifyPDUSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func releasePDUSessionHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReleasePDUSessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimAMFServer).ReleasePDUSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod("ReleasePDUSession")}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimAMFServer).ReleasePDUSession(ctx, req.(*ReleasePDUSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func pageHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimAMFServer).Page(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod("Page")}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimAMFServer).Page(ctx, req.(*PageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func resetHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimAMFServer).Reset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod("Reset")}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimAMFServer).Reset(ctx, req.(*ResetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func amfStatusIndicationHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AMFStatusIndicationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimAMFServer).AMFStatusIndication(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod("AMFStatusIndication")}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimAMFServer).AMFStatusIndication(ctx, req.(*AMFStatusIndicationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func amfConfigurationUpdateHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AMFConfigurationUpdateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimAMFServer).AMFConfigurationUpdate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod("AMFConfigurationUpdate")}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimAMFServer).AMFConfigurationUpdate(ctx, req.(*AMFConfigurationUpdateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func releaseUETNLABindingHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReleaseUETNLABindingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimAMFServer).ReleaseUETNLABinding(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod("ReleaseUETNLABinding")}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimAMFServer).ReleaseUETNLABinding(ctx, req.(*ReleaseUETNLABindingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func amfCPRelocationIndicationHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AMFCPRelocationIndicationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimAMFServer).AMFCPRelocationIndication(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod("AMFCPRelocationIndication")}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimAMFServer).AMFCPRelocationIndication(ctx, req.(*AMFCPRelocationIndicationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func traceStartHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TraceStartRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimAMFServer).TraceStart(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod("TraceStart")}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimAMFServer).TraceStart(ctx, req.(*TraceStartRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func deactivateTraceHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeactivateTraceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimAMFServer).DeactivateTrace(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod("DeactivateTrace")}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimAMFServer).DeactivateTrace(ctx, req.(*DeactivateTraceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func locationReportingControlHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LocationReportingControlRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimAMFServer).LocationReportingControl(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod("LocationReportingControl")}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimAMFServer).LocationReportingControl(ctx, req.(*LocationReportingControlRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func setTraceHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetTraceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimAMFServer).SetTrace(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod("SetTrace")}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimAMFServer).SetTrace(ctx, req.(*SetTraceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func setNASTimerHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetNASTimerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimAMFServer).SetNASTimer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod("SetNASTimer")}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimAMFServer).SetNASTimer(ctx, req.(*SetNASTimerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func addFaultHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Fault)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimAMFServer).AddFault(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod("AddFault")}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimAMFServer).AddFault(ctx, req.(*Fault))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func removeFaultsHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveFaultsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimAMFServer).RemoveFaults(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod("RemoveFaults")}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimAMFServer).RemoveFaults(ctx, req.(*RemoveFaultsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func listFaultsHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListFaultsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimAMFServer).ListFaults(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod("ListFaults")}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimAMFServer).ListFaults(ctx, req.(*ListFaultsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func reloadSubscribersHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReloadSubscribersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimAMFServer).ReloadSubscribers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod("ReloadSubscribers")}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimAMFServer).ReloadSubscribers(ctx, req.(*ReloadSubscribersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func watchEventsHandler(srv interface{}, stream grpc.ServerStream) error {
+	in := new(WatchEventsRequest)
+	if err := stream.RecvMsg(in); err != nil {
+		return err
+	}
+	return srv.(SimAMFServer).WatchEvents(in, &simAMFWatchEventsServer{stream})
+}
+
+type simAMFWatchEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *simAMFWatchEventsServer) Send(e *Event) error {
+	return x.ServerStream.SendMsg(e)
+}
+
+// SimAMFClient is the client API of the control API service
+type SimAMFClient interface {
+	ListAMFs(ctx context.Context, in *ListAMFsRequest, opts ...grpc.CallOption) (*ListAMFsResponse, error)
+	ListAGFs(ctx context.Context, in *ListAGFsRequest, opts ...grpc.CallOption) (*ListAGFsResponse, error)
+	ListUEs(ctx context.Context, in *ListUEsRequest, opts ...grpc.CallOption) (*ListUEsResponse, error)
+	GetUE(ctx context.Context, in *GetUERequest, opts ...grpc.CallOption) (*UE, error)
+	Deregister(ctx context.Context, in *DeregisterRequest, opts ...grpc.CallOption) (*Empty, error)
+	ReleaseUEContext(ctx context.Context, in *ReleaseUEContextRequest, opts ...grpc.CallOption) (*Empty, error)
+	ModifyUEContext(ctx context.Context, in *ModifyUEContextRequest, opts ...grpc.CallOption) (*Empty, error)
+	RekeyNAS(ctx context.Context, in *RekeyNASRequest, opts ...grpc.CallOption) (*Empty, error)
+	ModifyPDUSession(ctx context.Context, in *ModifyPDUSessionRequest, opts ...grpc.CallOption) (*Empty, error)
+	ReleasePDUSession(ctx context.Context, in *ReleasePDUSessionRequest, opts ...grpc.CallOption) (*Empty, error)
+	Page(ctx context.Context, in *PageRequest, opts ...grpc.CallOption) (*Empty, error)
+	Reset(ctx context.Context, in *ResetRequest, opts ...grpc.CallOption) (*Empty, error)
+	AMFStatusIndication(ctx context.Context, in *AMFStatusIndicationRequest, opts ...grpc.CallOption) (*Empty, error)
+	AMFConfigurationUpdate(ctx context.Context, in *AMFConfigurationUpdateRequest, opts ...grpc.CallOption) (*Empty, error)
+	ReleaseUETNLABinding(ctx context.Context, in *ReleaseUETNLABindingRequest, opts ...grpc.CallOption) (*Empty, error)
+	AMFCPRelocationIndication(ctx context.Context, in *AMFCPRelocationIndicationRequest, opts ...grpc.CallOption) (*Empty, error)
+	TraceStart(ctx context.Context, in *TraceStartRequest, opts ...grpc.CallOption) (*Empty, error)
+	DeactivateTrace(ctx context.Context, in *DeactivateTraceRequest, opts ...grpc.CallOption) (*Empty, error)
+	LocationReportingControl(ctx context.Context, in *LocationReportingControlRequest, opts ...grpc.CallOption) (*Empty, error)
+	SetTrace(ctx context.Context, in *SetTraceRequest, opts ...grpc.CallOption) (*Empty, error)
+	SetNASTimer(ctx context.Context, in *SetNASTimerRequest, opts ...grpc.CallOption) (*Empty, error)
+	AddFault(ctx context.Context, in *Fault, opts ...grpc.CallOption) (*Fault, error)
+	RemoveFaults(ctx context.Context, in *RemoveFaultsRequest, opts ...grpc.CallOption) (*Empty, error)
+	ListFaults(ctx context.Context, in *ListFaultsRequest, opts ...grpc.CallOption) (*ListFaultsResponse, error)
+	ReloadSubscribers(ctx context.Context, in *ReloadSubscribersRequest, opts ...grpc.CallOption) (*ReloadSubscribersResponse, error)
+	WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (SimAMFWatchEventsClient, error)
+}
+
+// SimAMFWatchEventsClient is the client side of the WatchEvents stream
+type SimAMFWatchEventsClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type simAMFClient struct {
+	cc *grpc.ClientConn
+}
+
+// NewSimAMFClient returns a client of the control API service using the JSON codec
+func NewSimAMFClient(cc *grpc.ClientConn) SimAMFClient {
+	return &simAMFClient{cc}
+}
+
+func (c *simAMFClient) invoke(ctx context.Context, method string, in, out interface{}, opts ...grpc.CallOption) error {
+	opts = append([]grpc.CallOption{grpc.CallContentSubtype(Name)}, opts...)
+	return c.cc.Invoke(ctx, fullMethod(method), in, out, opts...)
+}
+
+func (c *simAMFClient) ListAMFs(ctx context.Context, in *ListAMFsRequest, opts ...grpc.CallOption) (*ListAMFsResponse, error) {
+	out := new(ListAMFsResponse)
+	if err := c.invoke(ctx, "ListAMFs", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simAMFClient) ListAGFs(ctx context.Context, in *ListAGFsRequest, opts ...grpc.CallOption) (*ListAGFsResponse, error) {
+	out := new(ListAGFsResponse)
+	if err := c.invoke(ctx, "ListAGFs", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simAMFClient) ListUEs(ctx context.Context, in *ListUEsRequest, opts ...grpc.CallOption) (*ListUEsResponse, error) {
+	out := new(ListUEsResponse)
+	if err := c.invoke(ctx, "ListUEs", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simAMFClient) GetUE(ctx context.Context, in *GetUERequest, opts ...grpc.CallOption) (*UE, error) {
+	out := new(UE)
+	if err := c.invoke(ctx, "GetUE", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simAMFClient) Deregister(ctx context.Context, in *DeregisterRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	if err := c.invoke(ctx, "Deregister", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simAMFClient) ReleaseUEContext(ctx context.Context, in *ReleaseUEContextRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	if err := c.invoke(ctx, "ReleaseUEContext", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simAMFClient) ModifyUEContext(ctx context.Context, in *ModifyUEContextRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	if err := c.invoke(ctx, "ModifyUEContext", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simAMFClient) RekeyNAS(ctx context.Context, in *RekeyNASRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	if err := c.invoke(ctx, "RekeyNAS", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simAMFClient) ModifyPDUSession(ctx context.Context, in *ModifyPDUSessionRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	if err := c.invoke(ctx, "ModifyPDUSession", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simAMFClient) ReleasePDUSession(ctx context.Context, in *ReleasePDUSessionRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	if err := c.invoke(ctx, "ReleasePDUSession", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simAMFClient) Page(ctx context.Context, in *PageRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	if err := c.invoke(ctx, "Page", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simAMFClient) Reset(ctx context.Context, in *ResetRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	if err := c.invoke(ctx, "Reset", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simAMFClient) AMFStatusIndication(ctx context.Context, in *AMFStatusIndicationRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	if err := c.invoke(ctx, "AMFStatusIndication", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simAMFClient) AMFConfigurationUpdate(ctx context.Context, in *AMFConfigurationUpdateRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	if err := c.invoke(ctx, "AMFConfigurationUpdate", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simAMFClient) ReleaseUETNLABinding(ctx context.Context, in *ReleaseUETNLABindingRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	if err := c.invoke(ctx, "ReleaseUETNLABinding", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simAMFClient) AMFCPRelocationIndication(ctx context.Context, in *AMFCPRelocationIndicationRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	if err := c.invoke(ctx, "AMFCPRelocationIndication", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simAMFClient) TraceStart(ctx context.Context, in *TraceStartRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	if err := c.invoke(ctx, "TraceStart", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simAMFClient) DeactivateTrace(ctx context.Context, in *DeactivateTraceRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	if err := c.invoke(ctx, "DeactivateTrace", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simAMFClient) LocationReportingControl(ctx context.Context, in *LocationReportingControlRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	if err := c.invoke(ctx, "LocationReportingControl", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simAMFClient) SetTrace(ctx context.Context, in *SetTraceRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	if err := c.invoke(ctx, "SetTrace", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simAMFClient) SetNASTimer(ctx context.Context, in *SetNASTimerRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	if err := c.invoke(ctx, "SetNASTimer", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simAMFClient) AddFault(ctx context.Context, in *Fault, opts ...grpc.CallOption) (*Fault, error) {
+	out := new(Fault)
+	if err := c.invoke(ctx, "AddFault", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simAMFClient) RemoveFaults(ctx context.Context, in *RemoveFaultsRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	if err := c.invoke(ctx, "RemoveFaults", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simAMFClient) ListFaults(ctx context.Context, in *ListFaultsRequest, opts ...grpc.CallOption) (*ListFaultsResponse, error) {
+	out := new(ListFaultsResponse)
+	if err := c.invoke(ctx, "ListFaults", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simAMFClient) ReloadSubscribers(ctx context.Context, in *ReloadSubscribersRequest, opts ...grpc.CallOption) (*ReloadSubscribersResponse, error) {
+	out := new(ReloadSubscribersResponse)
+	if err := c.invoke(ctx, "ReloadSubscribers", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simAMFClient) WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (SimAMFWatchEventsClient, error) {
+	opts = append([]grpc.CallOption{grpc.CallContentSubtype(Name)}, opts...)
+	stream, err := c.cc.NewStream(ctx, &serviceDesc.Streams[0], fullMethod("WatchEvents"), opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &simAMFWatchEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type simAMFWatchEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *simAMFWatchEventsClient) Recv() (*Event, error) {
+	e := new(Event)
+	if err := x.ClientStream.RecvMsg(e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
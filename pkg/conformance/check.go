@@ -0,0 +1,430 @@
+package conformance
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"free5gc/lib/aper"
+	"free5gc/lib/nas"
+	"free5gc/lib/nas/nasMessage"
+	"free5gc/lib/ngap/ngapType"
+
+	"sim-amf/pkg/recording"
+	"sim-amf/pkg/types"
+	"sim-amf/pkg/util"
+)
+
+// uplinkMessageTypes are the 5GMM messages sent by the UE
+//
+// TS 24.501 8.2 5GS mobility management messages
+var uplinkMessageTypes = map[uint8]bool{
+	nas.MsgTypeRegistrationRequest:                              true,
+	nas.MsgTypeRegistrationComplete:                             true,
+	nas.MsgTypeDeregistrationRequestUEOriginatingDeregistration: true,
+	nas.MsgTypeDeregistrationAcceptUETerminatedDeregistration:   true,
+	nas.MsgTypeServiceRequest:                                   true,
+	nas.MsgTypeConfigurationUpdateComplete:                      true,
+	nas.MsgTypeAuthenticationResponse:                           true,
+	nas.MsgTypeAuthenticationFailure:                            true,
+	nas.MsgTypeIdentityResponse:                                 true,
+	nas.MsgTypeSecurityModeComplete:                             true,
+	nas.MsgTypeSecurityModeReject:                               true,
+	nas.MsgTypeStatus5GMM:                                       true,
+	nas.MsgTypeNotificationResponse:                             true,
+	nas.MsgTypeULNASTransport:                                   true,
+}
+
+// initialMessageTypes are the 5GMM messages sent in an Initial UE Message
+//
+// TS 24.501 4.4.6 Protection of initial NAS signalling messages
+var initialMessageTypes = map[uint8]bool{
+	nas.MsgTypeRegistrationRequest:                              true,
+	nas.MsgTypeDeregistrationRequestUEOriginatingDeregistration: true,
+	nas.MsgTypeServiceRequest:                                   true,
+}
+
+// checker collects the violations of a message
+type checker struct {
+	base       Violation
+	violations []Violation
+}
+
+func (c *checker) add(rule string, ie string, format string, args ...interface{}) {
+	v := c.base
+	v.Rule = rule
+	v.IE = ie
+	v.Detail = fmt.Sprintf(format, args...)
+	c.violations = append(c.violations, v)
+}
+
+// CheckNGAP checks an NGAP message received from the AGF agf, decodeErr being the error decoding it if pdu is nil.
+// It returns the violations found, none for a conformant message.
+func CheckNGAP(agf string, pdu *ngapType.NGAPPDU, decodeErr error) []Violation {
+	c := &checker{base: Violation{AGF: agf}}
+	if pdu == nil {
+		c.add(RuleTransferSyntax, "", "%v", decodeErr)
+		return c.violations
+	}
+
+	procedureCode, message := recording.Message(pdu)
+	c.base.Procedure = util.NgapProcedureName(procedureCode)
+	c.base.Message = message
+	var criticality aper.Enumerated
+	switch {
+	case pdu.InitiatingMessage != nil:
+		criticality = pdu.InitiatingMessage.Criticality.Value
+	case pdu.SuccessfulOutcome != nil:
+		criticality = pdu.SuccessfulOutcome.Criticality.Value
+	case pdu.UnsuccessfulOutcome != nil:
+		criticality = pdu.UnsuccessfulOutcome.Criticality.Value
+	}
+
+	ies := protocolIEs(pdu)
+	for _, ie := range ies {
+		if !ie.value.IsValid() {
+			continue
+		}
+		switch id := ie.value.Interface().(type) {
+		case *ngapType.AMFUENGAPID:
+			c.base.AmfUeNgapID = id.Value
+		case *ngapType.RANUENGAPID:
+			c.base.RanUeNgapID = id.Value
+		}
+	}
+
+	specs, ok := messageSpecs[message]
+	if !ok {
+		c.add(RuleUnexpectedMessage, "", "%s is not sent by a W-AGF to an AMF", message)
+		return c.violations
+	}
+	if expected := procedureCriticalities[procedureCode]; criticality != expected {
+		c.add(RuleCriticality, "", "procedure criticality %s instead of %s", criticalityName(criticality),
+			criticalityName(expected))
+	}
+	c.checkIEs(specs, ies)
+	for _, ie := range ies {
+		if !ie.value.IsValid() {
+			continue
+		}
+		name := ieName(ie.id)
+		c.checkConstraints(name, ie.value, "")
+		switch value := ie.value.Interface().(type) {
+		case *ngapType.NASPDU:
+			c.checkNASPDU(message, value.Value)
+		case *ngapType.UserLocationInformation:
+			c.checkUserLocationInformation(value)
+		case *ngapType.GlobalRANNodeID:
+			c.checkGlobalRANNodeID(value)
+		}
+	}
+	return c.violations
+}
+
+// protocolIE is an IE of a message, value being invalid if the IE is unknown to the decoder
+type protocolIE struct {
+	id          int64
+	criticality aper.Enumerated
+	value       reflect.Value
+}
+
+func protocolIEs(pdu *ngapType.NGAPPDU) (ies []protocolIE) {
+	var value reflect.Value
+	switch {
+	case pdu.InitiatingMessage != nil:
+		value = reflect.ValueOf(&pdu.InitiatingMessage.Value).Elem()
+	case pdu.SuccessfulOutcome != nil:
+		value = reflect.ValueOf(&pdu.SuccessfulOutcome.Value).Elem()
+	case pdu.UnsuccessfulOutcome != nil:
+		value = reflect.ValueOf(&pdu.UnsuccessfulOutcome.Value).Elem()
+	default:
+		return nil
+	}
+	present := int(value.FieldByName("Present").Int())
+	if present <= 0 || present >= value.NumField() || value.Field(present).IsNil() {
+		return nil
+	}
+	list := value.Field(present).Elem().FieldByName("ProtocolIEs").FieldByName("List")
+	for i := 0; i < list.Len(); i++ {
+		item := list.Index(i)
+		ie := protocolIE{
+			id:          item.FieldByName("Id").Field(0).Int(),
+			criticality: aper.Enumerated(item.FieldByName("Criticality").Field(0).Uint()),
+		}
+		ieValue := item.FieldByName("Value")
+		if present := int(ieValue.FieldByName("Present").Int()); present > 0 && present < ieValue.NumField() &&
+			!ieValue.Field(present).IsNil() {
+			ie.value = ieValue.Field(present)
+		}
+		ies = append(ies, ie)
+	}
+	return ies
+}
+
+// checkIEs checks the presence, order and criticality of the IEs of a message
+//
+// TS 38.413 10.3 Transfer Syntax Error, 10.3.4 Missing IE or IE Group, 10.3.5 IEs or IE Groups Received in Wrong
+// Order or with Too Many Occurrences or Erroneously Present
+func (c *checker) checkIEs(specs []ieSpec, ies []protocolIE) {
+	positions := make(map[int64]int, len(specs))
+	for i, spec := range specs {
+		positions[spec.id] = i
+	}
+	seen := make(map[int64]bool, len(ies))
+	last := -1
+	for _, ie := range ies {
+		name := ieName(ie.id)
+		if seen[ie.id] {
+			c.add(RuleDuplicateIE, name, "IE %d present more than once", ie.id)
+			continue
+		}
+		seen[ie.id] = true
+		position, ok := positions[ie.id]
+		if !ok || !ie.value.IsValid() {
+			c.add(RuleUnexpectedIE, name, "IE %d not defined for the message", ie.id)
+			continue
+		}
+		if position < last {
+			c.add(RuleIEOrder, name, "IE %d after IE %d", ie.id, specs[last].id)
+		} else {
+			last = position
+		}
+		if expected := specs[position].criticality; ie.criticality != expected {
+			c.add(RuleCriticality, name, "criticality %s instead of %s", criticalityName(ie.criticality),
+				criticalityName(expected))
+		}
+	}
+	for _, spec := range specs {
+		if spec.presence == mandatory && !seen[spec.id] {
+			c.add(RuleMissingIE, ieName(spec.id), "mandatory IE %d missing", spec.id)
+		}
+	}
+}
+
+var bitStringType = reflect.TypeOf(aper.BitString{})
+
+// checkConstraints checks the values and sizes reachable from v against the constraints of the aper tags, the
+// extensible ones excepted, and that a CHOICE has an alternative. The aper decoder only checks the bounds it needs to
+// decode the values, e.g. not the upper bound of an ENUMERATED.
+func (c *checker) checkConstraints(path string, v reflect.Value, tag string) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			c.checkConstraints(path, v.Elem(), tag)
+		}
+	case reflect.Struct:
+		if v.Type() == bitStringType {
+			c.checkSize(path, int64(v.FieldByName("BitLength").Uint()), tag)
+			return
+		}
+		if v.NumField() > 0 && v.Type().Field(0).Name == "Present" {
+			present := int(v.Field(0).Int())
+			if present <= 0 || present >= v.NumField() || v.Field(present).IsNil() {
+				c.add(RuleValueRange, path, "CHOICE without alternative")
+				return
+			}
+			field := v.Type().Field(present)
+			c.checkConstraints(path+"."+field.Name, v.Field(present), field.Tag.Get("aper"))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			c.checkConstraints(path+"."+field.Name, v.Field(i), field.Tag.Get("aper"))
+		}
+	case reflect.Slice:
+		c.checkSize(path, int64(v.Len()), tag)
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			c.checkConstraints(path+"["+strconv.Itoa(i)+"]", v.Index(i), "")
+		}
+	case reflect.String:
+		c.checkSize(path, int64(len(v.String())), tag)
+	case reflect.Int64:
+		c.checkValue(path, v.Int(), tag)
+	case reflect.Uint64:
+		c.checkValue(path, int64(v.Uint()), tag)
+	}
+}
+
+func (c *checker) checkValue(path string, value int64, tag string) {
+	params := tagParams(tag)
+	if _, ok := params["valueExt"]; ok {
+		return
+	}
+	if lb, ok := params["valueLB"]; ok && value < lb {
+		c.add(RuleValueRange, path, "value %d lower than %d", value, lb)
+	}
+	if ub, ok := params["valueUB"]; ok && value > ub {
+		c.add(RuleValueRange, path, "value %d greater than %d", value, ub)
+	}
+}
+
+func (c *checker) checkSize(path string, size int64, tag string) {
+	params := tagParams(tag)
+	if _, ok := params["sizeExt"]; ok {
+		return
+	}
+	if lb, ok := params["sizeLB"]; ok && size < lb {
+		c.add(RuleValueRange, path, "size %d lower than %d", size, lb)
+	}
+	if ub, ok := params["sizeUB"]; ok && size > ub {
+		c.add(RuleValueRange, path, "size %d greater than %d", size, ub)
+	}
+}
+
+// tagParams returns the bounds of an aper tag, and the extensible flags with the value 0
+func tagParams(tag string) map[string]int64 {
+	params := make(map[string]int64)
+	for _, part := range strings.Split(tag, ",") {
+		keyValue := strings.SplitN(part, ":", 2)
+		switch keyValue[0] {
+		case "valueExt", "sizeExt":
+			params[keyValue[0]] = 0
+		case "valueLB", "valueUB", "sizeLB", "sizeUB":
+			if len(keyValue) != 2 {
+				continue
+			}
+			if n, err := strconv.ParseInt(keyValue[1], 10, 64); err == nil {
+				params[keyValue[0]] = n
+			}
+		}
+	}
+	return params
+}
+
+// checkNASPDU checks the header of the NAS message carried in a NAS-PDU IE, before it is deprotected
+//
+// TS 24.501 9.1 Overview, 9.3 Security header type, 4.4.5 Ciphering of NAS signalling messages, 4.4.6 Protection of
+// initial NAS signalling messages
+func (c *checker) checkNASPDU(message string, pdu []byte) {
+	const ie = "NASPDU"
+	if len(pdu) < 3 {
+		c.add(RuleNASHeader, ie, "NAS message of %d octets", len(pdu))
+		return
+	}
+	if pdu[0] != nasMessage.Epd5GSMobilityManagementMessage {
+		c.add(RuleNASHeader, ie, "extended protocol discriminator %#x instead of 5GMM", pdu[0])
+		return
+	}
+	if pdu[1]&0xf0 != 0 {
+		c.add(RuleNASHeader, ie, "spare half octet %#x not zero", pdu[1]>>4)
+	}
+	securityHeaderType := pdu[1] & 0x0f
+	if securityHeaderType > nas.SecurityHeaderTypeIntegrityProtectedAndCipheredWithNew5gNasSecurityContext {
+		c.add(RuleNASHeader, ie, "security header type %d reserved", securityHeaderType)
+		return
+	}
+	if message == "InitialUEMessage" && securityHeaderType != nas.SecurityHeaderTypePlainNas &&
+		securityHeaderType != nas.SecurityHeaderTypeIntegrityProtected {
+		c.add(RuleNASHeader, ie, "initial NAS message with security header type %d, not sent ciphered",
+			securityHeaderType)
+		return
+	}
+
+	plain := pdu
+	if securityHeaderType != nas.SecurityHeaderTypePlainNas {
+		// the security protected NAS message header, 7 octets, is followed by the plain NAS message
+		if len(pdu) < 7+3 {
+			c.add(RuleNASHeader, ie, "security protected NAS message of %d octets", len(pdu))
+			return
+		}
+		switch securityHeaderType {
+		case nas.SecurityHeaderTypeIntegrityProtectedAndCiphered,
+			nas.SecurityHeaderTypeIntegrityProtectedAndCipheredWithNew5gNasSecurityContext:
+			return
+		}
+		plain = pdu[7:]
+		if plain[0] != nasMessage.Epd5GSMobilityManagementMessage || plain[1] != nas.SecurityHeaderTypePlainNas {
+			c.add(RuleNASHeader, ie, "plain NAS message header %#x %#x", plain[0], plain[1])
+			return
+		}
+	}
+
+	messageType := plain[2]
+	switch {
+	case !uplinkMessageTypes[messageType]:
+		c.add(RuleNASMessageType, ie, "%s is not sent by a UE", util.NasMessageTypeName(messageType))
+	case message == "InitialUEMessage" && !initialMessageTypes[messageType]:
+		c.add(RuleNASMessageType, ie, "%s is not an initial NAS message", util.NasMessageTypeName(messageType))
+	case securityHeaderType == nas.SecurityHeaderTypeIntegrityProtectedWithNew5gNasSecurityContext &&
+		messageType != nas.MsgTypeSecurityModeComplete:
+		c.add(RuleNASHeader, ie, "%s protected with a new 5G NAS security context",
+			util.NasMessageTypeName(messageType))
+	}
+}
+
+// checkUserLocationInformation checks that the User Location Information is the one of a W-AGF, with a well-formed
+// Global Line ID and its Line Type, or an HFC node ID
+//
+// TS 38.413 9.3.1.16 User Location Information, TS 23.316 4.7.8 Line ID and HFC identifier
+func (c *checker) checkUserLocationInformation(uli *ngapType.UserLocationInformation) {
+	const ie = "UserLocationInformation"
+	if uli.Present != ngapType.UserLocationInformationPresentChoiceExtensions || uli.ChoiceExtensions == nil ||
+		uli.ChoiceExtensions.Value.Value.UserLocationInformationWAGF == nil {
+		c.add(RuleUserLocationInformation, ie, "alternative %d instead of the W-AGF one", uli.Present)
+		return
+	}
+	if id := uli.ChoiceExtensions.Value.Id.Value; id != ngapType.ProtocolIEIDUserLocationInformationWAGF {
+		c.add(RuleUserLocationInformation, ie, "W-AGF alternative with IE %d", id)
+	}
+
+	wagf := uli.ChoiceExtensions.Value.Value.UserLocationInformationWAGF
+	switch {
+	case wagf.Present == ngapType.UserLocationInformationWAGFPresentGlobalLineID && wagf.GlobalLineID != nil:
+		if !types.ValidGlobalLineID(wagf.GlobalLineID.GlobalLineIdentity) {
+			c.add(RuleGlobalLineID, ie, "malformed Global Line ID %q", wagf.GlobalLineID.GlobalLineIdentity)
+		}
+		if wagf.GlobalLineID.LineType == nil {
+			c.add(RuleLineType, ie, "Global Line ID without Line Type")
+		}
+	case wagf.Present == ngapType.UserLocationInformationWAGFPresentHfcNodeID && wagf.HfcNodeID != nil:
+	default:
+		c.add(RuleUserLocationInformation, ie, "W-AGF alternative %d without Global Line ID nor HFC node ID",
+			wagf.Present)
+	}
+}
+
+// checkGlobalRANNodeID checks that the Global RAN Node ID is a Global W-AGF ID
+//
+// TS 38.413 9.3.1.5 Global RAN Node ID, 9.3.1.162 Global W-AGF ID
+func (c *checker) checkGlobalRANNodeID(globalRANNodeID *ngapType.GlobalRANNodeID) {
+	const ie = "GlobalRANNodeID"
+	if globalRANNodeID.Present != ngapType.GlobalRANNodeIDPresentChoiceExtensions ||
+		globalRANNodeID.ChoiceExtensions == nil ||
+		globalRANNodeID.ChoiceExtensions.Value.Value.GlobalWAGFID == nil {
+		c.add(RuleGlobalRANNodeID, ie, "alternative %d instead of the Global W-AGF ID", globalRANNodeID.Present)
+		return
+	}
+	if id := globalRANNodeID.ChoiceExtensions.Value.Id.Value; id != ngapType.ProtocolIEIDGlobalWAGFID {
+		c.add(RuleGlobalRANNodeID, ie, "Global W-AGF ID alternative with IE %d", id)
+	}
+	wagfID := globalRANNodeID.ChoiceExtensions.Value.Value.GlobalWAGFID.WAGFID
+	if wagfID.Present != ngapType.WAGFIDPresentWAGFID || wagfID.WAGFID == nil {
+		c.add(RuleGlobalRANNodeID, ie, "W-AGF ID alternative %d", wagfID.Present)
+	}
+}
+
+func ieName(id int64) string {
+	if name, ok := ieNames[id]; ok {
+		return name
+	}
+	return strconv.FormatInt(id, 10)
+}
+
+func criticalityName(criticality aper.Enumerated) string {
+	switch criticality {
+	case ngapType.CriticalityPresentReject:
+		return "reject"
+	case ngapType.CriticalityPresentIgnore:
+		return "ignore"
+	case ngapType.CriticalityPresentNotify:
+		return "notify"
+	}
+	return strconv.FormatUint(uint64(criticality), 10)
+}
@@ -0,0 +1,281 @@
+package conformance
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"free5gc/lib/aper"
+	"free5gc/lib/nas"
+	"free5gc/lib/ngap/ngapType"
+)
+
+func TestMessageSpecs(t *testing.T) {
+	for message, specs := range messageSpecs {
+		seen := make(map[int64]bool, len(specs))
+		for _, spec := range specs {
+			if seen[spec.id] {
+				t.Errorf("%s: IE %d defined more than once", message, spec.id)
+			}
+			seen[spec.id] = true
+			if _, ok := ieNames[spec.id]; !ok {
+				t.Errorf("%s: IE %d without name", message, spec.id)
+			}
+			if spec.criticality != reject && spec.criticality != ignore {
+				t.Errorf("%s: IE %d with criticality %d", message, spec.id, spec.criticality)
+			}
+		}
+	}
+}
+
+func TestTagParams(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want map[string]int64
+	}{
+		{tag: "", want: map[string]int64{}},
+		{tag: "valueLB:0,valueUB:4294967295", want: map[string]int64{"valueLB": 0, "valueUB": 4294967295}},
+		{tag: "valueExt,valueLB:0,valueUB:6", want: map[string]int64{"valueExt": 0, "valueLB": 0, "valueUB": 6}},
+		{tag: "sizeExt,sizeLB:1,sizeUB:150", want: map[string]int64{"sizeExt": 0, "sizeLB": 1, "sizeUB": 150}},
+		{tag: "referenceFieldValue:85", want: map[string]int64{}},
+		{tag: "sizeLB,sizeUB:x", want: map[string]int64{}},
+	}
+	for _, tt := range tests {
+		if got := tagParams(tt.tag); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tagParams(%q) = %v, want %v", tt.tag, got, tt.want)
+		}
+	}
+}
+
+func errorIndicationIE(id int64, criticality aper.Enumerated,
+	value ngapType.ErrorIndicationIEsValue) ngapType.ErrorIndicationIEs {
+	return ngapType.ErrorIndicationIEs{
+		Id:          ngapType.ProtocolIEID{Value: id},
+		Criticality: ngapType.Criticality{Value: criticality},
+		Value:       value,
+	}
+}
+
+func amfUeNgapIDIE(value int64) ngapType.ErrorIndicationIEs {
+	return errorIndicationIE(ngapType.ProtocolIEIDAMFUENGAPID, ignore, ngapType.ErrorIndicationIEsValue{
+		Present:     ngapType.ErrorIndicationIEsPresentAMFUENGAPID,
+		AMFUENGAPID: &ngapType.AMFUENGAPID{Value: value},
+	})
+}
+
+func ranUeNgapIDIE(value int64, criticality aper.Enumerated) ngapType.ErrorIndicationIEs {
+	return errorIndicationIE(ngapType.ProtocolIEIDRANUENGAPID, criticality, ngapType.ErrorIndicationIEsValue{
+		Present:     ngapType.ErrorIndicationIEsPresentRANUENGAPID,
+		RANUENGAPID: &ngapType.RANUENGAPID{Value: value},
+	})
+}
+
+func causeIE(cause *ngapType.Cause) ngapType.ErrorIndicationIEs {
+	return errorIndicationIE(ngapType.ProtocolIEIDCause, ignore, ngapType.ErrorIndicationIEsValue{
+		Present: ngapType.ErrorIndicationIEsPresentCause,
+		Cause:   cause,
+	})
+}
+
+func errorIndication(criticality aper.Enumerated, ies ...ngapType.ErrorIndicationIEs) *ngapType.NGAPPDU {
+	return &ngapType.NGAPPDU{
+		Present: ngapType.NGAPPDUPresentInitiatingMessage,
+		InitiatingMessage: &ngapType.InitiatingMessage{
+			ProcedureCode: ngapType.ProcedureCode{Value: ngapType.ProcedureCodeErrorIndication},
+			Criticality:   ngapType.Criticality{Value: criticality},
+			Value: ngapType.InitiatingMessageValue{
+				Present:         ngapType.InitiatingMessagePresentErrorIndication,
+				ErrorIndication: &ngapType.ErrorIndication{ProtocolIEs: ngapType.ProtocolIEContainerErrorIndicationIEs{List: ies}},
+			},
+		},
+	}
+}
+
+func TestCheckNGAP(t *testing.T) {
+	protocolCause := &ngapType.Cause{
+		Present:  ngapType.CausePresentProtocol,
+		Protocol: &ngapType.CauseProtocol{Value: ngapType.CauseProtocolPresentAbstractSyntaxErrorReject},
+	}
+	type violation struct {
+		rule string
+		ie   string
+	}
+	tests := []struct {
+		name string
+		pdu  *ngapType.NGAPPDU
+		want []violation
+	}{
+		{
+			name: "conformant",
+			pdu:  errorIndication(ignore, amfUeNgapIDIE(1), ranUeNgapIDIE(2, ignore), causeIE(protocolCause)),
+		},
+		{
+			name: "undecodable",
+			want: []violation{{RuleTransferSyntax, ""}},
+		},
+		{
+			name: "not sent by a W-AGF",
+			pdu: &ngapType.NGAPPDU{
+				Present: ngapType.NGAPPDUPresentInitiatingMessage,
+				InitiatingMessage: &ngapType.InitiatingMessage{
+					ProcedureCode: ngapType.ProcedureCode{Value: ngapType.ProcedureCodeDownlinkNASTransport},
+					Criticality:   ngapType.Criticality{Value: ignore},
+					Value: ngapType.InitiatingMessageValue{
+						Present:              ngapType.InitiatingMessagePresentDownlinkNASTransport,
+						DownlinkNASTransport: &ngapType.DownlinkNASTransport{},
+					},
+				},
+			},
+			want: []violation{{RuleUnexpectedMessage, ""}},
+		},
+		{
+			name: "procedure criticality",
+			pdu:  errorIndication(reject, amfUeNgapIDIE(1)),
+			want: []violation{{RuleCriticality, ""}},
+		},
+		{
+			name: "IE criticality",
+			pdu:  errorIndication(ignore, ranUeNgapIDIE(2, reject)),
+			want: []violation{{RuleCriticality, "RANUENGAPID"}},
+		},
+		{
+			name: "IE order",
+			pdu:  errorIndication(ignore, ranUeNgapIDIE(2, ignore), amfUeNgapIDIE(1)),
+			want: []violation{{RuleIEOrder, "AMFUENGAPID"}},
+		},
+		{
+			name: "duplicate IE",
+			pdu:  errorIndication(ignore, amfUeNgapIDIE(1), amfUeNgapIDIE(1)),
+			want: []violation{{RuleDuplicateIE, "AMFUENGAPID"}},
+		},
+		{
+			name: "IE not defined for the message",
+			pdu: errorIndication(ignore, amfUeNgapIDIE(1),
+				errorIndicationIE(ngapType.ProtocolIEIDNASPDU, ignore, ngapType.ErrorIndicationIEsValue{})),
+			want: []violation{{RuleUnexpectedIE, "NASPDU"}},
+		},
+		{
+			name: "value out of range",
+			pdu:  errorIndication(ignore, ranUeNgapIDIE(-1, ignore)),
+			want: []violation{{RuleValueRange, "RANUENGAPID.Value"}},
+		},
+		{
+			name: "CHOICE without alternative",
+			pdu:  errorIndication(ignore, causeIE(&ngapType.Cause{})),
+			want: []violation{{RuleValueRange, "Cause"}},
+		},
+		{
+			name: "missing mandatory IE",
+			pdu: &ngapType.NGAPPDU{
+				Present: ngapType.NGAPPDUPresentInitiatingMessage,
+				InitiatingMessage: &ngapType.InitiatingMessage{
+					ProcedureCode: ngapType.ProcedureCode{Value: ngapType.ProcedureCodeNGReset},
+					Criticality:   ngapType.Criticality{Value: reject},
+					Value: ngapType.InitiatingMessageValue{
+						Present: ngapType.InitiatingMessagePresentNGReset,
+						NGReset: &ngapType.NGReset{ProtocolIEs: ngapType.ProtocolIEContainerNGResetIEs{
+							List: []ngapType.NGResetIEs{{
+								Id:          ngapType.ProtocolIEID{Value: ngapType.ProtocolIEIDCause},
+								Criticality: ngapType.Criticality{Value: ignore},
+								Value: ngapType.NGResetIEsValue{
+									Present: ngapType.NGResetIEsPresentCause,
+									Cause:   protocolCause,
+								},
+							}},
+						}},
+					},
+				},
+			},
+			want: []violation{{RuleMissingIE, "ResetType"}},
+		},
+	}
+	for _, tt := range tests {
+		violations := CheckNGAP("agf", tt.pdu, errors.New("decoding error"))
+		var got []violation
+		for _, v := range violations {
+			got = append(got, violation{v.Rule, v.IE})
+			if v.AGF != "agf" {
+				t.Errorf("%s: violation of the AGF %q, want agf", tt.name, v.AGF)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: CheckNGAP() violations = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckNGAPIdentifiers(t *testing.T) {
+	violations := CheckNGAP("agf", errorIndication(reject, amfUeNgapIDIE(7), ranUeNgapIDIE(9, ignore)), nil)
+	if len(violations) != 1 {
+		t.Fatalf("CheckNGAP() violations = %v, want 1", violations)
+	}
+	v := violations[0]
+	if v.AmfUeNgapID != 7 || v.RanUeNgapID != 9 || v.Message != "ErrorIndication" {
+		t.Errorf("CheckNGAP() violation of %s AMF UE NGAP ID %d RAN UE NGAP ID %d, want ErrorIndication 7 9",
+			v.Message, v.AmfUeNgapID, v.RanUeNgapID)
+	}
+}
+
+func TestCheckNASPDU(t *testing.T) {
+	const (
+		epd           = 0x7e
+		plain         = nas.SecurityHeaderTypePlainNas
+		integrity     = nas.SecurityHeaderTypeIntegrityProtected
+		ciphered      = nas.SecurityHeaderTypeIntegrityProtectedAndCiphered
+		newContext    = nas.SecurityHeaderTypeIntegrityProtectedWithNew5gNasSecurityContext
+		registration  = nas.MsgTypeRegistrationRequest
+		smcComplete   = nas.MsgTypeSecurityModeComplete
+		ulNASTransfer = nas.MsgTypeULNASTransport
+	)
+	protected := func(securityHeaderType uint8, messageType uint8) []byte {
+		return []byte{epd, securityHeaderType, 0, 0, 0, 0, 0, epd, plain, messageType}
+	}
+	tests := []struct {
+		name    string
+		message string
+		pdu     []byte
+		want    []string
+	}{
+		{name: "plain initial", message: "InitialUEMessage", pdu: []byte{epd, plain, registration}},
+		{name: "protected initial", message: "InitialUEMessage", pdu: protected(integrity, registration)},
+		{name: "ciphered", message: "UplinkNASTransport", pdu: protected(ciphered, 0)},
+		{name: "new security context", message: "UplinkNASTransport", pdu: protected(newContext, smcComplete)},
+		{name: "too short", message: "UplinkNASTransport", pdu: []byte{epd, plain}, want: []string{RuleNASHeader}},
+		{name: "5GSM", message: "UplinkNASTransport", pdu: []byte{0x2e, 1, 0xc1}, want: []string{RuleNASHeader}},
+		{
+			name:    "spare half octet",
+			message: "UplinkNASTransport",
+			pdu:     []byte{epd, 0x10 | plain, ulNASTransfer},
+			want:    []string{RuleNASHeader},
+		},
+		{name: "reserved security header type", message: "UplinkNASTransport", pdu: []byte{epd, 5, ulNASTransfer},
+			want: []string{RuleNASHeader}},
+		{name: "ciphered initial", message: "InitialUEMessage", pdu: protected(ciphered, registration),
+			want: []string{RuleNASHeader}},
+		{name: "truncated protected", message: "UplinkNASTransport", pdu: []byte{epd, integrity, 0, 0, 0, 0, 0, epd},
+			want: []string{RuleNASHeader}},
+		{
+			name:    "protected plain header",
+			message: "UplinkNASTransport",
+			pdu:     []byte{epd, integrity, 0, 0, 0, 0, 0, epd, integrity, ulNASTransfer},
+			want:    []string{RuleNASHeader},
+		},
+		{name: "downlink message", message: "UplinkNASTransport", pdu: []byte{epd, plain, nas.MsgTypeRegistrationAccept},
+			want: []string{RuleNASMessageType}},
+		{name: "not initial", message: "InitialUEMessage", pdu: []byte{epd, plain, ulNASTransfer},
+			want: []string{RuleNASMessageType}},
+		{name: "new security context not SMC", message: "UplinkNASTransport", pdu: protected(newContext, ulNASTransfer),
+			want: []string{RuleNASHeader}},
+	}
+	for _, tt := range tests {
+		c := &checker{}
+		c.checkNASPDU(tt.message, tt.pdu)
+		var got []string
+		for _, v := range c.violations {
+			got = append(got, v.Rule)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: checkNASPDU(% x) violations = %v, want %v", tt.name, tt.pdu, got, tt.want)
+		}
+	}
+}
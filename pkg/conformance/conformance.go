@@ -0,0 +1,189 @@
+// Package conformance checks the NGAP messages received from the AGFs, and the NAS messages they carry, against TS
+// 38.413, TS 24.501 and the wireline access rules of TS 23.316, and reports the violations.
+package conformance
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"sim-amf/pkg/context"
+	"sim-amf/pkg/logger"
+	"sim-amf/pkg/metrics"
+)
+
+// Rules a message can violate
+const (
+	RuleTransferSyntax          string = "transfer_syntax"           // the NGAP message cannot be decoded
+	RuleUnexpectedMessage       string = "unexpected_message"        // the message is not sent by a W-AGF to an AMF
+	RuleCriticality             string = "criticality"               // criticality of the procedure or of an IE
+	RuleMissingIE               string = "missing_ie"                // mandatory IE absent
+	RuleDuplicateIE             string = "duplicate_ie"              // IE present more than once
+	RuleUnexpectedIE            string = "unexpected_ie"             // IE not defined for the message
+	RuleIEOrder                 string = "ie_order"                  // IEs not in the order of the message definition
+	RuleValueRange              string = "value_range"               // value or size out of its range, CHOICE without alternative
+	RuleUserLocationInformation string = "user_location_information" // User Location Information not the W-AGF choice
+	RuleGlobalLineID            string = "global_line_id"            // malformed Global Line ID
+	RuleLineType                string = "line_type"                 // Line Type absent from the Global Line ID
+	RuleGlobalRANNodeID         string = "global_ran_node_id"        // Global RAN Node ID not a Global W-AGF ID
+	RuleNASHeader               string = "nas_header"                // EPD, security header type or length of a NAS-PDU
+	RuleNASMessageType          string = "nas_message_type"          // NAS message type not sent by a UE, or not in this NGAP message
+	RuleNASMandatoryIE          string = "nas_mandatory_ie"          // NAS mandatory IE missing or invalid, semantically incorrect NAS message
+	RuleNASIntegrity            string = "nas_integrity"             // NAS message not integrity protected, or failing the integrity check
+	RuleNASProtocolState        string = "nas_protocol_state"        // NAS message type not compatible with the 5GMM state
+)
+
+// maxRecent is the number of violations kept for the summary
+const maxRecent = 100
+
+// Global is the conformance reporter of sim-amf, nil if the conformance checks are disabled
+var Global *Reporter
+
+// Violation is a violation of a rule by a message received from an AGF
+type Violation struct {
+	Time        time.Time `json:"time"`
+	AGF         string    `json:"agf"`
+	AmfUeNgapID int64     `json:"amfUeNgapId,omitempty"`
+	RanUeNgapID int64     `json:"ranUeNgapId,omitempty"`
+	Procedure   string    `json:"procedure,omitempty"`
+	Message     string    `json:"message,omitempty"`
+	Rule        string    `json:"rule"`
+	IE          string    `json:"ie,omitempty"`
+	Detail      string    `json:"detail"`
+}
+
+// Summary is the number of violations per rule and the last violations
+type Summary struct {
+	Messages   uint64            `json:"messages"` // messages checked
+	Violations uint64            `json:"violations"`
+	Rules      map[string]uint64 `json:"rules"`
+	Recent     []Violation       `json:"recent"`
+}
+
+// Reporter logs the violations, counts them in the metrics and writes them as JSON lines to the report, it is safe for concurrent
+// use. A nil Reporter reports nothing.
+type Reporter struct {
+	mu       sync.Mutex
+	out      io.WriteCloser // nil without report file
+	messages uint64
+	total    uint64
+	rules    map[string]uint64
+	recent   []Violation
+}
+
+// Create returns a Reporter writing the violations to a new file, or only logging them if name is empty
+func Create(name string) (*Reporter, error) {
+	if name == "" {
+		return NewReporter(nil), nil
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return NewReporter(f), nil
+}
+
+func NewReporter(out io.WriteCloser) *Reporter {
+	return &Reporter{out: out, rules: make(map[string]uint64)}
+}
+
+// Close logs the summary and closes the report
+func (r *Reporter) Close() error {
+	if r == nil {
+		return nil
+	}
+	summary := r.Summary()
+	rules := make([]string, 0, len(summary.Rules))
+	for rule := range summary.Rules {
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules)
+	logger.MainLog.Info("[Conformance] %d violations in %d messages", summary.Violations, summary.Messages)
+	for _, rule := range rules {
+		logger.MainLog.Info("[Conformance] %s: %d", rule, summary.Rules[rule])
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.out == nil {
+		return nil
+	}
+	return r.out.Close()
+}
+
+// Summary returns the violations counted so far
+func (r *Reporter) Summary() Summary {
+	if r == nil {
+		return Summary{Rules: map[string]uint64{}}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	summary := Summary{
+		Messages:   r.messages,
+		Violations: r.total,
+		Rules:      make(map[string]uint64, len(r.rules)),
+		Recent:     append([]Violation(nil), r.recent...),
+	}
+	for rule, count := range r.rules {
+		summary.Rules[rule] = count
+	}
+	return summary
+}
+
+// Report reports the violations of a message received from an AGF
+func (r *Reporter) Report(violations []Violation) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages++
+	r.add(violations)
+}
+
+func (r *Reporter) add(violations []Violation) {
+	for i := range violations {
+		v := &violations[i]
+		if v.Time.IsZero() {
+			v.Time = time.Now()
+		}
+		logger.MainLog.Warn("[Conformance] AGF[%s] AMF UE NGAP ID %d %s %s %s: %s", v.AGF, v.AmfUeNgapID, v.Message,
+			v.Rule, v.IE, v.Detail)
+		r.total++
+		r.rules[v.Rule]++
+		r.recent = append(r.recent, *v)
+		if len(r.recent) > maxRecent {
+			r.recent = r.recent[1:]
+		}
+		metrics.CountConformanceViolation(v.Procedure, v.Rule)
+		if r.out == nil {
+			continue
+		}
+		if line, err := json.Marshal(v); err == nil {
+			r.out.Write(append(line, '\n'))
+		}
+	}
+}
+
+// ReportNAS reports a violation of a NAS message of the UE, found once the message is deprotected and decoded
+func (r *Reporter) ReportNAS(ue *context.UEContext, message string, rule string, detail string) {
+	if r == nil {
+		return
+	}
+	v := Violation{
+		AmfUeNgapID: ue.AmfUeNgapId,
+		RanUeNgapID: ue.RanUeNgapId,
+		Message:     message,
+		Rule:        rule,
+		Detail:      detail,
+	}
+	if ue.AGF != nil {
+		v.AGF = ue.AGF.SCTPAddr
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.add([]Violation{v})
+}
@@ -0,0 +1,292 @@
+package conformance
+
+import (
+	"free5gc/lib/aper"
+	"free5gc/lib/ngap/ngapType"
+)
+
+type presence int
+
+const (
+	optional presence = iota
+	mandatory
+)
+
+const (
+	reject = ngapType.CriticalityPresentReject
+	ignore = ngapType.CriticalityPresentIgnore
+)
+
+// ieSpec is an IE of a message, in the order of the message definition
+type ieSpec struct {
+	id          int64
+	criticality aper.Enumerated
+	presence    presence
+}
+
+// messageSpecs are the IEs of the messages a W-AGF sends to the AMF
+//
+// TS 38.413 9.2 Message Functional Definition and Content, 9.4.4 PDU Definitions
+var messageSpecs = map[string][]ieSpec{
+	// 9.2.6 Interface Management Messages
+	"NGSetupRequest": {
+		{ngapType.ProtocolIEIDGlobalRANNodeID, reject, mandatory},
+		{ngapType.ProtocolIEIDRANNodeName, ignore, optional},
+		{ngapType.ProtocolIEIDSupportedTAList, reject, mandatory},
+		{ngapType.ProtocolIEIDDefaultPagingDRX, ignore, mandatory},
+	},
+	"RANConfigurationUpdate": {
+		{ngapType.ProtocolIEIDRANNodeName, ignore, optional},
+		{ngapType.ProtocolIEIDSupportedTAList, reject, optional},
+		{ngapType.ProtocolIEIDDefaultPagingDRX, ignore, optional},
+		{ngapType.ProtocolIEIDGlobalRANNodeID, ignore, optional},
+	},
+	"AMFConfigurationUpdateAcknowledge": {
+		{ngapType.ProtocolIEIDAMFTNLAssociationSetupList, ignore, optional},
+		{ngapType.ProtocolIEIDAMFTNLAssociationFailedToSetupList, ignore, optional},
+		{ngapType.ProtocolIEIDCriticalityDiagnostics, ignore, optional},
+	},
+	"AMFConfigurationUpdateFailure": {
+		{ngapType.ProtocolIEIDCause, ignore, mandatory},
+		{ngapType.ProtocolIEIDTimeToWait, ignore, optional},
+		{ngapType.ProtocolIEIDCriticalityDiagnostics, ignore, optional},
+	},
+	"NGReset": {
+		{ngapType.ProtocolIEIDCause, ignore, mandatory},
+		{ngapType.ProtocolIEIDResetType, reject, mandatory},
+	},
+	"NGResetAcknowledge": {
+		{ngapType.ProtocolIEIDUEAssociatedLogicalNGConnectionList, ignore, optional},
+		{ngapType.ProtocolIEIDCriticalityDiagnostics, ignore, optional},
+	},
+	"ErrorIndication": {
+		{ngapType.ProtocolIEIDAMFUENGAPID, ignore, optional},
+		{ngapType.ProtocolIEIDRANUENGAPID, ignore, optional},
+		{ngapType.ProtocolIEIDCause, ignore, optional},
+		{ngapType.ProtocolIEIDCriticalityDiagnostics, ignore, optional},
+	},
+
+	// 9.2.5 NAS Transport Messages
+	"InitialUEMessage": {
+		{ngapType.ProtocolIEIDRANUENGAPID, reject, mandatory},
+		{ngapType.ProtocolIEIDNASPDU, reject, mandatory},
+		{ngapType.ProtocolIEIDUserLocationInformation, reject, mandatory},
+		{ngapType.ProtocolIEIDRRCEstablishmentCause, ignore, mandatory},
+		{ngapType.ProtocolIEIDFiveGSTMSI, reject, optional},
+		{ngapType.ProtocolIEIDAMFSetID, ignore, optional},
+		{ngapType.ProtocolIEIDUEContextRequest, ignore, optional},
+		{ngapType.ProtocolIEIDAllowedNSSAI, reject, optional},
+		{ngapType.ProtocolIEIDAuthenticatedIndication, ignore, optional},
+	},
+	"UplinkNASTransport": {
+		{ngapType.ProtocolIEIDAMFUENGAPID, reject, mandatory},
+		{ngapType.ProtocolIEIDRANUENGAPID, reject, mandatory},
+		{ngapType.ProtocolIEIDNASPDU, reject, mandatory},
+		{ngapType.ProtocolIEIDUserLocationInformation, ignore, mandatory},
+		{ngapType.ProtocolIEIDWAGFIdentiftyInformation, reject, optional},
+	},
+	"NASNonDeliveryIndication": {
+		{ngapType.ProtocolIEIDAMFUENGAPID, reject, mandatory},
+		{ngapType.ProtocolIEIDRANUENGAPID, reject, mandatory},
+		{ngapType.ProtocolIEIDNASPDU, ignore, mandatory},
+		{ngapType.ProtocolIEIDCause, ignore, mandatory},
+	},
+
+	// 9.2.2 UE Context Management Messages
+	"InitialContextSetupResponse": {
+		{ngapType.ProtocolIEIDAMFUENGAPID, ignore, mandatory},
+		{ngapType.ProtocolIEIDRANUENGAPID, ignore, mandatory},
+		{ngapType.ProtocolIEIDPDUSessionResourceSetupListCxtRes, ignore, optional},
+		{ngapType.ProtocolIEIDPDUSessionResourceFailedToSetupListCxtRes, ignore, optional},
+		{ngapType.ProtocolIEIDCriticalityDiagnostics, ignore, optional},
+	},
+	"InitialContextSetupFailure": {
+		{ngapType.ProtocolIEIDAMFUENGAPID, ignore, mandatory},
+		{ngapType.ProtocolIEIDRANUENGAPID, ignore, mandatory},
+		{ngapType.ProtocolIEIDPDUSessionResourceFailedToSetupListCxtFail, ignore, optional},
+		{ngapType.ProtocolIEIDCause, ignore, mandatory},
+		{ngapType.ProtocolIEIDCriticalityDiagnostics, ignore, optional},
+	},
+	"UEContextReleaseRequest": {
+		{ngapType.ProtocolIEIDAMFUENGAPID, reject, mandatory},
+		{ngapType.ProtocolIEIDRANUENGAPID, reject, mandatory},
+		{ngapType.ProtocolIEIDPDUSessionResourceListCxtRelReq, reject, optional},
+		{ngapType.ProtocolIEIDCause, ignore, mandatory},
+	},
+	"UEContextReleaseComplete": {
+		{ngapType.ProtocolIEIDAMFUENGAPID, ignore, mandatory},
+		{ngapType.ProtocolIEIDRANUENGAPID, ignore, mandatory},
+		{ngapType.ProtocolIEIDUserLocationInformation, ignore, optional},
+		{ngapType.ProtocolIEIDInfoOnRecommendedCellsAndRANNodesForPaging, ignore, optional},
+		{ngapType.ProtocolIEIDPDUSessionResourceListCxtRelCpl, reject, optional},
+		{ngapType.ProtocolIEIDCriticalityDiagnostics, ignore, optional},
+	},
+	"UEContextModificationResponse": {
+		{ngapType.ProtocolIEIDAMFUENGAPID, ignore, mandatory},
+		{ngapType.ProtocolIEIDRANUENGAPID, ignore, mandatory},
+		{ngapType.ProtocolIEIDRRCState, ignore, optional},
+		{ngapType.ProtocolIEIDUserLocationInformation, ignore, optional},
+		{ngapType.ProtocolIEIDCriticalityDiagnostics, ignore, optional},
+	},
+	"UEContextModificationFailure": {
+		{ngapType.ProtocolIEIDAMFUENGAPID, ignore, mandatory},
+		{ngapType.ProtocolIEIDRANUENGAPID, ignore, mandatory},
+		{ngapType.ProtocolIEIDCause, ignore, mandatory},
+		{ngapType.ProtocolIEIDCriticalityDiagnostics, ignore, optional},
+	},
+	"UERadioCapabilityInfoIndication": {
+		{ngapType.ProtocolIEIDAMFUENGAPID, reject, mandatory},
+		{ngapType.ProtocolIEIDRANUENGAPID, reject, mandatory},
+		{ngapType.ProtocolIEIDUERadioCapability, ignore, mandatory},
+		{ngapType.ProtocolIEIDUERadioCapabilityForPaging, ignore, optional},
+	},
+	"UERadioCapabilityCheckResponse": {
+		{ngapType.ProtocolIEIDAMFUENGAPID, ignore, mandatory},
+		{ngapType.ProtocolIEIDRANUENGAPID, ignore, mandatory},
+		{ngapType.ProtocolIEIDIMSVoiceSupportIndicator, reject, mandatory},
+		{ngapType.ProtocolIEIDCriticalityDiagnostics, ignore, optional},
+	},
+
+	// 9.2.1 PDU Session Management Messages
+	"PDUSessionResourceSetupResponse": {
+		{ngapType.ProtocolIEIDAMFUENGAPID, ignore, mandatory},
+		{ngapType.ProtocolIEIDRANUENGAPID, ignore, mandatory},
+		{ngapType.ProtocolIEIDPDUSessionResourceSetupListSURes, ignore, optional},
+		{ngapType.ProtocolIEIDPDUSessionResourceFailedToSetupListSURes, ignore, optional},
+		{ngapType.ProtocolIEIDCriticalityDiagnostics, ignore, optional},
+	},
+	"PDUSessionResourceReleaseResponse": {
+		{ngapType.ProtocolIEIDAMFUENGAPID, ignore, mandatory},
+		{ngapType.ProtocolIEIDRANUENGAPID, ignore, mandatory},
+		{ngapType.ProtocolIEIDPDUSessionResourceReleasedListRelRes, ignore, mandatory},
+		{ngapType.ProtocolIEIDUserLocationInformation, ignore, optional},
+		{ngapType.ProtocolIEIDCriticalityDiagnostics, ignore, optional},
+	},
+	"PDUSessionResourceModifyResponse": {
+		{ngapType.ProtocolIEIDAMFUENGAPID, ignore, mandatory},
+		{ngapType.ProtocolIEIDRANUENGAPID, ignore, mandatory},
+		{ngapType.ProtocolIEIDPDUSessionResourceModifyListModRes, ignore, optional},
+		{ngapType.ProtocolIEIDPDUSessionResourceFailedToModifyListModRes, ignore, optional},
+		{ngapType.ProtocolIEIDUserLocationInformation, ignore, optional},
+		{ngapType.ProtocolIEIDCriticalityDiagnostics, ignore, optional},
+	},
+	"PDUSessionResourceNotify": {
+		{ngapType.ProtocolIEIDAMFUENGAPID, reject, mandatory},
+		{ngapType.ProtocolIEIDRANUENGAPID, reject, mandatory},
+		{ngapType.ProtocolIEIDPDUSessionResourceNotifyList, reject, optional},
+		{ngapType.ProtocolIEIDPDUSessionResourceReleasedListNot, ignore, optional},
+		{ngapType.ProtocolIEIDUserLocationInformation, ignore, optional},
+	},
+	"PDUSessionResourceModifyIndication": {
+		{ngapType.ProtocolIEIDAMFUENGAPID, reject, mandatory},
+		{ngapType.ProtocolIEIDRANUENGAPID, reject, mandatory},
+		{ngapType.ProtocolIEIDPDUSessionResourceModifyListModInd, reject, mandatory},
+	},
+
+	// 9.2.8 Location Reporting Messages
+	"LocationReportingFailureIndication": {
+		{ngapType.ProtocolIEIDAMFUENGAPID, reject, mandatory},
+		{ngapType.ProtocolIEIDRANUENGAPID, reject, mandatory},
+		{ngapType.ProtocolIEIDCause, ignore, mandatory},
+	},
+	"LocationReport": {
+		{ngapType.ProtocolIEIDAMFUENGAPID, reject, mandatory},
+		{ngapType.ProtocolIEIDRANUENGAPID, reject, mandatory},
+		{ngapType.ProtocolIEIDUserLocationInformation, ignore, mandatory},
+		{ngapType.ProtocolIEIDUEPresenceInAreaOfInterestList, ignore, optional},
+		{ngapType.ProtocolIEIDLocationReportingRequestType, ignore, mandatory},
+	},
+
+	// 9.2.10 Trace Messages
+	"TraceFailureIndication": {
+		{ngapType.ProtocolIEIDAMFUENGAPID, reject, mandatory},
+		{ngapType.ProtocolIEIDRANUENGAPID, reject, mandatory},
+		{ngapType.ProtocolIEIDNGRANTraceID, ignore, mandatory},
+		{ngapType.ProtocolIEIDCause, ignore, mandatory},
+	},
+	"CellTrafficTrace": {
+		{ngapType.ProtocolIEIDAMFUENGAPID, reject, mandatory},
+		{ngapType.ProtocolIEIDRANUENGAPID, reject, mandatory},
+		{ngapType.ProtocolIEIDNGRANTraceID, ignore, mandatory},
+		{ngapType.ProtocolIEIDNGRANCGI, ignore, mandatory},
+		{ngapType.ProtocolIEIDTraceCollectionEntityIPAddress, ignore, mandatory},
+	},
+}
+
+// procedureCriticalities are the criticalities of the elementary procedures of the messages a W-AGF sends
+//
+// TS 38.413 9.4.3 Elementary Procedure Definitions
+var procedureCriticalities = map[int64]aper.Enumerated{
+	ngapType.ProcedureCodeAMFConfigurationUpdate:             reject,
+	ngapType.ProcedureCodeCellTrafficTrace:                   ignore,
+	ngapType.ProcedureCodeErrorIndication:                    ignore,
+	ngapType.ProcedureCodeInitialContextSetup:                reject,
+	ngapType.ProcedureCodeInitialUEMessage:                   ignore,
+	ngapType.ProcedureCodeLocationReportingFailureIndication: ignore,
+	ngapType.ProcedureCodeLocationReport:                     ignore,
+	ngapType.ProcedureCodeNASNonDeliveryIndication:           ignore,
+	ngapType.ProcedureCodeNGReset:                            reject,
+	ngapType.ProcedureCodeNGSetup:                            reject,
+	ngapType.ProcedureCodePDUSessionResourceModify:           reject,
+	ngapType.ProcedureCodePDUSessionResourceModifyIndication: reject,
+	ngapType.ProcedureCodePDUSessionResourceRelease:          reject,
+	ngapType.ProcedureCodePDUSessionResourceSetup:            reject,
+	ngapType.ProcedureCodePDUSessionResourceNotify:           ignore,
+	ngapType.ProcedureCodeRANConfigurationUpdate:             reject,
+	ngapType.ProcedureCodeTraceFailureIndication:             ignore,
+	ngapType.ProcedureCodeUEContextModification:              reject,
+	ngapType.ProcedureCodeUEContextRelease:                   reject,
+	ngapType.ProcedureCodeUEContextReleaseRequest:            ignore,
+	ngapType.ProcedureCodeUERadioCapabilityCheck:             reject,
+	ngapType.ProcedureCodeUERadioCapabilityInfoIndication:    ignore,
+	ngapType.ProcedureCodeUplinkNASTransport:                 ignore,
+}
+
+// ieNames are the names of the IEs of messageSpecs used in the violations
+var ieNames = map[int64]string{
+	ngapType.ProtocolIEIDAllowedNSSAI:                               "AllowedNSSAI",
+	ngapType.ProtocolIEIDAMFSetID:                                   "AMFSetID",
+	ngapType.ProtocolIEIDAMFTNLAssociationFailedToSetupList:         "AMFTNLAssociationFailedToSetupList",
+	ngapType.ProtocolIEIDAMFTNLAssociationSetupList:                 "AMFTNLAssociationSetupList",
+	ngapType.ProtocolIEIDAMFUENGAPID:                                "AMFUENGAPID",
+	ngapType.ProtocolIEIDAuthenticatedIndication:                    "AuthenticatedIndication",
+	ngapType.ProtocolIEIDCause:                                      "Cause",
+	ngapType.ProtocolIEIDCriticalityDiagnostics:                     "CriticalityDiagnostics",
+	ngapType.ProtocolIEIDDefaultPagingDRX:                           "DefaultPagingDRX",
+	ngapType.ProtocolIEIDFiveGSTMSI:                                 "FiveGSTMSI",
+	ngapType.ProtocolIEIDGlobalRANNodeID:                            "GlobalRANNodeID",
+	ngapType.ProtocolIEIDIMSVoiceSupportIndicator:                   "IMSVoiceSupportIndicator",
+	ngapType.ProtocolIEIDInfoOnRecommendedCellsAndRANNodesForPaging: "InfoOnRecommendedCellsAndRANNodesForPaging",
+	ngapType.ProtocolIEIDLocationReportingRequestType:               "LocationReportingRequestType",
+	ngapType.ProtocolIEIDNASPDU:                                     "NASPDU",
+	ngapType.ProtocolIEIDNGRANCGI:                                   "NGRANCGI",
+	ngapType.ProtocolIEIDNGRANTraceID:                               "NGRANTraceID",
+	ngapType.ProtocolIEIDPDUSessionResourceFailedToModifyListModRes: "PDUSessionResourceFailedToModifyListModRes",
+	ngapType.ProtocolIEIDPDUSessionResourceFailedToSetupListCxtFail: "PDUSessionResourceFailedToSetupListCxtFail",
+	ngapType.ProtocolIEIDPDUSessionResourceFailedToSetupListCxtRes:  "PDUSessionResourceFailedToSetupListCxtRes",
+	ngapType.ProtocolIEIDPDUSessionResourceFailedToSetupListSURes:   "PDUSessionResourceFailedToSetupListSURes",
+	ngapType.ProtocolIEIDPDUSessionResourceListCxtRelCpl:            "PDUSessionResourceListCxtRelCpl",
+	ngapType.ProtocolIEIDPDUSessionResourceListCxtRelReq:            "PDUSessionResourceListCxtRelReq",
+	ngapType.ProtocolIEIDPDUSessionResourceModifyListModInd:         "PDUSessionResourceModifyListModInd",
+	ngapType.ProtocolIEIDPDUSessionResourceModifyListModRes:         "PDUSessionResourceModifyListModRes",
+	ngapType.ProtocolIEIDPDUSessionResourceNotifyList:               "PDUSessionResourceNotifyList",
+	ngapType.ProtocolIEIDPDUSessionResourceReleasedListNot:          "PDUSessionResourceReleasedListNot",
+	ngapType.ProtocolIEIDPDUSessionResourceReleasedListRelRes:       "PDUSessionResourceReleasedListRelRes",
+	ngapType.ProtocolIEIDPDUSessionResourceSetupListCxtRes:          "PDUSessionResourceSetupListCxtRes",
+	ngapType.ProtocolIEIDPDUSessionResourceSetupListSURes:           "PDUSessionResourceSetupListSURes",
+	ngapType.ProtocolIEIDRANNodeName:                                "RANNodeName",
+	ngapType.ProtocolIEIDRANUENGAPID:                                "RANUENGAPID",
+	ngapType.ProtocolIEIDResetType:                                  "ResetType",
+	ngapType.ProtocolIEIDRRCEstablishmentCause:                      "RRCEstablishmentCause",
+	ngapType.ProtocolIEIDRRCState:                                   "RRCState",
+	ngapType.ProtocolIEIDSupportedTAList:                            "SupportedTAList",
+	ngapType.ProtocolIEIDTimeToWait:                                 "TimeToWait",
+	ngapType.ProtocolIEIDTraceCollectionEntityIPAddress:             "TraceCollectionEntityIPAddress",
+	ngapType.ProtocolIEIDUEAssociatedLogicalNGConnectionList:        "UEAssociatedLogicalNGConnectionList",
+	ngapType.ProtocolIEIDUEContextRequest:                           "UEContextRequest",
+	ngapType.ProtocolIEIDUEPresenceInAreaOfInterestList:             "UEPresenceInAreaOfInterestList",
+	ngapType.ProtocolIEIDUERadioCapability:                          "UERadioCapability",
+	ngapType.ProtocolIEIDUERadioCapabilityForPaging:                 "UERadioCapabilityForPaging",
+	ngapType.ProtocolIEIDUserLocationInformation:                    "UserLocationInformation",
+	ngapType.ProtocolIEIDWAGFIdentiftyInformation:                   "WAGFIdentityInformation",
+}
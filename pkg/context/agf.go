@@ -0,0 +1,107 @@
+package context
+
+import (
+	"encoding/hex"
+	"sync"
+
+	"free5gc/lib/ngap/ngapType"
+
+	"gitlab.casa-systems.com/opensource/sctp"
+)
+
+// AGFContext is an AGF connected to sim-amf over an NGAP association
+type AGFContext struct {
+	AGFBasic
+
+	AMF                  *AMFContext    // AMF of the AMFSet the AGF is connected to
+	SCTPConn             *sctp.SCTPConn // first TNL association, which carried the NG Setup
+	UEContextRANUENGAPID sync.Map       // map[int64]*context.UEContext, RANUENGAPID as key
+	TNLASCTPAddr         sync.Map       // map[string]*sctp.SCTPConn, other TNL associations, SCTPRemoteAddr as key
+}
+
+type AGFBasic struct {
+	SCTPAddr         string // SCTPRemoteAddr
+	NGSetupDone      bool
+	GlobalRANNodeID  *ngapType.GlobalRANNodeID
+	RANNodeName      string
+	SupportedTAList  *ngapType.SupportedTAList
+	DefaultPagingDRX *ngapType.PagingDRX
+}
+
+func NewAGFContext(amf *AMFContext, conn *sctp.SCTPConn) *AGFContext {
+	agf := &AGFContext{AMF: amf, SCTPConn: conn}
+	if conn != nil && conn.RemoteAddr() != nil {
+		agf.SCTPAddr = conn.RemoteAddr().String()
+	}
+	return agf
+}
+
+// GlobalAGFIDStr returns the W-AGF ID advertised in the NG Setup Request as a hex string
+func (agf *AGFContext) GlobalAGFIDStr() string {
+	if agf.GlobalRANNodeID == nil || agf.GlobalRANNodeID.ChoiceExtensions == nil {
+		return ""
+	}
+	globalWAGFID := agf.GlobalRANNodeID.ChoiceExtensions.Value.Value.GlobalWAGFID
+	if globalWAGFID == nil || globalWAGFID.WAGFID.WAGFID == nil {
+		return ""
+	}
+	return hex.EncodeToString(globalWAGFID.PLMNIdentity.Value) + "-" + hex.EncodeToString(globalWAGFID.WAGFID.WAGFID.Bytes)
+}
+
+// LoadUEContextRANUENGAPID returns the UEContext stored in the UEContextRANUENGAPID for a RANUENGAPID, or nil if no
+// UEContext is present. The bool result indicates whether UEContext was found in the UEContextRANUENGAPID.
+func (agf *AGFContext) LoadUEContextRANUENGAPID(ranUENGAPID int64) (*UEContext, bool) {
+	if value, ok := agf.UEContextRANUENGAPID.Load(ranUENGAPID); ok {
+		return value.(*UEContext), true
+	}
+
+	return nil, false
+}
+
+// StoreUEContextRANUENGAPID sets the UEContext for a RANUENGAPID
+func (agf *AGFContext) StoreUEContextRANUENGAPID(ueContext *UEContext) {
+	if ueContext.RanUeNgapId != RanUeNgapIdUnspecified {
+		agf.UEContextRANUENGAPID.Store(ueContext.RanUeNgapId, ueContext)
+	}
+}
+
+// DeleteUEContextRANUENGAPID deletes the UEContext for a RANUENGAPID
+func (agf *AGFContext) DeleteUEContextRANUENGAPID(ranUENGAPID int64) {
+	agf.UEContextRANUENGAPID.Delete(ranUENGAPID)
+}
+
+// RangeUEContext calls f sequentially for each UEContext served by the AGF. If f returns false, range stops the
+// iteration.
+func (agf *AGFContext) RangeUEContext(f func(ue *UEContext) bool) {
+	agf.UEContextRANUENGAPID.Range(func(key, value interface{}) bool {
+		return f(value.(*UEContext))
+	})
+}
+
+// CountUEContext returns the number of UEContexts served by the AGF
+func (agf *AGFContext) CountUEContext() (count int) {
+	agf.RangeUEContext(func(ue *UEContext) bool {
+		count++
+		return true
+	})
+	return
+}
+
+// StoreTNLA adds a TNL association established by the AGF to an endpoint of the AMF advertised in an AMF
+// Configuration Update
+func (agf *AGFContext) StoreTNLA(conn *sctp.SCTPConn) {
+	agf.TNLASCTPAddr.Store(conn.RemoteAddr().String(), conn)
+}
+
+// DeleteTNLA removes a TNL association of the AGF, the UE-TNLA-bindings to it are released by the caller
+func (agf *AGFContext) DeleteTNLA(conn *sctp.SCTPConn) {
+	agf.TNLASCTPAddr.Delete(conn.RemoteAddr().String())
+}
+
+// RangeTNLA calls f sequentially for each TNL association of the AGF besides the first one. If f returns false, range
+// stops the iteration.
+func (agf *AGFContext) RangeTNLA(f func(conn *sctp.SCTPConn) bool) {
+	agf.TNLASCTPAddr.Range(func(key, value interface{}) bool {
+		return f(value.(*sctp.SCTPConn))
+	})
+}
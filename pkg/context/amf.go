@@ -2,21 +2,50 @@ package context
 
 import (
 	"bytes"
+	"fmt"
 	"free5gc/lib/aper"
 	"free5gc/lib/ngap/ngapConvert"
 	"free5gc/lib/ngap/ngapType"
+	"free5gc/lib/openapi/models"
+	"math"
 	"sync"
 
+	"sim-amf/pkg/pcap"
+	"sim-amf/pkg/suci"
+	"sim-amf/pkg/types"
+
 	//"git.cs.nctu.edu.tw/calee/sctp"
 
 	"gitlab.casa-systems.com/opensource/sctp"
 )
 
+// AMFSelf is the AMF emulated by sim-amf, the first AMF of the AMFSet. The AMFs of the set share its subscribers, home
+// network keys, DNNs and capture.
+var AMFSelf = NewAMFContext()
+
+// AMFSet is the set of AMFs emulated by sim-amf, each listening on its own NGAP address
+var AMFSet = []*AMFContext{AMFSelf}
+
 type AMFContext struct {
 	AMFBasic
 
 	SCTPConn             *sctp.SCTPConn
 	UEContextAMFUENGAPID sync.Map // map[string]*context.UEContext, AMFUENGAPID as key
+	AGFContextSCTPAddr   sync.Map // map[string]*context.AGFContext, SCTPRemoteAddr as key
+	AmfUeNgapIdGenerator *types.IDGenerator
+	Capture              *pcap.Writer // all the NGAP associations, nil if disabled
+	UEContextGUTI        sync.Map     // map[string]*context.UEContext, 5G-GUTI as key
+	UEContextIdentity    sync.Map     // map[string]*context.UEContext, MAC, GLI or GCI identity key as key, AMFSelf only
+	TmsiGenerator        *types.IDGenerator
+	Subscribers          sync.Map                      // map[string]*context.Subscriber, identity as key
+	DefaultSubscriber    *Subscriber                   // subscription data of the UEs not in the Subscribers
+	HomeNetworkKeys      map[uint8]suci.HomeNetworkKey // SUCI deconcealment keys, key identifier as key
+	DNNs                 map[string]*DNN               // session policy of the DNNs, lower case name as key, any DNN if empty
+	DefaultDNN           *DNN                          // DNN of the PDU sessions requested without DNN, nil if none
+
+	Reroute       bool   // the Initial UE Messages are rerouted to the AMF set
+	Unavailable   bool   // the served GUAMIs were indicated unavailable in an AMF Status Indication
+	BackupAMFName string // AMF taking over the served GUAMIs once unavailable
 }
 
 type AMFBasic struct {
@@ -26,13 +55,17 @@ type AMFBasic struct {
 	RelativeAMFCapacity *ngapType.RelativeAMFCapacity
 	PlmnSupportList     *ngapType.PLMNSupportList
 	AllowedNssai        *ngapType.AllowedNSSAI
+	EquivalentPlmns     []models.PlmnId
 
-	AMFTNLAssociationList map[string]*AMFTNLAssociationItem // v4+v6 as key
+	TNLEndpoints          []*AMFTNLAssociationItem          // endpoints besides SCTPAddr, listening from the start
+	AMFTNLAssociationList map[string]*AMFTNLAssociationItem // endpoints advertised to the AGFs, v4+v6 as key
+	amfTNLAssociationMu   sync.Mutex
 	// Overload related
 	AMFOverloadContent *AMFOverloadContent
 }
 
 type AMFTNLAssociationItem struct {
+	SCTPAddr               string // address the endpoint listens on
 	Ipv4                   string
 	Ipv6                   string
 	TNLAssociationUsage    *ngapType.TNLAssociationUsage
@@ -50,23 +83,158 @@ type SliceOverloadItem struct {
 	TrafficInd *int64
 }
 
+func NewAMFContext() *AMFContext {
+	amf := &AMFContext{}
+	amf.AMFTNLAssociationList = make(map[string]*AMFTNLAssociationItem)
+	amf.AmfUeNgapIdGenerator = types.NewIDGenerator(1, math.MaxUint32-1)
+	amf.TmsiGenerator = types.NewIDGenerator(1, math.MaxUint32-1)
+	return amf
+}
+
+// NewAMFSetMember adds a new AMF to the AMFSet. Its AMF UE NGAP IDs are allocated by AMFSelf, so that they identify the
+// UEs in the whole set.
+func NewAMFSetMember() *AMFContext {
+	amf := NewAMFContext()
+	amf.AmfUeNgapIdGenerator = AMFSelf.AmfUeNgapIdGenerator
+	AMFSet = append(AMFSet, amf)
+	return amf
+}
+
+// ResetAMFSet replaces the AMFSet by a new AMFSelf, forgetting the AGFs and UEs of the previous AMFs
+func ResetAMFSet() {
+	AMFSelf = NewAMFContext()
+	AMFSet = []*AMFContext{AMFSelf}
+}
+
+// LoadAMFContextName returns the AMF of the AMFSet named amfName
+func LoadAMFContextName(amfName string) (*AMFContext, bool) {
+	for _, amf := range AMFSet {
+		if amf.AMFName != nil && amf.AMFName.Value == amfName {
+			return amf, true
+		}
+	}
+	return nil, false
+}
+
+// LoadSetUEContextAMFUENGAPID returns the UEContext of an AMFUENGAPID in any AMF of the AMFSet
+func LoadSetUEContextAMFUENGAPID(amfUENGAPID int64) (*UEContext, bool) {
+	for _, amf := range AMFSet {
+		if ue, ok := amf.LoadUEContextAMFUENGAPID(amfUENGAPID); ok {
+			return ue, true
+		}
+	}
+	return nil, false
+}
+
+// LoadSetUEContextGUTI returns the UEContext of a 5G-GUTI in any AMF of the AMFSet, the AMFs of a set sharing the UE
+// contexts
+//
+// TS 23.501 5.21.3.2 AMF Set and AMF Pointer
+func LoadSetUEContextGUTI(guti string) (*UEContext, bool) {
+	for _, amf := range AMFSet {
+		if ue, ok := amf.LoadUEContextGUTI(guti); ok {
+			return ue, true
+		}
+	}
+	return nil, false
+}
+
+// LoadSetUEContextIdentity returns the UEContext of a MAC address, Global Line ID or Global Cable ID identity key in the
+// AMFSet, of which the AMFs share the index of AMFSelf
+func LoadSetUEContextIdentity(key string) (*UEContext, bool) {
+	if value, ok := AMFSelf.UEContextIdentity.Load(key); ok {
+		return value.(*UEContext), true
+	}
+	return nil, false
+}
+
+// RangeSetUEContext calls f sequentially for each UEContext of the AMFs of the AMFSet. If f returns false, range
+// stops the iteration.
+func RangeSetUEContext(f func(ue *UEContext) bool) {
+	for _, amf := range AMFSet {
+		stopped := false
+		amf.RangeUEContext(func(ue *UEContext) bool {
+			stopped = !f(ue)
+			return !stopped
+		})
+		if stopped {
+			return
+		}
+	}
+}
+
+// RangeSetAGFContext calls f sequentially for each AGFContext connected to the AMFs of the AMFSet. If f returns false,
+// range stops the iteration.
+func RangeSetAGFContext(f func(agf *AGFContext) bool) {
+	for _, amf := range AMFSet {
+		stopped := false
+		amf.RangeAGFContext(func(agf *AGFContext) bool {
+			stopped = !f(agf)
+			return !stopped
+		})
+		if stopped {
+			return
+		}
+	}
+}
+
 func (amf *AMFContext) AddAMFTNLAssociationItem(info ngapType.CPTransportLayerInformation) *AMFTNLAssociationItem {
 	item := &AMFTNLAssociationItem{}
 	item.Ipv4, item.Ipv6 = ngapConvert.IPAddressToString(*info.EndpointIPAddress)
-	amf.AMFTNLAssociationList[item.Ipv4+item.Ipv6] = item
+	amf.StoreAMFTNLAssociationItem(item)
 	return item
 }
 
+// StoreAMFTNLAssociationItem advertises an endpoint of the AMF, replacing the one of the same address
+func (amf *AMFContext) StoreAMFTNLAssociationItem(item *AMFTNLAssociationItem) {
+	amf.amfTNLAssociationMu.Lock()
+	defer amf.amfTNLAssociationMu.Unlock()
+	amf.AMFTNLAssociationList[item.Ipv4+item.Ipv6] = item
+}
+
 func (amf *AMFContext) FindAMFTNLAssociationItem(info ngapType.CPTransportLayerInformation) *AMFTNLAssociationItem {
 	v4, v6 := ngapConvert.IPAddressToString(*info.EndpointIPAddress)
+	amf.amfTNLAssociationMu.Lock()
+	defer amf.amfTNLAssociationMu.Unlock()
 	return amf.AMFTNLAssociationList[v4+v6]
 }
 
 func (amf *AMFContext) DeleteAMFTNLAssociationItem(info ngapType.CPTransportLayerInformation) {
 	v4, v6 := ngapConvert.IPAddressToString(*info.EndpointIPAddress)
+	amf.amfTNLAssociationMu.Lock()
+	defer amf.amfTNLAssociationMu.Unlock()
 	delete(amf.AMFTNLAssociationList, v4+v6)
 }
 
+// AMFTNLAssociationItems returns the endpoints advertised to the AGFs
+func (amf *AMFContext) AMFTNLAssociationItems() (items []*AMFTNLAssociationItem) {
+	amf.amfTNLAssociationMu.Lock()
+	defer amf.amfTNLAssociationMu.Unlock()
+	for _, item := range amf.AMFTNLAssociationList {
+		items = append(items, item)
+	}
+	return items
+}
+
+// FindTNLEndpoint returns the endpoint of the AMF listening on an SCTP address
+func (amf *AMFContext) FindTNLEndpoint(sctpAddr string) (*AMFTNLAssociationItem, bool) {
+	for _, item := range amf.TNLEndpoints {
+		if item.SCTPAddr == sctpAddr {
+			return item, true
+		}
+	}
+	return nil, false
+}
+
+// CPTransportLayerInformation returns the endpoint IP address of the item as advertised in NGAP
+func (item *AMFTNLAssociationItem) CPTransportLayerInformation() ngapType.CPTransportLayerInformation {
+	endpointIPAddress := ngapConvert.IPAddressToNgap(item.Ipv4, item.Ipv6)
+	return ngapType.CPTransportLayerInformation{
+		Present:           ngapType.CPTransportLayerInformationPresentEndpointIPAddress,
+		EndpointIPAddress: &endpointIPAddress,
+	}
+}
+
 func (amf *AMFContext) StartOverload(resp *ngapType.OverloadResponse, trafloadInd *ngapType.TrafficLoadReductionIndication, nssai *ngapType.OverloadStartNSSAIList) *AMFOverloadContent {
 	if resp == nil && trafloadInd == nil && nssai == nil {
 		return nil
@@ -120,6 +288,63 @@ func (amf *AMFContext) FindAvalibleAMFByCompareGUAMI(ueSpecifiedGUAMI *ngapType.
 	return false
 }
 
+// ServedGuami returns the first GUAMI served by the AMF, of which the 5G-GUTIs are allocated
+func (amf *AMFContext) ServedGuami() (models.Guami, error) {
+	if amf.ServedGuamiList == nil || len(amf.ServedGuamiList.List) == 0 {
+		return models.Guami{}, fmt.Errorf("no served GUAMI")
+	}
+	guami := amf.ServedGuamiList.List[0].GUAMI
+	plmnId := ngapConvert.PlmnIdToModels(guami.PLMNIdentity)
+	return models.Guami{
+		PlmnId: &plmnId,
+		AmfId:  ngapConvert.AmfIdToModels(guami.AMFRegionID.Value, guami.AMFSetID.Value, guami.AMFPointer.Value),
+	}, nil
+}
+
+// AllocateGuti allocates a new 5G-GUTI to the UE from the served GUAMI, replacing the one previously allocated
+//
+// TS 23.003 2.10.1 Structure of 5G-GUTI
+func (amf *AMFContext) AllocateGuti(ue *UEContext) error {
+	guami, err := amf.ServedGuami()
+	if err != nil {
+		return err
+	}
+	tmsi, err := amf.TmsiGenerator.Allocate()
+	if err != nil {
+		return err
+	}
+	if ue.Guti != "" {
+		amf.DeleteUEContextGUTI(ue.Guti)
+	}
+	ue.Guami = guami
+	ue.TMSI5G = [4]uint8{uint8(tmsi >> 24), uint8(tmsi >> 16), uint8(tmsi >> 8), uint8(tmsi)}
+	ue.Guti = fmt.Sprintf("%s%s%s%08x", guami.PlmnId.Mcc, guami.PlmnId.Mnc, guami.AmfId, uint32(tmsi))
+	amf.StoreUEContextGUTI(ue)
+	return nil
+}
+
+// LoadUEContextGUTI returns the UEContext stored in the UEContextGUTI for a 5G-GUTI, or nil if no UEContext is
+// present. The bool result indicates whether UEContext was found in the UEContextGUTI.
+func (amf *AMFContext) LoadUEContextGUTI(guti string) (*UEContext, bool) {
+	if value, ok := amf.UEContextGUTI.Load(guti); ok {
+		return value.(*UEContext), true
+	}
+
+	return nil, false
+}
+
+// StoreUEContextGUTI sets the UEContext for its 5G-GUTI
+func (amf *AMFContext) StoreUEContextGUTI(ueContext *UEContext) {
+	if ueContext.Guti != "" {
+		amf.UEContextGUTI.Store(ueContext.Guti, ueContext)
+	}
+}
+
+// DeleteUEContextGUTI deletes the UEContext for a 5G-GUTI
+func (amf *AMFContext) DeleteUEContextGUTI(guti string) {
+	amf.UEContextGUTI.Delete(guti)
+}
+
 // LoadUEContextAMFUENGAPID returns the UEContext stored in the UEContextAMFUENGAPID for a AMFUENGAPID, or nil if no
 // UEContext is present. The bool result indicates whether UEContext was found in the UEContextAMFUENGAPID.
 func (amf *AMFContext) LoadUEContextAMFUENGAPID(amfUENGAPID int64) (*UEContext, bool) {
@@ -150,3 +375,57 @@ func (amf *AMFContext) EmptyUEContext() {
 		return true
 	})
 }
+
+// NewUEContext allocates an AMF UE NGAP ID and stores a new UEContext served by the AGF, whose jobs run on the
+// dispatcher shard of the key
+func (amf *AMFContext) NewUEContext(agf *AGFContext, ranUeNgapId int64, shard uint32) (*UEContext, error) {
+	amfUeNgapId, err := amf.AmfUeNgapIdGenerator.Allocate()
+	if err != nil {
+		return nil, err
+	}
+	ue := &UEContext{}
+	ue.AmfUeNgapId = amfUeNgapId
+	ue.RanUeNgapId = ranUeNgapId
+	ue.Shard = shard
+	ue.AttachAMF(amf)
+	ue.AttachAGF(agf)
+	amf.StoreUEContextAMFUENGAPID(ue)
+	return ue, nil
+}
+
+// RangeUEContext calls f sequentially for each UEContext in the UEContextAMFUENGAPID. If f returns false, range stops
+// the iteration.
+func (amf *AMFContext) RangeUEContext(f func(ue *UEContext) bool) {
+	amf.UEContextAMFUENGAPID.Range(func(key, value interface{}) bool {
+		return f(value.(*UEContext))
+	})
+}
+
+// LoadAGFContextSCTPAddr returns the AGFContext stored in the AGFContextSCTPAddr for a SCTPRemoteAddr, or nil if no
+// AGFContext is present. The bool result indicates whether AGFContext was found in the AGFContextSCTPAddr.
+func (amf *AMFContext) LoadAGFContextSCTPAddr(sctpAddr string) (*AGFContext, bool) {
+	if value, ok := amf.AGFContextSCTPAddr.Load(sctpAddr); ok {
+		return value.(*AGFContext), true
+	}
+
+	return nil, false
+}
+
+// StoreAGFContextSCTPAddr sets the AGFContext for a SCTPRemoteAddr
+func (amf *AMFContext) StoreAGFContextSCTPAddr(agf *AGFContext) {
+	amf.AGFContextSCTPAddr.Store(agf.SCTPAddr, agf)
+}
+
+// DeleteAGFContextSCTPAddr deletes the AGFContext for a SCTPRemoteAddr, the UEContexts it serves are removed by the
+// caller
+func (amf *AMFContext) DeleteAGFContextSCTPAddr(sctpAddr string) {
+	amf.AGFContextSCTPAddr.Delete(sctpAddr)
+}
+
+// RangeAGFContext calls f sequentially for each AGFContext in the AGFContextSCTPAddr. If f returns false, range stops
+// the iteration.
+func (amf *AMFContext) RangeAGFContext(f func(agf *AGFContext) bool) {
+	amf.AGFContextSCTPAddr.Range(func(key, value interface{}) bool {
+		return f(value.(*AGFContext))
+	})
+}
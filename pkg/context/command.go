@@ -6,7 +6,8 @@ import (
 	"os"
 )
 
-func newCommand() *cobra.Command {
+// NewCommand returns the root command of sim-amf with the version subcommand attached
+func NewCommand() *cobra.Command {
 	versionCmd := &cobra.Command{
 		Use: "version",
 		Run: func(cmd *cobra.Command, args []string) {
@@ -0,0 +1,208 @@
+package context
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"free5gc/lib/nas/nasMessage"
+	"free5gc/lib/openapi/models"
+)
+
+// DNN is the session policy of a data network: the PDU session types, SSC modes and slices of the PDU sessions
+// allowed, their Session-AMBR, the pools their addresses are allocated from, the DNS servers and MTU provided to the
+// UEs, and the DN-specific identities authorized
+//
+// TS 23.501 5.6.1 Overview, TS 24.501 6.4.1 UE-requested PDU session establishment procedure
+type DNN struct {
+	Name            string
+	PDUSessionTypes []uint8         // allowed, the first one selected if the UE requests none, any if empty
+	SSCModes        []uint8         // allowed, the first one selected if the UE requests none, any if empty
+	Snssais         []models.Snssai // slices the DNN is served in, any if empty
+	SessionAmbrUL   int64           // Session-AMBR in bps, 0 for the default
+	SessionAmbrDL   int64
+	IPv4Pool        *AddressPool  // nil if the IPv4 addresses are not allocated
+	IPv6Pool        *AddressPool  // nil if the IPv6 addresses are not allocated
+	DNS             []net.IP      // DNS server addresses
+	MTU             uint16        // IPv4 link MTU, 0 if not provided
+	Users           []string      // DN-specific identities authorized, any UE if empty
+	Backoff         time.Duration // back-off timer of the PDU Session Establishment Rejects, none if zero
+}
+
+// FindDNN returns the DNN of a name, or the DefaultDNN for an empty name. The bool result indicates whether the DNN was
+// found.
+func (amf *AMFContext) FindDNN(name string) (*DNN, bool) {
+	if name == "" {
+		return amf.DefaultDNN, amf.DefaultDNN != nil
+	}
+	dnn, ok := amf.DNNs[strings.ToLower(name)]
+	return dnn, ok
+}
+
+// PDUSessionTypeAllowed tells whether a PDU session of the type may be established to the DNN, IPv4v6 allowing IPv4
+// and IPv6
+func (dnn *DNN) PDUSessionTypeAllowed(pduSessionType uint8) bool {
+	if len(dnn.PDUSessionTypes) == 0 {
+		return true
+	}
+	for _, allowed := range dnn.PDUSessionTypes {
+		if allowed == pduSessionType || (allowed == nasMessage.PDUSessionTypeIPv4IPv6 &&
+			(pduSessionType == nasMessage.PDUSessionTypeIPv4 || pduSessionType == nasMessage.PDUSessionTypeIPv6)) {
+			return true
+		}
+	}
+	return false
+}
+
+// SSCModeAllowed tells whether a PDU session of the SSC mode may be established to the DNN
+func (dnn *DNN) SSCModeAllowed(sscMode uint8) bool {
+	if len(dnn.SSCModes) == 0 {
+		return true
+	}
+	for _, allowed := range dnn.SSCModes {
+		if allowed == sscMode {
+			return true
+		}
+	}
+	return false
+}
+
+// SnssaiAllowed tells whether the DNN is served in the slice
+func (dnn *DNN) SnssaiAllowed(snssai models.Snssai) bool {
+	if len(dnn.Snssais) == 0 {
+		return true
+	}
+	for _, allowed := range dnn.Snssais {
+		if allowed.Sst == snssai.Sst && strings.EqualFold(allowed.Sd, snssai.Sd) {
+			return true
+		}
+	}
+	return false
+}
+
+// UserAllowed tells whether the UE with the DN-specific identity is authorized to the DNN
+func (dnn *DNN) UserAllowed(identity string) bool {
+	if len(dnn.Users) == 0 {
+		return true
+	}
+	for _, user := range dnn.Users {
+		if user == identity {
+			return true
+		}
+	}
+	return false
+}
+
+// AddressPool allocates the addresses of a prefix to the PDU sessions, the first address of the prefix and the IPv4
+// broadcast address excluded. It is safe for concurrent use.
+type AddressPool struct {
+	mu        sync.Mutex
+	prefix    *net.IPNet
+	size      uint64 // addresses of the prefix allocated from, at most 2^32
+	next      uint64 // offset of the next address tried
+	allocated map[uint64]bool
+}
+
+// NewAddressPool returns the pool of the addresses of a prefix given in CIDR notation, e.g. 10.60.0.0/16
+func NewAddressPool(cidr string) (*AddressPool, error) {
+	_, prefix, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	ones, bits := prefix.Mask.Size()
+	hostBits := bits - ones
+	if hostBits > 32 {
+		hostBits = 32
+	}
+	size := uint64(1) << uint(hostBits)
+	if bits == 8*net.IPv4len {
+		size-- // broadcast address
+	}
+	if size < 2 {
+		return nil, fmt.Errorf("address pool %s too small", cidr)
+	}
+	return &AddressPool{prefix: prefix, size: size, next: 1, allocated: make(map[uint64]bool)}, nil
+}
+
+// String returns the prefix of the pool
+func (pool *AddressPool) String() string {
+	return pool.prefix.String()
+}
+
+// IPv4 tells whether the pool allocates IPv4 addresses
+func (pool *AddressPool) IPv4() bool {
+	return len(pool.prefix.IP) == net.IPv4len
+}
+
+// Contains tells whether the address is in the prefix of the pool
+func (pool *AddressPool) Contains(ip net.IP) bool {
+	return pool.prefix.Contains(ip)
+}
+
+// Allocate returns a free address of the pool, or nil if all the addresses are allocated
+func (pool *AddressPool) Allocate() net.IP {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	for i := uint64(1); i < pool.size; i++ {
+		offset := pool.next
+		pool.next++
+		if pool.next >= pool.size {
+			pool.next = 1
+		}
+		if !pool.allocated[offset] {
+			pool.allocated[offset] = true
+			return pool.address(offset)
+		}
+	}
+	return nil
+}
+
+// Reserve allocates an address of the pool, e.g. a static address, so that it is not allocated again until released.
+// It returns false if the address is already allocated or not allocated by the pool.
+func (pool *AddressPool) Reserve(ip net.IP) bool {
+	if ip == nil || !pool.prefix.Contains(ip) {
+		return false
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	offset := pool.offset(ip)
+	if offset == 0 || offset >= pool.size || pool.allocated[offset] {
+		return false
+	}
+	pool.allocated[offset] = true
+	return true
+}
+
+// Release frees an address allocated by the pool
+func (pool *AddressPool) Release(ip net.IP) {
+	if ip == nil || !pool.prefix.Contains(ip) {
+		return
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	delete(pool.allocated, pool.offset(ip))
+}
+
+func (pool *AddressPool) address(offset uint64) net.IP {
+	ip := make(net.IP, len(pool.prefix.IP))
+	copy(ip, pool.prefix.IP)
+	var host [8]byte
+	binary.BigEndian.PutUint64(host[:], offset)
+	sum := new(big.Int).Add(new(big.Int).SetBytes(ip), new(big.Int).SetBytes(host[:]))
+	sum.FillBytes(ip)
+	return ip
+}
+
+func (pool *AddressPool) offset(ip net.IP) uint64 {
+	if len(pool.prefix.IP) == net.IPv4len {
+		ip = ip.To4()
+	} else {
+		ip = ip.To16()
+	}
+	diff := new(big.Int).Sub(new(big.Int).SetBytes(ip), new(big.Int).SetBytes(pool.prefix.IP))
+	return diff.Uint64()
+}
@@ -0,0 +1,132 @@
+package context
+
+import (
+	"net"
+	"testing"
+)
+
+func TestNewAddressPool(t *testing.T) {
+	tests := []struct {
+		cidr    string
+		size    uint64
+		wantErr bool
+	}{
+		{cidr: "10.60.0.0/16", size: 1<<16 - 1},
+		{cidr: "10.60.0.0/30", size: 3},
+		{cidr: "10.60.0.0/31", wantErr: true},
+		{cidr: "10.60.0.0/32", wantErr: true},
+		{cidr: "2001:db8::/64", size: 1 << 32},
+		{cidr: "2001:db8::/127", size: 2},
+		{cidr: "10.60.0.0", wantErr: true},
+	}
+	for _, tt := range tests {
+		pool, err := NewAddressPool(tt.cidr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewAddressPool(%q) error = %v, wantErr %v", tt.cidr, err, tt.wantErr)
+			continue
+		}
+		if err == nil && pool.size != tt.size {
+			t.Errorf("NewAddressPool(%q) size = %d, want %d", tt.cidr, pool.size, tt.size)
+		}
+	}
+}
+
+func TestAddressPool(t *testing.T) {
+	type step struct {
+		op   string // allocate, release or reserve
+		ip   string // released or reserved
+		want string // allocated, "" for none, or the reserve result
+	}
+	tests := []struct {
+		name  string
+		cidr  string
+		steps []step
+	}{
+		{
+			name: "exhaustion",
+			cidr: "10.60.0.0/30",
+			steps: []step{
+				{op: "allocate", want: "10.60.0.1"},
+				{op: "allocate", want: "10.60.0.2"},
+				{op: "allocate", want: ""},
+				{op: "release", ip: "10.60.0.1"},
+				{op: "allocate", want: "10.60.0.1"},
+				{op: "allocate", want: ""},
+			},
+		},
+		{
+			name: "wrap-around",
+			cidr: "10.60.0.0/29",
+			steps: []step{
+				{op: "allocate", want: "10.60.0.1"},
+				{op: "allocate", want: "10.60.0.2"},
+				{op: "release", ip: "10.60.0.1"},
+				{op: "allocate", want: "10.60.0.3"},
+				{op: "allocate", want: "10.60.0.4"},
+				{op: "allocate", want: "10.60.0.5"},
+				{op: "allocate", want: "10.60.0.6"},
+				{op: "allocate", want: "10.60.0.1"},
+				{op: "allocate", want: ""},
+			},
+		},
+		{
+			name: "release of an address not allocated",
+			cidr: "10.60.0.0/30",
+			steps: []step{
+				{op: "allocate", want: "10.60.0.1"},
+				{op: "release", ip: "10.60.0.2"},
+				{op: "release", ip: "192.168.0.1"},
+				{op: "allocate", want: "10.60.0.2"},
+				{op: "allocate", want: ""},
+			},
+		},
+		{
+			name: "reserve",
+			cidr: "10.60.0.0/29",
+			steps: []step{
+				{op: "reserve", ip: "10.60.0.2", want: "true"},
+				{op: "reserve", ip: "10.60.0.2", want: "false"},
+				{op: "reserve", ip: "10.60.0.0", want: "false"},
+				{op: "reserve", ip: "10.60.0.7", want: "false"},
+				{op: "reserve", ip: "10.61.0.1", want: "false"},
+				{op: "allocate", want: "10.60.0.1"},
+				{op: "allocate", want: "10.60.0.3"},
+				{op: "reserve", ip: "10.60.0.3", want: "false"},
+				{op: "release", ip: "10.60.0.2"},
+				{op: "reserve", ip: "10.60.0.2", want: "true"},
+			},
+		},
+		{
+			name: "IPv6",
+			cidr: "2001:db8:0:1::/64",
+			steps: []step{
+				{op: "allocate", want: "2001:db8:0:1::1"},
+				{op: "reserve", ip: "2001:db8:0:1::2", want: "true"},
+				{op: "allocate", want: "2001:db8:0:1::3"},
+				{op: "release", ip: "2001:db8:0:1::1"},
+				{op: "reserve", ip: "2001:db8:0:1::1", want: "true"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		pool, err := NewAddressPool(tt.cidr)
+		if err != nil {
+			t.Fatalf("%s: NewAddressPool(%q) error = %v", tt.name, tt.cidr, err)
+		}
+		for i, s := range tt.steps {
+			switch s.op {
+			case "allocate":
+				got := pool.Allocate()
+				if (got == nil && s.want != "") || (got != nil && !got.Equal(net.ParseIP(s.want))) {
+					t.Errorf("%s: step %d Allocate() = %v, want %q", tt.name, i, got, s.want)
+				}
+			case "release":
+				pool.Release(net.ParseIP(s.ip))
+			case "reserve":
+				if got := pool.Reserve(net.ParseIP(s.ip)); (got && s.want != "true") || (!got && s.want != "false") {
+					t.Errorf("%s: step %d Reserve(%s) = %v, want %s", tt.name, i, s.ip, got, s.want)
+				}
+			}
+		}
+	}
+}
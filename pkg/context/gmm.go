@@ -0,0 +1,187 @@
+package context
+
+import (
+	"fmt"
+
+	"free5gc/lib/fsm"
+	"free5gc/lib/nas"
+
+	"sim-amf/pkg/types"
+)
+
+// 5GMM states in the AMF
+//
+// TS 24.501 5.1.3.2.3 5GMM states in the AMF
+const (
+	GmmDeregistered             fsm.State = "5GMM-DEREGISTERED"
+	GmmCommonProcedureInitiated fsm.State = "5GMM-COMMON-PROCEDURE-INITIATED"
+	GmmRegistered               fsm.State = "5GMM-REGISTERED"
+	GmmDeregisteredInitiated    fsm.State = "5GMM-DEREGISTERED-INITIATED"
+	CmIdle                      fsm.State = "CM-IDLE"
+	CmConnected                 fsm.State = "CM-CONNECTED"
+)
+
+// 5GMM events, driven by the NAS messages sent and received
+const (
+	GmmEventCommonProcedureStarted fsm.Event = "Common Procedure Started" // Identity/Authentication/Security Mode Command sent
+	GmmEventRegistrationAccepted   fsm.Event = "Registration Accepted"    // Registration Accept sent
+	GmmEventRegistrationRejected   fsm.Event = "Registration Rejected"    // Registration Reject sent or common procedure failed
+	GmmEventDeregistrationStarted  fsm.Event = "Deregistration Started"   // network-initiated Deregistration Request sent
+	GmmEventDeregistered           fsm.Event = "Deregistered"             // Deregistration Accept sent or received
+)
+
+// CM events, driven by the UE-associated NG connection
+//
+// TS 23.501 5.3.3.2 5GS Connection Management states
+const (
+	CmEventConnected fsm.Event = "NG Connection Established" // Initial UE Message received
+	CmEventReleased  fsm.Event = "NG Connection Released"    // UE Context Release Complete received
+)
+
+var gmmTransitions = map[fsm.State]map[fsm.Event]fsm.State{
+	GmmDeregistered: {
+		GmmEventCommonProcedureStarted: GmmCommonProcedureInitiated,
+		GmmEventRegistrationAccepted:   GmmRegistered,
+		GmmEventRegistrationRejected:   GmmDeregistered,
+		GmmEventDeregistered:           GmmDeregistered,
+	},
+	GmmCommonProcedureInitiated: {
+		GmmEventCommonProcedureStarted: GmmCommonProcedureInitiated,
+		GmmEventRegistrationAccepted:   GmmRegistered,
+		GmmEventRegistrationRejected:   GmmDeregistered,
+		GmmEventDeregistered:           GmmDeregistered,
+	},
+	GmmRegistered: {
+		GmmEventCommonProcedureStarted: GmmCommonProcedureInitiated,
+		GmmEventRegistrationAccepted:   GmmRegistered,
+		GmmEventRegistrationRejected:   GmmDeregistered,
+		GmmEventDeregistrationStarted:  GmmDeregisteredInitiated,
+		GmmEventDeregistered:           GmmDeregistered,
+	},
+	GmmDeregisteredInitiated: {
+		GmmEventDeregistrationStarted: GmmDeregisteredInitiated,
+		GmmEventDeregistered:          GmmDeregistered,
+	},
+}
+
+var cmTransitions = map[fsm.State]map[fsm.Event]fsm.State{
+	CmIdle: {
+		CmEventConnected: CmConnected,
+		CmEventReleased:  CmIdle,
+	},
+	CmConnected: {
+		CmEventConnected: CmConnected,
+		CmEventReleased:  CmIdle,
+	},
+}
+
+// gmmUplinkMessages are the 5GMM messages the AMF accepts from the UE in each 5GMM state. 5GMM STATUS is accepted in
+// any state.
+//
+// TS 24.501 5.1.3.2.3 5GMM states in the AMF
+var gmmUplinkMessages = map[fsm.State]map[uint8]bool{
+	GmmDeregistered: {
+		nas.MsgTypeRegistrationRequest:                              true,
+		nas.MsgTypeDeregistrationRequestUEOriginatingDeregistration: true,
+	},
+	GmmCommonProcedureInitiated: {
+		nas.MsgTypeRegistrationRequest:                              true,
+		nas.MsgTypeDeregistrationRequestUEOriginatingDeregistration: true,
+		nas.MsgTypeIdentityResponse:                                 true,
+		nas.MsgTypeAuthenticationResponse:                           true,
+		nas.MsgTypeAuthenticationFailure:                            true,
+		nas.MsgTypeSecurityModeComplete:                             true,
+		nas.MsgTypeSecurityModeReject:                               true,
+	},
+	GmmRegistered: {
+		nas.MsgTypeRegistrationRequest:                              true,
+		nas.MsgTypeRegistrationComplete:                             true,
+		nas.MsgTypeDeregistrationRequestUEOriginatingDeregistration: true,
+		nas.MsgTypeServiceRequest:                                   true,
+		nas.MsgTypeULNASTransport:                                   true,
+		nas.MsgTypeConfigurationUpdateComplete:                      true,
+		nas.MsgTypeNotificationResponse:                             true,
+	},
+	GmmDeregisteredInitiated: {
+		nas.MsgTypeDeregistrationRequestUEOriginatingDeregistration: true,
+		nas.MsgTypeDeregistrationAcceptUETerminatedDeregistration:   true,
+	},
+}
+
+// newStateMachine returns an FSM in the initial state, of which the states accept the events of the transitions
+func newStateMachine(initState fsm.State, transitions map[fsm.State]map[fsm.Event]fsm.State) *fsm.FSM {
+	table := fsm.NewFuncTable()
+	for state := range transitions {
+		table[state] = func(sm *fsm.FSM, event fsm.Event, args fsm.Args) error {
+			if event == fsm.EVENT_ENTRY {
+				return nil
+			}
+			next, ok := transitions[sm.Current()][event]
+			if !ok {
+				return fmt.Errorf("event [%s] is not allowed in state [%s]", event, sm.Current())
+			}
+			return sm.Transfer(next, args)
+		}
+	}
+	sm, _ := fsm.NewFSM(initState, table)
+	return sm
+}
+
+// InitStateMachine sets the 5GMM state machines of the RG types to 5GMM-DEREGISTERED and the CM state to CM-IDLE
+func (ue *UEContext) InitStateMachine() {
+	ue.SM = make(map[types.RGType]*fsm.FSM)
+	for _, rgType := range []types.RGType{types.RGType_FN_RG, types.RGType_FIVEG_RG} {
+		ue.SM[rgType] = newStateMachine(GmmDeregistered, gmmTransitions)
+	}
+	ue.CM = newStateMachine(CmIdle, cmTransitions)
+	ue.StateMachineIndex = GmmDeregistered
+}
+
+// SendGmmEvent drives the 5GMM state machine of the UE
+func (ue *UEContext) SendGmmEvent(event fsm.Event) error {
+	sm, ok := ue.SM[ue.RGType]
+	if !ok {
+		return fmt.Errorf("no 5GMM state machine for RG type %s", ue.RGType)
+	}
+	if err := sm.SendEvent(event, nil); err != nil {
+		return err
+	}
+	ue.StateMachineIndex = sm.Current()
+	return nil
+}
+
+// SendCmEvent drives the CM state machine of the UE
+func (ue *UEContext) SendCmEvent(event fsm.Event) error {
+	return ue.CM.SendEvent(event, nil)
+}
+
+// CmState returns the CM state of the UE
+func (ue *UEContext) CmState() string {
+	return string(ue.CM.Current())
+}
+
+// GmmMessageCompatible tells whether an uplink 5GMM message is compatible with the 5GMM state of the UE, the AMF
+// answering the other ones with a 5GMM STATUS #98 "message type not compatible with protocol state". The Security
+// Mode Complete and Reject answer in 5GMM-REGISTERED the Security Mode Command of a NAS security rekeying.
+//
+// TS 24.501 7.4 Message type non-existent or not implemented, TS 33.501 6.9.3 NAS key re-keying
+func (ue *UEContext) GmmMessageCompatible(messageType uint8) bool {
+	if messageType == nas.MsgTypeStatus5GMM {
+		return true
+	}
+	sm, ok := ue.SM[ue.RGType]
+	if !ok {
+		return false
+	}
+	if sm.Current() == GmmRegistered && ue.PreviousSecurityContext != nil &&
+		(messageType == nas.MsgTypeSecurityModeComplete || messageType == nas.MsgTypeSecurityModeReject) {
+		return true
+	}
+	return gmmUplinkMessages[sm.Current()][messageType]
+}
+
+// Registered tells whether the UE is in 5GMM-REGISTERED
+func (ue *UEContext) Registered() bool {
+	sm, ok := ue.SM[ue.RGType]
+	return ok && sm.Current() == GmmRegistered
+}
@@ -0,0 +1,221 @@
+package context
+
+import (
+	"testing"
+
+	"free5gc/lib/fsm"
+	"free5gc/lib/nas"
+
+	"sim-amf/pkg/types"
+)
+
+func TestSendGmmEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		events  []fsm.Event
+		want    fsm.State
+		wantErr bool
+	}{
+		{
+			name:   "registration",
+			events: []fsm.Event{GmmEventCommonProcedureStarted, GmmEventCommonProcedureStarted, GmmEventRegistrationAccepted},
+			want:   GmmRegistered,
+		},
+		{
+			name:   "registration without common procedure",
+			events: []fsm.Event{GmmEventRegistrationAccepted},
+			want:   GmmRegistered,
+		},
+		{
+			name:   "common procedure failure",
+			events: []fsm.Event{GmmEventCommonProcedureStarted, GmmEventRegistrationRejected},
+			want:   GmmDeregistered,
+		},
+		{
+			name:   "common procedure in 5GMM-REGISTERED",
+			events: []fsm.Event{GmmEventRegistrationAccepted, GmmEventCommonProcedureStarted},
+			want:   GmmCommonProcedureInitiated,
+		},
+		{
+			name:   "UE-initiated deregistration",
+			events: []fsm.Event{GmmEventRegistrationAccepted, GmmEventDeregistered},
+			want:   GmmDeregistered,
+		},
+		{
+			name:   "network-initiated deregistration",
+			events: []fsm.Event{GmmEventRegistrationAccepted, GmmEventDeregistrationStarted},
+			want:   GmmDeregisteredInitiated,
+		},
+		{
+			name: "network-initiated deregistration accepted",
+			events: []fsm.Event{GmmEventRegistrationAccepted, GmmEventDeregistrationStarted,
+				GmmEventDeregistrationStarted, GmmEventDeregistered},
+			want: GmmDeregistered,
+		},
+		{
+			name:    "network-initiated deregistration in 5GMM-DEREGISTERED",
+			events:  []fsm.Event{GmmEventDeregistrationStarted},
+			want:    GmmDeregistered,
+			wantErr: true,
+		},
+		{
+			name:    "registration accepted in 5GMM-DEREGISTERED-INITIATED",
+			events:  []fsm.Event{GmmEventRegistrationAccepted, GmmEventDeregistrationStarted, GmmEventRegistrationAccepted},
+			want:    GmmDeregisteredInitiated,
+			wantErr: true,
+		},
+		{
+			name:    "unknown event",
+			events:  []fsm.Event{CmEventConnected},
+			want:    GmmDeregistered,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		ue := new(UEContext)
+		ue.RGType = types.RGType_FIVEG_RG
+		ue.InitStateMachine()
+		var err error
+		for _, event := range tt.events {
+			if err = ue.SendGmmEvent(event); err != nil {
+				break
+			}
+		}
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: SendGmmEvent() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if ue.StateMachineIndex != tt.want {
+			t.Errorf("%s: state = %s, want %s", tt.name, ue.StateMachineIndex, tt.want)
+		}
+		if other := ue.SM[types.RGType_FN_RG].Current(); other != GmmDeregistered {
+			t.Errorf("%s: FN-RG state = %s, want %s", tt.name, other, GmmDeregistered)
+		}
+	}
+}
+
+func TestSendGmmEventWithoutStateMachine(t *testing.T) {
+	ue := new(UEContext)
+	ue.RGType = types.RGType_FIVEG_RG
+	if err := ue.SendGmmEvent(GmmEventRegistrationAccepted); err == nil {
+		t.Error("SendGmmEvent() without state machine succeeded")
+	}
+	if ue.Registered() {
+		t.Error("Registered() without state machine")
+	}
+}
+
+func TestSendCmEvent(t *testing.T) {
+	ue := new(UEContext)
+	ue.InitStateMachine()
+	steps := []struct {
+		event fsm.Event
+		want  fsm.State
+	}{
+		{event: CmEventConnected, want: CmConnected},
+		{event: CmEventConnected, want: CmConnected},
+		{event: CmEventReleased, want: CmIdle},
+		{event: CmEventReleased, want: CmIdle},
+	}
+	for i, step := range steps {
+		if err := ue.SendCmEvent(step.event); err != nil {
+			t.Fatalf("step %d: SendCmEvent(%s) error = %v", i, step.event, err)
+		}
+		if got := ue.CmState(); got != string(step.want) {
+			t.Errorf("step %d: CmState() = %s, want %s", i, got, step.want)
+		}
+	}
+	if err := ue.SendCmEvent(GmmEventDeregistered); err == nil {
+		t.Error("SendCmEvent() of a 5GMM event succeeded")
+	}
+}
+
+func TestGmmMessageCompatible(t *testing.T) {
+	tests := []struct {
+		name        string
+		events      []fsm.Event
+		rekeying    bool
+		messageType uint8
+		want        bool
+	}{
+		{name: "registration request", messageType: nas.MsgTypeRegistrationRequest, want: true},
+		{name: "status", messageType: nas.MsgTypeStatus5GMM, want: true},
+		{name: "authentication response before authentication", messageType: nas.MsgTypeAuthenticationResponse},
+		{name: "registration complete before registration", messageType: nas.MsgTypeRegistrationComplete},
+		{name: "service request before registration", messageType: nas.MsgTypeServiceRequest},
+		{
+			name:        "authentication response",
+			events:      []fsm.Event{GmmEventCommonProcedureStarted},
+			messageType: nas.MsgTypeAuthenticationResponse,
+			want:        true,
+		},
+		{
+			name:        "security mode complete",
+			events:      []fsm.Event{GmmEventCommonProcedureStarted},
+			messageType: nas.MsgTypeSecurityModeComplete,
+			want:        true,
+		},
+		{
+			name:        "UL NAS transport before registration",
+			events:      []fsm.Event{GmmEventCommonProcedureStarted},
+			messageType: nas.MsgTypeULNASTransport,
+		},
+		{
+			name:        "registration complete",
+			events:      []fsm.Event{GmmEventRegistrationAccepted},
+			messageType: nas.MsgTypeRegistrationComplete,
+			want:        true,
+		},
+		{
+			name:        "security mode complete in 5GMM-REGISTERED",
+			events:      []fsm.Event{GmmEventRegistrationAccepted},
+			messageType: nas.MsgTypeSecurityModeComplete,
+		},
+		{
+			name:        "security mode complete of a rekeying",
+			events:      []fsm.Event{GmmEventRegistrationAccepted},
+			rekeying:    true,
+			messageType: nas.MsgTypeSecurityModeComplete,
+			want:        true,
+		},
+		{
+			name:        "security mode reject of a rekeying",
+			events:      []fsm.Event{GmmEventRegistrationAccepted},
+			rekeying:    true,
+			messageType: nas.MsgTypeSecurityModeReject,
+			want:        true,
+		},
+		{
+			name:        "authentication response in a rekeying",
+			events:      []fsm.Event{GmmEventRegistrationAccepted},
+			rekeying:    true,
+			messageType: nas.MsgTypeAuthenticationResponse,
+		},
+		{
+			name:        "deregistration accept",
+			events:      []fsm.Event{GmmEventRegistrationAccepted, GmmEventDeregistrationStarted},
+			messageType: nas.MsgTypeDeregistrationAcceptUETerminatedDeregistration,
+			want:        true,
+		},
+		{
+			name:        "UL NAS transport in 5GMM-DEREGISTERED-INITIATED",
+			events:      []fsm.Event{GmmEventRegistrationAccepted, GmmEventDeregistrationStarted},
+			messageType: nas.MsgTypeULNASTransport,
+		},
+	}
+	for _, tt := range tests {
+		ue := new(UEContext)
+		ue.RGType = types.RGType_FIVEG_RG
+		ue.InitStateMachine()
+		for _, event := range tt.events {
+			if err := ue.SendGmmEvent(event); err != nil {
+				t.Fatalf("%s: SendGmmEvent(%s) error = %v", tt.name, event, err)
+			}
+		}
+		if tt.rekeying {
+			ue.PreviousSecurityContext = new(NASSecurityContext)
+		}
+		if got := ue.GmmMessageCompatible(tt.messageType); got != tt.want {
+			t.Errorf("%s: GmmMessageCompatible(%d) = %v, want %v", tt.name, tt.messageType, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package context
+
+import (
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"free5gc/lib/aper"
+	"free5gc/lib/ngap/ngapType"
+	"sim-amf/pkg/types"
+)
+
+// MaxUserLocations is the number of user locations kept per UE, the oldest ones being dropped
+const MaxUserLocations = 16
+
+// UserLocation is the line identity of a wireline UE reported by the W-AGF in a User Location Information
+//
+// TS 38.413 9.3.1.16 User Location Information
+type UserLocation struct {
+	Time         time.Time
+	Procedure    string           // NGAP procedure the location was reported in, e.g. location_report
+	GlobalLineID aper.OctetString // Global Line Identity of a DSL or PON line
+	LineType     string           // line type of the Global Line ID, empty if not reported
+	HFCNodeID    aper.OctetString // HFC node ID of a cable line
+	Presence     map[int64]string // UE presence, in, out or unknown, by Location Reporting Reference ID
+}
+
+// UserLocationFromNgap returns the line identity of the User Location Information of a W-AGF, false if it has none
+func UserLocationFromNgap(userLocationInformation *ngapType.UserLocationInformation) (UserLocation, bool) {
+	var location UserLocation
+	if userLocationInformation == nil || userLocationInformation.ChoiceExtensions == nil {
+		return location, false
+	}
+	userLocationInformationWAGF := userLocationInformation.ChoiceExtensions.Value.Value.UserLocationInformationWAGF
+	if userLocationInformationWAGF == nil {
+		return location, false
+	}
+	if userLocationInformationWAGF.HfcNodeID != nil {
+		location.HFCNodeID = userLocationInformationWAGF.HfcNodeID.Value
+		location.LineType = types.LineType_CABLE
+		return location, true
+	}
+	globalLineID := userLocationInformationWAGF.GlobalLineID
+	if globalLineID == nil {
+		return location, false
+	}
+	location.GlobalLineID = globalLineID.GlobalLineIdentity
+	if globalLineID.LineType != nil {
+		switch globalLineID.LineType.Value {
+		case ngapType.LineTypePresentDS1:
+			location.LineType = types.LineType_DSL
+		case ngapType.LineTypePresentPON:
+			location.LineType = types.LineType_PON
+		}
+	}
+	return location, true
+}
+
+// SameLine reports whether the locations identify the same line
+func (l *UserLocation) SameLine(other *UserLocation) bool {
+	return string(l.GlobalLineID) == string(other.GlobalLineID) && string(l.HFCNodeID) == string(other.HFCNodeID) &&
+		l.LineType == other.LineType
+}
+
+// LineString returns the line identity of the location
+func (l *UserLocation) LineString() string {
+	if l.HFCNodeID != nil {
+		return "HFC node ID " + hex.EncodeToString(l.HFCNodeID)
+	}
+	if l.LineType != "" {
+		return fmt.Sprintf("Global Line ID %s (%s)", l.GlobalLineID, l.LineType)
+	}
+	return fmt.Sprintf("Global Line ID %s", l.GlobalLineID)
+}
+
+// AddUserLocation appends the location to the location history of the UE and returns the previous location, nil if
+// none. The history is replaced rather than appended in place, the control API reading it outside of the UE dispatcher.
+func (ue *UEContext) AddUserLocation(location UserLocation) *UserLocation {
+	var previous *UserLocation
+	if n := len(ue.UserLocations); n > 0 {
+		previous = &ue.UserLocations[n-1]
+	}
+	first := 0
+	if len(ue.UserLocations) >= MaxUserLocations {
+		first = len(ue.UserLocations) - MaxUserLocations + 1
+	}
+	userLocations := make([]UserLocation, 0, len(ue.UserLocations)-first+1)
+	userLocations = append(userLocations, ue.UserLocations[first:]...)
+	ue.UserLocations = append(userLocations, location)
+	return previous
+}
+
+// LastUserLocation returns the last location of the UE, nil if none
+func (ue *UEContext) LastUserLocation() *UserLocation {
+	if n := len(ue.UserLocations); n > 0 {
+		return &ue.UserLocations[n-1]
+	}
+	return nil
+}
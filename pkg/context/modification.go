@@ -0,0 +1,34 @@
+package context
+
+import "free5gc/lib/ngap/ngapType"
+
+// UEContextModification is the UE context requested to the AGF in a UE Context Modification Request, applied to the UE
+// context on the UE Context Modification Response. The nil or zero fields are not modified.
+//
+// TS 38.413 8.3.4 UE Context Modification
+type UEContextModification struct {
+	Kwagf                            []uint8 // new Security Key
+	Ambr                             *ngapType.UEAggregateMaximumBitRate
+	SecurityCapabilities             *ngapType.UESecurityCapabilities
+	IndexToRfsp                      int64
+	CoreNetworkAssistanceInformation *ngapType.CoreNetworkAssistanceInformation
+}
+
+// ApplyContextModification applies the UE context modification acknowledged by the AGF
+func (ue *UEContext) ApplyContextModification(modification *UEContextModification) {
+	if modification.Kwagf != nil {
+		ue.Kwagf = modification.Kwagf
+	}
+	if modification.Ambr != nil {
+		ue.Ambr = modification.Ambr
+	}
+	if modification.SecurityCapabilities != nil {
+		ue.SecurityCapabilities = modification.SecurityCapabilities
+	}
+	if modification.IndexToRfsp != 0 {
+		ue.IndexToRfsp = modification.IndexToRfsp
+	}
+	if modification.CoreNetworkAssistanceInformation != nil {
+		ue.CoreNetworkAssistanceInformation = modification.CoreNetworkAssistanceInformation
+	}
+}
@@ -0,0 +1,185 @@
+package context
+
+import (
+	"encoding/binary"
+	"strings"
+
+	"free5gc/lib/UeauCommon"
+	"free5gc/lib/nas/nasMessage"
+	"free5gc/lib/nas/security"
+	"free5gc/lib/openapi/models"
+
+	"sim-amf/pkg/types"
+)
+
+// AccessType returns the access the UE registers over: the W-AGF registers the FN-RGs over non-3GPP access, the 5G-RGs
+// running their own NAS are registered over 3GPP access
+//
+// TS 24.501 9.11.3.6 5GS registration result, 9.11.3.20 De-registration type
+func (ue *UEContext) AccessType() uint8 {
+	switch ue.RGType {
+	case types.RGType_FN_RG:
+		return nasMessage.AccessTypeNon3GPP
+	case types.RGType_FIVEG_RG:
+		return nasMessage.AccessType3GPP
+	default:
+		return nasMessage.AccessTypeBoth
+	}
+}
+
+// DerivateKamf derives the KAMF of the UE from the KSEAF of its 5G AKA
+//
+// TS 33.501 A.7 KAMF derivation function
+func (ue *UEContext) DerivateKamf(kseaf []byte) {
+	// P0 is the IMSI digits, or the NAI, of the SUPI
+	P0 := []byte(strings.TrimPrefix(strings.TrimPrefix(ue.Supi, "imsi-"), "nai-"))
+	L0 := UeauCommon.KDFLen(P0)
+	P1 := ue.ABBA
+	L1 := UeauCommon.KDFLen(P1)
+
+	ue.Kamf = UeauCommon.GetKDFValue(kseaf, UeauCommon.FC_FOR_KAMF_DERIVATION, P0, L0, P1, L1)
+}
+
+// DerivateAlgKey derives the NAS encryption and integrity keys of the selected algorithms from the KAMF
+//
+// TS 33.501 A.8 Algorithm key derivation functions
+func (ue *UEContext) DerivateAlgKey() {
+	P0 := []byte{security.NNASEncAlg}
+	L0 := UeauCommon.KDFLen(P0)
+	P1 := []byte{ue.CipheringAlg}
+	L1 := UeauCommon.KDFLen(P1)
+	kenc := UeauCommon.GetKDFValue(ue.Kamf, UeauCommon.FC_FOR_ALGORITHM_KEY_DERIVATION, P0, L0, P1, L1)
+	copy(ue.KnasEnc[:], kenc[16:32])
+
+	P0 = []byte{security.NNASIntAlg}
+	L0 = UeauCommon.KDFLen(P0)
+	P1 = []byte{ue.IntegrityAlg}
+	L1 = UeauCommon.KDFLen(P1)
+	kint := UeauCommon.GetKDFValue(ue.Kamf, UeauCommon.FC_FOR_ALGORITHM_KEY_DERIVATION, P0, L0, P1, L1)
+	copy(ue.KnasInt[:], kint[16:32])
+}
+
+// DerivateAnKey derives the Kwagf sent to the W-AGF in the Initial Context Setup Request
+func (ue *UEContext) DerivateAnKey() {
+	ue.Kwagf = ue.AnKey()
+}
+
+// AnKey returns the Kwagf derived from the KAMF and the uplink NAS COUNT, with the access type distinguisher of the
+// access the UE registers over
+//
+// TS 33.501 A.9 KgNB, KN3IWF, KWAGF derivation function
+func (ue *UEContext) AnKey() []uint8 {
+	// the uplink NAS COUNT is the one of the UE side, see nas.Decode
+	P0 := make([]byte, 4)
+	binary.BigEndian.PutUint32(P0, ue.DLCount.Get())
+	L0 := UeauCommon.KDFLen(P0)
+	P1 := []byte{security.AccessType3GPP}
+	if ue.AccessType() == nasMessage.AccessTypeNon3GPP {
+		P1 = []byte{security.AccessTypeNon3GPP}
+	}
+	L1 := UeauCommon.KDFLen(P1)
+
+	return UeauCommon.GetKDFValue(ue.Kamf, UeauCommon.FC_FOR_KGNB_KN3IWF_DERIVATION, P0, L0, P1, L1)
+}
+
+// SelectSecurityAlg selects the NAS integrity and ciphering algorithms supported by the UE in the order of preference
+// of the AMF: 128-NIA2 and 128-NIA1, then 128-NEA2, 128-NEA1 and the null ciphering. It returns false if the UE
+// supports no integrity algorithm but the null one, not allowed out of emergency services.
+//
+// TS 33.501 6.7.1 NAS security algorithm selection
+func (ue *UEContext) SelectSecurityAlg() bool {
+	capability := ue.NasUESecurityCapability
+	if capability == nil {
+		return false
+	}
+	switch {
+	case capability.GetIA2_128_5G() == 1:
+		ue.IntegrityAlg = security.AlgIntegrity128NIA2
+	case capability.GetIA1_128_5G() == 1:
+		ue.IntegrityAlg = security.AlgIntegrity128NIA1
+	default:
+		return false
+	}
+	switch {
+	case capability.GetEA2_128_5G() == 1:
+		ue.CipheringAlg = security.AlgCiphering128NEA2
+	case capability.GetEA1_128_5G() == 1:
+		ue.CipheringAlg = security.AlgCiphering128NEA1
+	default:
+		ue.CipheringAlg = security.AlgCiphering128NEA0
+	}
+	return true
+}
+
+// fcForKamfPrimeDerivation is the FC of the KAMF to K'AMF derivation
+//
+// TS 33.501 A.13 KAMF to K'AMF derivation in mobility
+const fcForKamfPrimeDerivation = "72"
+
+// NASSecurityContext is a 5G NAS security context of the UE, kept while the Security Mode Command of a rekeying takes
+// a new one into use
+//
+// TS 33.501 6.9.3 Key-change-on-the-fly
+type NASSecurityContext struct {
+	NgKsi        models.NgKsi
+	Kamf         []uint8
+	CipheringAlg uint8
+	IntegrityAlg uint8
+	KnasEnc      [16]uint8
+	KnasInt      [16]uint8
+	ULCount      types.Count
+	DLCount      types.Count
+}
+
+// CurrentNASSecurityContext returns a copy of the NAS security context in use
+func (ue *UEContext) CurrentNASSecurityContext() *NASSecurityContext {
+	return &NASSecurityContext{
+		NgKsi:        ue.NgKsi,
+		Kamf:         append([]uint8(nil), ue.Kamf...),
+		CipheringAlg: ue.CipheringAlg,
+		IntegrityAlg: ue.IntegrityAlg,
+		KnasEnc:      ue.KnasEnc,
+		KnasInt:      ue.KnasInt,
+		ULCount:      ue.ULCount,
+		DLCount:      ue.DLCount,
+	}
+}
+
+// RestoreNASSecurityContext takes the NAS security context back into use
+func (ue *UEContext) RestoreNASSecurityContext(securityContext *NASSecurityContext) {
+	ue.NgKsi = securityContext.NgKsi
+	ue.Kamf = securityContext.Kamf
+	ue.CipheringAlg = securityContext.CipheringAlg
+	ue.IntegrityAlg = securityContext.IntegrityAlg
+	ue.KnasEnc = securityContext.KnasEnc
+	ue.KnasInt = securityContext.KnasInt
+	ue.ULCount = securityContext.ULCount
+	ue.DLCount = securityContext.DLCount
+}
+
+// DerivateHorizontalKamf replaces the KAMF of the UE by the K'AMF derived from it with the downlink NAS COUNT, and
+// assigns it the next ngKSI. The NAS COUNTs are reset once the Security Mode Command takes it into use.
+//
+// TS 33.501 6.9.3 Key-change-on-the-fly, A.13 KAMF to K'AMF derivation in mobility
+func (ue *UEContext) DerivateHorizontalKamf() {
+	// the direction of a connected mode derivation, and the downlink NAS COUNT of the AMF side, see nas.protect
+	P0 := []byte{0x01}
+	L0 := UeauCommon.KDFLen(P0)
+	P1 := make([]byte, 4)
+	binary.BigEndian.PutUint32(P1, ue.ULCount.Get())
+	L1 := UeauCommon.KDFLen(P1)
+
+	ue.Kamf = UeauCommon.GetKDFValue(ue.Kamf, fcForKamfPrimeDerivation, P0, L0, P1, L1)
+	ue.NgKsi.Ksi = (ue.NgKsi.Ksi + 1) % nasMessage.NasKeySetIdentifierNoKeyIsAvailable
+}
+
+// RestorePreviousSecurityContext takes back into use the NAS security context of the UE saved for the ongoing Security
+// Mode Command of a rekeying, and returns false if none is ongoing
+func (ue *UEContext) RestorePreviousSecurityContext() bool {
+	if ue.PreviousSecurityContext == nil {
+		return false
+	}
+	ue.RestoreNASSecurityContext(ue.PreviousSecurityContext)
+	ue.PreviousSecurityContext, ue.HorizontalDerivation = nil, false
+	return true
+}
@@ -0,0 +1,115 @@
+package context
+
+import (
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"free5gc/lib/openapi/models"
+)
+
+// Subscriber is the subscription data of a UE
+type Subscriber struct {
+	sqn             uint64                    // SQN of the last authentication vector, first for its atomic alignment
+	ID              string                    // SUPI, GLI NAI, GCI, MAC address or IMSI of the UE
+	K               []byte                    // permanent key
+	OPc             []byte                    // operator variant algorithm configuration field
+	SubscribedNssai []models.SubscribedSnssai // the default S-NSSAIs are allowed to the UE requesting none
+	Dnns            []string                  // DNNs of the PDU sessions, any DNN if empty
+	UeAmbrUL        int64                     // UE-AMBR in bps, 0 for the default
+	UeAmbrDL        int64
+	SessionAmbrUL   int64 // Session-AMBR in bps, 0 for the default
+	SessionAmbrDL   int64
+	StaticIPs       map[string]net.IP // static IPv4 address of the PDU sessions, DNN as key
+	Barred          bool              // registrations rejected
+	Trace           *TraceSettings    // trace session activated in the AGF on the Initial Context Setup, nil if none
+}
+
+// LoadSubscriber returns the Subscriber stored in the Subscribers for an identity, or nil if no Subscriber is present.
+// The bool result indicates whether Subscriber was found in the Subscribers.
+func (amf *AMFContext) LoadSubscriber(id string) (*Subscriber, bool) {
+	if value, ok := amf.Subscribers.Load(id); ok {
+		return value.(*Subscriber), true
+	}
+
+	return nil, false
+}
+
+// StoreSubscriber sets the Subscriber for its identity
+func (amf *AMFContext) StoreSubscriber(subscriber *Subscriber) {
+	amf.Subscribers.Store(subscriber.ID, subscriber)
+}
+
+// DeleteSubscriber deletes the Subscriber for an identity
+func (amf *AMFContext) DeleteSubscriber(id string) {
+	amf.Subscribers.Delete(id)
+}
+
+// ReplaceSubscribers sets the Subscribers, identity as key, and deletes the other ones. A replaced Subscriber passes its
+// SQN on.
+func (amf *AMFContext) ReplaceSubscribers(subscribers map[string]*Subscriber) {
+	amf.Subscribers.Range(func(key, value interface{}) bool {
+		if _, ok := subscribers[key.(string)]; !ok {
+			amf.Subscribers.Delete(key)
+		}
+		return true
+	})
+	for id, subscriber := range subscribers {
+		if replaced, ok := amf.LoadSubscriber(id); ok {
+			subscriber.ResyncSqn(atomic.LoadUint64(&replaced.sqn))
+		}
+		amf.Subscribers.Store(id, subscriber)
+	}
+}
+
+// FindSubscriber returns the Subscriber of the UE, looked up by its SUPI, SUCI NAI, GLI SUPI or GCI, IMSI, MAC address
+// and Global Line ID in turn, or the DefaultSubscriber
+func (amf *AMFContext) FindSubscriber(ue *UEContext) *Subscriber {
+	ids := []string{ue.Supi, ue.Suci, ue.Nai, ue.GlobalIDSUPI, ue.Imsi, strings.ToLower(ue.MAC), ue.GlobalIDStr}
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		if subscriber, ok := amf.LoadSubscriber(id); ok {
+			return subscriber
+		}
+	}
+	return amf.DefaultSubscriber
+}
+
+// SnssaiSubscribed tells whether the S-NSSAI is in the subscribed NSSAI
+func (subscriber *Subscriber) SnssaiSubscribed(snssai models.Snssai) bool {
+	for _, subscribedSnssai := range subscriber.SubscribedNssai {
+		if subscribedSnssai.SubscribedSnssai != nil && *subscribedSnssai.SubscribedSnssai == snssai {
+			return true
+		}
+	}
+	return false
+}
+
+// DnnAllowed tells whether a PDU session may be established to the DNN
+func (subscriber *Subscriber) DnnAllowed(dnn string) bool {
+	if len(subscriber.Dnns) == 0 {
+		return true
+	}
+	for _, subscribedDnn := range subscriber.Dnns {
+		if strings.EqualFold(subscribedDnn, dnn) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextSqn returns the 48 bits SQN of a new authentication vector of the Subscriber
+//
+// TS 33.102 C.1.1 Generation of sequence numbers
+func (subscriber *Subscriber) NextSqn() uint64 {
+	return atomic.AddUint64(&subscriber.sqn, 1) & 0xffffffffffff
+}
+
+// ResyncSqn sets the SQN of the Subscriber to the highest one accepted by the UE, returned in its AUTS
+//
+// TS 33.102 6.3.5 Re-synchronisation procedure
+func (subscriber *Subscriber) ResyncSqn(sqnMS uint64) {
+	atomic.StoreUint64(&subscriber.sqn, sqnMS)
+}
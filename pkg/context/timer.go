@@ -0,0 +1,94 @@
+package context
+
+import (
+	"time"
+
+	"free5gc/lib/timer"
+)
+
+// Network side 5GMM timers
+//
+// TS 24.501 10.2 Table 10.2.2: Timers of 5GS mobility management - AMF side
+const (
+	T3522 string = "T3522" // Deregistration Request -> Deregistration Accept
+	T3550 string = "T3550" // Registration Accept -> Registration Complete
+	T3560 string = "T3560" // Authentication Request, Security Mode Command -> Response, Complete
+	T3570 string = "T3570" // Identity Request -> Identity Response
+)
+
+// NASTimer is a running network side 5GMM timer, guarding a downlink NAS message of which the UE reply is awaited
+type NASTimer struct {
+	Name        string
+	ExpireTimes int // expiries so far, the NAS message being retransmitted on each expiry
+	timer       *time.Timer
+}
+
+// nasTimer returns the slot of the running timer, its value and maximum retransmissions
+func (ue *UEContext) nasTimer(name string) (t **NASTimer, value int, maxRetryTimes int) {
+	switch name {
+	case T3522:
+		return &ue.T3522, ue.T3522Value, ue.MaxT3522RetryTimes
+	case T3550:
+		return &ue.T3550, ue.T3550Value, ue.MaxT3550RetryTimes
+	case T3560:
+		return &ue.T3560, ue.T3560Value, ue.MaxT3560RetryTimes
+	case T3570:
+		return &ue.T3570, ue.T3570Value, ue.MaxT3570RetryTimes
+	}
+	return nil, 0, 0
+}
+
+// StartNASTimer starts a 5GMM timer, replacing the running one. expired is called from the timer goroutine on expiry.
+func (ue *UEContext) StartNASTimer(name string, expired func(t *NASTimer)) {
+	ue.StopNASTimer(name)
+	ue.runNASTimer(&NASTimer{Name: name}, expired)
+}
+
+// RestartNASTimer restarts an expired 5GMM timer after the retransmission of its NAS message, keeping its expiries
+func (ue *UEContext) RestartNASTimer(t *NASTimer, expired func(t *NASTimer)) {
+	ue.runNASTimer(&NASTimer{Name: t.Name, ExpireTimes: t.ExpireTimes}, expired)
+}
+
+func (ue *UEContext) runNASTimer(t *NASTimer, expired func(t *NASTimer)) {
+	slot, value, _ := ue.nasTimer(t.Name)
+	if slot == nil {
+		return
+	}
+	t.timer = timer.StartTimer(value, func(msg interface{}) {
+		expired(msg.(*NASTimer))
+	}, t)
+	*slot = t
+}
+
+// StopNASTimer stops a 5GMM timer on the reception of the UE reply or the end of the procedure
+func (ue *UEContext) StopNASTimer(name string) {
+	slot, _, _ := ue.nasTimer(name)
+	if slot == nil || *slot == nil {
+		return
+	}
+	(*slot).timer.Stop()
+	*slot = nil
+}
+
+// StopNASTimers stops all the 5GMM timers of the UE
+func (ue *UEContext) StopNASTimers() {
+	for _, name := range []string{T3522, T3550, T3560, T3570} {
+		ue.StopNASTimer(name)
+	}
+}
+
+// NASTimerExpired counts an expiry of a 5GMM timer and tells whether its NAS message may be retransmitted, or the
+// procedure aborted once the maximum retransmissions are reached. It returns false for a timer stopped or replaced
+// after its expiry.
+func (ue *UEContext) NASTimerExpired(t *NASTimer) (running bool, retransmit bool) {
+	slot, _, maxRetryTimes := ue.nasTimer(t.Name)
+	if slot == nil || *slot != t {
+		return false, false
+	}
+	t.ExpireTimes++
+	if t.ExpireTimes > maxRetryTimes {
+		*slot = nil
+		return true, false
+	}
+	return true, true
+}
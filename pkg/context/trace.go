@@ -0,0 +1,34 @@
+package context
+
+import (
+	"encoding/hex"
+	"net"
+
+	"free5gc/lib/aper"
+)
+
+// Interfaces to trace, from the most significant bit of the Interfaces To Trace bitmap
+//
+// TS 38.413 9.3.1.15 Interfaces to Trace
+const (
+	TraceInterfaceNGC uint8 = 0x80
+	TraceInterfaceXnC uint8 = 0x40
+	TraceInterfaceUu  uint8 = 0x20
+	TraceInterfaceF1C uint8 = 0x10
+	TraceInterfaceE1  uint8 = 0x08
+)
+
+// TraceSettings are the parameters of a subscriber and equipment trace session activated in the AGF for a UE
+//
+// TS 38.413 9.3.1.14 Trace Activation, TS 32.422 4.1.2 Trace Session activation
+type TraceSettings struct {
+	TraceID           []byte          // NG-RAN Trace ID, Trace ID of 6 octets followed by the Trace Recording Session Reference
+	InterfacesToTrace uint8           // TraceInterface bitmap
+	Depth             aper.Enumerated // ngapType.TraceDepthPresent value
+	CollectionEntity  net.IP          // Trace Collection Entity IP Address
+}
+
+// TraceIDString returns the NG-RAN Trace ID in hex
+func (t *TraceSettings) TraceIDString() string {
+	return hex.EncodeToString(t.TraceID)
+}
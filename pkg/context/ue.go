@@ -2,21 +2,28 @@ package context
 
 import (
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"math"
 	"net"
+	"strings"
+	"sync"
 	"time"
 
 	"free5gc/lib/aper"
 	"free5gc/lib/fsm"
 	"free5gc/lib/nas"
+	"free5gc/lib/nas/nasConvert"
 	"free5gc/lib/nas/nasMessage"
 	"free5gc/lib/nas/nasType"
 	"free5gc/lib/nas/security"
 	"free5gc/lib/ngap/ngapType"
 	"free5gc/lib/openapi/models"
 
+	"sim-amf/pkg/pcap"
 	"sim-amf/pkg/types"
+
+	"gitlab.casa-systems.com/opensource/sctp"
 )
 
 const (
@@ -29,6 +36,10 @@ const (
 	MaxDeregistrationRetryTime int = 4
 	MaxT3580RetryTimes         int = 5
 	MaxT3582RetryTimes         int = 5
+	MaxT3522RetryTimes         int = 4
+	MaxT3550RetryTimes         int = 4
+	MaxT3560RetryTimes         int = 4
+	MaxT3570RetryTimes         int = 4
 	// DefaultT3502Value int = 2
 	DefaultT3502Value int = 12 * 60 // Default 12 minutes
 	DefaultT3510Value int = 15
@@ -45,6 +56,11 @@ const (
 	DefaultT3580Value                      int = 16
 	DefaultT3582Value                      int = 16
 	DefaultNon3GppDeregistrationTimerValue int = 54 * 60
+	DefaultT3512Value                      int = 54 * 60
+	DefaultT3522Value                      int = 6
+	DefaultT3550Value                      int = 6
+	DefaultT3560Value                      int = 6
+	DefaultT3570Value                      int = 6
 )
 
 type UEContext struct {
@@ -52,9 +68,24 @@ type UEContext struct {
 
 	CurrentAMF  *AMFContext
 	PreviousAMF *AMFContext
+	AGF         *AGFContext
+	TNLA        *sctp.SCTPConn // TNL association of the AGF the UE is bound to, the first one of the AGF if nil
+	Shard       uint32         // key of the dispatcher shard the jobs of the UE run on, fixed on creation
+	Capture     *pcap.Writer // per UE capture, nil if disabled
+	Trace       *TraceSettings // trace session activated in the AGF, nil if none
+
+	ContextModification *UEContextModification // UE Context Modification Request awaiting its response, nil if none
+	UserLocations       []UserLocation         // line identities reported by the W-AGF, oldest first
+
+	// pduSessionMu guards the PDU session maps, read by the control API and the metrics outside of the UE dispatcher
+	pduSessionMu sync.RWMutex
+
+	// identityKeys are the keys the UE is indexed with in the UEContextIdentity of AMFSelf
+	identityKeys []string
 
 	Restoring                     bool
-	SM                            map[types.RGType]*fsm.FSM
+	SM                            map[types.RGType]*fsm.FSM // 5GMM state machine per RG type
+	CM                            *fsm.FSM
 	BinarySemaphoreDeregistration chan struct{}
 	Timers
 }
@@ -74,6 +105,7 @@ type UEBasic struct {
 	GlobalIDSUPI         string
 	CircuitID            string
 	RemoteID             string
+	HFCNodeID            aper.OctetString // TS 38.413 9.3.1.16, of a cable line
 	WAgfInfo             types.WAgfInfo
 	GtpBindAddr          string
 
@@ -107,15 +139,25 @@ type UEBasic struct {
 	KnasInt                  [16]uint8 // 16 byte
 	KnasEnc                  [16]uint8 // 16 byte
 	Kwagf                    []uint8   // 32 bytes
+	Kamf                     []uint8   // 32 bytes, 5G-RG only
+	ABBA                     []uint8
+	Rand                     []uint8 // RAND of the ongoing 5G AKA
+	XresStar                 []uint8
+	Kseaf                    []uint8
+	SynchFailures            int // Authentication Failures #21 of the ongoing 5G AKA
 	SecurityContextAvailable bool
 	SecurityCapabilities     *ngapType.UESecurityCapabilities // TS 38.413 9.3.1.86
 	NasUESecurityCapability  *nasType.UESecurityCapability    // for registration request
 	CipheringAlg             uint8
 	IntegrityAlg             uint8
 	SecurityHeaderType       uint8
+	PreviousSecurityContext  *NASSecurityContext // restored if the UE rejects the Security Mode Command of a rekeying
+	HorizontalDerivation     bool                // K'AMF of the ongoing Security Mode Command derived horizontally, HDP
 
 	// From RG
 	RegistrationType uint8
+	FollowOnRequest  uint8    // follow-on request pending, the NG connection is kept after a registration update
+	UplinkDataStatus [16]bool // PDU sessions of which the user plane is to be re-established, by PSI
 	SupiType         uint8
 	IdentityType     uint8
 	Nai              string
@@ -132,13 +174,19 @@ type UEBasic struct {
 	TMSI5G              [4]uint8
 	IndexToRfsp         int64
 	Ambr                *ngapType.UEAggregateMaximumBitRate
+	Subscriber          *Subscriber
 	RequestedNssai      []models.Snssai
+	SubscribedNssai     []models.SubscribedSnssai
 	AllowedNssai        []models.Snssai
 	RejectedNssaiInPlmn []models.Snssai
 	RejectedNssaiInTai  []models.Snssai
 	ConfiguredNssai     []models.Snssai
 	TAIList             []models.Tai
 
+	PduSessionReactivationResult [16]bool // PDU sessions of which the user plane could not be re-established, by PSI
+
+	RegistrationStartTime time.Time // Initial UE Message, for the registration latency
+
 	RadioCapability                  *ngapType.UERadioCapability                // TODO: This is for RRC, can be deleted
 	CoreNetworkAssistanceInformation *ngapType.CoreNetworkAssistanceInformation // TS 38.413 9.3.1.15
 	IMSVoiceSupported                uint8
@@ -151,6 +199,7 @@ type UEBasic struct {
 	T3525Value                      int
 	T3540Value                      int
 	Non3GppDeregistrationTimerValue int
+	T3512Value                      int // periodic registration update, sent in the Registration Accept
 
 	T3502RetryTimes                      int
 	T3510RetryTimes                      int
@@ -188,6 +237,17 @@ type UEBasic struct {
 	MaxT3583RetryTimes int
 	// MaxT3584RetryTimes int
 	// MaxT3585RetryTimes int
+
+	// network side 5GMM timers
+	T3522Value int
+	T3550Value int
+	T3560Value int
+	T3570Value int
+
+	MaxT3522RetryTimes int
+	MaxT3550RetryTimes int
+	MaxT3560RetryTimes int
+	MaxT3570RetryTimes int
 }
 
 type Timers struct {
@@ -208,6 +268,12 @@ type Timers struct {
 	T3583 *time.Timer
 	//T3584 *time.Timer
 	//T3585 *time.Timer
+
+	// 5GS Mobility Management Messages, network side
+	T3522 *NASTimer
+	T3550 *NASTimer
+	T3560 *NASTimer
+	T3570 *NASTimer
 }
 
 // Constants definition of State and Cause
@@ -244,6 +310,7 @@ type PDUSession struct {
 	Type                             *ngapType.PDUSessionType
 	Ambr                             *ngapType.PDUSessionAggregateMaximumBitRate
 	Snssai                           ngapType.SNSSAI
+	Dnn                              string
 	NetworkInstance                  *ngapType.NetworkInstance
 	SecurityCipher                   bool
 	SecurityIntegrity                bool
@@ -252,6 +319,27 @@ type PDUSession struct {
 	GTPConnection                    *GTPConnectionInfo
 	QFIList                          []uint8
 	QosFlows                         map[int64]*QosFlow // QosFlowIdentifier as key
+	SetupStartTime                   time.Time          // PDU Session Resource Setup Request, for the setup latency
+	Policy                           *DNN               // session policy of the DNN, nil if the DNNs are not configured
+	PDUSessionType                   uint8              // PDU session type selected by the policy
+	SSCMode                          uint8              // SSC mode selected by the policy
+	Cause5GSM                        uint8              // 5GSM cause of the selected PDU session type, e.g. #50, or 0
+	IPv4Address                      net.IP             // allocated from the IPv4 pool of the policy, nil if none
+	IPv6Address                      net.IP             // allocated from the IPv6 pool of the policy, nil if none
+}
+
+// ReleaseAddresses returns the addresses of the PDU session to the pools of its DNN
+func (pduSession *PDUSession) ReleaseAddresses() {
+	if pduSession.Policy == nil {
+		return
+	}
+	if pduSession.Policy.IPv4Pool != nil {
+		pduSession.Policy.IPv4Pool.Release(pduSession.IPv4Address)
+	}
+	if pduSession.Policy.IPv6Pool != nil {
+		pduSession.Policy.IPv6Pool.Release(pduSession.IPv6Address)
+	}
+	pduSession.IPv4Address, pduSession.IPv6Address = nil, nil
 }
 
 type PDUSessionSetupTemporaryData struct {
@@ -305,7 +393,7 @@ func (ue *UEContext) Init() {
 	for pduSessionID = 1; pduSessionID < 16; pduSessionID++ {
 		ue.PduSessionIDList[pduSessionID] = false
 	}
-	ue.SM = make(map[types.RGType]*fsm.FSM)
+	ue.InitStateMachine()
 
 	ue.RegistrationType = nasMessage.RegistrationType5GSInitialRegistration
 
@@ -329,8 +417,17 @@ func (ue *UEContext) InitTimers() {
 	ue.MaxServiceAttemptTime = MaxServiceAttemptTime
 	ue.MaxDeregistrationRetryTime = MaxDeregistrationRetryTime
 	ue.Non3GppDeregistrationTimerValue = DefaultNon3GppDeregistrationTimerValue
+	ue.T3512Value = DefaultT3512Value
 	ue.MaxT3580RetryTimes = MaxT3580RetryTimes
 	ue.MaxT3582RetryTimes = MaxT3582RetryTimes
+	ue.T3522Value = DefaultT3522Value
+	ue.T3550Value = DefaultT3550Value
+	ue.T3560Value = DefaultT3560Value
+	ue.T3570Value = DefaultT3570Value
+	ue.MaxT3522RetryTimes = MaxT3522RetryTimes
+	ue.MaxT3550RetryTimes = MaxT3550RetryTimes
+	ue.MaxT3560RetryTimes = MaxT3560RetryTimes
+	ue.MaxT3570RetryTimes = MaxT3570RetryTimes
 }
 
 // 24.501 9.11.3.4
@@ -354,7 +451,18 @@ func (ue *UEContext) InitMobileIdentity() {
 	   - 010: GCI
 	   - 011: GLI <===
 	*/
-	if len(ue.LineID) != 0 {
+	if ue.LineType == types.LineType_CABLE && ue.GlobalIDStr != "" {
+		// SUPI:type3.rid0.schid0.userid<GCI>@5gc.mnc<MNC>.mcc<MCC>.3gppnetwork.org
+		ue.SupiType = nasMessage.SupiFormatGCI                 // 0x02
+		ue.IdentityType = nasMessage.MobileIdentity5GSTypeSuci // 0x01
+		realm := "5gc.mnc" + "123" + ".mcc" + "123" + ".3gppnetwork.org"
+		ue.Nai = fmt.Sprintf("type3.rid0.schid0.userid%s@%s", ue.GlobalIDStr, realm)
+
+		mobileIdentity5GSContents = append(mobileIdentity5GSContents, 0x21)
+		mobileIdentity5GSContents = AppendStringToNgap(mobileIdentity5GSContents, ue.Nai)
+		mobileIdentity.SetLen(uint16(len(mobileIdentity5GSContents)))
+		mobileIdentity.SetMobileIdentity5GSContents(mobileIdentity5GSContents)
+	} else if len(ue.LineID) != 0 {
 		//8	7	6	5	4	3	2	1
 		//	5GS mobile identity IEI					octet 1
 		//	Length of contents  					octet 2
@@ -464,17 +572,29 @@ func (ue *UEContext) InitNasSecurityCapability() {
 }*/
 
 func (ue *UEContext) Remove() {
+	ue.StopNASTimers()
 	// remove from AMF context
 	ue.DetachAMF()
+	ue.unindexIdentities()
+	// remove from AGF context
+	ue.DetachAGF()
+
+	if ue.Capture != nil {
+		ue.Capture.Close()
+		ue.Capture = nil
+	}
 
 	// cleanup PDU session
+	ue.pduSessionMu.Lock()
+	defer ue.pduSessionMu.Unlock()
 	for _, pduSession := range ue.PduSessionList {
 		if pduSession != nil {
 			ue.PduSessionIDList[pduSession.Id] = false
+			pduSession.ReleaseAddresses()
 
 			//AGFSelf.DeleteTEID(pduSession.GTPConnection.IncomingTEID)
 			delete(ue.PduSessionList, pduSession.Id)
-			ue.DeleteAuthorizedQosRule(pduSession.Id)
+			delete(ue.AuthorizedQosRulesList, pduSession.Id)
 
 			//IncSessionDeleted()
 			//ue.Stats.IncSessionDeleted(pduSession)
@@ -488,6 +608,9 @@ func (ue *UEContext) Remove() {
 }
 
 func (ue *UEContext) NewPDUSessionID() int64 {
+	ue.pduSessionMu.RLock()
+	defer ue.pduSessionMu.RUnlock()
+
 	var pduSessionID int64
 	for pduSessionID = 1; pduSessionID < 16; pduSessionID++ {
 		if active, ok := ue.PduSessionIDList[pduSessionID]; ok {
@@ -500,6 +623,9 @@ func (ue *UEContext) NewPDUSessionID() int64 {
 }
 
 func (ue *UEContext) FindPDUSession(pduSessionID int64) *PDUSession {
+	ue.pduSessionMu.RLock()
+	defer ue.pduSessionMu.RUnlock()
+
 	if pduSession, ok := ue.PduSessionList[pduSessionID]; ok {
 		return pduSession
 	} else {
@@ -508,6 +634,9 @@ func (ue *UEContext) FindPDUSession(pduSessionID int64) *PDUSession {
 }
 
 func (ue *UEContext) CreatePDUSession(pduSessionID int64, snssai ngapType.SNSSAI) (*PDUSession, error) {
+	ue.pduSessionMu.Lock()
+	defer ue.pduSessionMu.Unlock()
+
 	if _, exists := ue.PduSessionList[pduSessionID]; exists {
 		return nil, fmt.Errorf("PDU Session[ID:%d] already exists", pduSessionID)
 	}
@@ -527,14 +656,18 @@ func (ue *UEContext) CreatePDUSession(pduSessionID int64, snssai ngapType.SNSSAI
 }
 
 func (ue *UEContext) DeletePDUSession(pduSessionID int64) error {
-	if value := ue.LoadPduSessionIDList(uint8(pduSessionID)); value {
+	ue.pduSessionMu.Lock()
+	defer ue.pduSessionMu.Unlock()
+
+	if value := ue.PduSessionIDList[pduSessionID]; value {
 		ue.PduSessionIDList[pduSessionID] = false
 
-		if pduSession := ue.FindPDUSession(pduSessionID); pduSession != nil {
+		if pduSession := ue.PduSessionList[pduSessionID]; pduSession != nil {
 			//AGFSelf.DeleteTEID(pduSession.GTPConnection.IncomingTEID)
-			ue.StorePDUSessionExtendedStateCause(pduSessionID, PDUSessionStateReleased, "")
+			ue.storePDUSessionExtendedStateCause(pduSessionID, PDUSessionStateReleased, "")
+			pduSession.ReleaseAddresses()
 			delete(ue.PduSessionList, pduSessionID)
-			ue.DeleteAuthorizedQosRule(pduSessionID)
+			delete(ue.AuthorizedQosRulesList, pduSessionID)
 
 			//IncSessionDeleted()
 			//ue.Stats.IncSessionDeleted(pduSession)
@@ -573,13 +706,19 @@ func (ue *UEContext) Establishment() bool {
 // pduSessionID, or nil if no pduSessionExtended is present. The ok result indicates
 // whether pduSessionExtended was found in the map.
 func (ue *UEContext) LoadPduSessionExtended(pduSessionID int64) (pduSessionExtended *PDUSessionExtended, ok bool) {
+	ue.pduSessionMu.RLock()
+	defer ue.pduSessionMu.RUnlock()
+
 	pduSessionExtended, ok = ue.PduSessionExtendedList[pduSessionID]
 	return
 }
 
 // StorePDUSessionExtendedType sets the pduSessionType for a pduSessionID
 func (ue *UEContext) StorePDUSessionExtendedType(pduSessionID int64, pduSessionType string) {
-	if pduSessionExtended, ok := ue.LoadPduSessionExtended(pduSessionID); ok {
+	ue.pduSessionMu.Lock()
+	defer ue.pduSessionMu.Unlock()
+
+	if pduSessionExtended, ok := ue.PduSessionExtendedList[pduSessionID]; ok {
 		pduSessionExtended.Type = pduSessionType
 	} else {
 		ue.PduSessionExtendedList[pduSessionID] = &PDUSessionExtended{Type: pduSessionType}
@@ -588,7 +727,14 @@ func (ue *UEContext) StorePDUSessionExtendedType(pduSessionID int64, pduSessionT
 
 // StorePDUSessionExtendedStateCause sets the pduSessionState and pduSessionCause for a pduSessionID
 func (ue *UEContext) StorePDUSessionExtendedStateCause(pduSessionID int64, pduSessionState string, pduSessionCause string) {
-	if pduSessionExtended, ok := ue.LoadPduSessionExtended(pduSessionID); ok {
+	ue.pduSessionMu.Lock()
+	defer ue.pduSessionMu.Unlock()
+
+	ue.storePDUSessionExtendedStateCause(pduSessionID, pduSessionState, pduSessionCause)
+}
+
+func (ue *UEContext) storePDUSessionExtendedStateCause(pduSessionID int64, pduSessionState string, pduSessionCause string) {
+	if pduSessionExtended, ok := ue.PduSessionExtendedList[pduSessionID]; ok {
 		pduSessionExtended.State = pduSessionState
 		pduSessionExtended.Cause = pduSessionCause
 	} else {
@@ -629,6 +775,9 @@ func (ue *UEContext) DisableIntegrityProtection() {
 }
 
 func (ue *UEContext) LoadPduSessionIDList(pduSessionID uint8) bool {
+	ue.pduSessionMu.RLock()
+	defer ue.pduSessionMu.RUnlock()
+
 	if value, ok := ue.PduSessionIDList[int64(pduSessionID)]; ok {
 		return value
 	}
@@ -643,6 +792,7 @@ func (ue *UEContext) RGAttach(rgCtx *types.RGContext) {
 	ue.RemoteID = rgCtx.RemoteID
 	ue.WAgfInfo = rgCtx.WAgfInfo
 	ue.LineType = rgCtx.LineType
+	ue.HFCNodeID, _ = hex.DecodeString(rgCtx.HFCNodeID)
 	ue.AutoCreatePDUSession = rgCtx.CreatePDUSession
 	ue.EstablishingPduSessionType = rgCtx.PDUSessionType
 	ue.MacUnique = rgCtx.MacUnique
@@ -651,6 +801,110 @@ func (ue *UEContext) RGAttach(rgCtx *types.RGContext) {
 	ue.InitTimers()
 	ue.InitMobileIdentity()
 	//ue.InitRequestedSliceInfo()
+	ue.IndexIdentities()
+}
+
+// UpdateMobileIdentity stores the 5GS mobile identity carried in the Registration Request
+//
+// TS 24.501 9.11.3.4 5GS mobile identity
+func (ue *UEContext) UpdateMobileIdentity(mobileIdentity nasType.MobileIdentity5GS) {
+	contents := mobileIdentity.GetMobileIdentity5GSContents()
+	if len(contents) == 0 {
+		return
+	}
+
+	ue.MobileIdentity = &mobileIdentity
+	ue.IdentityType = contents[0] & 0x07
+	switch ue.IdentityType {
+	case nasMessage.MobileIdentity5GSTypeSuci:
+		ue.SupiType = (contents[0] & 0x70) >> 4
+		if ue.SupiType != nasMessage.SupiFormatImsi {
+			ue.Nai = string(contents[1:])
+			ue.Suci = ue.Nai
+			if ue.SupiType == nasMessage.SupiFormatGCI {
+				// the GCI is the username of the NAI, type3.rid<RID>.schid0.userid<GCI>@<realm>
+				if i, j := strings.Index(ue.Nai, ".userid"), strings.LastIndex(ue.Nai, "@"); i >= 0 && j > i {
+					ue.GlobalIDStr = ue.Nai[i+len(".userid") : j]
+					ue.GlobalIDSUPI = ue.GlobalIDStr
+					ue.LineType = types.LineType_CABLE
+				}
+			}
+		} else if len(contents) >= 9 {
+			ue.Suci, _ = nasConvert.SuciToString(contents)
+		}
+	case nasMessage.MobileIdentity5GSTypeMacAddress:
+		if len(contents) >= 7 {
+			ue.MAC = net.HardwareAddr(contents[1:7]).String()
+		}
+	}
+	ue.IndexIdentities()
+}
+
+// UpdateUserLocationInformation stores the Global Line ID, or the HFC node ID of a cable line, reported by the W-AGF
+//
+// TS 38.413 9.3.1.16 User Location Information
+func (ue *UEContext) UpdateUserLocationInformation(userLocationInformation *ngapType.UserLocationInformation) {
+	location, ok := UserLocationFromNgap(userLocationInformation)
+	if !ok {
+		return
+	}
+	if location.HFCNodeID != nil {
+		ue.HFCNodeID = location.HFCNodeID
+		ue.LineType = location.LineType
+		ue.IndexIdentities()
+		return
+	}
+
+	ue.GlobalID = location.GlobalLineID
+	ue.GlobalIDStr = string(location.GlobalLineID)
+	if location.LineType != "" {
+		ue.LineType = location.LineType
+	}
+	ue.IndexIdentities()
+}
+
+// Prefixes of the identity keys of the UEs in the UEContextIdentity
+const (
+	IdentityMAC           = "mac"
+	IdentityGlobalLineID  = "gli"
+	IdentityGlobalCableID = "gci"
+)
+
+// IdentityKey returns the key of an identity of a UE in the UEContextIdentity, e.g. mac:00:11:22:33:44:55
+func IdentityKey(prefix string, identity string) string {
+	return prefix + ":" + identity
+}
+
+// IndexIdentities indexes the UE with its MAC address, and its Global Line ID or Global Cable ID depending on its line
+// type, in the UEContextIdentity of AMFSelf, so that the control API resolves it without reading its identities out of
+// its shard. It is called on the shard of the UE whenever its identities change.
+func (ue *UEContext) IndexIdentities() {
+	var keys []string
+	if ue.MAC != "" {
+		keys = append(keys, IdentityKey(IdentityMAC, ue.MAC))
+	}
+	if ue.GlobalIDStr != "" {
+		if ue.LineType == types.LineType_CABLE {
+			keys = append(keys, IdentityKey(IdentityGlobalCableID, ue.GlobalIDStr))
+		} else {
+			keys = append(keys, IdentityKey(IdentityGlobalLineID, ue.GlobalIDStr))
+		}
+	}
+	ue.unindexIdentities()
+	for _, key := range keys {
+		AMFSelf.UEContextIdentity.Store(key, ue)
+	}
+	ue.identityKeys = keys
+}
+
+// unindexIdentities removes the UE from the UEContextIdentity of AMFSelf, leaving the keys another UE took over
+func (ue *UEContext) unindexIdentities() {
+	for _, key := range ue.identityKeys {
+		if value, ok := AMFSelf.UEContextIdentity.Load(key); ok && value == ue {
+			AMFSelf.UEContextIdentity.Delete(key)
+		}
+	}
+	ue.identityKeys = nil
 }
 
 /*func (ue *UEContext) AttachAnyAMF() bool {
@@ -693,6 +947,94 @@ func (ue *UEContext) DetachAMF() {
 	}
 
 	ue.CurrentAMF.DeleteUEContextAMFUENGAPID(ue.AmfUeNgapId)
+	if value, ok := ue.CurrentAMF.LoadUEContextGUTI(ue.Guti); ok && value == ue {
+		ue.CurrentAMF.DeleteUEContextGUTI(ue.Guti)
+	}
+}
+
+func (ue *UEContext) AttachAGF(agf *AGFContext) {
+	if ue.AGF != agf {
+		ue.DetachAGF()
+	}
+
+	ue.AGF = agf
+	agf.StoreUEContextRANUENGAPID(ue)
+}
+
+func (ue *UEContext) DetachAGF() {
+	if ue.AGF == nil {
+		return
+	}
+
+	if value, ok := ue.AGF.LoadUEContextRANUENGAPID(ue.RanUeNgapId); ok && value == ue {
+		ue.AGF.DeleteUEContextRANUENGAPID(ue.RanUeNgapId)
+	}
+	ue.AGF = nil
+	ue.TNLA = nil
+}
+
+// SCTPConn returns the TNL association the UE-associated NGAP messages of the UE are sent on
+//
+// TS 38.412 7 Transport layer, UE-TNLA-binding
+func (ue *UEContext) SCTPConn() *sctp.SCTPConn {
+	if ue.TNLA != nil {
+		return ue.TNLA
+	}
+	return ue.AGF.SCTPConn
+}
+
+// ReleaseNGConnection ends the UE-associated NG connection of a registered UE entering CM-IDLE. The UE context,
+// with its NAS security context and PDU sessions, is kept to be resolved by its 5G-GUTI on its next registration.
+func (ue *UEContext) ReleaseNGConnection() {
+	ue.StopNASTimers()
+	ue.DetachAGF()
+	ue.AGF = nil
+	ue.RanUeNgapId = RanUeNgapIdUnspecified
+	// the trace session ends with the UE context of the AGF
+	ue.Trace = nil
+	ue.ContextModification = nil
+	// the UE keeps the NAS security context of a rekeying it did not complete
+	ue.RestorePreviousSecurityContext()
+
+	if ue.Capture != nil {
+		ue.Capture.Close()
+		ue.Capture = nil
+	}
+}
+
+// ResumeNGConnection binds the UE-associated NG connection of conn, the UE context created on the Initial UE Message
+// before the UE was resolved by its 5G-GUTI, to the registered UE. conn is discarded.
+//
+// TS 23.502 4.2.2.2.2 General Registration
+func (ue *UEContext) ResumeNGConnection(conn *UEContext) {
+	ue.StopNASTimers()
+	ue.DetachAGF()
+	ue.Trace = nil
+	ue.ContextModification = nil
+	if ue.CurrentAMF != nil {
+		ue.CurrentAMF.DeleteUEContextAMFUENGAPID(ue.AmfUeNgapId)
+	}
+	if ue.Capture != nil {
+		ue.Capture.Close()
+	}
+	ue.Capture, conn.Capture = conn.Capture, nil
+
+	if ue.CurrentAMF != nil && ue.CurrentAMF != conn.CurrentAMF {
+		// the UE moved to another AMF of the set, advertised as Old AMF to the AGF
+		ue.PreviousAMFIndex = ue.CurrentAMFIndex
+		ue.PreviousAMF = ue.CurrentAMF
+	}
+	ue.AmfUeNgapId = conn.AmfUeNgapId
+	ue.RanUeNgapId = conn.RanUeNgapId
+	ue.AttachAMF(conn.CurrentAMF)
+	ue.CurrentAMF.StoreUEContextAMFUENGAPID(ue)
+	ue.AttachAGF(conn.AGF)
+	ue.TNLA = conn.TNLA
+
+	// the NG connection context is dropped, its NGAP IDs now addressing the UE
+	conn.StopNASTimers()
+	conn.unindexIdentities()
+	conn.CurrentAMF, conn.AGF, conn.TNLA = nil, nil, nil
 }
 
 func (ue *UEContext) ChangeSmState(subsequentState fsm.State) error {
@@ -723,6 +1065,9 @@ func (ue *UEContext) RGTypeStr() string {
 }*/
 
 func (ue *UEContext) GetPDUSessionStatus() *[16]bool {
+	ue.pduSessionMu.RLock()
+	defer ue.pduSessionMu.RUnlock()
+
 	var pduSessionStatus *[16]bool
 	pduSessionStatus = new([16]bool)
 	for psi := 1; psi <= 15; psi++ {
@@ -733,15 +1078,32 @@ func (ue *UEContext) GetPDUSessionStatus() *[16]bool {
 	return pduSessionStatus
 }
 
+// CountPDUSession returns the number of PDU sessions of the UE
+func (ue *UEContext) CountPDUSession() int {
+	ue.pduSessionMu.RLock()
+	defer ue.pduSessionMu.RUnlock()
+
+	return len(ue.PduSessionList)
+}
+
 func (ue *UEContext) StoreAuthorizedQosRule(pduSessionID int64, authorizedQosRule types.AuthorizedQosRules) {
+	ue.pduSessionMu.Lock()
+	defer ue.pduSessionMu.Unlock()
+
 	ue.AuthorizedQosRulesList[pduSessionID] = authorizedQosRule
 }
 
 func (ue *UEContext) LoadAuthorizedQosRule(pduSessionID int64) types.AuthorizedQosRules {
+	ue.pduSessionMu.RLock()
+	defer ue.pduSessionMu.RUnlock()
+
 	return ue.AuthorizedQosRulesList[pduSessionID]
 }
 
 func (ue *UEContext) DeleteAuthorizedQosRule(pduSessionID int64) {
+	ue.pduSessionMu.Lock()
+	defer ue.pduSessionMu.Unlock()
+
 	delete(ue.AuthorizedQosRulesList, pduSessionID)
 }
 
@@ -786,6 +1148,14 @@ func AppendNgapByte(x []byte, y []byte) []byte {
 	return x
 }
 
+// InitGlobalCableID initializes the GCI, GCIStr and GCISUPI of a cable line. Unlike the GLI, the GCI is used as is as
+// the username of the SUCI and SUPI in NAI format.
+//
+// TS 23.003 28.15.4 Global Cable Identifier (GCI)
+func InitGlobalCableID(srcCableID string) (aper.OctetString, string, string) {
+	return StringToNgap(srcCableID), srcCableID, srcCableID
+}
+
 // InitGlobalLineID initializes the LineID, GLI, GLIStr and GLISUPI according to the CircuitID and RemoteID
 //
 // - Global Line Identifier
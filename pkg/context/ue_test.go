@@ -0,0 +1,45 @@
+package context
+
+import (
+	"testing"
+
+	"sim-amf/pkg/types"
+)
+
+func TestIndexIdentities(t *testing.T) {
+	ResetAMFSet()
+	defer ResetAMFSet()
+	lookup := func(prefix string, identity string) *UEContext {
+		ue, _ := LoadSetUEContextIdentity(IdentityKey(prefix, identity))
+		return ue
+	}
+
+	ue := new(UEContext)
+	ue.MAC, ue.GlobalIDStr, ue.LineType = "00:11:22:33:44:55", "line-1", types.LineType_DSL
+	ue.IndexIdentities()
+	if lookup(IdentityMAC, ue.MAC) != ue || lookup(IdentityGlobalLineID, "line-1") != ue {
+		t.Fatalf("UE not indexed by its MAC address and Global Line ID")
+	}
+
+	// the UE moves to a cable line
+	ue.GlobalIDStr, ue.LineType = "cable-1", types.LineType_CABLE
+	ue.IndexIdentities()
+	if lookup(IdentityGlobalLineID, "line-1") != nil {
+		t.Errorf("UE still indexed by its previous Global Line ID")
+	}
+	if lookup(IdentityGlobalCableID, "cable-1") != ue {
+		t.Errorf("UE not indexed by its Global Cable ID")
+	}
+
+	// another UE takes over the MAC address, kept in the index once the first UE is removed
+	other := new(UEContext)
+	other.MAC = ue.MAC
+	other.IndexIdentities()
+	ue.Remove()
+	if got := lookup(IdentityMAC, ue.MAC); got != other {
+		t.Errorf("MAC address indexed to %p after the removal of the previous UE, want %p", got, other)
+	}
+	if lookup(IdentityGlobalCableID, "cable-1") != nil {
+		t.Errorf("removed UE still indexed by its Global Cable ID")
+	}
+}
@@ -0,0 +1,89 @@
+// Package event publishes the outcomes of the UE procedures, e.g. a UE registered, a PDU session established or a NAS
+// message retransmitted on a timer expiry, to the subscribers such as the control API or the tests embedding sim-amf.
+package event
+
+import (
+	"sync"
+	"time"
+
+	"sim-amf/pkg/context"
+)
+
+// Type of an event
+type Type string
+
+const (
+	NASTimerExpired                 Type = "nas_timer_expired"                  // 5GMM timer expiry, the NAS message being retransmitted
+	ProcedureAborted                Type = "procedure_aborted"                  // 5GMM timer expiry after the maximum retransmissions
+	ReplayDivergence                Type = "replay_divergence"                  // AGF message differing from the recording being replayed
+	Registered                      Type = "registered"                         // Registration Complete received
+	RegistrationRejected            Type = "registration_rejected"              // Registration Reject sent
+	Deregistered                    Type = "deregistered"                       // UE-initiated or network-initiated de-registration completed
+	UEContextReleased               Type = "ue_context_released"                // UE-associated NG connection released
+	UEContextModified               Type = "ue_context_modified"                // UE Context Modification Response received, the modification applied
+	UEContextModificationFailed     Type = "ue_context_modification_failed"     // UE Context Modification Failure received
+	NASSecurityRekeyed              Type = "nas_security_rekeyed"               // Security Mode Complete of a rekeying received, the new NAS security context in use
+	NASSecurityRekeyingFailed       Type = "nas_security_rekeying_failed"       // Security Mode Command of a rekeying rejected or unanswered
+	PDUSessionEstablished           Type = "pdu_session_established"            // PDU session resources set up by the AGF
+	PDUSessionEstablishmentFailed   Type = "pdu_session_establishment_failed"   // PDU session resources the AGF failed to set up
+	PDUSessionEstablishmentRejected Type = "pdu_session_establishment_rejected" // PDU Session Establishment Reject sent, the 5GSM cause in the detail
+	PDUSessionReleased              Type = "pdu_session_released"               // PDU session resources released by the AGF
+	TraceFailure                    Type = "trace_failure"                      // Trace Failure Indication received
+	CellTrafficTrace                Type = "cell_traffic_trace"                 // Cell Traffic Trace received
+	LocationReport                  Type = "location_report"                    // Location Report received
+	LineIdentityChanged             Type = "line_identity_changed"              // line identity reported by the AGF differing from the previous one
+	LocationReportingFailure        Type = "location_reporting_failure"         // Location Reporting Failure Indication received
+	FaultInjected                   Type = "fault_injected"                     // fault injected in a message sent to or received from the AGF
+)
+
+// Event is an outcome of a procedure of a UE
+type Event struct {
+	Time         time.Time
+	Type         Type
+	AmfUeNgapId  int64
+	MAC          string
+	Timer        string // T3522, T3550, T3560 or T3570
+	ExpireTimes  int
+	Procedure    string // NAS message type name of the guarded message, e.g. security_mode_command
+	PDUSessionID int64
+	Detail       string // difference between the received and the recorded message, or cause of the outcome
+}
+
+var (
+	mu          sync.Mutex
+	subscribers = make(map[chan Event]struct{})
+)
+
+// Subscribe returns a channel receiving the events published from now on, and the function to unsubscribe. The events
+// are dropped while the channel buffer of size events is full.
+func Subscribe(size int) (<-chan Event, func()) {
+	ch := make(chan Event, size)
+	mu.Lock()
+	subscribers[ch] = struct{}{}
+	mu.Unlock()
+	return ch, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if _, ok := subscribers[ch]; ok {
+			delete(subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Publish sends an event of the UE to the subscribers
+func Publish(ue *context.UEContext, e Event) {
+	e.Time = time.Now()
+	if ue != nil {
+		e.AmfUeNgapId = ue.AmfUeNgapId
+		e.MAC = ue.MAC
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for ch := range subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
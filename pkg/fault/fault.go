@@ -0,0 +1,345 @@
+// Package fault injects faults in the NGAP and NAS messages exchanged with the AGFs, to exercise the robustness and the
+// retransmissions of the AGFs and of the UEs behind them: the messages of the selected procedures and UEs are delayed,
+// dropped, duplicated, reordered or corrupted, sent with wrong NGAP IDs, a bad NAS MAC or a wrong NAS sequence number.
+package fault
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"sim-amf/pkg/context"
+	"sim-amf/pkg/metrics"
+)
+
+// Actions of a fault rule
+const (
+	ActionDelay            string = "delay"                // message sent or handled after the delay
+	ActionDrop             string = "drop"                 // message neither sent nor handled
+	ActionDuplicate        string = "duplicate"            // message sent or handled twice
+	ActionReorder          string = "reorder"              // message held until the next one of the UE, at most the delay
+	ActionCorrupt          string = "corrupt"              // random bit of the NGAP message flipped
+	ActionWrongAMFUENGAPID string = "wrong_amf_ue_ngap_id" // AMF UE NGAP ID of the sent message unknown to the AGF
+	ActionWrongRANUENGAPID string = "wrong_ran_ue_ngap_id" // RAN UE NGAP ID of the sent message unknown to the AGF
+	ActionBadMAC           string = "bad_mac"              // NAS message sent with an invalid MAC
+	ActionWrongSQN         string = "wrong_sqn"            // NAS message sent with the NAS COUNT of the previous one, a replay
+)
+
+// DefaultHold is the longest a reordered message is held without delay
+const DefaultHold = time.Second
+
+// actions tells whether an action applies to the received messages
+var actions = map[string]bool{
+	ActionDelay:            true,
+	ActionDrop:             true,
+	ActionDuplicate:        true,
+	ActionReorder:          true,
+	ActionCorrupt:          true,
+	ActionWrongAMFUENGAPID: false,
+	ActionWrongRANUENGAPID: false,
+	ActionBadMAC:           false,
+	ActionWrongSQN:         false,
+}
+
+// Global is the fault injector of sim-amf, nil while sim-amf is stopped
+var Global *Injector
+
+// Rule injects a fault in the messages of the NGAP procedures or NAS message types named as in the metrics, e.g.
+// initial_context_setup or registration_accept, exchanged with the UEs with the AMF UE NGAP IDs or MAC addresses, with
+// a probability. No message name selects all the messages, no UE all the UEs and the non UE associated messages.
+type Rule struct {
+	ID          int64
+	Action      string
+	Direction   string        // sent or received, sent if empty
+	Messages    []string      // NGAP procedure or NAS message type names
+	UEs         []string      // AMF UE NGAP IDs or MAC addresses
+	Probability float64       // 0 to 1, 1 if zero
+	Delay       time.Duration // delay, or longest hold of a reordered message
+	Count       int64         // faults injected before the rule is removed, unlimited if zero
+	Injected    int64         // faults injected
+}
+
+// Faults are the faults drawn for a message
+type Faults struct {
+	Actions          []string // actions injected, for the logs
+	Drop             bool
+	Duplicate        bool
+	Reorder          bool
+	Corrupt          bool
+	WrongAMFUENGAPID bool
+	WrongRANUENGAPID bool
+	BadMAC           bool
+	WrongSQN         bool
+	Delay            time.Duration
+	Hold             time.Duration
+}
+
+// String returns the actions injected
+func (f *Faults) String() string {
+	return strings.Join(f.Actions, ", ")
+}
+
+// Injector draws the faults of the messages from its rules, it is safe for concurrent use. A nil Injector injects
+// nothing.
+type Injector struct {
+	mu     sync.Mutex
+	rules  []*Rule
+	nextID int64
+	random *rand.Rand
+}
+
+func NewInjector() *Injector {
+	return &Injector{nextID: 1, random: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// ParseRule parses a rule given as comma separated options, e.g.
+// action=drop,messages=registration_accept,ues=1,probability=0.5. The options without an equal sign continue the list
+// of the previous one.
+func ParseRule(s string) (Rule, error) {
+	var rule Rule
+	var key string
+	for _, option := range strings.Split(s, ",") {
+		value := option
+		if i := strings.Index(option, "="); i >= 0 {
+			key, value = option[:i], option[i+1:]
+		} else if key != "messages" && key != "ues" {
+			return rule, fmt.Errorf("invalid fault option %s, expecting <key>=<value>", option)
+		}
+		var err error
+		switch key {
+		case "action":
+			rule.Action = value
+		case "direction":
+			rule.Direction = value
+		case "messages":
+			rule.Messages = append(rule.Messages, value)
+		case "ues":
+			rule.UEs = append(rule.UEs, value)
+		case "probability":
+			rule.Probability, err = strconv.ParseFloat(value, 64)
+		case "delay":
+			rule.Delay, err = time.ParseDuration(value)
+		case "count":
+			rule.Count, err = strconv.ParseInt(value, 10, 64)
+		default:
+			return rule, fmt.Errorf("unknown fault option %s", key)
+		}
+		if err != nil {
+			return rule, fmt.Errorf("invalid fault option %s: %v", option, err)
+		}
+	}
+	return rule, nil
+}
+
+// Add validates the rule and adds it to the rules of the injector, returning it with its ID
+func (i *Injector) Add(rule Rule) (Rule, error) {
+	received, ok := actions[rule.Action]
+	if !ok {
+		return rule, fmt.Errorf("unknown fault action %s", rule.Action)
+	}
+	switch rule.Direction {
+	case "":
+		rule.Direction = metrics.DirectionSent
+	case metrics.DirectionSent:
+	case metrics.DirectionReceived:
+		if !received {
+			return rule, fmt.Errorf("fault action %s only applies to the sent messages", rule.Action)
+		}
+	default:
+		return rule, fmt.Errorf("invalid fault direction %s, expecting sent or received", rule.Direction)
+	}
+	if rule.Probability == 0 {
+		rule.Probability = 1
+	}
+	if rule.Probability < 0 || rule.Probability > 1 {
+		return rule, fmt.Errorf("invalid fault probability %g, expecting 0 to 1", rule.Probability)
+	}
+	if rule.Delay < 0 || (rule.Action == ActionDelay && rule.Delay == 0) {
+		return rule, fmt.Errorf("invalid fault delay %s", rule.Delay)
+	}
+	if rule.Count < 0 {
+		return rule, fmt.Errorf("invalid fault count %d", rule.Count)
+	}
+	ues := make([]string, 0, len(rule.UEs))
+	for _, ue := range rule.UEs {
+		ues = append(ues, strings.ToLower(ue))
+	}
+	rule.UEs, rule.Messages = ues, append([]string(nil), rule.Messages...)
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	rule.ID, rule.Injected = i.nextID, 0
+	i.nextID++
+	added := rule
+	i.rules = append(i.rules, &added)
+	return rule, nil
+}
+
+// Remove removes the rules with the IDs, or all the rules if none is given, and returns the number removed
+func (i *Injector) Remove(ids ...int64) int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if len(ids) == 0 {
+		n := len(i.rules)
+		i.rules = nil
+		return n
+	}
+	remove := make(map[int64]bool)
+	for _, id := range ids {
+		remove[id] = true
+	}
+	var rules []*Rule
+	for _, rule := range i.rules {
+		if !remove[rule.ID] {
+			rules = append(rules, rule)
+		}
+	}
+	n := len(i.rules) - len(rules)
+	i.rules = rules
+	return n
+}
+
+// Rules returns a copy of the rules of the injector, by ID
+func (i *Injector) Rules() []Rule {
+	if i == nil {
+		return nil
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	rules := make([]Rule, 0, len(i.rules))
+	for _, rule := range i.rules {
+		r := *rule
+		r.Messages = append([]string(nil), rule.Messages...)
+		r.UEs = append([]string(nil), rule.UEs...)
+		rules = append(rules, r)
+	}
+	sort.Slice(rules, func(a, b int) bool { return rules[a].ID < rules[b].ID })
+	return rules
+}
+
+// Active tells whether a rule applies to the messages of the direction, sparing the decoding of the messages otherwise
+func (i *Injector) Active(direction string) bool {
+	if i == nil {
+		return false
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, rule := range i.rules {
+		if rule.Direction == direction {
+			return true
+		}
+	}
+	return false
+}
+
+// NGAP draws the faults of an NGAP message of the UE, nil for a non UE associated message, the names being the ones of
+// its procedure and of the NAS messages it carries
+func (i *Injector) NGAP(direction string, ue *context.UEContext, names []string) Faults {
+	return i.draw(direction, ue, names, false)
+}
+
+// NAS draws the faults of the security protection of a NAS message sent to the UE
+func (i *Injector) NAS(ue *context.UEContext, names []string) Faults {
+	return i.draw(metrics.DirectionSent, ue, names, true)
+}
+
+func (i *Injector) draw(direction string, ue *context.UEContext, names []string, nas bool) Faults {
+	var faults Faults
+	if i == nil {
+		return faults
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	expired := false
+	for _, rule := range i.rules {
+		if rule.Direction != direction || (rule.Action == ActionBadMAC || rule.Action == ActionWrongSQN) != nas ||
+			!rule.matches(ue, names) || i.random.Float64() >= rule.Probability {
+			continue
+		}
+		switch rule.Action {
+		case ActionDelay:
+			if rule.Delay > faults.Delay {
+				faults.Delay = rule.Delay
+			}
+		case ActionDrop:
+			faults.Drop = true
+		case ActionDuplicate:
+			faults.Duplicate = true
+		case ActionReorder:
+			faults.Reorder = true
+			hold := rule.Delay
+			if hold == 0 {
+				hold = DefaultHold
+			}
+			if hold > faults.Hold {
+				faults.Hold = hold
+			}
+		case ActionCorrupt:
+			faults.Corrupt = true
+		case ActionWrongAMFUENGAPID:
+			faults.WrongAMFUENGAPID = true
+		case ActionWrongRANUENGAPID:
+			faults.WrongRANUENGAPID = true
+		case ActionBadMAC:
+			faults.BadMAC = true
+		case ActionWrongSQN:
+			faults.WrongSQN = true
+		}
+		faults.Actions = append(faults.Actions, rule.Action)
+		rule.Injected++
+		expired = expired || (rule.Count > 0 && rule.Injected >= rule.Count)
+	}
+	if expired {
+		var rules []*Rule
+		for _, rule := range i.rules {
+			if rule.Count == 0 || rule.Injected < rule.Count {
+				rules = append(rules, rule)
+			}
+		}
+		i.rules = rules
+	}
+	return faults
+}
+
+// Flip flips a random bit of the octets of b from offset on, in place
+func (i *Injector) Flip(b []byte, offset int) {
+	if i == nil || offset >= len(b) {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	n := i.random.Intn((len(b) - offset) * 8)
+	b[offset+n/8] ^= 0x80 >> uint(n%8)
+}
+
+func (r *Rule) matches(ue *context.UEContext, names []string) bool {
+	if len(r.UEs) > 0 {
+		if ue == nil {
+			return false
+		}
+		id, mac := strconv.FormatInt(ue.AmfUeNgapId, 10), strings.ToLower(ue.MAC)
+		found := false
+		for _, s := range r.UEs {
+			found = found || s == id || s == mac
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(r.Messages) == 0 {
+		return true
+	}
+	for _, message := range r.Messages {
+		for _, name := range names {
+			if message == name {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,221 @@
+package fault
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"sim-amf/pkg/context"
+	"sim-amf/pkg/metrics"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    Rule
+		wantErr bool
+	}{
+		{s: "action=drop", want: Rule{Action: ActionDrop}},
+		{
+			s: "action=drop,messages=registration_accept,ues=1,probability=0.5",
+			want: Rule{
+				Action:      ActionDrop,
+				Messages:    []string{"registration_accept"},
+				UEs:         []string{"1"},
+				Probability: 0.5,
+			},
+		},
+		{
+			s: "action=delay,direction=received,delay=2s,count=3",
+			want: Rule{
+				Action:    ActionDelay,
+				Direction: metrics.DirectionReceived,
+				Delay:     2 * time.Second,
+				Count:     3,
+			},
+		},
+		{
+			s: "messages=initial_context_setup,registration_accept,ues=1,00:11:22:33:44:55,action=corrupt",
+			want: Rule{
+				Action:   ActionCorrupt,
+				Messages: []string{"initial_context_setup", "registration_accept"},
+				UEs:      []string{"1", "00:11:22:33:44:55"},
+			},
+		},
+		{s: "", wantErr: true},
+		{s: "drop", wantErr: true},
+		{s: "action=drop,corrupt", wantErr: true},
+		{s: "action=drop,size=1", wantErr: true},
+		{s: "action=drop,probability=half", wantErr: true},
+		{s: "action=delay,delay=2", wantErr: true},
+		{s: "action=drop,count=1.5", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRule(tt.s)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRule(%q) error = %v, wantErr %v", tt.s, err, tt.wantErr)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseRule(%q) = %+v, want %+v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestInjectorAdd(t *testing.T) {
+	tests := []struct {
+		rule    Rule
+		wantErr bool
+	}{
+		{rule: Rule{Action: ActionDrop}},
+		{rule: Rule{Action: ActionDrop, Direction: metrics.DirectionReceived}},
+		{rule: Rule{Action: ActionBadMAC, Direction: metrics.DirectionSent}},
+		{rule: Rule{Action: ActionDelay, Delay: time.Second}},
+		{rule: Rule{Action: "lose"}, wantErr: true},
+		{rule: Rule{Action: ActionBadMAC, Direction: metrics.DirectionReceived}, wantErr: true},
+		{rule: Rule{Action: ActionDrop, Direction: "both"}, wantErr: true},
+		{rule: Rule{Action: ActionDrop, Probability: 1.5}, wantErr: true},
+		{rule: Rule{Action: ActionDrop, Probability: -0.5}, wantErr: true},
+		{rule: Rule{Action: ActionDelay}, wantErr: true},
+		{rule: Rule{Action: ActionReorder, Delay: -time.Second}, wantErr: true},
+		{rule: Rule{Action: ActionDrop, Count: -1}, wantErr: true},
+	}
+	injector := NewInjector()
+	id := int64(1)
+	for _, tt := range tests {
+		got, err := injector.Add(tt.rule)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Add(%+v) error = %v, wantErr %v", tt.rule, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got.ID != id || got.Direction == "" || got.Probability == 0 {
+			t.Errorf("Add(%+v) = %+v, want ID %d with a direction and a probability", tt.rule, got, id)
+		}
+		id++
+	}
+	if rules := injector.Rules(); len(rules) != int(id-1) {
+		t.Errorf("Rules() = %d rules, want %d", len(rules), id-1)
+	}
+	if n := injector.Remove(1, 3); n != 2 {
+		t.Errorf("Remove(1, 3) = %d, want 2", n)
+	}
+	if n := injector.Remove(); n != int(id-3) {
+		t.Errorf("Remove() = %d, want %d", n, id-3)
+	}
+}
+
+func TestInjectorDraw(t *testing.T) {
+	ue, other := new(context.UEContext), new(context.UEContext)
+	ue.AmfUeNgapId, ue.MAC = 1, "00:11:22:33:44:55"
+	other.AmfUeNgapId, other.MAC = 2, "00:11:22:33:44:66"
+	injector := NewInjector()
+	for _, rule := range []Rule{
+		{Action: ActionDrop, Messages: []string{"registration_accept"}, UEs: []string{"00:11:22:33:44:55"}},
+		{Action: ActionDelay, Delay: time.Second, UEs: []string{"2"}, Count: 1},
+		{Action: ActionReorder, Direction: metrics.DirectionReceived},
+		{Action: ActionBadMAC, Messages: []string{"security_mode_command"}},
+	} {
+		if _, err := injector.Add(rule); err != nil {
+			t.Fatalf("Add(%+v) error = %v", rule, err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		direction string
+		ue        *context.UEContext
+		names     []string
+		nas       bool
+		want      Faults
+	}{
+		{
+			name:      "message and UE matched",
+			direction: metrics.DirectionSent,
+			ue:        ue,
+			names:     []string{"downlink_nas_transport", "registration_accept"},
+			want:      Faults{Actions: []string{ActionDrop}, Drop: true},
+		},
+		{
+			name:      "message not matched",
+			direction: metrics.DirectionSent,
+			ue:        ue,
+			names:     []string{"downlink_nas_transport"},
+		},
+		{
+			name:      "other UE matched",
+			direction: metrics.DirectionSent,
+			ue:        other,
+			names:     []string{"registration_accept"},
+			want:      Faults{Actions: []string{ActionDelay}, Delay: time.Second},
+		},
+		{
+			name:      "rule expired",
+			direction: metrics.DirectionSent,
+			ue:        other,
+			names:     []string{"registration_accept"},
+		},
+		{
+			name:      "non UE associated",
+			direction: metrics.DirectionReceived,
+			names:     []string{"ng_setup"},
+			want:      Faults{Actions: []string{ActionReorder}, Reorder: true, Hold: DefaultHold},
+		},
+		{
+			name:      "NAS",
+			direction: metrics.DirectionSent,
+			ue:        ue,
+			names:     []string{"security_mode_command"},
+			nas:       true,
+			want:      Faults{Actions: []string{ActionBadMAC}, BadMAC: true},
+		},
+		{
+			name:      "NAS rule not applied to NGAP",
+			direction: metrics.DirectionSent,
+			ue:        ue,
+			names:     []string{"security_mode_command"},
+		},
+	}
+	for _, tt := range tests {
+		var got Faults
+		if tt.nas {
+			got = injector.NAS(tt.ue, tt.names)
+		} else {
+			got = injector.NGAP(tt.direction, tt.ue, tt.names)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: faults = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+	if rules := injector.Rules(); len(rules) != 3 {
+		t.Errorf("Rules() = %d rules, want 3", len(rules))
+	}
+}
+
+func TestNilInjector(t *testing.T) {
+	var injector *Injector
+	if injector.Active(metrics.DirectionSent) {
+		t.Errorf("Active() = true, want false")
+	}
+	if faults := injector.NGAP(metrics.DirectionSent, nil, nil); !reflect.DeepEqual(faults, Faults{}) {
+		t.Errorf("NGAP() = %+v, want none", faults)
+	}
+	if rules := injector.Rules(); rules != nil {
+		t.Errorf("Rules() = %v, want nil", rules)
+	}
+	injector.Flip([]byte{0}, 0)
+}
+
+func TestFlip(t *testing.T) {
+	injector := NewInjector()
+	for i := 0; i < 100; i++ {
+		b := []byte{0xaa, 0x00, 0x00}
+		injector.Flip(b, 1)
+		if b[0] != 0xaa || b[1]^b[2] == 0 || (b[1]&(b[1]-1)) != 0 || (b[2]&(b[2]-1)) != 0 ||
+			(b[1] != 0 && b[2] != 0) {
+			t.Fatalf("Flip() = % x, want one bit flipped after the offset", b)
+		}
+	}
+}
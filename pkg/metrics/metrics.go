@@ -0,0 +1,164 @@
+// Package metrics exposes the signalling counters and procedure latencies of sim-amf in Prometheus text format.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"free5gc/lib/nas"
+
+	"sim-amf/pkg/context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "simamf"
+
+// Direction of a message, seen from sim-amf
+const (
+	DirectionSent     string = "sent"
+	DirectionReceived string = "received"
+)
+
+// Result of sending or receiving a message
+const (
+	ResultOK     string = "ok"
+	ResultFailed string = "failed"
+)
+
+// Outcome of a NAS timer expiry
+const (
+	OutcomeRetransmitted string = "retransmitted"
+	OutcomeAborted       string = "aborted"
+)
+
+// Procedures of which the latency is observed
+const (
+	ProcedureRegistration            string = "registration"               // Initial UE Message -> Registration Complete
+	ProcedurePDUSessionResourceSetup string = "pdu_session_resource_setup" // PDU Session Resource Setup Request -> Response
+)
+
+var (
+	ngapMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ngap_messages_total",
+		Help:      "NGAP messages per procedure, message type, direction and result.",
+	}, []string{"procedure", "message", "direction", "result"})
+
+	nasMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "nas_messages_total",
+		Help:      "NAS messages per message type, direction and result.",
+	}, []string{"message_type", "direction", "result"})
+
+	procedureDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "procedure_duration_seconds",
+		Help:      "Latency of the UE procedures.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 15),
+	}, []string{"procedure"})
+
+	nasTimerExpiries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "nas_timer_expiries_total",
+		Help:      "Expiries of the network side 5GMM timers per timer and outcome.",
+	}, []string{"timer", "outcome"})
+
+	conformanceViolations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "conformance_violations_total",
+		Help:      "Violations of the conformance rules by the messages received from the AGFs, per procedure and rule.",
+	}, []string{"procedure", "rule"})
+
+	connectedAGFs = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "connected_agfs",
+		Help:      "AGFs with an NGAP association to the AMFs of sim-amf.",
+	}, func() float64 {
+		var count int
+		context.RangeSetAGFContext(func(agf *context.AGFContext) bool {
+			count++
+			return true
+		})
+		return float64(count)
+	})
+
+	registeredUEs = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "registered_ues",
+		Help:      "UEs which completed the registration.",
+	}, func() float64 {
+		var count int
+		context.RangeSetUEContext(func(ue *context.UEContext) bool {
+			if ue.ISAttached() {
+				count++
+			}
+			return true
+		})
+		return float64(count)
+	})
+
+	activePDUSessions = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_pdu_sessions",
+		Help:      "PDU sessions held by the UEs.",
+	}, func() float64 {
+		var count int
+		context.RangeSetUEContext(func(ue *context.UEContext) bool {
+			count += ue.CountPDUSession()
+			return true
+		})
+		return float64(count)
+	})
+)
+
+func init() {
+	prometheus.MustRegister(ngapMessages, nasMessages, procedureDuration, nasTimerExpiries, conformanceViolations,
+		connectedAGFs, registeredUEs, activePDUSessions)
+}
+
+// Handler returns the handler serving the metrics on /metrics
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	return mux
+}
+
+func result(err error) string {
+	if err != nil {
+		return ResultFailed
+	}
+	return ResultOK
+}
+
+// CountNGAPMessage counts an NGAP message sent or received, identified from its encoded PDU
+func CountNGAPMessage(direction string, pdu []byte, err error) {
+	procedure, message := ngapMessageName(pdu)
+	ngapMessages.WithLabelValues(procedure, message, direction, result(err)).Inc()
+}
+
+// CountNASMessage counts a NAS message sent or received, together with the 5GSM message it transports if any
+func CountNASMessage(direction string, msg *nas.Message, err error) {
+	for _, messageType := range NASMessageNames(msg) {
+		nasMessages.WithLabelValues(messageType, direction, result(err)).Inc()
+	}
+}
+
+// ObserveProcedure records the latency of a procedure started at start, if it was started
+func ObserveProcedure(procedure string, start time.Time) {
+	if start.IsZero() {
+		return
+	}
+	procedureDuration.WithLabelValues(procedure).Observe(time.Since(start).Seconds())
+}
+
+// CountNASTimerExpiry counts an expiry of a 5GMM timer, with the retransmission or abort it resulted in
+func CountNASTimerExpiry(timer string, outcome string) {
+	nasTimerExpiries.WithLabelValues(timer, outcome).Inc()
+}
+
+// CountConformanceViolation counts a violation of a conformance rule by a message received from an AGF
+func CountConformanceViolation(procedure string, rule string) {
+	conformanceViolations.WithLabelValues(procedure, rule).Inc()
+}
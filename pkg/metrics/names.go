@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"free5gc/lib/nas"
+	"free5gc/lib/nas/nasMessage"
+	"free5gc/lib/ngap/ngapType"
+
+	"sim-amf/pkg/util"
+)
+
+// ngapMessageName returns the procedure and the message type of an encoded NGAP PDU. The NGAP-PDU CHOICE index is
+// carried in the 2 bits following the extension bit of the first octet, and the procedure code in the second octet.
+//
+// TS 38.413 9.4.2 Elementary Procedure Definitions
+func ngapMessageName(pdu []byte) (procedure string, message string) {
+	if len(pdu) < 2 {
+		return "unknown", "unknown"
+	}
+
+	switch int(pdu[0]>>5&0x03) + 1 {
+	case ngapType.NGAPPDUPresentInitiatingMessage:
+		message = "initiating_message"
+	case ngapType.NGAPPDUPresentSuccessfulOutcome:
+		message = "successful_outcome"
+	case ngapType.NGAPPDUPresentUnsuccessfulOutcome:
+		message = "unsuccessful_outcome"
+	default:
+		message = "unknown"
+	}
+
+	procedure = util.NgapProcedureName(int64(pdu[1]))
+	return
+}
+
+// NASMessageNames returns the names of the 5GMM message and of the 5GSM message carried in its N1 SM payload
+func NASMessageNames(msg *nas.Message) (names []string) {
+	if msg == nil {
+		return []string{"unknown"}
+	}
+
+	if msg.GsmMessage != nil {
+		return []string{util.NasMessageTypeName(msg.GsmMessage.GetMessageType())}
+	}
+	if msg.GmmMessage == nil {
+		return []string{"unknown"}
+	}
+
+	names = append(names, util.NasMessageTypeName(msg.GmmMessage.GetMessageType()))
+
+	// 5GSM message type is the 4th octet of the plain 5GSM message, TS 24.501 8.3.1
+	var payloadContainer []uint8
+	switch msg.GmmMessage.GetMessageType() {
+	case nas.MsgTypeULNASTransport:
+		if ulNASTransport := msg.GmmMessage.ULNASTransport; ulNASTransport != nil &&
+			ulNASTransport.GetPayloadContainerType() == nasMessage.PayloadContainerTypeN1SMInfo {
+			payloadContainer = ulNASTransport.GetPayloadContainerContents()
+		}
+	case nas.MsgTypeDLNASTransport:
+		if dlNASTransport := msg.GmmMessage.DLNASTransport; dlNASTransport != nil &&
+			dlNASTransport.GetPayloadContainerType() == nasMessage.PayloadContainerTypeN1SMInfo {
+			payloadContainer = dlNASTransport.GetPayloadContainerContents()
+		}
+	}
+	if len(payloadContainer) >= 4 {
+		names = append(names, util.NasMessageTypeName(payloadContainer[3]))
+	}
+	return
+}
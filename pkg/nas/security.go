@@ -1,17 +1,67 @@
 package nas
 
 import (
+	"errors"
 	"fmt"
 	"free5gc/lib/nas"
+	"free5gc/lib/nas/nasMessage"
 	"free5gc/lib/nas/security"
 	"reflect"
+	"sync"
+	"time"
 
 	"sim-amf/pkg/context"
+	"sim-amf/pkg/event"
+	"sim-amf/pkg/fault"
+	"sim-amf/pkg/logger"
+	"sim-amf/pkg/metrics"
+	"sim-amf/pkg/recording"
+	"sim-amf/pkg/trace"
 	"sim-amf/pkg/types"
 )
 
+// Errors of the uplink NAS messages which cannot be decoded
+//
+// TS 24.501 7.2 Message too short, 7.4 Message type non-existent or not implemented, 7.5 Non-semantical mandatory
+// information element errors
+var (
+	ErrMessageTooShort              = errors.New("message too short")
+	ErrUnknownProtocolDiscriminator = errors.New("unknown extended protocol discriminator")
+	ErrMessageTypeNonExistent       = errors.New("message type non-existent or not implemented")
+	ErrInvalidMandatoryInformation  = errors.New("invalid mandatory information")
+)
+
+// Length of the headers, TS 24.501 9.1.1
+const (
+	plainGmmHeaderLen = 3 // EPD, security header type, message type
+	gsmHeaderLen      = 4 // EPD, PDU session ID, PTI, message type
+	securityHeaderLen = 7 // EPD, security header type, MAC, sequence number
+)
+
+// snow3gMutex serializes the 128-NEA1 and 128-NIA1 algorithms, the SNOW 3G implementation keeping its state in
+// package variables while the UEs are handled by concurrent dispatcher shards
+var snow3gMutex sync.Mutex
+
+// Encrypt ciphers or deciphers the NAS payload in place, TS 33.501 6.4.4
+func Encrypt(alg uint8, knasEnc [16]byte, count uint32, bearer uint8, direction uint8, payload []byte) error {
+	if alg == security.AlgCiphering128NEA1 {
+		snow3gMutex.Lock()
+		defer snow3gMutex.Unlock()
+	}
+	return security.NASEncrypt(alg, knasEnc, count, bearer, direction, payload)
+}
+
+// MacCalculate computes the NAS MAC of the payload, nil with 128-NIA0, TS 33.501 6.4.3
+func MacCalculate(alg uint8, knasInt [16]byte, count uint32, bearer uint8, direction uint8, payload []byte) (
+	[]byte, error) {
+	if alg == security.AlgIntegrity128NIA1 {
+		snow3gMutex.Lock()
+		defer snow3gMutex.Unlock()
+	}
+	return security.NASMacCalculate(alg, knasInt, count, bearer, direction, payload)
+}
+
 func Encode(ue *context.UEContext, msg *nas.Message, newSecurityContext bool) (payload []byte, err error) {
-	var sequenceNumber uint8
 	if ue == nil {
 		err = fmt.Errorf("UEContext is nil")
 		return
@@ -20,47 +70,100 @@ func Encode(ue *context.UEContext, msg *nas.Message, newSecurityContext bool) (p
 		err = fmt.Errorf("Nas Message is empty")
 		return
 	}
+	defer func() {
+		metrics.CountNASMessage(metrics.DirectionSent, msg, err)
+	}()
 
-	if !ue.SecurityContextAvailable {
+	if !ue.SecurityContextAvailable || msg.SecurityHeader.SecurityHeaderType == nas.SecurityHeaderTypePlainNas {
 		return msg.PlainNasEncode()
-	} else {
-		if newSecurityContext {
-			ue.ULCount.Set(0, 0)
-			ue.DLCount.Set(0, 0)
+	}
+	payload, err = msg.PlainNasEncode()
+	if err != nil {
+		return
+	}
+	trace.Global.NAS(ue, metrics.DirectionSent, msg)
+	var faults fault.Faults
+	if fault.Global.Active(metrics.DirectionSent) {
+		names := metrics.NASMessageNames(msg)
+		if faults = fault.Global.NAS(ue, names); len(faults.Actions) > 0 {
+			logger.MainLog.Warn("[%s] Fault injected in %s: %s", ue.LogTag("NAS"), names[0], faults.String())
+			event.Publish(ue, event.Event{Type: event.FaultInjected, Procedure: names[0],
+				Detail: metrics.DirectionSent + " " + faults.String()})
 		}
+	}
+	return protect(ue, payload, msg.SecurityHeader.ProtocolDiscriminator, msg.SecurityHeader.SecurityHeaderType,
+		newSecurityContext, faults)
+}
+
+// EncodePlain protects an encoded plain NAS message with the security header type of the security protected message
+// it was carried in, e.g. a recorded one. A security header type with a new 5G NAS security context resets the NAS
+// COUNTs.
+func EncodePlain(ue *context.UEContext, securityHeaderType uint8, plain []byte) ([]byte, error) {
+	if !ue.SecurityContextAvailable || securityHeaderType == nas.SecurityHeaderTypePlainNas {
+		return plain, nil
+	}
+	newSecurityContext := securityHeaderType == nas.SecurityHeaderTypeIntegrityProtectedWithNew5gNasSecurityContext ||
+		securityHeaderType == nas.SecurityHeaderTypeIntegrityProtectedAndCipheredWithNew5gNasSecurityContext
+	return protect(ue, append([]byte(nil), plain...), nasMessage.Epd5GSMobilityManagementMessage, securityHeaderType,
+		newSecurityContext, fault.Faults{})
+}
 
-		sequenceNumber = ue.ULCount.GetSQN()
+// protect ciphers and integrity protects a plain NAS message in place with the downlink NAS COUNT of the UE. The faults
+// invert the MAC, or protect the message with the NAS COUNT of the previous one, a replay.
+//
+// TS 24.501 4.4.3 Handling of NAS COUNT and NAS sequence number
+func protect(ue *context.UEContext, payload []byte, epd uint8, securityHeaderType uint8, newSecurityContext bool,
+	faults fault.Faults) ([]byte, error) {
+	if newSecurityContext {
+		ue.ULCount.Set(0, 0)
+		ue.DLCount.Set(0, 0)
+	}
 
-		payload, err = msg.PlainNasEncode()
-		if err != nil {
-			return
-		}
+	count := ue.ULCount
+	replay := faults.WrongSQN && count.Get() > 0
+	if replay {
+		count.Count--
+	}
+	sequenceNumber := count.GetSQN()
+	captureNAS(ue, payload, "DL")
+	plain := recording.Global.Copy(payload)
 
-		if err = security.NASEncrypt(ue.CipheringAlg, ue.KnasEnc, ue.ULCount.Get(), security.Bearer3GPP, security.DirectionDownlink, payload); err != nil {
-			return
+	// the Security Mode Command is integrity protected only
+	if securityHeaderType == nas.SecurityHeaderTypeIntegrityProtectedAndCiphered ||
+		securityHeaderType == nas.SecurityHeaderTypeIntegrityProtectedAndCipheredWithNew5gNasSecurityContext {
+		if err := Encrypt(ue.CipheringAlg, ue.KnasEnc, count.Get(), security.Bearer3GPP, security.DirectionDownlink, payload); err != nil {
+			return nil, err
 		}
+	}
 
-		// add sequece number
-		payload = append([]byte{sequenceNumber}, payload[:]...)
-		var mac32 []byte
-		mac32, err = security.NASMacCalculate(ue.IntegrityAlg, ue.KnasInt, ue.ULCount.Get(), security.Bearer3GPP, security.DirectionDownlink, payload)
-		if err != nil {
-			return
-		}
-		if mac32 == nil {
-			mac32 = []byte{0x00, 0x00, 0x0, 0x00}
+	// add sequece number
+	payload = append([]byte{sequenceNumber}, payload[:]...)
+	mac32, err := MacCalculate(ue.IntegrityAlg, ue.KnasInt, count.Get(), security.Bearer3GPP, security.DirectionDownlink, payload)
+	if err != nil {
+		return nil, err
+	}
+	if mac32 == nil {
+		mac32 = []byte{0x00, 0x00, 0x0, 0x00}
+	}
+	if faults.BadMAC {
+		for i := range mac32 {
+			mac32[i] ^= 0xff
 		}
+	}
 
-		// Add mac value
-		payload = append(mac32, payload[:]...)
+	// Add mac value
+	payload = append(mac32, payload[:]...)
 
-		// Add EPD and Security Type
-		msgSecurityHeader := []byte{msg.SecurityHeader.ProtocolDiscriminator, msg.SecurityHeader.SecurityHeaderType}
-		payload = append(msgSecurityHeader, payload[:]...)
-		// Increase DL Count
+	// Add EPD and Security Type
+	msgSecurityHeader := []byte{epd, securityHeaderType}
+	payload = append(msgSecurityHeader, payload[:]...)
+	// Increase DL Count, unless the count of the previous message is replayed
+	if !replay {
 		ue.ULCount.AddOne()
 	}
-	return
+
+	recording.Global.NAS(payload, plain)
+	return payload, nil
 }
 
 /*
@@ -73,18 +176,23 @@ func Decode(ue *context.UEContext, rgType types.RGType, securityHeaderType uint8
 		err = fmt.Errorf("UEContext is nil")
 		return
 	}
-	if payload == nil {
-		err = fmt.Errorf("Nas payload is empty")
+	if len(payload) < plainGmmHeaderLen ||
+		(securityHeaderType != nas.SecurityHeaderTypePlainNas && len(payload) < securityHeaderLen+plainGmmHeaderLen) {
+		err = ErrMessageTooShort
 		return
 	}
+	defer func() {
+		metrics.CountNASMessage(metrics.DirectionReceived, msg, err)
+	}()
 
 	msg = new(nas.Message)
 	msg.SecurityHeaderType = securityHeaderType
 	if securityHeaderType == nas.SecurityHeaderTypePlainNas {
-		err = msg.PlainNasDecode(&payload)
+		err = plainNasDecode(msg, payload)
 		ue.MacFailed = false
 		return
 	} else { // security protected NAS message
+		protected := recording.Global.Copy(payload)
 		securityHeader := payload[0:6]
 		sequenceNumber := payload[6]
 
@@ -92,17 +200,10 @@ func Decode(ue *context.UEContext, rgType types.RGType, securityHeaderType uint8
 		// remove security Header except for sequece Number
 		payload = payload[6:]
 
-		if securityHeaderType == nas.SecurityHeaderTypeIntegrityProtectedWithNew5gNasSecurityContext || securityHeaderType == nas.SecurityHeaderTypeIntegrityProtectedAndCipheredWithNew5gNasSecurityContext {
-			ue.DLCount.Set(0, 0)
-		}
-
-		if ue.DLCount.GetSQN() > sequenceNumber {
-			ue.DLCount.SetOverflow(ue.DLCount.GetOverflow() + 1)
-		}
-		ue.DLCount.SetSQN(sequenceNumber)
+		setUplinkCount(ue, securityHeaderType, sequenceNumber)
 
 		if ue.SecurityContextAvailable {
-			mac32, err := security.NASMacCalculate(ue.IntegrityAlg, ue.KnasInt, ue.DLCount.Get(), security.Bearer3GPP,
+			mac32, err := MacCalculate(ue.IntegrityAlg, ue.KnasInt, ue.DLCount.Get(), security.Bearer3GPP,
 				security.DirectionUplink, payload)
 			if err != nil {
 				ue.MacFailed = true
@@ -118,9 +219,10 @@ func Decode(ue *context.UEContext, rgType types.RGType, securityHeaderType uint8
 			}
 
 			// TODO: Support for ue has nas connection in both accessType
-			if securityHeaderType != nas.SecurityHeaderTypeIntegrityProtected {
+			if securityHeaderType == nas.SecurityHeaderTypeIntegrityProtectedAndCiphered ||
+				securityHeaderType == nas.SecurityHeaderTypeIntegrityProtectedAndCipheredWithNew5gNasSecurityContext {
 				// decrypt payload without sequence number (payload[1])
-				if err = security.NASEncrypt(ue.CipheringAlg, ue.KnasEnc, ue.DLCount.Get(), security.Bearer3GPP, security.DirectionUplink, payload[1:]); err != nil {
+				if err = Encrypt(ue.CipheringAlg, ue.KnasEnc, ue.DLCount.Get(), security.Bearer3GPP, security.DirectionUplink, payload[1:]); err != nil {
 					return nil, err
 				}
 			}
@@ -130,7 +232,150 @@ func Decode(ue *context.UEContext, rgType types.RGType, securityHeaderType uint8
 
 		// remove sequece Number
 		payload = payload[1:]
-		err = msg.PlainNasDecode(&payload)
+		if ue.SecurityContextAvailable {
+			captureNAS(ue, payload, "UL")
+			recording.Global.NAS(protected, recording.Global.Copy(payload))
+		}
+		if err = plainNasDecode(msg, payload); err == nil {
+			trace.Global.NAS(ue, metrics.DirectionReceived, msg)
+		}
 	}
 	return
 }
+
+// CheckIntegrity verifies the MAC of a security protected uplink NAS PDU with the NAS security context of the UE, e.g.
+// the registered UE resolved by the 5G-GUTI of a Registration Request decoded on a new NG connection without NAS
+// security context. The uplink NAS COUNT of the UE is set from the sequence number of the PDU, and MacFailed on a MAC
+// mismatch.
+//
+// TS 24.501 4.4.4.3 Integrity checking of NAS signalling messages in the AMF
+func CheckIntegrity(ue *context.UEContext, payload []byte) bool {
+	securityHeaderType := SecurityHeaderType(payload)
+	if !ue.SecurityContextAvailable || securityHeaderType == nas.SecurityHeaderTypePlainNas ||
+		len(payload) < securityHeaderLen+plainGmmHeaderLen {
+		return false
+	}
+	setUplinkCount(ue, securityHeaderType, payload[securityHeaderLen-1])
+	mac32, err := MacCalculate(ue.IntegrityAlg, ue.KnasInt, ue.DLCount.Get(), security.Bearer3GPP,
+		security.DirectionUplink, payload[securityHeaderLen-1:])
+	if mac32 == nil {
+		mac32 = []byte{0x00, 0x00, 0x0, 0x00}
+	}
+	ue.MacFailed = err != nil || !reflect.DeepEqual(mac32, payload[2:securityHeaderLen-1])
+	return !ue.MacFailed
+}
+
+// setUplinkCount sets the uplink NAS COUNT of the UE from the sequence number of an uplink NAS message, counting an
+// overflow when the sequence number wraps around
+func setUplinkCount(ue *context.UEContext, securityHeaderType uint8, sequenceNumber uint8) {
+	// the NAS COUNTs of a rekeying changing the algorithms only are kept, TS 33.501 6.9.3
+	if (securityHeaderType == nas.SecurityHeaderTypeIntegrityProtectedWithNew5gNasSecurityContext || securityHeaderType == nas.SecurityHeaderTypeIntegrityProtectedAndCipheredWithNew5gNasSecurityContext) &&
+		(ue.PreviousSecurityContext == nil || ue.HorizontalDerivation) {
+		ue.DLCount.Set(0, 0)
+	}
+
+	if ue.DLCount.GetSQN() > sequenceNumber {
+		ue.DLCount.SetOverflow(ue.DLCount.GetOverflow() + 1)
+	}
+	ue.DLCount.SetSQN(sequenceNumber)
+}
+
+// Peek returns the plain NAS message of a NAS PDU sent to or received from the UE, leaving its NAS security context
+// unchanged: a ciphered message is deciphered in a copy with the NAS COUNT estimated from its sequence number, as
+// Decode does for the uplink ones
+func Peek(ue *context.UEContext, direction string, payload []byte) (*nas.Message, error) {
+	msg := nas.NewMessage()
+	securityHeaderType := SecurityHeaderType(payload)
+	if securityHeaderType == nas.SecurityHeaderTypePlainNas ||
+		payload[0] != nasMessage.Epd5GSMobilityManagementMessage {
+		return msg, plainNasDecode(msg, payload)
+	}
+	if len(payload) < securityHeaderLen+plainGmmHeaderLen {
+		return msg, ErrMessageTooShort
+	}
+	plain := append([]byte(nil), payload[securityHeaderLen:]...)
+	if ue.SecurityContextAvailable && (securityHeaderType == nas.SecurityHeaderTypeIntegrityProtectedAndCiphered ||
+		securityHeaderType == nas.SecurityHeaderTypeIntegrityProtectedAndCipheredWithNew5gNasSecurityContext) {
+		sequenceNumber := payload[securityHeaderLen-1]
+		var count types.Count
+		var bearerDirection uint8
+		if direction == metrics.DirectionSent {
+			// the downlink NAS COUNT is the one following the message
+			overflow := ue.ULCount.GetOverflow()
+			if sequenceNumber >= ue.ULCount.GetSQN() && overflow > 0 {
+				overflow--
+			}
+			count.Set(overflow, sequenceNumber)
+			bearerDirection = security.DirectionDownlink
+		} else {
+			overflow := ue.DLCount.GetOverflow()
+			if securityHeaderType == nas.SecurityHeaderTypeIntegrityProtectedAndCipheredWithNew5gNasSecurityContext {
+				overflow = 0
+			} else if ue.DLCount.GetSQN() > sequenceNumber {
+				overflow++
+			}
+			count.Set(overflow, sequenceNumber)
+			bearerDirection = security.DirectionUplink
+		}
+		if err := Encrypt(ue.CipheringAlg, ue.KnasEnc, count.Get(), security.Bearer3GPP, bearerDirection,
+			plain); err != nil {
+			return msg, err
+		}
+	}
+	return msg, plainNasDecode(msg, plain)
+}
+
+// DecodeN1SM decodes the plain 5GSM message of an N1 SM payload container
+func DecodeN1SM(payload []byte) (*nas.Message, error) {
+	if len(payload) > 0 && payload[0] != nasMessage.Epd5GSSessionManagementMessage {
+		return nil, fmt.Errorf("%w %d in N1 SM information", ErrUnknownProtocolDiscriminator, payload[0])
+	}
+	msg := nas.NewMessage()
+	if err := plainNasDecode(msg, payload); err != nil {
+		return msg, err
+	}
+	return msg, nil
+}
+
+// SecurityHeaderType returns the security header type of a 5GS NAS message, plain for a message too short
+func SecurityHeaderType(payload []byte) uint8 {
+	if len(payload) < 2 {
+		return nas.SecurityHeaderTypePlainNas
+	}
+	return nas.GetSecurityHeaderType(payload) & 0x0f
+}
+
+// plainNasDecode decodes a plain 5GMM or 5GSM message. The decoders of free5gc/lib/nas panic on some IEs longer than
+// their maximum length, reported as ErrInvalidMandatoryInformation.
+func plainNasDecode(msg *nas.Message, payload []byte) (err error) {
+	if len(payload) < plainGmmHeaderLen {
+		return ErrMessageTooShort
+	}
+	switch payload[0] {
+	case nasMessage.Epd5GSMobilityManagementMessage:
+	case nasMessage.Epd5GSSessionManagementMessage:
+		if len(payload) < gsmHeaderLen {
+			return ErrMessageTooShort
+		}
+	default:
+		return fmt.Errorf("%w %d", ErrUnknownProtocolDiscriminator, payload[0])
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrInvalidMandatoryInformation, r)
+		}
+	}()
+	if err = msg.PlainNasDecode(&payload); err != nil {
+		return fmt.Errorf("%w: %v", ErrMessageTypeNonExistent, err)
+	}
+	return nil
+}
+
+// captureNAS writes the plain NAS message carried in a security protected message to the AMF and the UE captures
+func captureNAS(ue *context.UEContext, plainNas []byte, direction string) {
+	now := time.Now()
+	comment := fmt.Sprintf("%s decrypted NAS, AMF UE NGAP ID %d", direction, ue.AmfUeNgapId)
+	context.AMFSelf.Capture.WriteNAS(now, plainNas, comment)
+	ue.Capture.WriteNAS(now, plainNas, comment)
+}
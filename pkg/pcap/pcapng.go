@@ -0,0 +1,295 @@
+// Package pcap writes the NGAP and NAS traffic of sim-amf to pcapng files which Wireshark dissects natively.
+//
+// NGAP messages are framed as SCTP DATA chunks with PPID 60 over raw IPv4/IPv6 (LINKTYPE_RAW) on interface 0.
+// Decrypted NAS messages are written as Wireshark exported PDUs (LINKTYPE_WIRESHARK_UPPER_PDU) for the "nas-5gs"
+// dissector on interface 1.
+package pcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// pcapng block types and options, draft-ietf-opsawg-pcapng
+const (
+	blockTypeSectionHeader        uint32 = 0x0A0D0D0A
+	blockTypeInterfaceDescription uint32 = 0x00000001
+	blockTypeEnhancedPacket       uint32 = 0x00000006
+
+	byteOrderMagic uint32 = 0x1A2B3C4D
+
+	optionEndOfOpt  uint16 = 0
+	optionComment   uint16 = 1
+	optionIfName    uint16 = 2
+	optionIfTsresol uint16 = 9
+)
+
+// Link types, https://www.tcpdump.org/linktypes.html
+const (
+	linkTypeRaw               uint16 = 101
+	linkTypeWiresharkUpperPDU uint16 = 252
+)
+
+// Interfaces described in the section header of every file
+const (
+	interfaceNGAP uint32 = 0
+	interfaceNAS  uint32 = 1
+)
+
+// Wireshark exported PDU tags, epan/exported_pdu.h
+const (
+	exportedPDUTagEndOfOpt  uint16 = 0
+	exportedPDUTagProtoName uint16 = 12
+)
+
+const (
+	ipProtocolSCTP uint8  = 132
+	ngapPPID       uint32 = 60 // TS 38.412 7 Transport layer
+	nasDissector   string = "nas-5gs"
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// Writer writes pcapng blocks, it is safe for concurrent use. A nil Writer discards everything.
+type Writer struct {
+	mu     sync.Mutex
+	w      *bufio.Writer
+	c      io.Closer
+	tsn    uint32
+	closed bool
+
+	// DecryptedNAS enables writing the decrypted NAS messages
+	DecryptedNAS bool
+}
+
+// NewWriter writes the section header and the interface descriptions to w
+func NewWriter(w io.Writer) (*Writer, error) {
+	writer := &Writer{w: bufio.NewWriter(w)}
+	if c, ok := w.(io.Closer); ok {
+		writer.c = c
+	}
+
+	writer.writeSectionHeader()
+	writer.writeInterfaceDescription(linkTypeRaw, "ngap")
+	writer.writeInterfaceDescription(linkTypeWiresharkUpperPDU, "nas")
+	if err := writer.w.Flush(); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+// Create creates the file at path and writes the pcapng header to it
+func Create(path string) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewWriter(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// WriteNGAP writes an NGAP message sent from src to dst
+func (w *Writer) WriteNGAP(ts time.Time, src, dst *net.TCPAddr, ngapPdu []byte, comment string) error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+
+	w.tsn++
+	packet := ipPacket(src, dst, sctpPacket(src.Port, dst.Port, w.tsn, ngapPdu))
+	w.writeEnhancedPacket(interfaceNGAP, ts, packet, comment)
+	return w.w.Flush()
+}
+
+// WriteNAS writes a plain NAS message, if the decrypted NAS messages are enabled
+func (w *Writer) WriteNAS(ts time.Time, plainNas []byte, comment string) error {
+	if w == nil || !w.DecryptedNAS {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+
+	packet := exportedPDU(nasDissector, plainNas)
+	w.writeEnhancedPacket(interfaceNAS, ts, packet, comment)
+	return w.w.Flush()
+}
+
+// Close flushes and closes the underlying file
+func (w *Writer) Close() error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	err := w.w.Flush()
+	if w.c != nil {
+		if cerr := w.c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (w *Writer) writeBlock(blockType uint32, body []byte) {
+	length := uint32(12 + len(body))
+	w.writeUint32(blockType)
+	w.writeUint32(length)
+	w.w.Write(body)
+	w.writeUint32(length)
+}
+
+func (w *Writer) writeUint32(v uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	w.w.Write(b[:])
+}
+
+func (w *Writer) writeSectionHeader() {
+	body := make([]byte, 16)
+	binary.LittleEndian.PutUint32(body[0:], byteOrderMagic)
+	binary.LittleEndian.PutUint16(body[4:], 1) // major version
+	binary.LittleEndian.PutUint16(body[6:], 0) // minor version
+	binary.LittleEndian.PutUint64(body[8:], 0xFFFFFFFFFFFFFFFF)
+	w.writeBlock(blockTypeSectionHeader, body)
+}
+
+func (w *Writer) writeInterfaceDescription(linkType uint16, name string) {
+	body := make([]byte, 8)
+	binary.LittleEndian.PutUint16(body[0:], linkType)
+	binary.LittleEndian.PutUint32(body[4:], 0) // no snap length
+	body = appendOption(body, optionIfName, []byte(name))
+	body = appendOption(body, optionIfTsresol, []byte{6}) // microseconds
+	body = appendOption(body, optionEndOfOpt, nil)
+	w.writeBlock(blockTypeInterfaceDescription, body)
+}
+
+func (w *Writer) writeEnhancedPacket(interfaceID uint32, ts time.Time, packet []byte, comment string) {
+	micros := uint64(ts.UnixNano() / int64(time.Microsecond))
+
+	body := make([]byte, 20)
+	binary.LittleEndian.PutUint32(body[0:], interfaceID)
+	binary.LittleEndian.PutUint32(body[4:], uint32(micros>>32))
+	binary.LittleEndian.PutUint32(body[8:], uint32(micros))
+	binary.LittleEndian.PutUint32(body[12:], uint32(len(packet)))
+	binary.LittleEndian.PutUint32(body[16:], uint32(len(packet)))
+	body = append(body, pad(packet)...)
+	if comment != "" {
+		body = appendOption(body, optionComment, []byte(comment))
+		body = appendOption(body, optionEndOfOpt, nil)
+	}
+	w.writeBlock(blockTypeEnhancedPacket, body)
+}
+
+func appendOption(body []byte, code uint16, value []byte) []byte {
+	var header [4]byte
+	binary.LittleEndian.PutUint16(header[0:], code)
+	binary.LittleEndian.PutUint16(header[2:], uint16(len(value)))
+	body = append(body, header[:]...)
+	return append(body, pad(value)...)
+}
+
+// pad pads b with zeros to a multiple of 4 octets
+func pad(b []byte) []byte {
+	if len(b)%4 == 0 {
+		return b
+	}
+	return append(append([]byte{}, b...), make([]byte, 4-len(b)%4)...)
+}
+
+// sctpPacket builds an SCTP packet carrying the payload in a single unfragmented DATA chunk
+//
+// RFC 4960 3 SCTP Packet Format
+func sctpPacket(srcPort, dstPort int, tsn uint32, payload []byte) []byte {
+	chunkLength := 16 + len(payload)
+	packet := make([]byte, 12+16)
+
+	// Common Header, verification tag left to 0
+	binary.BigEndian.PutUint16(packet[0:], uint16(srcPort))
+	binary.BigEndian.PutUint16(packet[2:], uint16(dstPort))
+
+	// DATA chunk, beginning and ending fragment
+	packet[12] = 0
+	packet[13] = 0x03
+	binary.BigEndian.PutUint16(packet[14:], uint16(chunkLength))
+	binary.BigEndian.PutUint32(packet[16:], tsn)
+	binary.BigEndian.PutUint32(packet[24:], ngapPPID)
+	packet = append(packet, pad(payload)...)
+
+	binary.LittleEndian.PutUint32(packet[8:], crc32.Checksum(packet, crc32c))
+	return packet
+}
+
+// ipPacket builds an IPv4 or IPv6 packet carrying an SCTP packet
+func ipPacket(src, dst *net.TCPAddr, sctp []byte) []byte {
+	if src4, dst4 := src.IP.To4(), dst.IP.To4(); src4 != nil && dst4 != nil {
+		header := make([]byte, 20)
+		header[0] = 0x45
+		binary.BigEndian.PutUint16(header[2:], uint16(20+len(sctp)))
+		binary.BigEndian.PutUint16(header[6:], 0x4000) // don't fragment
+		header[8] = 64
+		header[9] = ipProtocolSCTP
+		copy(header[12:16], src4)
+		copy(header[16:20], dst4)
+		binary.BigEndian.PutUint16(header[10:], ipv4Checksum(header))
+		return append(header, sctp...)
+	}
+
+	header := make([]byte, 40)
+	header[0] = 0x60
+	binary.BigEndian.PutUint16(header[4:], uint16(len(sctp)))
+	header[6] = ipProtocolSCTP
+	header[7] = 64
+	copy(header[8:24], src.IP.To16())
+	copy(header[24:40], dst.IP.To16())
+	return append(header, sctp...)
+}
+
+func ipv4Checksum(header []byte) uint16 {
+	var sum uint32
+	for i := 0; i < len(header); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(header[i:]))
+	}
+	for sum>>16 != 0 {
+		sum = (sum & 0xffff) + (sum >> 16)
+	}
+	return ^uint16(sum)
+}
+
+// exportedPDU builds a Wireshark exported PDU handing the payload to the named dissector
+func exportedPDU(dissector string, payload []byte) []byte {
+	var packet []byte
+	appendTag := func(tag uint16, value []byte) {
+		var header [4]byte
+		value = pad(value)
+		binary.BigEndian.PutUint16(header[0:], tag)
+		binary.BigEndian.PutUint16(header[2:], uint16(len(value)))
+		packet = append(packet, header[:]...)
+		packet = append(packet, value...)
+	}
+	appendTag(exportedPDUTagProtoName, []byte(dissector))
+	appendTag(exportedPDUTagEndOfOpt, nil)
+	return append(packet, payload...)
+}
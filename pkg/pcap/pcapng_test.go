@@ -0,0 +1,302 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"net"
+	"testing"
+	"time"
+)
+
+// block is a pcapng block read back from the Writer output
+type block struct {
+	blockType uint32
+	body      []byte
+}
+
+// packet is an enhanced packet block read back from the Writer output
+type packet struct {
+	interfaceID uint32
+	ts          time.Time
+	data        []byte
+	comment     string
+}
+
+// readBlocks reads the pcapng blocks, checking their framing
+func readBlocks(t *testing.T, data []byte) []block {
+	t.Helper()
+	var blocks []block
+	for len(data) > 0 {
+		if len(data) < 12 {
+			t.Fatalf("truncated block of %d octets", len(data))
+		}
+		blockType := binary.LittleEndian.Uint32(data[0:])
+		length := binary.LittleEndian.Uint32(data[4:])
+		if length < 12 || length%4 != 0 || int(length) > len(data) {
+			t.Fatalf("block 0x%08x of invalid length %d", blockType, length)
+		}
+		if trailing := binary.LittleEndian.Uint32(data[length-4:]); trailing != length {
+			t.Fatalf("block 0x%08x trailing length %d, want %d", blockType, trailing, length)
+		}
+		blocks = append(blocks, block{blockType: blockType, body: data[8 : length-4]})
+		data = data[length:]
+	}
+	return blocks
+}
+
+// readOptions returns the options of a block body by code, checking the end of options
+func readOptions(t *testing.T, options []byte) map[uint16][]byte {
+	t.Helper()
+	values := make(map[uint16][]byte)
+	for len(options) > 0 {
+		if len(options) < 4 {
+			t.Fatalf("truncated option of %d octets", len(options))
+		}
+		code := binary.LittleEndian.Uint16(options[0:])
+		length := int(binary.LittleEndian.Uint16(options[2:]))
+		if code == optionEndOfOpt {
+			if len(options) != 4 {
+				t.Fatalf("%d octets after the end of options", len(options)-4)
+			}
+			return values
+		}
+		padded := (length + 3) &^ 3
+		if 4+padded > len(options) {
+			t.Fatalf("option %d of invalid length %d", code, length)
+		}
+		values[code] = options[4 : 4+length]
+		options = options[4+padded:]
+	}
+	t.Fatal("missing end of options")
+	return nil
+}
+
+// readPcapng reads back the section header, the interface descriptions and the packets written by the Writer
+func readPcapng(t *testing.T, data []byte) []packet {
+	t.Helper()
+	blocks := readBlocks(t, data)
+	if len(blocks) < 3 {
+		t.Fatalf("%d blocks, want at least 3", len(blocks))
+	}
+
+	shb := blocks[0]
+	if shb.blockType != blockTypeSectionHeader || len(shb.body) != 16 {
+		t.Fatalf("first block 0x%08x of %d octets, want a section header", shb.blockType, len(shb.body))
+	}
+	if magic := binary.LittleEndian.Uint32(shb.body[0:]); magic != byteOrderMagic {
+		t.Errorf("byte-order magic 0x%08x, want 0x%08x", magic, byteOrderMagic)
+	}
+	if major, minor := binary.LittleEndian.Uint16(shb.body[4:]), binary.LittleEndian.Uint16(shb.body[6:]); major != 1 ||
+		minor != 0 {
+		t.Errorf("version %d.%d, want 1.0", major, minor)
+	}
+
+	interfaces := []struct {
+		linkType uint16
+		name     string
+	}{{linkTypeRaw, "ngap"}, {linkTypeWiresharkUpperPDU, "nas"}}
+	for i, want := range interfaces {
+		idb := blocks[1+i]
+		if idb.blockType != blockTypeInterfaceDescription {
+			t.Fatalf("block %d type 0x%08x, want an interface description", 1+i, idb.blockType)
+		}
+		if linkType := binary.LittleEndian.Uint16(idb.body[0:]); linkType != want.linkType {
+			t.Errorf("interface %d link type %d, want %d", i, linkType, want.linkType)
+		}
+		options := readOptions(t, idb.body[8:])
+		if name := string(options[optionIfName]); name != want.name {
+			t.Errorf("interface %d name %q, want %q", i, name, want.name)
+		}
+		if tsresol := options[optionIfTsresol]; !bytes.Equal(tsresol, []byte{6}) {
+			t.Errorf("interface %d timestamp resolution %v, want microseconds", i, tsresol)
+		}
+	}
+
+	var packets []packet
+	for _, epb := range blocks[3:] {
+		if epb.blockType != blockTypeEnhancedPacket {
+			t.Fatalf("block type 0x%08x, want an enhanced packet", epb.blockType)
+		}
+		capLen := binary.LittleEndian.Uint32(epb.body[12:])
+		if origLen := binary.LittleEndian.Uint32(epb.body[16:]); origLen != capLen {
+			t.Errorf("original length %d, want the captured length %d", origLen, capLen)
+		}
+		micros := uint64(binary.LittleEndian.Uint32(epb.body[4:]))<<32 | uint64(binary.LittleEndian.Uint32(epb.body[8:]))
+		p := packet{
+			interfaceID: binary.LittleEndian.Uint32(epb.body[0:]),
+			ts:          time.Unix(0, int64(micros)*int64(time.Microsecond)),
+			data:        epb.body[20 : 20+capLen],
+		}
+		if options := epb.body[20+(capLen+3)&^3:]; len(options) > 0 {
+			p.comment = string(readOptions(t, options)[optionComment])
+		}
+		packets = append(packets, p)
+	}
+	return packets
+}
+
+// readSCTP returns the endpoints and the NGAP message of a raw IP packet carrying an SCTP DATA chunk
+func readSCTP(t *testing.T, data []byte) (src, dst *net.TCPAddr, ngapPdu []byte) {
+	t.Helper()
+	var sctp []byte
+	src, dst = new(net.TCPAddr), new(net.TCPAddr)
+	switch data[0] >> 4 {
+	case 4:
+		header := data[:20]
+		if ipv4Checksum(header) != 0 {
+			t.Error("invalid IPv4 header checksum")
+		}
+		if header[9] != ipProtocolSCTP || int(binary.BigEndian.Uint16(header[2:])) != len(data) {
+			t.Errorf("IPv4 protocol %d, total length %d", header[9], binary.BigEndian.Uint16(header[2:]))
+		}
+		src.IP, dst.IP = net.IP(header[12:16]), net.IP(header[16:20])
+		sctp = data[20:]
+	case 6:
+		header := data[:40]
+		if header[6] != ipProtocolSCTP || int(binary.BigEndian.Uint16(header[4:])) != len(data)-40 {
+			t.Errorf("IPv6 next header %d, payload length %d", header[6], binary.BigEndian.Uint16(header[4:]))
+		}
+		src.IP, dst.IP = net.IP(header[8:24]), net.IP(header[24:40])
+		sctp = data[40:]
+	default:
+		t.Fatalf("IP version %d", data[0]>>4)
+	}
+
+	src.Port, dst.Port = int(binary.BigEndian.Uint16(sctp[0:])), int(binary.BigEndian.Uint16(sctp[2:]))
+	checksum := binary.LittleEndian.Uint32(sctp[8:])
+	zeroed := append([]byte{}, sctp...)
+	binary.LittleEndian.PutUint32(zeroed[8:], 0)
+	if crc32.Checksum(zeroed, crc32c) != checksum {
+		t.Error("invalid SCTP CRC32c checksum")
+	}
+	chunk := sctp[12:]
+	if chunk[0] != 0 || chunk[1] != 0x03 {
+		t.Errorf("chunk type %d flags 0x%02x, want an unfragmented DATA chunk", chunk[0], chunk[1])
+	}
+	if ppid := binary.BigEndian.Uint32(chunk[12:]); ppid != ngapPPID {
+		t.Errorf("PPID %d, want %d", ppid, ngapPPID)
+	}
+	length := int(binary.BigEndian.Uint16(chunk[2:]))
+	return src, dst, chunk[16:length]
+}
+
+func TestWriterNGAP(t *testing.T) {
+	ts := time.Date(2026, 1, 2, 3, 4, 5, 678901000, time.UTC)
+	tests := []struct {
+		name     string
+		src, dst *net.TCPAddr
+		ngapPdus [][]byte
+		comment  string
+	}{
+		{
+			name:     "IPv4",
+			src:      &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 38412},
+			dst:      &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 9487},
+			ngapPdus: [][]byte{{0x00, 0x15, 0x00, 0x2c}, {0x20, 0x15, 0x00, 0x31, 0x00, 0x00, 0x04}},
+		},
+		{
+			name:     "IPv6 with comment",
+			src:      &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 38412},
+			dst:      &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 38412},
+			ngapPdus: [][]byte{{0x00, 0x0f, 0x40, 0x48, 0x00, 0x00, 0x05, 0x00, 0x55}},
+			comment:  "AmfUeNgapID 1",
+		},
+		{
+			name:     "empty",
+			src:      &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1},
+			dst:      &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 2},
+			ngapPdus: [][]byte{{}},
+		},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		w, err := NewWriter(&out)
+		if err != nil {
+			t.Fatalf("%s: NewWriter() error = %v", tt.name, err)
+		}
+		for _, ngapPdu := range tt.ngapPdus {
+			if err := w.WriteNGAP(ts, tt.src, tt.dst, ngapPdu, tt.comment); err != nil {
+				t.Fatalf("%s: WriteNGAP() error = %v", tt.name, err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("%s: Close() error = %v", tt.name, err)
+		}
+
+		packets := readPcapng(t, out.Bytes())
+		if len(packets) != len(tt.ngapPdus) {
+			t.Fatalf("%s: %d packets, want %d", tt.name, len(packets), len(tt.ngapPdus))
+		}
+		for i, p := range packets {
+			if p.interfaceID != interfaceNGAP || !p.ts.Equal(ts.Truncate(time.Microsecond)) || p.comment != tt.comment {
+				t.Errorf("%s: packet %d on interface %d at %v with comment %q", tt.name, i, p.interfaceID, p.ts,
+					p.comment)
+			}
+			src, dst, ngapPdu := readSCTP(t, p.data)
+			if !src.IP.Equal(tt.src.IP) || src.Port != tt.src.Port || !dst.IP.Equal(tt.dst.IP) || dst.Port != tt.dst.Port {
+				t.Errorf("%s: packet %d from %v to %v, want from %v to %v", tt.name, i, src, dst, tt.src, tt.dst)
+			}
+			if !bytes.Equal(ngapPdu, tt.ngapPdus[i]) {
+				t.Errorf("%s: packet %d NGAP % x, want % x", tt.name, i, ngapPdu, tt.ngapPdus[i])
+			}
+		}
+	}
+}
+
+func TestWriterNAS(t *testing.T) {
+	plainNas := []byte{0x7e, 0x00, 0x41, 0x79, 0x00, 0x0d, 0x01}
+	tests := []struct {
+		decryptedNAS bool
+		packets      int
+	}{
+		{decryptedNAS: false, packets: 0},
+		{decryptedNAS: true, packets: 1},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		w, err := NewWriter(&out)
+		if err != nil {
+			t.Fatalf("NewWriter() error = %v", err)
+		}
+		w.DecryptedNAS = tt.decryptedNAS
+		if err := w.WriteNAS(time.Now(), plainNas, "Registration Request"); err != nil {
+			t.Fatalf("WriteNAS() error = %v", err)
+		}
+		w.Close()
+		if err := w.WriteNAS(time.Now(), plainNas, ""); tt.decryptedNAS && err == nil {
+			t.Error("WriteNAS() after Close() succeeded")
+		}
+
+		packets := readPcapng(t, out.Bytes())
+		if len(packets) != tt.packets {
+			t.Fatalf("DecryptedNAS %v: %d packets, want %d", tt.decryptedNAS, len(packets), tt.packets)
+		}
+		for _, p := range packets {
+			if p.interfaceID != interfaceNAS || p.comment != "Registration Request" {
+				t.Errorf("packet on interface %d with comment %q", p.interfaceID, p.comment)
+			}
+			// protocol name tag padded to 8 octets, end of options tag, then the NAS message
+			want := append([]byte{0x00, 0x0c, 0x00, 0x08}, []byte("nas-5gs\x00")...)
+			want = append(want, 0x00, 0x00, 0x00, 0x00)
+			want = append(want, plainNas...)
+			if !bytes.Equal(p.data, want) {
+				t.Errorf("exported PDU % x, want % x", p.data, want)
+			}
+		}
+	}
+}
+
+func TestNilWriter(t *testing.T) {
+	var w *Writer
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 38412}
+	if err := w.WriteNGAP(time.Now(), addr, addr, []byte{0x00}, ""); err != nil {
+		t.Errorf("WriteNGAP() error = %v", err)
+	}
+	if err := w.WriteNAS(time.Now(), []byte{0x7e}, ""); err != nil {
+		t.Errorf("WriteNAS() error = %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+}
@@ -0,0 +1,323 @@
+// Package recording records the NGAP messages exchanged with the AGFs, with the plain NAS messages they carry and the
+// NAS security context of the UE at each step, and loads the recordings replayed by sim-amf.
+package recording
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"free5gc/lib/aper"
+	"free5gc/lib/nas"
+	lib_ngap "free5gc/lib/ngap"
+	"free5gc/lib/ngap/ngapType"
+
+	"sim-amf/pkg/context"
+	"sim-amf/pkg/util"
+)
+
+// maxPlainNAS is the number of protected NAS messages of which the plain message is kept until their NGAP message is
+// recorded
+const maxPlainNAS = 4096
+
+// Global is the recorder of sim-amf, nil if recording is disabled
+var Global *Recorder
+
+// Step is an NGAP message sent or received by sim-amf
+type Step struct {
+	Time        time.Time `json:"time"`
+	Direction   string    `json:"direction"`
+	AGF         string    `json:"agf"`
+	AmfUeNgapID int64     `json:"amfUeNgapId,omitempty"` // zero for the non UE associated messages
+	RanUeNgapID int64     `json:"ranUeNgapId,omitempty"`
+	Procedure   string    `json:"procedure"`
+	Message     string    `json:"message"`
+	NGAP        []byte    `json:"ngap"`
+	NAS         [][]byte  `json:"nas,omitempty"` // plain NAS message of each NAS-PDU of the NGAP message, in order
+	Security    *Security `json:"security,omitempty"`
+}
+
+// Security is the NAS security context of the UE after the step
+type Security struct {
+	Available    bool   `json:"available"`
+	Kamf         []byte `json:"kamf,omitempty"`
+	KnasInt      []byte `json:"knasInt"`
+	KnasEnc      []byte `json:"knasEnc"`
+	Kwagf        []byte `json:"kwagf,omitempty"`
+	IntegrityAlg uint8  `json:"integrityAlg"`
+	CipheringAlg uint8  `json:"cipheringAlg"`
+	ULCount      uint32 `json:"ulCount"`
+	DLCount      uint32 `json:"dlCount"`
+}
+
+// Recorder writes the steps as JSON lines, it is safe for concurrent use. A nil Recorder records nothing.
+type Recorder struct {
+	mu     sync.Mutex
+	out    io.WriteCloser
+	plains map[string][]byte // plain NAS messages by protected NAS message
+	order  []string          // protected NAS messages in the order they were added to plains
+}
+
+// Create returns a Recorder writing to a new file
+func Create(name string) (*Recorder, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return NewRecorder(f), nil
+}
+
+func NewRecorder(out io.WriteCloser) *Recorder {
+	return &Recorder{out: out, plains: make(map[string][]byte)}
+}
+
+// Close closes the recording
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.out.Close()
+}
+
+// Copy returns a copy of a NAS message about to be protected or deprotected in place, nil if recording is disabled
+func (r *Recorder) Copy(payload []byte) []byte {
+	if r == nil {
+		return nil
+	}
+	return append([]byte(nil), payload...)
+}
+
+// NAS keeps the plain NAS message of a security protected NAS message, until the NGAP message carrying it is recorded
+func (r *Recorder) NAS(protected []byte, plain []byte) {
+	if r == nil || protected == nil || plain == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := string(protected)
+	if _, ok := r.plains[key]; !ok {
+		r.order = append(r.order, key)
+	}
+	r.plains[key] = plain
+	if len(r.order) > maxPlainNAS {
+		delete(r.plains, r.order[0])
+		r.order = r.order[1:]
+	}
+}
+
+// NGAP records an NGAP message sent to or received from the AGF, ue is nil for the non UE associated messages
+func (r *Recorder) NGAP(agf string, ue *context.UEContext, direction string, pkt []byte) {
+	if r == nil {
+		return
+	}
+	pdu, err := lib_ngap.Decoder(pkt)
+	if err != nil {
+		return
+	}
+	procedureCode, message := Message(pdu)
+	step := Step{
+		Time:      time.Now(),
+		Direction: direction,
+		AGF:       agf,
+		Procedure: util.NgapProcedureName(procedureCode),
+		Message:   message,
+		NGAP:      pkt,
+	}
+	if ue != nil {
+		step.AmfUeNgapID = ue.AmfUeNgapId
+		step.RanUeNgapID = ue.RanUeNgapId
+		step.Security = snapshot(ue)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, nasPdu := range NASPDUs(pdu) {
+		plain := nasPdu.Value
+		if nas.GetSecurityHeaderType(nasPdu.Value)&0x0f != nas.SecurityHeaderTypePlainNas {
+			plain = r.plains[string(nasPdu.Value)]
+		}
+		step.NAS = append(step.NAS, plain)
+	}
+	line, err := json.Marshal(step)
+	if err != nil {
+		return
+	}
+	r.out.Write(append(line, '\n'))
+}
+
+func snapshot(ue *context.UEContext) *Security {
+	return &Security{
+		Available:    ue.SecurityContextAvailable,
+		Kamf:         ue.Kamf,
+		KnasInt:      append([]byte(nil), ue.KnasInt[:]...),
+		KnasEnc:      append([]byte(nil), ue.KnasEnc[:]...),
+		Kwagf:        ue.Kwagf,
+		IntegrityAlg: ue.IntegrityAlg,
+		CipheringAlg: ue.CipheringAlg,
+		ULCount:      ue.ULCount.Get(),
+		DLCount:      ue.DLCount.Get(),
+	}
+}
+
+// Apply sets the NAS security context of the UE to the recorded one, except the NAS COUNTs
+func (s *Security) Apply(ue *context.UEContext) {
+	ue.SecurityContextAvailable = s.Available
+	ue.Kamf = s.Kamf
+	copy(ue.KnasInt[:], s.KnasInt)
+	copy(ue.KnasEnc[:], s.KnasEnc)
+	ue.Kwagf = s.Kwagf
+	ue.IntegrityAlg = s.IntegrityAlg
+	ue.CipheringAlg = s.CipheringAlg
+}
+
+// Load reads the steps of a recording
+func Load(name string) ([]*Step, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var steps []*Step
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		step := new(Step)
+		if err := json.Unmarshal(scanner.Bytes(), step); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, line, err)
+		}
+		steps = append(steps, step)
+	}
+	return steps, scanner.Err()
+}
+
+// Message returns the procedure code of an NGAP message and the name of the message, e.g. InitialUEMessage
+func Message(pdu *ngapType.NGAPPDU) (procedureCode int64, message string) {
+	value := messageValue(pdu)
+	if !value.IsValid() {
+		return -1, "Unknown"
+	}
+	switch {
+	case pdu.InitiatingMessage != nil:
+		procedureCode = pdu.InitiatingMessage.ProcedureCode.Value
+	case pdu.SuccessfulOutcome != nil:
+		procedureCode = pdu.SuccessfulOutcome.ProcedureCode.Value
+	case pdu.UnsuccessfulOutcome != nil:
+		procedureCode = pdu.UnsuccessfulOutcome.ProcedureCode.Value
+	}
+	present := int(value.FieldByName("Present").Int())
+	if present <= 0 || present >= value.NumField() || value.Field(present).IsNil() {
+		return procedureCode, "Unknown"
+	}
+	return procedureCode, value.Type().Field(present).Name
+}
+
+// IEIDs returns the IDs of the IEs of an NGAP message in order
+func IEIDs(pdu *ngapType.NGAPPDU) (ids []int64) {
+	value := messageValue(pdu)
+	if !value.IsValid() {
+		return nil
+	}
+	present := int(value.FieldByName("Present").Int())
+	if present <= 0 || present >= value.NumField() || value.Field(present).IsNil() {
+		return nil
+	}
+	list := value.Field(present).Elem().FieldByName("ProtocolIEs").FieldByName("List")
+	for i := 0; i < list.Len(); i++ {
+		ids = append(ids, list.Index(i).FieldByName("Id").Field(0).Int())
+	}
+	return ids
+}
+
+func messageValue(pdu *ngapType.NGAPPDU) reflect.Value {
+	switch {
+	case pdu.InitiatingMessage != nil:
+		return reflect.ValueOf(&pdu.InitiatingMessage.Value).Elem()
+	case pdu.SuccessfulOutcome != nil:
+		return reflect.ValueOf(&pdu.SuccessfulOutcome.Value).Elem()
+	case pdu.UnsuccessfulOutcome != nil:
+		return reflect.ValueOf(&pdu.UnsuccessfulOutcome.Value).Elem()
+	}
+	return reflect.Value{}
+}
+
+// NASPDUs returns the NAS-PDUs carried in an NGAP message in order, the ones of the PDU session resource items
+// included. They are pointers into the message, so that the NAS PDUs can be replaced before the message is encoded.
+func NASPDUs(pdu *ngapType.NGAPPDU) (nasPdus []*ngapType.NASPDU) {
+	walk(reflect.ValueOf(pdu), func(v reflect.Value) {
+		if nasPdu, ok := v.Addr().Interface().(*ngapType.NASPDU); ok {
+			nasPdus = append(nasPdus, nasPdu)
+		}
+	})
+	return nasPdus
+}
+
+// SetUENGAPIDs sets all the AMF and RAN UE NGAP IDs of an NGAP message
+func SetUENGAPIDs(pdu *ngapType.NGAPPDU, amfUeNgapId, ranUeNgapId int64) {
+	walk(reflect.ValueOf(pdu), func(v reflect.Value) {
+		switch id := v.Addr().Interface().(type) {
+		case *ngapType.AMFUENGAPID:
+			id.Value = amfUeNgapId
+		case *ngapType.RANUENGAPID:
+			id.Value = ranUeNgapId
+		}
+	})
+}
+
+// SetSecurityKey sets the Security Key of an NGAP message, it returns false if the message has none
+func SetSecurityKey(pdu *ngapType.NGAPPDU, key []byte) (found bool) {
+	walk(reflect.ValueOf(pdu), func(v reflect.Value) {
+		if securityKey, ok := v.Addr().Interface().(*ngapType.SecurityKey); ok {
+			securityKey.Value = aper.BitString{Bytes: key, BitLength: uint64(8 * len(key))}
+			found = true
+		}
+	})
+	return found
+}
+
+var (
+	nasPduType      = reflect.TypeOf(ngapType.NASPDU{})
+	amfUeNgapIdType = reflect.TypeOf(ngapType.AMFUENGAPID{})
+	ranUeNgapIdType = reflect.TypeOf(ngapType.RANUENGAPID{})
+	securityKeyType = reflect.TypeOf(ngapType.SecurityKey{})
+)
+
+// walk calls f on the addressable NASPDU, AMFUENGAPID, RANUENGAPID and SecurityKey values reachable from v, depth
+// first
+func walk(v reflect.Value, f func(v reflect.Value)) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			walk(v.Elem(), f)
+		}
+	case reflect.Struct:
+		switch v.Type() {
+		case nasPduType, amfUeNgapIdType, ranUeNgapIdType, securityKeyType:
+			if v.CanAddr() {
+				f(v)
+			}
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			walk(v.Field(i), f)
+		}
+	case reflect.Slice, reflect.Array:
+		// the OCTET STRINGs and BIT STRINGs are byte slices
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			walk(v.Index(i), f)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package simamf
+
+import (
+	lib_ngap "free5gc/lib/ngap"
+	"free5gc/lib/ngap/ngapConvert"
+	"free5gc/lib/ngap/ngapType"
+	"sim-amf/pkg/context"
+	"sim-amf/pkg/logger"
+)
+
+// rerouteInitialUEMessage asks the AGF to send the Initial UE Message of a UE to another AMF of the AMF set, instead
+// of the AMF it is connected to which reroutes the UEs or whose GUAMIs are unavailable. No UE context is created.
+//
+// TS 23.502 4.2.2.2.3 Registration with AMF re-allocation, TS 38.413 8.6.5 Reroute NAS Request
+func rerouteInitialUEMessage(agf *context.AGFContext, pdu *ngapType.NGAPPDU, rANUENGAPID *ngapType.RANUENGAPID) {
+	initialUEMessage, err := lib_ngap.Encoder(*pdu)
+	if err != nil {
+		logger.MainLog.Error("Encode Initial UE Message failed: %+v", err)
+		return
+	}
+	amfSetID := agf.AMF.ServedGuamiList.List[0].GUAMI.AMFSetID.Value
+	pkt, err := BuildRerouteNASRequest(rANUENGAPID.Value, initialUEMessage, amfSetID)
+	if err != nil {
+		logger.MainLog.Error("Build Reroute NAS Request failed: %+v", err)
+		return
+	}
+	logger.MainLog.Info("AMF[%s] reroutes the Initial UE Message of RanUeNgapID %d to AMF Set %s",
+		agf.AMF.AMFName.Value, rANUENGAPID.Value, ngapConvert.BitStringToHex(&amfSetID))
+	if _, err := SendData(agf.SCTPConn, pkt, "Server"); err != nil {
+		logger.MainLog.Error("Error %v", err)
+	}
+}
+
+// indicateAMFUnavailable marks the GUAMIs served by an AMF of the set unavailable, and indicates it with the backup
+// AMF, if any, to all the AGFs connected to the set. The Initial UE Messages later received by the AMF are rerouted.
+//
+// TS 23.501 5.21.2.2 NF Service Planned Removal, TS 38.413 8.7.6 AMF Status Indication
+func indicateAMFUnavailable(amf *context.AMFContext, backupAMFName string) error {
+	pkt, err := BuildAMFStatusIndication(amf.ServedGuamiList, backupAMFName)
+	if err != nil {
+		return err
+	}
+	amf.Unavailable = true
+	amf.BackupAMFName = backupAMFName
+	context.RangeSetAGFContext(func(agf *context.AGFContext) bool {
+		if !agf.NGSetupDone {
+			return true
+		}
+		if _, err := SendData(agf.SCTPConn, pkt, "Server"); err != nil {
+			logger.MainLog.Error("Send AMF Status Indication to AGF[%s] failed: %v", agf.SCTPAddr, err)
+		}
+		return true
+	})
+	return nil
+}
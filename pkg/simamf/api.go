@@ -0,0 +1,819 @@
+package simamf
+
+import (
+	gocontext "context"
+	"encoding/hex"
+	"net"
+	"time"
+
+	"free5gc/lib/aper"
+	lib_nas "free5gc/lib/nas"
+	"free5gc/lib/nas/nasMessage"
+	"free5gc/lib/ngap/ngapConvert"
+	"free5gc/lib/ngap/ngapType"
+	"sim-amf/pkg/api"
+	"sim-amf/pkg/context"
+	"sim-amf/pkg/event"
+	"sim-amf/pkg/fault"
+	"sim-amf/pkg/logger"
+	"sim-amf/pkg/trace"
+	"sim-amf/pkg/types"
+	"sim-amf/pkg/util"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// apiServer implements the gRPC control API on top of the AMFSet
+type apiServer struct{}
+
+// listenAPI starts the gRPC control API on the TCP address
+func listenAPI(addr string) (*grpc.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// the messages are JSON whatever the content-subtype of the requests, see api.ServerCodec
+	server := grpc.NewServer(grpc.CustomCodec(api.ServerCodec))
+	api.RegisterSimAMFServer(server, &apiServer{})
+	logger.MainLog.Info("API server listening on %s", addr)
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			logger.MainLog.Error("API serve failed: %s", err)
+		}
+	}()
+	return server, nil
+}
+
+// findUE returns the UEContext matching the selector
+func findUE(selector api.UESelector) (*context.UEContext, error) {
+	if selector.AmfUeNgapID != 0 {
+		if ue, ok := context.LoadSetUEContextAMFUENGAPID(selector.AmfUeNgapID); ok {
+			return ue, nil
+		}
+		return nil, status.Errorf(codes.NotFound, "no UE with AMF UE NGAP ID %d", selector.AmfUeNgapID)
+	}
+	var keys []string
+	if selector.MAC != "" {
+		keys = append(keys, context.IdentityKey(context.IdentityMAC, selector.MAC))
+	}
+	if selector.GlobalLineID != "" {
+		keys = append(keys, context.IdentityKey(context.IdentityGlobalLineID, selector.GlobalLineID))
+	}
+	if selector.GlobalCableID != "" {
+		keys = append(keys, context.IdentityKey(context.IdentityGlobalCableID, selector.GlobalCableID))
+	}
+	if len(keys) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "empty UE selector")
+	}
+	// the UEs are indexed by their identities on their shards
+	for _, key := range keys {
+		if ue, ok := context.LoadSetUEContextIdentity(key); ok {
+			return ue, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "no UE matching %+v", selector)
+}
+
+// findAGF returns the AGF connected to the AMF set from the SCTP address
+func findAGF(sctpAddr string) (*context.AGFContext, error) {
+	var found *context.AGFContext
+	context.RangeSetAGFContext(func(agf *context.AGFContext) bool {
+		if agf.SCTPAddr == sctpAddr {
+			found = agf
+			return false
+		}
+		return true
+	})
+	if found == nil {
+		return nil, status.Errorf(codes.NotFound, "no AGF %s", sctpAddr)
+	}
+	return found, nil
+}
+
+// sendToUE sends an NGAP message on the association of the AGF serving the UE
+func sendToUE(ue *context.UEContext, pkt []byte, err error) error {
+	if err != nil {
+		return status.Errorf(codes.Internal, "build failed: %v", err)
+	}
+	if ue.AGF == nil {
+		return status.Errorf(codes.FailedPrecondition, "UE %d is not served by any AGF", ue.AmfUeNgapId)
+	}
+	if _, err := SendData(ue.SCTPConn(), pkt, "Server"); err != nil {
+		return status.Errorf(codes.Unavailable, "send failed: %v", err)
+	}
+	return nil
+}
+
+func ngapCause(causePresent int, causeValue int64, defaultCausePresent int, defaultCauseValue aper.Enumerated) (ngapType.Cause, error) {
+	if causePresent == ngapType.CausePresentNothing {
+		return util.NgapCause(defaultCausePresent, defaultCauseValue)
+	}
+	cause, err := util.NgapCause(causePresent, aper.Enumerated(causeValue))
+	if err != nil {
+		return cause, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return cause, nil
+}
+
+func amfToAPI(amf *context.AMFContext) api.AMF {
+	guami := amf.ServedGuamiList.List[0].GUAMI
+	a := api.AMF{
+		Name:          amf.AMFName.Value,
+		SCTPAddr:      amf.SCTPAddr,
+		AmfID:         ngapConvert.AmfIdToModels(guami.AMFRegionID.Value, guami.AMFSetID.Value, guami.AMFPointer.Value),
+		Capacity:      amf.RelativeAMFCapacity.Value,
+		Reroute:       amf.Reroute,
+		Unavailable:   amf.Unavailable,
+		BackupAMFName: amf.BackupAMFName,
+	}
+	amf.RangeAGFContext(func(agf *context.AGFContext) bool {
+		a.AGFCount++
+		return true
+	})
+	return a
+}
+
+func agfToAPI(agf *context.AGFContext) api.AGF {
+	return api.AGF{
+		SCTPAddr:    agf.SCTPAddr,
+		AMF:         agf.AMF.AMFName.Value,
+		RANNodeName: agf.RANNodeName,
+		GlobalAGFID: agf.GlobalAGFIDStr(),
+		NGSetupDone: agf.NGSetupDone,
+		UECount:     agf.CountUEContext(),
+	}
+}
+
+func ueToAPI(ue *context.UEContext) api.UE {
+	u := api.UE{
+		AmfUeNgapID:  ue.AmfUeNgapId,
+		RanUeNgapID:  ue.RanUeNgapId,
+		RGType:       ue.RGTypeStr(),
+		Registered:   ue.ISAttached(),
+		GmmState:     ue.SmState(),
+		CmState:      ue.CmState(),
+		MAC:          ue.MAC,
+		GlobalLineID: ue.GlobalIDStr,
+		LineType:     ue.LineType,
+		Supi:         ue.Supi,
+		Suci:         ue.Suci,
+		Guti:         ue.Guti,
+	}
+	if ue.LineType == types.LineType_CABLE {
+		u.GlobalLineID, u.GlobalCableID = "", ue.GlobalIDStr
+		u.HFCNodeID = hex.EncodeToString(ue.HFCNodeID)
+	}
+	if ue.AGF != nil {
+		u.AGF = ue.AGF.SCTPAddr
+	}
+	if ue.CurrentAMF != nil {
+		u.AMF = ue.CurrentAMF.AMFName.Value
+	}
+	if ue.Ambr != nil {
+		u.UeAmbrUL = ue.Ambr.UEAggregateMaximumBitRateUL.Value
+		u.UeAmbrDL = ue.Ambr.UEAggregateMaximumBitRateDL.Value
+	}
+	u.IndexToRfsp = ue.IndexToRfsp
+	if ue.Trace != nil {
+		u.TraceID = ue.Trace.TraceIDString()
+	}
+	for _, location := range ue.UserLocations {
+		l := api.Location{
+			Time:         location.Time,
+			Procedure:    location.Procedure,
+			GlobalLineID: string(location.GlobalLineID),
+			LineType:     location.LineType,
+			Presence:     location.Presence,
+		}
+		if location.HFCNodeID != nil {
+			l.HFCNodeID = hex.EncodeToString(location.HFCNodeID)
+		}
+		u.Locations = append(u.Locations, l)
+	}
+	for psi := int64(1); psi <= 15; psi++ {
+		pduSession := ue.FindPDUSession(psi)
+		if pduSession == nil {
+			continue
+		}
+		snssai := ngapConvert.SNssaiToModels(pduSession.Snssai)
+		s := api.PDUSession{
+			PduSessionID: pduSession.Id,
+			Sst:          snssai.Sst,
+			Sd:           snssai.Sd,
+			Dnn:          pduSession.Dnn,
+		}
+		if pduSession.IPv4Address != nil {
+			s.IPv4Address = pduSession.IPv4Address.String()
+		}
+		if pduSession.IPv6Address != nil {
+			s.IPv6Address = pduSession.IPv6Address.String()
+		}
+		if pduSessionExtended, ok := ue.LoadPduSessionExtended(psi); ok {
+			s.Type = pduSessionExtended.Type
+			s.State = pduSessionExtended.State
+		}
+		u.PduSessions = append(u.PduSessions, s)
+	}
+	return u
+}
+
+func faultToAPI(rule fault.Rule) api.Fault {
+	return api.Fault{
+		ID:          rule.ID,
+		Action:      rule.Action,
+		Direction:   rule.Direction,
+		Messages:    rule.Messages,
+		UEs:         rule.UEs,
+		Probability: rule.Probability,
+		DelayMs:     int64(rule.Delay / time.Millisecond),
+		Count:       rule.Count,
+		Injected:    rule.Injected,
+	}
+}
+
+func (s *apiServer) ListAMFs(ctx gocontext.Context, req *api.ListAMFsRequest) (*api.ListAMFsResponse, error) {
+	rsp := &api.ListAMFsResponse{}
+	for _, amf := range context.AMFSet {
+		rsp.AMFs = append(rsp.AMFs, amfToAPI(amf))
+	}
+	return rsp, nil
+}
+
+func (s *apiServer) ListAGFs(ctx gocontext.Context, req *api.ListAGFsRequest) (*api.ListAGFsResponse, error) {
+	rsp := &api.ListAGFsResponse{}
+	context.RangeSetAGFContext(func(agf *context.AGFContext) bool {
+		rsp.AGFs = append(rsp.AGFs, agfToAPI(agf))
+		return true
+	})
+	return rsp, nil
+}
+
+func (s *apiServer) ListUEs(ctx gocontext.Context, req *api.ListUEsRequest) (*api.ListUEsResponse, error) {
+	rsp := &api.ListUEsResponse{}
+	var err error
+	context.RangeSetUEContext(func(ue *context.UEContext) bool {
+		err = runOnUE(ue, func() error {
+			if req.SCTPAddr == "" || (ue.AGF != nil && ue.AGF.SCTPAddr == req.SCTPAddr) {
+				rsp.UEs = append(rsp.UEs, ueToAPI(ue))
+			}
+			return nil
+		})
+		return err == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rsp, nil
+}
+
+func (s *apiServer) GetUE(ctx gocontext.Context, req *api.GetUERequest) (*api.UE, error) {
+	ue, err := findUE(req.UESelector)
+	if err != nil {
+		return nil, err
+	}
+	var u api.UE
+	err = runOnUE(ue, func() error {
+		u = ueToAPI(ue)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (s *apiServer) Deregister(ctx gocontext.Context, req *api.DeregisterRequest) (*api.Empty, error) {
+	ue, err := findUE(req.UESelector)
+	if err != nil {
+		return nil, err
+	}
+	err = runOnUE(ue, func() error {
+		// a UE in CM-IDLE is deregistered locally
+		if ue.AGF == nil {
+			ue.SetAttached(0)
+			gmmEvent(ue, context.GmmEventDeregistered)
+			ue.Remove()
+			return nil
+		}
+		if err := ue.SendGmmEvent(context.GmmEventDeregistrationStarted); err != nil {
+			return status.Errorf(codes.FailedPrecondition, "UE %d: %v", ue.AmfUeNgapId, err)
+		}
+		var buildErr error
+		build := func() ([]byte, error) {
+			pkt, err := BuildDeregistrationRequestUETerminated(ue, req.ReRegistrationRequired, req.Cause5GMM)
+			buildErr = err
+			return pkt, err
+		}
+		err := sendGuardedNAS(ue, context.T3522, lib_nas.MsgTypeDeregistrationRequestUETerminatedDeregistration, build)
+		if buildErr != nil {
+			return status.Errorf(codes.Internal, "build failed: %v", buildErr)
+		}
+		if err != nil {
+			return status.Errorf(codes.Unavailable, "send failed: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &api.Empty{}, nil
+}
+
+func (s *apiServer) ReleaseUEContext(ctx gocontext.Context, req *api.ReleaseUEContextRequest) (*api.Empty, error) {
+	ue, err := findUE(req.UESelector)
+	if err != nil {
+		return nil, err
+	}
+	cause, err := ngapCause(req.CausePresent, req.CauseValue, ngapType.CausePresentNas, ngapType.CauseNasPresentNormalRelease)
+	if err != nil {
+		return nil, err
+	}
+	err = runOnUE(ue, func() error {
+		pkt, err := BuildUEContextReleaseCommand(ue, cause)
+		return sendToUE(ue, pkt, err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &api.Empty{}, nil
+}
+
+func (s *apiServer) ModifyUEContext(ctx gocontext.Context, req *api.ModifyUEContextRequest) (*api.Empty, error) {
+	ue, err := findUE(req.UESelector)
+	if err != nil {
+		return nil, err
+	}
+	err = runOnUE(ue, func() error {
+		if ue.ContextModification != nil {
+			return status.Errorf(codes.FailedPrecondition, "UE Context Modification of UE %d in progress",
+				ue.AmfUeNgapId)
+		}
+		modification, err := newUEContextModification(ue, req)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		pkt, err := BuildUEContextModificationRequest(ue, modification)
+		if err := sendToUE(ue, pkt, err); err != nil {
+			return err
+		}
+		ue.ContextModification = modification
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &api.Empty{}, nil
+}
+
+func (s *apiServer) RekeyNAS(ctx gocontext.Context, req *api.RekeyNASRequest) (*api.Empty, error) {
+	ue, err := findUE(req.UESelector)
+	if err != nil {
+		return nil, err
+	}
+	err = runOnUE(ue, func() error {
+		switch {
+		case len(ue.Kamf) == 0 || !ue.SecurityContextAvailable:
+			return status.Errorf(codes.FailedPrecondition, "no NAS security context of UE %d", ue.AmfUeNgapId)
+		case !ue.Registered():
+			return status.Errorf(codes.FailedPrecondition, "UE %d is not registered", ue.AmfUeNgapId)
+		case ue.PreviousSecurityContext != nil:
+			return status.Errorf(codes.FailedPrecondition, "rekeying of UE %d in progress", ue.AmfUeNgapId)
+		}
+		integrityAlg, cipheringAlg, err := rekeyingAlgorithms(ue, req.NewNgKsi, req.IntegrityAlgorithm,
+			req.CipheringAlgorithm)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		return startRekeying(ue, req.NewNgKsi, integrityAlg, cipheringAlg)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &api.Empty{}, nil
+}
+
+func (s *apiServer) ModifyPDUSession(ctx gocontext.Context, req *api.ModifyPDUSessionRequest) (*api.Empty, error) {
+	ue, err := findUE(req.UESelector)
+	if err != nil {
+		return nil, err
+	}
+	if req.SessionAmbrUL <= 0 || req.SessionAmbrDL <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "Session-AMBR must be positive")
+	}
+	err = runOnUE(ue, func() error {
+		pduSession := ue.FindPDUSession(req.PduSessionID)
+		if pduSession == nil {
+			return status.Errorf(codes.NotFound, "no PDU Session %d", req.PduSessionID)
+		}
+		pkt, err := BuildPDUSessionResourceModifyRequest(ue, uint8(req.PduSessionID), req.SessionAmbrUL, req.SessionAmbrDL)
+		if err := sendToUE(ue, pkt, err); err != nil {
+			return err
+		}
+		pduSession.Ambr = &ngapType.PDUSessionAggregateMaximumBitRate{
+			PDUSessionAggregateMaximumBitRateUL: ngapType.BitRate{Value: req.SessionAmbrUL},
+			PDUSessionAggregateMaximumBitRateDL: ngapType.BitRate{Value: req.SessionAmbrDL},
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &api.Empty{}, nil
+}
+
+func (s *apiServer) ReleasePDUSession(ctx gocontext.Context, req *api.ReleasePDUSessionRequest) (*api.Empty, error) {
+	ue, err := findUE(req.UESelector)
+	if err != nil {
+		return nil, err
+	}
+	cause5GSM := req.Cause5GSM
+	if cause5GSM == 0 {
+		cause5GSM = nasMessage.Cause5GSMRegularDeactivation
+	}
+	err = runOnUE(ue, func() error {
+		if ue.FindPDUSession(req.PduSessionID) == nil {
+			return status.Errorf(codes.NotFound, "no PDU Session %d", req.PduSessionID)
+		}
+		pkt, err := BuildPDUSessionResourceReleaseCommand(ue, uint8(req.PduSessionID), cause5GSM)
+		return sendToUE(ue, pkt, err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &api.Empty{}, nil
+}
+
+func (s *apiServer) Page(ctx gocontext.Context, req *api.PageRequest) (*api.Empty, error) {
+	ue, err := findUE(req.UESelector)
+	if err != nil {
+		return nil, err
+	}
+	err = runOnUE(ue, func() error {
+		pkt, err := BuildPaging(ue)
+		return sendToUE(ue, pkt, err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &api.Empty{}, nil
+}
+
+func (s *apiServer) Reset(ctx gocontext.Context, req *api.ResetRequest) (*api.Empty, error) {
+	agf, err := findAGF(req.SCTPAddr)
+	if err != nil {
+		return nil, err
+	}
+	cause, err := ngapCause(req.CausePresent, req.CauseValue, ngapType.CausePresentMisc, ngapType.CauseMiscPresentOmIntervention)
+	if err != nil {
+		return nil, err
+	}
+
+	var partOfNGInterface *ngapType.UEAssociatedLogicalNGConnectionList
+	if len(req.UEs) > 0 {
+		partOfNGInterface = new(ngapType.UEAssociatedLogicalNGConnectionList)
+		for _, selector := range req.UEs {
+			ue, err := findUE(selector)
+			if err != nil {
+				return nil, err
+			}
+			err = runOnUE(ue, func() error {
+				if ue.AGF != agf {
+					return status.Errorf(codes.InvalidArgument, "UE %d is not served by AGF %s", ue.AmfUeNgapId, req.SCTPAddr)
+				}
+				item := ngapType.UEAssociatedLogicalNGConnectionItem{
+					AMFUENGAPID: &ngapType.AMFUENGAPID{Value: ue.AmfUeNgapId},
+					RANUENGAPID: &ngapType.RANUENGAPID{Value: ue.RanUeNgapId},
+				}
+				partOfNGInterface.List = append(partOfNGInterface.List, item)
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	pkt, err := BuildNGReset(cause, partOfNGInterface)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "build failed: %v", err)
+	}
+	if _, err := SendData(agf.SCTPConn, pkt, "Server"); err != nil {
+		return nil, status.Errorf(codes.Unavailable, "send failed: %v", err)
+	}
+	return &api.Empty{}, nil
+}
+
+func (s *apiServer) AMFStatusIndication(ctx gocontext.Context, req *api.AMFStatusIndicationRequest) (*api.Empty, error) {
+	amf, ok := context.LoadAMFContextName(req.AMFName)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no AMF %s", req.AMFName)
+	}
+	if err := indicateAMFUnavailable(amf, req.BackupAMFName); err != nil {
+		return nil, status.Errorf(codes.Internal, "build failed: %v", err)
+	}
+	return &api.Empty{}, nil
+}
+
+func (s *apiServer) AMFConfigurationUpdate(ctx gocontext.Context, req *api.AMFConfigurationUpdateRequest) (*api.Empty, error) {
+	amf, ok := context.LoadAMFContextName(req.AMFName)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no AMF %s", req.AMFName)
+	}
+	findEndpoint := func(address string) (*context.AMFTNLAssociationItem, error) {
+		if item, ok := amf.FindTNLEndpoint(address); ok {
+			return item, nil
+		}
+		return nil, status.Errorf(codes.NotFound, "no TNL endpoint %s of AMF %s", address, req.AMFName)
+	}
+
+	var toAdd, toRemove, toUpdate []*context.AMFTNLAssociationItem
+	for _, address := range req.Add {
+		item, err := findEndpoint(address)
+		if err != nil {
+			return nil, err
+		}
+		toAdd = append(toAdd, item)
+	}
+	for _, address := range req.Remove {
+		item, err := findEndpoint(address)
+		if err != nil {
+			return nil, err
+		}
+		toRemove = append(toRemove, item)
+	}
+	for _, update := range req.Update {
+		item, err := findEndpoint(update.Address)
+		if err != nil {
+			return nil, err
+		}
+		updated := *item
+		if update.Usage != "" {
+			usage, ok := tnlAssociationUsages[update.Usage]
+			if !ok {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid usage %s, expecting ue, non-ue or both", update.Usage)
+			}
+			updated.TNLAssociationUsage = &ngapType.TNLAssociationUsage{Value: usage}
+		}
+		if update.Weight != nil {
+			if *update.Weight < 0 || *update.Weight > 255 {
+				return nil, status.Errorf(codes.InvalidArgument, "weight factor %d out of range", *update.Weight)
+			}
+			weight := *update.Weight
+			updated.TNLAddressWeightFactor = &weight
+		}
+		toUpdate = append(toUpdate, &updated)
+	}
+	if len(toAdd) == 0 && len(toRemove) == 0 && len(toUpdate) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no TNL endpoint to add, remove or update")
+	}
+
+	if err := updateTNLEndpoints(amf, toAdd, toRemove, toUpdate, req.AbortRemoved); err != nil {
+		return nil, status.Errorf(codes.Internal, "build failed: %v", err)
+	}
+	return &api.Empty{}, nil
+}
+
+func (s *apiServer) ReleaseUETNLABinding(ctx gocontext.Context, req *api.ReleaseUETNLABindingRequest) (*api.Empty, error) {
+	ue, err := findUE(req.UESelector)
+	if err != nil {
+		return nil, err
+	}
+	err = runOnUE(ue, func() error {
+		pkt, err := BuildUETNLABindingReleaseRequest(ue)
+		if err := sendToUE(ue, pkt, err); err != nil {
+			return err
+		}
+		ue.TNLA = nil
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &api.Empty{}, nil
+}
+
+func (s *apiServer) AMFCPRelocationIndication(ctx gocontext.Context, req *api.AMFCPRelocationIndicationRequest) (*api.Empty, error) {
+	ue, err := findUE(req.UESelector)
+	if err != nil {
+		return nil, err
+	}
+	err = runOnUE(ue, func() error {
+		pkt, err := BuildAMFCPRelocationIndication(ue)
+		return sendToUE(ue, pkt, err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &api.Empty{}, nil
+}
+
+func (s *apiServer) TraceStart(ctx gocontext.Context, req *api.TraceStartRequest) (*api.Empty, error) {
+	ue, err := findUE(req.UESelector)
+	if err != nil {
+		return nil, err
+	}
+	var trace *context.TraceSettings
+	if req.TraceID != "" {
+		if trace, err = parseTraceSettings(req.TraceID, req.Interfaces, req.Depth, req.CollectionEntity); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	err = runOnUE(ue, func() error {
+		if trace == nil && ue.Subscriber != nil {
+			trace = ue.Subscriber.Trace
+		}
+		if trace == nil {
+			return status.Errorf(codes.InvalidArgument, "no trace parameters given nor configured for UE %d",
+				ue.AmfUeNgapId)
+		}
+		pkt, err := BuildTraceStart(ue, trace)
+		if err := sendToUE(ue, pkt, err); err != nil {
+			return err
+		}
+		ue.Trace = trace
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &api.Empty{}, nil
+}
+
+func (s *apiServer) DeactivateTrace(ctx gocontext.Context, req *api.DeactivateTraceRequest) (*api.Empty, error) {
+	ue, err := findUE(req.UESelector)
+	if err != nil {
+		return nil, err
+	}
+	err = runOnUE(ue, func() error {
+		if ue.Trace == nil {
+			return status.Errorf(codes.FailedPrecondition, "no trace session of UE %d", ue.AmfUeNgapId)
+		}
+		pkt, err := BuildDeactivateTrace(ue, ue.Trace.TraceID)
+		if err := sendToUE(ue, pkt, err); err != nil {
+			return err
+		}
+		ue.Trace = nil
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &api.Empty{}, nil
+}
+
+func (s *apiServer) LocationReportingControl(ctx gocontext.Context,
+	req *api.LocationReportingControlRequest) (*api.Empty, error) {
+	ue, err := findUE(req.UESelector)
+	if err != nil {
+		return nil, err
+	}
+	err = runOnUE(ue, func() error {
+		requestType, err := buildLocationReportingRequestType(ue, req)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		pkt, err := BuildLocationReportingControl(ue, requestType)
+		return sendToUE(ue, pkt, err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &api.Empty{}, nil
+}
+
+func (s *apiServer) SetTrace(ctx gocontext.Context, req *api.SetTraceRequest) (*api.Empty, error) {
+	if trace.Global == nil {
+		return nil, status.Error(codes.FailedPrecondition, "message trace is disabled")
+	}
+	ue, err := findUE(req.UESelector)
+	if err != nil {
+		return nil, err
+	}
+	trace.Global.EnableUE(ue, req.Enable)
+	return &api.Empty{}, nil
+}
+
+func (s *apiServer) SetNASTimer(ctx gocontext.Context, req *api.SetNASTimerRequest) (*api.Empty, error) {
+	if req.Value < 0 || (req.MaxRetransmissions != nil && *req.MaxRetransmissions < 0) {
+		return nil, status.Error(codes.InvalidArgument, "negative timer value or retransmissions")
+	}
+	ue, err := findUE(req.UESelector)
+	if err != nil {
+		return nil, err
+	}
+	err = runOnUE(ue, func() error {
+		var value, maxRetryTimes *int
+		switch req.Timer {
+		case context.T3522:
+			value, maxRetryTimes = &ue.T3522Value, &ue.MaxT3522RetryTimes
+		case context.T3550:
+			value, maxRetryTimes = &ue.T3550Value, &ue.MaxT3550RetryTimes
+		case context.T3560:
+			value, maxRetryTimes = &ue.T3560Value, &ue.MaxT3560RetryTimes
+		case context.T3570:
+			value, maxRetryTimes = &ue.T3570Value, &ue.MaxT3570RetryTimes
+		default:
+			return status.Errorf(codes.InvalidArgument, "unknown timer %s", req.Timer)
+		}
+		if req.Value != 0 {
+			*value = req.Value
+		}
+		if req.MaxRetransmissions != nil {
+			*maxRetryTimes = *req.MaxRetransmissions
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &api.Empty{}, nil
+}
+
+func (s *apiServer) AddFault(ctx gocontext.Context, req *api.Fault) (*api.Fault, error) {
+	injector := fault.Global
+	if injector == nil {
+		return nil, status.Error(codes.FailedPrecondition, "sim-amf stopped")
+	}
+	rule, err := injector.Add(fault.Rule{
+		Action:      req.Action,
+		Direction:   req.Direction,
+		Messages:    req.Messages,
+		UEs:         req.UEs,
+		Probability: req.Probability,
+		Delay:       time.Duration(req.DelayMs) * time.Millisecond,
+		Count:       req.Count,
+	})
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	logger.MainLog.Info("Fault %d added: %s", rule.ID, rule.Action)
+	f := faultToAPI(rule)
+	return &f, nil
+}
+
+func (s *apiServer) RemoveFaults(ctx gocontext.Context, req *api.RemoveFaultsRequest) (*api.Empty, error) {
+	injector := fault.Global
+	if injector == nil {
+		return nil, status.Error(codes.FailedPrecondition, "sim-amf stopped")
+	}
+	if n := injector.Remove(req.IDs...); n < len(req.IDs) {
+		return nil, status.Errorf(codes.NotFound, "%d of the faults not found", len(req.IDs)-n)
+	}
+	return &api.Empty{}, nil
+}
+
+func (s *apiServer) ListFaults(ctx gocontext.Context, req *api.ListFaultsRequest) (*api.ListFaultsResponse, error) {
+	resp := &api.ListFaultsResponse{Faults: []api.Fault{}}
+	for _, rule := range fault.Global.Rules() {
+		resp.Faults = append(resp.Faults, faultToAPI(rule))
+	}
+	return resp, nil
+}
+
+func (s *apiServer) ReloadSubscribers(ctx gocontext.Context, req *api.ReloadSubscribersRequest) (*api.ReloadSubscribersResponse, error) {
+	count, err := loadSubscribers()
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "reload subscribers failed: %v", err)
+	}
+	logger.MainLog.Info("Reloaded %d subscribers", count)
+	return &api.ReloadSubscribersResponse{Subscribers: count}, nil
+}
+
+func (s *apiServer) WatchEvents(req *api.WatchEventsRequest, stream api.SimAMFWatchEventsServer) error {
+	var ue *context.UEContext
+	if req.UESelector != (api.UESelector{}) {
+		var err error
+		if ue, err = findUE(req.UESelector); err != nil {
+			return err
+		}
+	}
+	events, unsubscribe := event.Subscribe(256)
+	defer unsubscribe()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case e := <-events:
+			if ue != nil && e.AmfUeNgapId != ue.AmfUeNgapId {
+				continue
+			}
+			err := stream.Send(&api.Event{
+				Time:         e.Time,
+				Type:         string(e.Type),
+				AmfUeNgapID:  e.AmfUeNgapId,
+				MAC:          e.MAC,
+				Timer:        e.Timer,
+				ExpireTimes:  e.ExpireTimes,
+				Procedure:    e.Procedure,
+				PDUSessionID: e.PDUSessionID,
+				Detail:       e.Detail,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
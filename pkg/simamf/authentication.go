@@ -0,0 +1,208 @@
+package simamf
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+
+	"free5gc/lib/UeauCommon"
+	"free5gc/lib/milenage"
+	lib_nas "free5gc/lib/nas"
+	"free5gc/lib/nas/nasMessage"
+	"free5gc/lib/ngap/ngapType"
+	"sim-amf/pkg/context"
+	"sim-amf/pkg/logger"
+)
+
+// authenticationManagementField is the AMF field of the AUTN, with the separation bit set for 5G AKA
+//
+// TS 33.102 Annex H, TS 33.501 6.1.3.2.0
+var authenticationManagementField = []byte{0x80, 0x00}
+
+// servingNetworkName returns the serving network name the 5G AKA keys are bound to, e.g.
+// 5G:mnc090.mcc207.3gppnetwork.org
+//
+// TS 24.501 9.12.1 Serving network name (SNN)
+func servingNetworkName() string {
+	plmn, _ := parsePlmnID(plmnID)
+	return fmt.Sprintf("5G:mnc%03s.mcc%s.3gppnetwork.org", plmn.Mnc, plmn.Mcc)
+}
+
+// startAuthentication generates a 5G AKA authentication vector from the K and OPc of the Subscriber of a 5G-RG,
+// playing the AUSF and UDM, and sends the Authentication Request. The KSEAF and XRES* are kept for the Authentication
+// Response.
+//
+// TS 33.501 6.1.3.2 Authentication procedure for 5G AKA, TS 24.501 5.4.1.3 5G AKA based primary authentication and key
+// agreement procedure
+func startAuthentication(ue *context.UEContext) error {
+	subscriber := ue.Subscriber
+	if subscriber == nil || len(subscriber.K) == 0 || len(subscriber.OPc) == 0 {
+		return fmt.Errorf("no K nor OPc subscribed")
+	}
+
+	sqn := make([]byte, 8)
+	binary.BigEndian.PutUint64(sqn, subscriber.NextSqn())
+	sqn = sqn[2:]
+	ue.Rand = make([]byte, 16)
+	if _, err := rand.Read(ue.Rand); err != nil {
+		return err
+	}
+	autn, ik, ck, ak, res := make([]byte, 16), make([]byte, 16), make([]byte, 16), make([]byte, 6), make([]byte, 8)
+	resLen := uint(len(res))
+	milenage.MilenageGenerate(subscriber.OPc, authenticationManagementField, subscriber.K, sqn, ue.Rand, autn, ik, ck,
+		ak, res, &resLen)
+	if resLen == 0 {
+		return fmt.Errorf("milenage failed")
+	}
+
+	key := append(ck, ik...)
+	snName := []byte(servingNetworkName())
+	xresStar := UeauCommon.GetKDFValue(key, UeauCommon.FC_FOR_RES_STAR_XRES_STAR_DERIVATION,
+		snName, UeauCommon.KDFLen(snName), ue.Rand, UeauCommon.KDFLen(ue.Rand), res, UeauCommon.KDFLen(res))
+	ue.XresStar = xresStar[16:]
+	// SQN xor AK are the first 6 octets of the AUTN
+	kausf := UeauCommon.GetKDFValue(key, UeauCommon.FC_FOR_KAUSF_DERIVATION,
+		snName, UeauCommon.KDFLen(snName), autn[:6], UeauCommon.KDFLen(autn[:6]))
+	ue.Kseaf = UeauCommon.GetKDFValue(kausf, UeauCommon.FC_FOR_KSEAF_DERIVATION, snName, UeauCommon.KDFLen(snName))
+
+	// a new ngKSI for the new partial native security context
+	ue.NgKsi.Ksi = (ue.NgKsi.Ksi + 1) % nasMessage.NasKeySetIdentifierNoKeyIsAvailable
+	ue.ABBA = []byte{0x00, 0x00}
+	err := sendGuardedNAS(ue, context.T3560, lib_nas.MsgTypeAuthenticationRequest, func() ([]byte, error) {
+		return BuildAuthenticationRequest(ue, autn)
+	})
+	if err != nil {
+		return err
+	}
+	gmmEvent(ue, context.GmmEventCommonProcedureStarted)
+	return nil
+}
+
+// handleAuthenticationResponse checks the RES* of the 5G-RG against the XRES*, and starts the Security Mode Command
+// procedure with the KAMF derived from the KSEAF on success
+//
+// TS 33.501 6.1.3.2.0 5G AKA, TS 24.501 5.4.1.3.4 Authentication response by the network
+func handleAuthenticationResponse(ue *context.UEContext, authenticationResponse *nasMessage.AuthenticationResponse) {
+	ue.StopNASTimer(context.T3560)
+	if authenticationResponse.AuthenticationResponseParameter == nil || len(ue.XresStar) == 0 {
+		logger.MainLog.Warn("[%s] Missing RES* in Authentication Response", ue.LogTag("NAS"))
+		rejectAuthentication(ue)
+		return
+	}
+	resStar := authenticationResponse.AuthenticationResponseParameter.GetRES()
+	if !bytes.Equal(resStar[:], ue.XresStar) {
+		logger.MainLog.Warn("[%s] RES* %x mismatch, XRES* %x", ue.LogTag("NAS"), resStar, ue.XresStar)
+		rejectAuthentication(ue)
+		return
+	}
+
+	ue.SynchFailures = 0
+	ue.DerivateKamf(ue.Kseaf)
+	ue.XresStar, ue.Kseaf = nil, nil
+	sendSecurityModeCommand(ue)
+}
+
+// handleAuthenticationFailure re-synchronises the SQN of the Subscriber from the AUTS of a synch failure and starts a
+// new authentication once. The other failures abort the registration.
+//
+// TS 24.501 5.4.1.3.7 Authentication not accepted by the UE, TS 33.102 6.3.5 Re-synchronisation procedure
+func handleAuthenticationFailure(ue *context.UEContext, authenticationFailure *nasMessage.AuthenticationFailure) {
+	ue.StopNASTimer(context.T3560)
+	cause5GMM := authenticationFailure.Cause5GMM.GetCauseValue()
+	if cause5GMM != nasMessage.Cause5GMMSynchFailure || authenticationFailure.AuthenticationFailureParameter == nil ||
+		len(ue.Rand) == 0 {
+		logger.MainLog.Warn("[%s] Authentication Failure cause %d", ue.LogTag("NAS"), cause5GMM)
+		gmmEvent(ue, context.GmmEventRegistrationRejected)
+		sendUEContextReleaseCommand(ue, ngapType.CauseNasPresentAuthenticationFailure)
+		return
+	}
+
+	ue.SynchFailures++
+	auts := authenticationFailure.AuthenticationFailureParameter.GetAuthenticationFailureParameter()
+	sqnMS := make([]byte, 6)
+	if ue.SynchFailures > 1 ||
+		milenage.Milenage_auts(ue.Subscriber.OPc, ue.Subscriber.K, ue.Rand, auts[:], sqnMS) != 0 {
+		logger.MainLog.Warn("[%s] Authentication re-synchronisation failed", ue.LogTag("NAS"))
+		rejectAuthentication(ue)
+		return
+	}
+	logger.MainLog.Info("[%s] Authentication re-synchronised to SQN %x", ue.LogTag("NAS"), sqnMS)
+	ue.Subscriber.ResyncSqn(binary.BigEndian.Uint64(append([]byte{0, 0}, sqnMS...)))
+	if err := startAuthentication(ue); err != nil {
+		logger.MainLog.Error("Error %v", err)
+	}
+}
+
+// rejectAuthentication sends an Authentication Reject and releases the NG connection of the UE
+//
+// TS 24.501 5.4.1.3.5 Authentication not accepted by the network
+func rejectAuthentication(ue *context.UEContext) {
+	pkt, err := BuildAuthenticationReject(ue)
+	if err != nil {
+		logger.MainLog.Error("Error %v", err)
+		return
+	}
+	if _, err = SendData(ue.SCTPConn(), pkt, "Server"); err != nil {
+		logger.MainLog.Error("Error %v", err)
+		return
+	}
+	gmmEvent(ue, context.GmmEventRegistrationRejected)
+	sendUEContextReleaseCommand(ue, ngapType.CauseNasPresentAuthenticationFailure)
+}
+
+// sendSecurityModeCommand starts the Security Mode Command procedure. The 5G-RG gets the NAS security algorithms
+// selected from its UE security capability and a new NAS security context derived from its KAMF, the W-AGF serving an
+// FN-RG keeps the null algorithms.
+//
+// TS 24.501 5.4.2 Security mode control procedure
+func sendSecurityModeCommand(ue *context.UEContext) {
+	if len(ue.Kamf) > 0 {
+		if !ue.SelectSecurityAlg() {
+			logger.MainLog.Warn("[%s] No NAS integrity algorithm supported", ue.LogTag("NAS"))
+			rejectRegistration(ue, nasMessage.Cause5GMMUESecurityCapabilitiesMismatch)
+			return
+		}
+		ue.DerivateAlgKey()
+		ue.EnableIntegrityProtection()
+	}
+
+	if err := sendGuardedSecurityModeCommand(ue); err != nil {
+		logger.MainLog.Error("Error %v", err)
+		return
+	}
+	gmmEvent(ue, context.GmmEventCommonProcedureStarted)
+}
+
+// sendGuardedSecurityModeCommand sends the Security Mode Command guarded by T3560. The NAS COUNTs are reset when a new
+// KAMF is taken into use, not on a change of the algorithms of the current one, and the retransmissions are protected
+// with the next downlink NAS COUNT, the UE discarding a replayed one.
+//
+// TS 33.501 6.9.3 Key-change-on-the-fly, TS 24.501 4.4.3.1 NAS COUNT
+func sendGuardedSecurityModeCommand(ue *context.UEContext) error {
+	newKamf := ue.PreviousSecurityContext == nil || ue.HorizontalDerivation
+	return sendGuardedNAS(ue, context.T3560, lib_nas.MsgTypeSecurityModeCommand, func() ([]byte, error) {
+		pkt, err := BuildSecurityModeCommand(ue, newKamf)
+		newKamf = false
+		return pkt, err
+	})
+}
+
+// integrityChecked tells whether an uplink 5GMM message may be processed: once the UE has a NAS security context, only
+// the messages of TS 24.501 4.4.4.3 are processed without passing the integrity check
+func integrityChecked(ue *context.UEContext, msg *lib_nas.Message) bool {
+	if !ue.SecurityContextAvailable || (msg.SecurityHeaderType != lib_nas.SecurityHeaderTypePlainNas && !ue.MacFailed) {
+		return true
+	}
+	switch msg.GmmMessage.GetMessageType() {
+	case lib_nas.MsgTypeRegistrationRequest,
+		lib_nas.MsgTypeIdentityResponse,
+		lib_nas.MsgTypeAuthenticationResponse,
+		lib_nas.MsgTypeAuthenticationFailure,
+		lib_nas.MsgTypeSecurityModeReject,
+		lib_nas.MsgTypeDeregistrationRequestUEOriginatingDeregistration,
+		lib_nas.MsgTypeDeregistrationAcceptUETerminatedDeregistration:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,2310 @@
+package simamf
+
+import (
+	"fmt"
+	"free5gc/lib/aper"
+	"free5gc/lib/nas"
+	"free5gc/lib/nas/nasConvert"
+	"free5gc/lib/nas/nasMessage"
+	"free5gc/lib/nas/nasType"
+	"free5gc/lib/ngap"
+	"free5gc/lib/ngap/ngapConvert"
+	"free5gc/lib/ngap/ngapType"
+	"free5gc/lib/openapi/models"
+	"net"
+	"sim-amf/pkg/context"
+	"sim-amf/pkg/logger"
+	amf_nas "sim-amf/pkg/nas"
+	"sim-amf/pkg/types"
+	"sim-amf/pkg/util"
+	"time"
+)
+
+// copied from src/test/ngapTestPacket/build.go, in case more changes for various test cases
+func buildNGSetupResponse(amfName string, guamiList []ngapType.ServedGUAMIItem, plmnList []ngapType.PLMNSupportItem, amfRelativeCapacity int64) (pdu ngapType.NGAPPDU) {
+
+	pdu.Present = ngapType.NGAPPDUPresentSuccessfulOutcome
+	pdu.SuccessfulOutcome = new(ngapType.SuccessfulOutcome)
+
+	successfulOutcome := pdu.SuccessfulOutcome
+	successfulOutcome.ProcedureCode.Value = ngapType.ProcedureCodeNGSetup
+	successfulOutcome.Criticality.Value = ngapType.CriticalityPresentReject
+	successfulOutcome.Value.Present = ngapType.SuccessfulOutcomePresentNGSetupResponse
+	successfulOutcome.Value.NGSetupResponse = new(ngapType.NGSetupResponse)
+
+	nGSetupResponse := successfulOutcome.Value.NGSetupResponse
+	nGSetupResponseIEs := &nGSetupResponse.ProtocolIEs
+
+	// AMFName
+	ie := ngapType.NGSetupResponseIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDAMFName
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.NGSetupResponseIEsPresentAMFName
+	ie.Value.AMFName = new(ngapType.AMFName)
+
+	aMFName := ie.Value.AMFName
+	aMFName.Value = amfName
+
+	nGSetupResponseIEs.List = append(nGSetupResponseIEs.List, ie)
+
+	// ServedGUAMIList
+	ie = ngapType.NGSetupResponseIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDServedGUAMIList
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.NGSetupResponseIEsPresentServedGUAMIList
+	ie.Value.ServedGUAMIList = new(ngapType.ServedGUAMIList)
+
+	servedGUAMIList := ie.Value.ServedGUAMIList
+	servedGUAMIList.List = guamiList
+
+	nGSetupResponseIEs.List = append(nGSetupResponseIEs.List, ie)
+
+	// relativeAMFCapacity
+	ie = ngapType.NGSetupResponseIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRelativeAMFCapacity
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.NGSetupResponseIEsPresentRelativeAMFCapacity
+	ie.Value.RelativeAMFCapacity = new(ngapType.RelativeAMFCapacity)
+	relativeAMFCapacity := ie.Value.RelativeAMFCapacity
+	relativeAMFCapacity.Value = amfRelativeCapacity
+
+	nGSetupResponseIEs.List = append(nGSetupResponseIEs.List, ie)
+
+	// PLMNSupportList
+	ie = ngapType.NGSetupResponseIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDPLMNSupportList
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.NGSetupResponseIEsPresentPLMNSupportList
+	ie.Value.PLMNSupportList = new(ngapType.PLMNSupportList)
+
+	pLMNSupportList := ie.Value.PLMNSupportList
+	pLMNSupportList.List = plmnList
+
+	nGSetupResponseIEs.List = append(nGSetupResponseIEs.List, ie)
+
+	return
+}
+
+// BuildSecurityModeCommand builds the Security Mode Command of the NAS security context of the UE. newKamf resets the
+// NAS COUNTs, on the first transmission of the command taking a new KAMF into use.
+func BuildSecurityModeCommand(ue *context.UEContext, newKamf bool) ([]byte, error) {
+	var nasMsg []byte
+	var pdu []byte
+	var err error
+	nasMsg, err = buildSecurityModeCommnad(ue, newKamf)
+	if err != nil {
+		logger.MainLog.Error("[TEST] Build Security Mode Command failed : %+v", err)
+		return nasMsg, err
+	}
+	pdu, err = BuildDownlinkNasTransport(ue, nasMsg, nil)
+	if err != nil {
+		logger.MainLog.Error("[TEST] Build Down Link NAS Transport failed : %+v", err)
+		return pdu, err
+	}
+	return pdu, err
+}
+
+func buildSecurityModeCommnad(ue *context.UEContext, newKamf bool) ([]byte, error) {
+	m := nas.NewMessage()
+	m.GmmMessage = nas.NewGmmMessage()
+	m.GmmHeader.SetMessageType(nas.MsgTypeSecurityModeCommand)
+
+	m.SecurityHeader = nas.SecurityHeader{
+		ProtocolDiscriminator: nasMessage.Epd5GSMobilityManagementMessage,
+		SecurityHeaderType:    nas.SecurityHeaderTypeIntegrityProtectedWithNew5gNasSecurityContext,
+	}
+
+	securityModeCommand := nasMessage.NewSecurityModeCommand(0)
+	securityModeCommand.SpareHalfOctetAndSecurityHeaderType.SetSecurityHeaderType(nas.SecurityHeaderTypePlainNas)
+	securityModeCommand.SpareHalfOctetAndSecurityHeaderType.SetSpareHalfOctet(0)
+	securityModeCommand.ExtendedProtocolDiscriminator.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSMobilityManagementMessage)
+	securityModeCommand.SecurityModeCommandMessageIdentity.SetMessageType(nas.MsgTypeSecurityModeCommand)
+
+	securityModeCommand.SelectedNASSecurityAlgorithms.SetTypeOfCipheringAlgorithm(ue.CipheringAlg)
+	securityModeCommand.SelectedNASSecurityAlgorithms.SetTypeOfIntegrityProtectionAlgorithm(ue.IntegrityAlg)
+
+	securityModeCommand.SpareHalfOctetAndNgksi = nasConvert.SpareHalfOctetAndNgksiToNas(ue.NgKsi)
+
+	securityModeCommand.ReplayedUESecurityCapabilities.SetLen(ue.NasUESecurityCapability.GetLen())
+	securityModeCommand.ReplayedUESecurityCapabilities.Buffer = ue.NasUESecurityCapability.Buffer
+
+	securityModeCommand.IMEISVRequest = nasType.NewIMEISVRequest(nasMessage.SecurityModeCommandIMEISVRequestType)
+	securityModeCommand.IMEISVRequest.SetIMEISVRequestValue(nasMessage.IMEISVNotRequested)
+
+	securityModeCommand.Additional5GSecurityInformation = nasType.NewAdditional5GSecurityInformation(nasMessage.SecurityModeCommandAdditional5GSecurityInformationType)
+	securityModeCommand.Additional5GSecurityInformation.SetLen(1)
+	/*if ue.IsCleartext*/ {
+		securityModeCommand.Additional5GSecurityInformation.SetRINMR(0)
+	} /* else {
+		securityModeCommand.Additional5GSecurityInformation.SetRINMR(1)
+	}*/
+
+	// the K'AMF of a rekeying derived horizontally, TS 24.501 5.4.2.2
+	if ue.HorizontalDerivation {
+		securityModeCommand.Additional5GSecurityInformation.SetHDP(1)
+	} else {
+		securityModeCommand.Additional5GSecurityInformation.SetHDP(0)
+	}
+
+	m.GmmMessage.SecurityModeCommand = securityModeCommand
+	// plain for the FN-RG of which the W-AGF has no NAS security context
+	return amf_nas.Encode(ue, m, newKamf)
+}
+
+// amf/gmm/message/build.go: BuildAuthenticationRequest
+func BuildAuthenticationRequest(ue *context.UEContext, autn []byte) ([]byte, error) {
+	nasMsg, err := buildAuthenticationRequest(ue, autn)
+	if err != nil {
+		return nil, err
+	}
+	return BuildDownlinkNasTransport(ue, nasMsg, nil)
+}
+
+func buildAuthenticationRequest(ue *context.UEContext, autn []byte) ([]byte, error) {
+	m := nas.NewMessage()
+	m.GmmMessage = nas.NewGmmMessage()
+	m.GmmHeader.SetMessageType(nas.MsgTypeAuthenticationRequest)
+
+	m.SecurityHeader = nas.SecurityHeader{
+		ProtocolDiscriminator: nasMessage.Epd5GSMobilityManagementMessage,
+		SecurityHeaderType:    nas.SecurityHeaderTypeIntegrityProtectedAndCiphered,
+	}
+
+	authenticationRequest := nasMessage.NewAuthenticationRequest(0)
+	authenticationRequest.ExtendedProtocolDiscriminator.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSMobilityManagementMessage)
+	authenticationRequest.SpareHalfOctetAndSecurityHeaderType.SetSecurityHeaderType(nas.SecurityHeaderTypePlainNas)
+	authenticationRequest.SpareHalfOctetAndSecurityHeaderType.SetSpareHalfOctet(0)
+	authenticationRequest.AuthenticationRequestMessageIdentity.SetMessageType(nas.MsgTypeAuthenticationRequest)
+	authenticationRequest.SpareHalfOctetAndNgksi = nasConvert.SpareHalfOctetAndNgksiToNas(ue.NgKsi)
+	authenticationRequest.ABBA.SetLen(uint8(len(ue.ABBA)))
+	authenticationRequest.ABBA.SetABBAContents(ue.ABBA)
+
+	var tmpArray [16]byte
+	authenticationRequest.AuthenticationParameterRAND = nasType.NewAuthenticationParameterRAND(nasMessage.AuthenticationRequestAuthenticationParameterRANDType)
+	copy(tmpArray[:], ue.Rand)
+	authenticationRequest.AuthenticationParameterRAND.SetRANDValue(tmpArray)
+
+	authenticationRequest.AuthenticationParameterAUTN = nasType.NewAuthenticationParameterAUTN(nasMessage.AuthenticationRequestAuthenticationParameterAUTNType)
+	authenticationRequest.AuthenticationParameterAUTN.SetLen(uint8(len(autn)))
+	copy(tmpArray[:], autn)
+	authenticationRequest.AuthenticationParameterAUTN.SetAUTN(tmpArray)
+
+	m.GmmMessage.AuthenticationRequest = authenticationRequest
+	return amf_nas.Encode(ue, m, false)
+}
+
+// amf/gmm/message/build.go: BuildAuthenticationReject
+func BuildAuthenticationReject(ue *context.UEContext) ([]byte, error) {
+	nasMsg, err := buildAuthenticationReject(ue)
+	if err != nil {
+		return nil, err
+	}
+	return BuildDownlinkNasTransport(ue, nasMsg, nil)
+}
+
+func buildAuthenticationReject(ue *context.UEContext) ([]byte, error) {
+	m := nas.NewMessage()
+	m.GmmMessage = nas.NewGmmMessage()
+	m.GmmHeader.SetMessageType(nas.MsgTypeAuthenticationReject)
+
+	m.SecurityHeader = nas.SecurityHeader{
+		ProtocolDiscriminator: nasMessage.Epd5GSMobilityManagementMessage,
+		SecurityHeaderType:    nas.SecurityHeaderTypePlainNas,
+	}
+
+	authenticationReject := nasMessage.NewAuthenticationReject(0)
+	authenticationReject.ExtendedProtocolDiscriminator.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSMobilityManagementMessage)
+	authenticationReject.SpareHalfOctetAndSecurityHeaderType.SetSecurityHeaderType(nas.SecurityHeaderTypePlainNas)
+	authenticationReject.SpareHalfOctetAndSecurityHeaderType.SetSpareHalfOctet(0)
+	authenticationReject.AuthenticationRejectMessageIdentity.SetMessageType(nas.MsgTypeAuthenticationReject)
+
+	m.GmmMessage.AuthenticationReject = authenticationReject
+	return amf_nas.Encode(ue, m, false)
+}
+
+func BuildDownlinkNasTransport(ue *context.UEContext, nasPdu []byte, mobilityRestrictionList *ngapType.MobilityRestrictionList) ([]byte, error) {
+
+	var pdu ngapType.NGAPPDU
+
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodeDownlinkNASTransport
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentIgnore
+
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentDownlinkNASTransport
+	initiatingMessage.Value.DownlinkNASTransport = new(ngapType.DownlinkNASTransport)
+
+	downlinkNasTransport := initiatingMessage.Value.DownlinkNASTransport
+	downlinkNasTransportIEs := &downlinkNasTransport.ProtocolIEs
+
+	// AMF UE NGAP ID
+	ie := ngapType.DownlinkNASTransportIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDAMFUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.DownlinkNASTransportIEsPresentAMFUENGAPID
+	ie.Value.AMFUENGAPID = new(ngapType.AMFUENGAPID)
+
+	aMFUENGAPID := ie.Value.AMFUENGAPID
+	aMFUENGAPID.Value = ue.AmfUeNgapId
+
+	downlinkNasTransportIEs.List = append(downlinkNasTransportIEs.List, ie)
+
+	// RAN UE NGAP ID
+	ie = ngapType.DownlinkNASTransportIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.DownlinkNASTransportIEsPresentRANUENGAPID
+	ie.Value.RANUENGAPID = new(ngapType.RANUENGAPID)
+
+	rANUENGAPID := ie.Value.RANUENGAPID
+	rANUENGAPID.Value = ue.RanUeNgapId
+
+	downlinkNasTransportIEs.List = append(downlinkNasTransportIEs.List, ie)
+
+	// NAS PDU
+	ie = ngapType.DownlinkNASTransportIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDNASPDU
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.DownlinkNASTransportIEsPresentNASPDU
+	ie.Value.NASPDU = new(ngapType.NASPDU)
+
+	ie.Value.NASPDU.Value = nasPdu
+
+	downlinkNasTransportIEs.List = append(downlinkNasTransportIEs.List, ie)
+
+	// Old AMF (optional)
+	if ue.PreviousAMF != nil {
+		ie = ngapType.DownlinkNASTransportIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDOldAMF
+		ie.Criticality.Value = ngapType.CriticalityPresentReject
+		ie.Value.Present = ngapType.DownlinkNASTransportIEsPresentOldAMF
+		ie.Value.OldAMF = new(ngapType.AMFName)
+		ie.Value.OldAMF = ue.PreviousAMF.AMFName
+
+		downlinkNasTransportIEs.List = append(downlinkNasTransportIEs.List, ie)
+		ue.PreviousAMFIndex = ""
+		ue.PreviousAMF = nil
+	}
+
+	return ngap.Encoder(pdu)
+}
+
+/*
+M: Message Type, AMF UE NGAP ID, RAN UE NGAP ID, GUAMI, Allowed NSSAI, UE Security CApabilities, Security Key
+*/
+func BuildInitialContextSetupRequest(ue *context.UEContext, nasPdu []byte) ([]byte, error) {
+	var pdu ngapType.NGAPPDU
+
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodeInitialContextSetup
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentIgnore
+
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentInitialContextSetupRequest
+	initiatingMessage.Value.InitialContextSetupRequest = new(ngapType.InitialContextSetupRequest)
+
+	initialContextSetupRequest := initiatingMessage.Value.InitialContextSetupRequest
+	initialContextSetupRequestIEs := &initialContextSetupRequest.ProtocolIEs
+
+	// AMF UE NGAP ID
+	ie := ngapType.InitialContextSetupRequestIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDAMFUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.InitialContextSetupRequestIEsPresentAMFUENGAPID
+	ie.Value.AMFUENGAPID = new(ngapType.AMFUENGAPID)
+
+	aMFUENGAPID := ie.Value.AMFUENGAPID
+	aMFUENGAPID.Value = ue.AmfUeNgapId
+
+	initialContextSetupRequestIEs.List = append(initialContextSetupRequestIEs.List, ie)
+
+	// RAN UE NGAP ID
+	ie = ngapType.InitialContextSetupRequestIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.InitialContextSetupRequestIEsPresentRANUENGAPID
+	ie.Value.RANUENGAPID = new(ngapType.RANUENGAPID)
+
+	rANUENGAPID := ie.Value.RANUENGAPID
+	rANUENGAPID.Value = ue.RanUeNgapId
+
+	initialContextSetupRequestIEs.List = append(initialContextSetupRequestIEs.List, ie)
+
+	// NAS PDU
+	if nasPdu != nil {
+		ie = ngapType.InitialContextSetupRequestIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDNASPDU
+		ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+		ie.Value.Present = ngapType.InitialContextSetupRequestIEsPresentNASPDU
+		ie.Value.NASPDU = new(ngapType.NASPDU)
+
+		ie.Value.NASPDU.Value = nasPdu
+
+		initialContextSetupRequestIEs.List = append(initialContextSetupRequestIEs.List, ie)
+	}
+	// Old AMF (optional)
+	if ue.PreviousAMF != nil {
+		ie = ngapType.InitialContextSetupRequestIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDOldAMF
+		ie.Criticality.Value = ngapType.CriticalityPresentReject
+		ie.Value.Present = ngapType.InitialContextSetupRequestIEsPresentOldAMF
+		ie.Value.OldAMF = new(ngapType.AMFName)
+		ie.Value.OldAMF = ue.PreviousAMF.AMFName
+
+		initialContextSetupRequestIEs.List = append(initialContextSetupRequestIEs.List, ie)
+		ue.PreviousAMFIndex = ""
+		ue.PreviousAMF = nil
+	}
+
+	// GUAMI
+	ie = ngapType.InitialContextSetupRequestIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDGUAMI
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.InitialContextSetupRequestIEsPresentGUAMI
+	ie.Value.GUAMI = new(ngapType.GUAMI)
+	ie.Value.GUAMI = buildGuami(ue)
+
+	initialContextSetupRequestIEs.List = append(initialContextSetupRequestIEs.List, ie)
+
+	// Allowed NSSAI
+	ie = ngapType.InitialContextSetupRequestIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDAllowedNSSAI
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.InitialContextSetupRequestIEsPresentAllowedNSSAI
+	ie.Value.AllowedNSSAI = util.AllowedNssaiToNgap(ue.AllowedNssai)
+	initialContextSetupRequestIEs.List = append(initialContextSetupRequestIEs.List, ie)
+
+	// UE Security Capabilities
+	ie = ngapType.InitialContextSetupRequestIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDUESecurityCapabilities
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.InitialContextSetupRequestIEsPresentUESecurityCapabilities
+	//ie.Value.UESecurityCapabilities = new(ngapType.UESecurityCapabilities)
+	ie.Value.UESecurityCapabilities = ue.SecurityCapabilities
+
+	// Security Key
+	ie = ngapType.InitialContextSetupRequestIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDSecurityKey
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.InitialContextSetupRequestIEsPresentSecurityKey
+	ie.Value.SecurityKey = new(ngapType.SecurityKey)
+
+	securityKey := ie.Value.SecurityKey
+	securityKey.Value = ngapConvert.ByteToBitString(ue.Kwagf, 256)
+
+	initialContextSetupRequestIEs.List = append(initialContextSetupRequestIEs.List, ie)
+
+	// Trace Activation (optional), the trace session of the subscriber being activated with the UE context
+	if ue.Trace == nil && ue.Subscriber != nil {
+		ue.Trace = ue.Subscriber.Trace
+	}
+	if ue.Trace != nil {
+		ie = ngapType.InitialContextSetupRequestIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDTraceActivation
+		ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+		ie.Value.Present = ngapType.InitialContextSetupRequestIEsPresentTraceActivation
+		ie.Value.TraceActivation = buildTraceActivation(ue.Trace)
+
+		initialContextSetupRequestIEs.List = append(initialContextSetupRequestIEs.List, ie)
+	}
+
+	// UE Radio Capability (optional)
+	if ue.RadioCapability != nil {
+		ie = ngapType.InitialContextSetupRequestIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDUERadioCapability
+		ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+		ie.Value.Present = ngapType.InitialContextSetupRequestIEsPresentUERadioCapability
+		//ie.Value.UERadioCapability = new(ngapType.UERadioCapability)
+		ie.Value.UERadioCapability = ue.RadioCapability
+
+		initialContextSetupRequestIEs.List = append(initialContextSetupRequestIEs.List, ie)
+	}
+	// PDU Session Resource Setup List (optional), the user plane of the PDU sessions in the uplink data status of a
+	// registration update being re-established
+	var pDUSessionResourceSetupListCxtReq ngapType.PDUSessionResourceSetupListCxtReq
+	for psi := 1; psi <= 15; psi++ {
+		if !ue.UplinkDataStatus[psi] {
+			continue
+		}
+		pduSession := ue.FindPDUSession(int64(psi))
+		if pduSession == nil {
+			continue
+		}
+		transfer, err := buildPDUSessionResourceSetupRequestTransfer(pduSession)
+		if err != nil {
+			return nil, err
+		}
+		pDUSessionResourceSetupListCxtReq.List = append(pDUSessionResourceSetupListCxtReq.List,
+			ngapType.PDUSessionResourceSetupItemCxtReq{
+				PDUSessionID:                           ngapType.PDUSessionID{Value: pduSession.Id},
+				SNSSAI:                                 pduSession.Snssai,
+				PDUSessionResourceSetupRequestTransfer: transfer,
+			})
+	}
+	if len(pDUSessionResourceSetupListCxtReq.List) > 0 {
+		ie = ngapType.InitialContextSetupRequestIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDPDUSessionResourceSetupListCxtReq
+		ie.Criticality.Value = ngapType.CriticalityPresentReject
+		ie.Value.Present = ngapType.InitialContextSetupRequestIEsPresentPDUSessionResourceSetupListCxtReq
+		ie.Value.PDUSessionResourceSetupListCxtReq = &pDUSessionResourceSetupListCxtReq
+
+		initialContextSetupRequestIEs.List = append(initialContextSetupRequestIEs.List, ie)
+	}
+	return ngap.Encoder(pdu)
+}
+
+func BuildPDUSessionResourceSetupRequest(ue *context.UEContext, sessionId uint8) ([]byte, error) {
+	var nasMsg []byte
+	var pdu []byte
+	var err error
+
+	nasMsg, err = BuildPDUSessionEstablishmentAccept(ue, sessionId)
+	if err != nil {
+		return nasMsg, err
+	}
+	pdu, err = buildPDUSessionResourceSetupRequest(ue, sessionId, nasMsg)
+	if err != nil {
+		return pdu, err
+	}
+	return pdu, err
+}
+
+func BuildPDUSessionEstablishmentAccept(ue *context.UEContext, pdusessionID uint8) ([]byte, error) {
+	m := nas.NewMessage()
+	m.GsmMessage = nas.NewGsmMessage()
+	m.GsmHeader.SetMessageType(nas.MsgTypePDUSessionEstablishmentAccept)
+
+	pduSessionEstablishmentAccept := nasMessage.NewPDUSessionEstablishmentAccept(0xc2)
+	pduSessionEstablishmentAccept.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSSessionManagementMessage)
+	// PDUSessionID 9.4
+	// PDUSessionID Row, sBit, len = [0, 0], 8 , 8
+	pduSessionEstablishmentAccept.PDUSessionID.SetPDUSessionID(pdusessionID)
+	// PTI 9.6
+	// PTI Row, sBit, len = [0, 0], 8 , 8
+	pduSessionEstablishmentAccept.PTI.SetPTI(0x01)
+	pduSessionEstablishmentAccept.PDUSESSIONESTABLISHMENTACCEPTMessageIdentity.SetMessageType(nas.MsgTypePDUSessionEstablishmentAccept)
+	pduSessionEstablishmentAccept.SelectedSSCModeAndSelectedPDUSessionType.SetSSCMode(3)        // SSC mode 3
+	pduSessionEstablishmentAccept.SelectedSSCModeAndSelectedPDUSessionType.SetPDUSessionType(5) // Ethernet
+
+	// TBD: some problem on AuthorizedQosRules
+	pduSessionEstablishmentAccept.AuthorizedQosRules = nasType.AuthorizedQosRules{
+		Len: 28,
+		Buffer: []uint8{
+			0x01, 0x00, 0x06, 0x31, 0x31, 0x01, 0x01, 0x00,
+			0x3f, 0x02, 0x00, 0x10, 0x21, 0x35, 0x0b, 0x10,
+			0x12, 0x23, 0x34, 0x45, 0x56, 0x67, 0x78, 0x89,
+			0x30, 0x24, 0x03, 0x12,
+		},
+	}
+	pduSessionEstablishmentAccept.SessionAMBR = nasType.SessionAMBR{
+		Len:   6,
+		Octet: [6]uint8{0x06, 0x00, 0x04, 0x06, 0x00, 0x01},
+	}
+	if pduSession := ue.FindPDUSession(int64(pdusessionID)); pduSession != nil {
+		pduSessionEstablishmentAccept.SNSSAI = util.SnssaiToNas(nasMessage.PDUSessionEstablishmentAcceptSNSSAIType,
+			ngapConvert.SNssaiToModels(pduSession.Snssai))
+		if pduSession.Policy != nil {
+			buildSessionPolicy(pduSessionEstablishmentAccept, pduSession)
+		}
+		if subscriber := ue.Subscriber; subscriber != nil && pduSession.Policy == nil {
+			// Session-AMBR and static IPv4 address of the subscriber, selected with the policy of the DNN if configured
+			if subscriber.SessionAmbrUL > 0 && subscriber.SessionAmbrDL > 0 {
+				unitDL, valueDL := util.BitRateToNasAMBR(subscriber.SessionAmbrDL)
+				pduSessionEstablishmentAccept.SessionAMBR.SetUnitForSessionAMBRForDownlink(unitDL)
+				pduSessionEstablishmentAccept.SessionAMBR.SetSessionAMBRForDownlink(valueDL)
+				unitUL, valueUL := util.BitRateToNasAMBR(subscriber.SessionAmbrUL)
+				pduSessionEstablishmentAccept.SessionAMBR.SetUnitForSessionAMBRForUplink(unitUL)
+				pduSessionEstablishmentAccept.SessionAMBR.SetSessionAMBRForUplink(valueUL)
+			}
+			if ip, ok := subscriber.StaticIPs[pduSession.Dnn]; ok {
+				pduSessionEstablishmentAccept.SelectedSSCModeAndSelectedPDUSessionType.SetPDUSessionType(nasMessage.PDUSessionTypeIPv4)
+				pduSessionEstablishmentAccept.PDUAddress = nasType.NewPDUAddress(nasMessage.PDUSessionEstablishmentAcceptPDUAddressType)
+				pduSessionEstablishmentAccept.PDUAddress.SetLen(5)
+				pduSessionEstablishmentAccept.PDUAddress.SetPDUSessionTypeValue(nasMessage.PDUSessionTypeIPv4)
+				var pduAddressInformation [12]uint8
+				copy(pduAddressInformation[:], ip.To4())
+				pduSessionEstablishmentAccept.PDUAddress.SetPDUAddressInformation(pduAddressInformation)
+			}
+		}
+	}
+
+	m.GsmMessage.PDUSessionEstablishmentAccept = pduSessionEstablishmentAccept
+	nasMsg, err := m.PlainNasEncode()
+	if err != nil {
+		return nasMsg, err
+	}
+
+	return BuildDLNASTransport(ue, nasMsg, &pdusessionID, nil, nil)
+}
+
+// buildSessionPolicy sets the SSC mode, PDU session type, Session-AMBR, PDU address, DNS server addresses and MTU
+// selected by the policy of the DNN of the PDU session in its PDU Session Establishment Accept
+//
+// TS 24.501 6.4.1.3 UE-requested PDU session establishment procedure accepted by the network, TS 24.008 10.5.6.3
+// Protocol configuration options
+func buildSessionPolicy(accept *nasMessage.PDUSessionEstablishmentAccept, pduSession *context.PDUSession) {
+	policy := pduSession.Policy
+	accept.SelectedSSCModeAndSelectedPDUSessionType.SetSSCMode(pduSession.SSCMode)
+	accept.SelectedSSCModeAndSelectedPDUSessionType.SetPDUSessionType(pduSession.PDUSessionType)
+	if pduSession.Cause5GSM != 0 {
+		accept.Cause5GSM = nasType.NewCause5GSM(nasMessage.PDUSessionEstablishmentAcceptCause5GSMType)
+		accept.Cause5GSM.SetCauseValue(pduSession.Cause5GSM)
+	}
+	// the Session-AMBR of the PDU Session Resource Setup Request Transfer
+	if ambr := pduSession.Ambr; ambr != nil {
+		unitDL, valueDL := util.BitRateToNasAMBR(ambr.PDUSessionAggregateMaximumBitRateDL.Value)
+		accept.SessionAMBR.SetUnitForSessionAMBRForDownlink(unitDL)
+		accept.SessionAMBR.SetSessionAMBRForDownlink(valueDL)
+		unitUL, valueUL := util.BitRateToNasAMBR(ambr.PDUSessionAggregateMaximumBitRateUL.Value)
+		accept.SessionAMBR.SetUnitForSessionAMBRForUplink(unitUL)
+		accept.SessionAMBR.SetSessionAMBRForUplink(valueUL)
+	}
+
+	// PDU address, the interface identifier of the IPv6 address followed by the IPv4 address
+	var pduAddressInformation [12]uint8
+	var length uint8
+	if ip := pduSession.IPv6Address.To16(); ip != nil {
+		copy(pduAddressInformation[length:], ip[8:])
+		length += 8
+	}
+	if ip := pduSession.IPv4Address.To4(); ip != nil {
+		copy(pduAddressInformation[length:], ip)
+		length += 4
+	}
+	if length > 0 {
+		accept.PDUAddress = nasType.NewPDUAddress(nasMessage.PDUSessionEstablishmentAcceptPDUAddressType)
+		accept.PDUAddress.SetLen(length + 1)
+		accept.PDUAddress.SetPDUSessionTypeValue(pduSession.PDUSessionType)
+		accept.PDUAddress.SetPDUAddressInformation(pduAddressInformation)
+	}
+
+	// extended protocol configuration options: configuration protocol PPP, then the DNS server IPv4 and IPv6 address
+	// and IPv4 link MTU containers
+	if len(policy.DNS) == 0 && policy.MTU == 0 {
+		return
+	}
+	contents := []uint8{0x80}
+	for _, ip := range policy.DNS {
+		if ip4 := ip.To4(); ip4 != nil {
+			contents = append(contents, 0x00, 0x0d, net.IPv4len)
+			contents = append(contents, ip4...)
+		} else {
+			contents = append(contents, 0x00, 0x03, net.IPv6len)
+			contents = append(contents, ip.To16()...)
+		}
+	}
+	if policy.MTU > 0 {
+		contents = append(contents, 0x00, 0x10, 2, uint8(policy.MTU>>8), uint8(policy.MTU))
+	}
+	accept.ExtendedProtocolConfigurationOptions = nasType.NewExtendedProtocolConfigurationOptions(
+		nasMessage.PDUSessionEstablishmentAcceptExtendedProtocolConfigurationOptionsType)
+	accept.ExtendedProtocolConfigurationOptions.SetLen(uint16(len(contents)))
+	accept.ExtendedProtocolConfigurationOptions.SetExtendedProtocolConfigurationOptionsContents(contents)
+}
+
+// BuildPDUSessionEstablishmentReject returns the PDU Session Establishment Reject of a PDU Session Establishment
+// Request with the 5GSM cause, e.g. #27 missing or unknown DNN, the SSC modes allowed for #68 not supported SSC mode,
+// and the back-off timer the UE waits before requesting the DNN again, none if zero
+//
+// TS 24.501 6.4.1.4 UE-requested PDU session establishment procedure not accepted by the network
+func BuildPDUSessionEstablishmentReject(ue *context.UEContext, pduSessionID uint8, pti uint8, cause5GSM uint8,
+	allowedSSCModes []uint8, backoff time.Duration) ([]byte, error) {
+	m := nas.NewMessage()
+	m.GsmMessage = nas.NewGsmMessage()
+	m.GsmHeader.SetMessageType(nas.MsgTypePDUSessionEstablishmentReject)
+
+	pduSessionEstablishmentReject := nasMessage.NewPDUSessionEstablishmentReject(0)
+	pduSessionEstablishmentReject.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSSessionManagementMessage)
+	pduSessionEstablishmentReject.PDUSessionID.SetPDUSessionID(pduSessionID)
+	pduSessionEstablishmentReject.PTI.SetPTI(pti)
+	pduSessionEstablishmentReject.PDUSESSIONESTABLISHMENTREJECTMessageIdentity.SetMessageType(
+		nas.MsgTypePDUSessionEstablishmentReject)
+	pduSessionEstablishmentReject.Cause5GSM.SetCauseValue(cause5GSM)
+	if backoff > 0 {
+		// GPRS timer 3, at most 31 multiples of 10 hours
+		seconds := int(backoff / time.Second)
+		if seconds > 31*36000 {
+			seconds = 31 * 36000
+		}
+		backoffTimerValue := nasType.NewBackoffTimerValue(nasMessage.PDUSessionEstablishmentRejectBackoffTimerValueType)
+		backoffTimerValue.SetLen(1)
+		backoffTimerValue.Octet = nasConvert.GPRSTimer3ToNas(seconds)
+		pduSessionEstablishmentReject.BackoffTimerValue = backoffTimerValue
+	}
+	if len(allowedSSCModes) > 0 {
+		allowedSSCMode := nasType.NewAllowedSSCMode(nasMessage.PDUSessionEstablishmentRejectAllowedSSCModeType)
+		for _, sscMode := range allowedSSCModes {
+			switch sscMode {
+			case 1:
+				allowedSSCMode.SetSSC1(1)
+			case 2:
+				allowedSSCMode.SetSSC2(1)
+			case 3:
+				allowedSSCMode.SetSSC3(1)
+			}
+		}
+		pduSessionEstablishmentReject.AllowedSSCMode = allowedSSCMode
+	}
+
+	m.GsmMessage.PDUSessionEstablishmentReject = pduSessionEstablishmentReject
+	nasMsg, err := m.PlainNasEncode()
+	if err != nil {
+		return nil, err
+	}
+	nasMsg, err = BuildDLNASTransport(ue, nasMsg, &pduSessionID, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return BuildDownlinkNasTransport(ue, nasMsg, nil)
+}
+
+// BuildPayloadNotForwarded returns the 5GSM message of the UE not forwarded in a Downlink NAS Transport with the 5GMM
+// cause, e.g. #90 payload was not forwarded or #91 DNN not supported or not subscribed in the slice
+//
+// TS 24.501 5.4.5.2.5 Abnormal cases in the AMF, UE-initiated NAS transport procedure
+func BuildPayloadNotForwarded(ue *context.UEContext, pduSessionID uint8, gsmMessage []byte, cause5GMM uint8) ([]byte,
+	error) {
+	nasMsg, err := BuildDLNASTransport(ue, gsmMessage, &pduSessionID, nil, &cause5GMM)
+	if err != nil {
+		return nil, err
+	}
+	return BuildDownlinkNasTransport(ue, nasMsg, nil)
+}
+
+func BuildDLNASTransport(ue *context.UEContext, nasPdu []byte, pduSessionID *uint8, additionalInformation []uint8, cause5GMM *uint8) ([]byte, error) {
+
+	m := nas.NewMessage()
+	m.GmmMessage = nas.NewGmmMessage()
+	m.GmmHeader.SetMessageType(nas.MsgTypeDLNASTransport)
+
+	m.SecurityHeader = nas.SecurityHeader{
+		ProtocolDiscriminator: nasMessage.Epd5GSMobilityManagementMessage,
+		SecurityHeaderType:    nas.SecurityHeaderTypeIntegrityProtectedAndCiphered,
+	}
+
+	dLNASTransport := nasMessage.NewDLNASTransport(0)
+	dLNASTransport.SpareHalfOctetAndSecurityHeaderType.SetSecurityHeaderType(nas.SecurityHeaderTypePlainNas)
+	dLNASTransport.ExtendedProtocolDiscriminator.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSMobilityManagementMessage)
+	dLNASTransport.DLNASTRANSPORTMessageIdentity.SetMessageType(nas.MsgTypeDLNASTransport)
+	dLNASTransport.SpareHalfOctetAndPayloadContainerType.SetPayloadContainerType(nasMessage.PayloadContainerTypeN1SMInfo)
+	if nasPdu == nil {
+		return nil, fmt.Errorf("nasPdu is nil")
+	}
+	dLNASTransport.PayloadContainer.SetLen(uint16(len(nasPdu)))
+	dLNASTransport.PayloadContainer.SetPayloadContainerContents(nasPdu)
+
+	if pduSessionID != nil {
+		dLNASTransport.PduSessionID2Value = new(nasType.PduSessionID2Value)
+		dLNASTransport.PduSessionID2Value.SetIei(nasMessage.DLNASTransportPduSessionID2ValueType)
+		dLNASTransport.PduSessionID2Value.SetPduSessionID2Value(*pduSessionID)
+	}
+	if additionalInformation != nil {
+		info := nasType.NewAdditionalInformation(nasMessage.DLNASTransportAdditionalInformationType)
+		info.SetLen(uint8(len(additionalInformation)))
+		info.SetAdditionalInformationValue(additionalInformation)
+		dLNASTransport.AdditionalInformation = info
+	}
+	if cause5GMM != nil {
+		cause := nasType.NewCause5GMM(nasMessage.DLNASTransportCause5GMMType)
+		cause.SetCauseValue(*cause5GMM)
+		dLNASTransport.Cause5GMM = cause
+	}
+	// TODO: handle BackoffTimerValue
+
+	m.GmmMessage.DLNASTransport = dLNASTransport
+
+	return amf_nas.Encode(ue, m, false)
+}
+
+// nasPDU: from nas layer
+// pduSessionResourceSetupRequestList: provided by AMF, and transfer data is from SMF
+// pduSessionResourceSetupRequestTransfer is the hard coded transfer of the PDU sessions set up, with the Session AMBR,
+// the UL NG-U UP TNL information, the PDU session type and a QoS flow
+var pduSessionResourceSetupRequestTransfer = []uint8{
+	0x00, 0x00, 0x04, 0x00, 0x82, 0x00, 0x06, 0x04, 0x03, 0xe8, 0x10, 0x03, 0xe8, 0x00, 0x8b, 0x00,
+	0x0a, 0x01, 0xf0, 0x01, 0x02, 0x03, 0x04, 0x0b, 0x16, 0x21, 0x2c, 0x00, 0x86, 0x00, 0x01, 0x00,
+	0x00, 0x88, 0x00, 0x07, 0x00, 0x01, 0x00, 0x00, 0x07, 0x24, 0x00,
+}
+
+// buildPDUSessionResourceSetupRequestTransfer returns the transfer of the PDU session set up, the hard coded one with
+// the PDU session type and Session-AMBR selected by the policy of its DNN if configured
+//
+// TS 38.413 9.3.4.1 PDU Session Resource Setup Request Transfer
+func buildPDUSessionResourceSetupRequestTransfer(pduSession *context.PDUSession) ([]byte, error) {
+	if pduSession.Policy == nil {
+		return pduSessionResourceSetupRequestTransfer, nil
+	}
+	transfer := ngapType.PDUSessionResourceSetupRequestTransfer{}
+	if err := aper.UnmarshalWithParams(pduSessionResourceSetupRequestTransfer, &transfer, "valueExt"); err != nil {
+		return nil, err
+	}
+	for i := range transfer.ProtocolIEs.List {
+		ie := &transfer.ProtocolIEs.List[i]
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDPDUSessionAggregateMaximumBitRate:
+			if pduSession.Ambr != nil {
+				ie.Value.PDUSessionAggregateMaximumBitRate = pduSession.Ambr
+			}
+		case ngapType.ProtocolIEIDPDUSessionType:
+			if pduSession.Type != nil {
+				ie.Value.PDUSessionType = pduSession.Type
+			}
+		}
+	}
+	return aper.MarshalWithParams(transfer, "valueExt")
+}
+
+func buildPDUSessionResourceSetupRequest(ue *context.UEContext, pduSessionID uint8, nasPdu []byte) ([]byte, error) {
+	pduSession := ue.FindPDUSession(int64(pduSessionID))
+	if pduSession == nil {
+		return nil, fmt.Errorf("PDU Session[ID:%d] not found", pduSessionID)
+	}
+	var pdu ngapType.NGAPPDU
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodePDUSessionResourceSetup
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentReject
+
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentPDUSessionResourceSetupRequest
+	initiatingMessage.Value.PDUSessionResourceSetupRequest = new(ngapType.PDUSessionResourceSetupRequest)
+
+	PDUSessionResourceSetupRequest := initiatingMessage.Value.PDUSessionResourceSetupRequest
+	PDUSessionResourceSetupRequestIEs := &PDUSessionResourceSetupRequest.ProtocolIEs
+
+	ie := ngapType.PDUSessionResourceSetupRequestIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDAMFUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.PDUSessionResourceSetupRequestIEsPresentAMFUENGAPID
+	ie.Value.AMFUENGAPID = new(ngapType.AMFUENGAPID)
+	aMFUENGAPID := ie.Value.AMFUENGAPID
+	aMFUENGAPID.Value = ue.AmfUeNgapId
+	PDUSessionResourceSetupRequestIEs.List = append(PDUSessionResourceSetupRequestIEs.List, ie)
+
+	ie = ngapType.PDUSessionResourceSetupRequestIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.PDUSessionResourceSetupRequestIEsPresentRANUENGAPID
+	ie.Value.RANUENGAPID = new(ngapType.RANUENGAPID)
+	rANUENGAPID := ie.Value.RANUENGAPID
+	rANUENGAPID.Value = ue.RanUeNgapId
+	PDUSessionResourceSetupRequestIEs.List = append(PDUSessionResourceSetupRequestIEs.List, ie)
+
+	// NAS-PDU
+	ie = ngapType.PDUSessionResourceSetupRequestIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDNASPDU
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.PDUSessionResourceSetupRequestIEsPresentNASPDU
+	ie.Value.NASPDU = new(ngapType.NASPDU)
+	nASPDU := ie.Value.NASPDU
+	nASPDU.Value = nasPdu
+	PDUSessionResourceSetupRequestIEs.List = append(PDUSessionResourceSetupRequestIEs.List, ie)
+
+	ie = ngapType.PDUSessionResourceSetupRequestIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDPDUSessionResourceSetupListSUReq
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.PDUSessionResourceSetupRequestIEsPresentPDUSessionResourceSetupListSUReq
+	ie.Value.PDUSessionResourceSetupListSUReq = new(ngapType.PDUSessionResourceSetupListSUReq)
+	setupReqItem := new(ngapType.PDUSessionResourceSetupItemSUReq)
+	setupReqItem.PDUSessionID.Value = int64(pduSessionID)
+	setupReqItem.SNSSAI = pduSession.Snssai
+	transfer, err := buildPDUSessionResourceSetupRequestTransfer(pduSession)
+	if err != nil {
+		return nil, err
+	}
+	setupReqItem.PDUSessionResourceSetupRequestTransfer = transfer
+	ie.Value.PDUSessionResourceSetupListSUReq.List = append(ie.Value.PDUSessionResourceSetupListSUReq.List, *setupReqItem)
+	PDUSessionResourceSetupRequestIEs.List = append(PDUSessionResourceSetupRequestIEs.List, ie)
+
+	// UEAggregateMaximumBitRate
+	ie = ngapType.PDUSessionResourceSetupRequestIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDUEAggregateMaximumBitRate
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.PDUSessionResourceSetupRequestIEsPresentPDUUEAggregateMaximumBitRate
+	ie.Value.UEAggregateMaximumBitRate = new(ngapType.UEAggregateMaximumBitRate)
+	UEAggregateMaximumBitRate := ie.Value.UEAggregateMaximumBitRate
+	UEAggregateMaximumBitRate.UEAggregateMaximumBitRateDL.Value = defaultUeAmbrDL
+	UEAggregateMaximumBitRate.UEAggregateMaximumBitRateUL.Value = defaultUeAmbrUL
+	if ue.Ambr != nil {
+		*UEAggregateMaximumBitRate = *ue.Ambr
+	}
+	PDUSessionResourceSetupRequestIEs.List = append(PDUSessionResourceSetupRequestIEs.List, ie)
+
+	return ngap.Encoder(pdu)
+}
+
+func BuildPDUSessionResourceReleaseCommand(ue *context.UEContext, sessionId uint8, cause5GSM uint8) ([]byte, error) {
+	var nasMsg []byte
+	var pdu []byte
+	var err error
+
+	nasMsg, err = BuildPDUSessionReleaseCommand(ue, sessionId, &cause5GSM)
+	if err != nil {
+		return nasMsg, err
+	}
+	pdu, err = buildPDUSessionResourceReleaseCommand(ue, sessionId, nasMsg)
+	if err != nil {
+		return pdu, err
+	}
+	return pdu, err
+}
+
+func BuildPDUSessionReleaseCommand(ue *context.UEContext, pdusessionID uint8, cause5GMM *uint8) ([]byte, error) {
+	m := nas.NewMessage()
+	m.GsmMessage = nas.NewGsmMessage()
+	m.GsmHeader.SetMessageType(nas.MsgTypePDUSessionReleaseCommand)
+
+	pduSessionReleaseCommand := nasMessage.NewPDUSessionReleaseCommand(0xd3)
+	pduSessionReleaseCommand.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSSessionManagementMessage)
+	// PDUSessionID 9.4
+	// PDUSessionID Row, sBit, len = [0, 0], 8 , 8
+	pduSessionReleaseCommand.PDUSessionID.SetPDUSessionID(pdusessionID)
+	// PTI 9.6
+	// PTI Row, sBit, len = [0, 0], 8 , 8
+	pduSessionReleaseCommand.PTI.SetPTI(0x01)
+	pduSessionReleaseCommand.PDUSESSIONRELEASECOMMANDMessageIdentity.SetMessageType(nas.MsgTypePDUSessionReleaseCommand)
+	pduSessionReleaseCommand.Cause5GSM.SetCauseValue(*cause5GMM)
+
+	// TODO: handle EAPMessage, ExtendedProtocolConfigurationOptions, BackoffTimerValue
+	m.GsmMessage.PDUSessionReleaseCommand = pduSessionReleaseCommand
+	nasMsg, err := m.PlainNasEncode()
+	if err != nil {
+		return nasMsg, err
+	}
+
+	return BuildDLNASTransport(ue, nasMsg, &pdusessionID, nil, nil)
+}
+
+func buildPDUSessionResourceReleaseCommand(ue *context.UEContext, pduSessionID uint8, nasPdu []byte) ([]byte, error) {
+
+	var pdu ngapType.NGAPPDU
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodePDUSessionResourceRelease
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentReject
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentPDUSessionResourceReleaseCommand
+	initiatingMessage.Value.PDUSessionResourceReleaseCommand = new(ngapType.PDUSessionResourceReleaseCommand)
+
+	pDUSessionResourceReleaseCommand := initiatingMessage.Value.PDUSessionResourceReleaseCommand
+	PDUSessionResourceReleaseCommandIEs := &pDUSessionResourceReleaseCommand.ProtocolIEs
+
+	// AMFUENGAPID
+	ie := ngapType.PDUSessionResourceReleaseCommandIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDAMFUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.PDUSessionResourceReleaseCommandIEsPresentAMFUENGAPID
+	ie.Value.AMFUENGAPID = new(ngapType.AMFUENGAPID)
+
+	aMFUENGAPID := ie.Value.AMFUENGAPID
+	aMFUENGAPID.Value = ue.AmfUeNgapId
+
+	PDUSessionResourceReleaseCommandIEs.List = append(PDUSessionResourceReleaseCommandIEs.List, ie)
+
+	// RANUENGAPID
+	ie = ngapType.PDUSessionResourceReleaseCommandIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.PDUSessionResourceReleaseCommandIEsPresentRANUENGAPID
+	ie.Value.RANUENGAPID = new(ngapType.RANUENGAPID)
+
+	rANUENGAPID := ie.Value.RANUENGAPID
+	rANUENGAPID.Value = ue.RanUeNgapId
+
+	PDUSessionResourceReleaseCommandIEs.List = append(PDUSessionResourceReleaseCommandIEs.List, ie)
+
+	// NAS-PDU (optional)
+	if nasPdu != nil {
+		ie = ngapType.PDUSessionResourceReleaseCommandIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDNASPDU
+		ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+		ie.Value.Present = ngapType.PDUSessionResourceReleaseCommandIEsPresentNASPDU
+		ie.Value.NASPDU = new(ngapType.NASPDU)
+
+		ie.Value.NASPDU.Value = nasPdu
+
+		PDUSessionResourceReleaseCommandIEs.List = append(PDUSessionResourceReleaseCommandIEs.List, ie)
+	}
+
+	// PDUSessionResourceToReleaseListRelCmd
+	ie = ngapType.PDUSessionResourceReleaseCommandIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDPDUSessionResourceToReleaseListRelCmd
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.PDUSessionResourceReleaseCommandIEsPresentPDUSessionResourceToReleaseListRelCmd
+	ie.Value.PDUSessionResourceToReleaseListRelCmd = new(ngapType.PDUSessionResourceToReleaseListRelCmd)
+	item := ngapType.PDUSessionResourceToReleaseItemRelCmd{}
+	item.PDUSessionID.Value = int64(pduSessionID)
+	item.PDUSessionResourceReleaseCommandTransfer = []uint8{0x10}
+	ie.Value.PDUSessionResourceToReleaseListRelCmd.List = append(ie.Value.PDUSessionResourceToReleaseListRelCmd.List, item)
+	PDUSessionResourceReleaseCommandIEs.List = append(PDUSessionResourceReleaseCommandIEs.List, ie)
+
+	return ngap.Encoder(pdu)
+}
+
+// amf/gmm/handle.go: HandleDeregistrationRequest
+// lib/nas/nasTestPacket/NasPdu.go: GetDeregistrationRequest
+func BuildDeregistrationRequest(ue *context.UEContext, switchOff uint8, reRegistrationRequired bool) ([]byte, error) {
+
+	if ue == nil {
+		return nil, fmt.Errorf("UE Context is nil when BuildDeregistrationRequest")
+	}
+
+	m := nas.NewMessage()
+	m.GmmMessage = nas.NewGmmMessage()
+	m.GmmHeader.SetMessageType(nas.MsgTypeDeregistrationRequestUEOriginatingDeregistration)
+
+	m.SecurityHeader = nas.SecurityHeader{
+		ProtocolDiscriminator: nasMessage.Epd5GSMobilityManagementMessage,
+		SecurityHeaderType:    ue.SecurityHeaderType,
+	}
+
+	deregistrationRequest := nasMessage.NewDeregistrationRequestUEOriginatingDeregistration(0)
+	deregistrationRequest.ExtendedProtocolDiscriminator.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSMobilityManagementMessage)
+	deregistrationRequest.SpareHalfOctetAndSecurityHeaderType.SetSecurityHeaderType(nas.SecurityHeaderTypePlainNas)
+	deregistrationRequest.SpareHalfOctetAndSecurityHeaderType.SetSpareHalfOctet(0)
+	deregistrationRequest.DeregistrationRequestMessageIdentity.SetMessageType(nas.MsgTypeDeregistrationRequestUEOriginatingDeregistration)
+
+	deregistrationRequest.NgksiAndDeregistrationType.SetAccessType(ue.AccessType())
+	deregistrationRequest.NgksiAndDeregistrationType.SetSwitchOff(switchOff)
+	if reRegistrationRequired {
+		deregistrationRequest.NgksiAndDeregistrationType.SetReRegistrationRequired(nasMessage.ReRegistrationRequired)
+	} else {
+		deregistrationRequest.NgksiAndDeregistrationType.SetReRegistrationRequired(nasMessage.ReRegistrationNotRequired)
+	}
+	switch ue.NgKsi.Tsc {
+	case models.ScType_NATIVE:
+		deregistrationRequest.NgksiAndDeregistrationType.SetTSC(nasMessage.TypeOfSecurityContextFlagNative)
+	case models.ScType_MAPPED:
+		deregistrationRequest.NgksiAndDeregistrationType.SetTSC(nasMessage.TypeOfSecurityContextFlagMapped)
+	}
+	deregistrationRequest.NgksiAndDeregistrationType.SetNasKeySetIdentifiler((uint8)(ue.NgKsi.Ksi))
+
+	// TS 23.502 4.2.2.3.2 UE-Initiated Deregistration
+	// The UE sends Deregistration Request (5G-GUTI, Deregistration Type, ngKSI) to the AMF.
+	if len(ue.Guti) != 0 {
+		mobileIdentity := util.GUTI5GToMobileIdentity5GS(nasConvert.GutiToNas(ue.Guti))
+		deregistrationRequest.MobileIdentity5GS.SetIei(mobileIdentity.GetIei())
+		deregistrationRequest.MobileIdentity5GS.SetLen(mobileIdentity.GetLen())
+		deregistrationRequest.MobileIdentity5GS.SetMobileIdentity5GSContents(mobileIdentity.GetMobileIdentity5GSContents())
+	} else {
+		deregistrationRequest.MobileIdentity5GS.SetIei(ue.MobileIdentity.GetIei())
+		deregistrationRequest.MobileIdentity5GS.SetLen(ue.MobileIdentity.GetLen())
+		deregistrationRequest.MobileIdentity5GS.SetMobileIdentity5GSContents(ue.MobileIdentity.GetMobileIdentity5GSContents())
+	}
+
+	m.GmmMessage.DeregistrationRequestUEOriginatingDeregistration = deregistrationRequest
+	return amf_nas.Encode(ue, m, false)
+}
+
+func BuildUplinkNASTransport(ue *context.UEContext, nasPdu []byte) ([]byte, error) {
+	var pdu ngapType.NGAPPDU
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodeUplinkNASTransport
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentIgnore
+
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentUplinkNASTransport
+	initiatingMessage.Value.UplinkNASTransport = new(ngapType.UplinkNASTransport)
+
+	uplinkNasTransport := initiatingMessage.Value.UplinkNASTransport
+	uplinkNasTransportIEs := &uplinkNasTransport.ProtocolIEs
+
+	// AMF UE NGAP ID
+	ie := ngapType.UplinkNASTransportIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDAMFUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.UplinkNASTransportIEsPresentAMFUENGAPID
+	ie.Value.AMFUENGAPID = new(ngapType.AMFUENGAPID)
+
+	aMFUENGAPID := ie.Value.AMFUENGAPID
+	aMFUENGAPID.Value = ue.AmfUeNgapId
+
+	uplinkNasTransportIEs.List = append(uplinkNasTransportIEs.List, ie)
+
+	// RAN UE NGAP ID
+	ie = ngapType.UplinkNASTransportIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.UplinkNASTransportIEsPresentRANUENGAPID
+	ie.Value.RANUENGAPID = new(ngapType.RANUENGAPID)
+
+	rANUENGAPID := ie.Value.RANUENGAPID
+	rANUENGAPID.Value = ue.RanUeNgapId
+
+	uplinkNasTransportIEs.List = append(uplinkNasTransportIEs.List, ie)
+
+	// NAS-PDU
+	ie = ngapType.UplinkNASTransportIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDNASPDU
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.UplinkNASTransportIEsPresentNASPDU
+	ie.Value.NASPDU = new(ngapType.NASPDU)
+	nASPDU := ie.Value.NASPDU
+	nASPDU.Value = nasPdu
+	uplinkNasTransportIEs.List = append(uplinkNasTransportIEs.List, ie)
+
+	// User Location Information
+	ie = ngapType.UplinkNASTransportIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDUserLocationInformation
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.UplinkNASTransportIEsPresentUserLocationInformation
+	ie.Value.UserLocationInformation = agfUserLocationInfo(ue)
+
+	uplinkNasTransportIEs.List = append(uplinkNasTransportIEs.List, ie)
+
+	return ngap.Encoder(pdu)
+}
+
+func agfUserLocationInfo(ue *context.UEContext) *ngapType.UserLocationInformation {
+	var info *ngapType.UserLocationInformation
+	// var lineType *ngapType.LineType
+	if len(ue.GlobalID) == 0 {
+		logger.MainLog.Error("missing ue GlobalID")
+		return nil
+	}
+	/*switch ue.LineType {
+	case "DSL", "dsl":
+		lineType = &ngapType.LineType{
+			Value: ngapType.LineTypePresentDS1,
+		}
+	case "PON", "pon":
+		lineType = &ngapType.LineType{
+			Value: ngapType.LineTypePresentPON,
+		}
+	default:
+		logger.NgapLog.Error("invalie lineType: %s", ue.LineType)
+		return nil
+	}*/
+	userLocationInformationWAGF := &ngapType.UserLocationInformationWAGF{
+		Present: ngapType.UserLocationInformationWAGFPresentGlobalLineID,
+		GlobalLineID: &ngapType.GlobalLineID{
+			GlobalLineIdentity: ue.GlobalID,
+			// TOFIX: need to fix it back when amf issue have fixed
+			// LineType:           lineType,
+		},
+	}
+	if ue.LineType == types.LineType_CABLE {
+		// the GCI is only carried in the SUCI, the location of a cable line is its HFC node
+		if len(ue.HFCNodeID) == 0 {
+			logger.MainLog.Error("missing ue HFCNodeID")
+			return nil
+		}
+		userLocationInformationWAGF = &ngapType.UserLocationInformationWAGF{
+			Present:   ngapType.UserLocationInformationWAGFPresentHfcNodeID,
+			HfcNodeID: &ngapType.HfcNodeID{Value: ue.HFCNodeID},
+		}
+	}
+	info = &ngapType.UserLocationInformation{
+		Present: ngapType.UserLocationInformationPresentChoiceExtensions,
+		ChoiceExtensions: &ngapType.ProtocolIESingleContainerUserLocationInformationExtIEs{
+			Value: ngapType.UserLocationInformationExtIEs{
+				Id: ngapType.ProtocolIEID{
+					Value: ngapType.ProtocolIEIDUserLocationInformationWAGF,
+				},
+				Criticality: ngapType.Criticality{
+					Value: ngapType.CriticalityPresentIgnore,
+				},
+				Value: ngapType.UserLocationInformationExtIEsValue{
+					Present:                     ngapType.UserLocationInformationExtIEsPresentWAGF,
+					UserLocationInformationWAGF: userLocationInformationWAGF,
+				},
+			},
+		},
+	}
+	return info
+}
+
+func BuildRegistrationAccept(ue *context.UEContext) ([]byte, error) {
+	var nasMsg []byte
+	var pdu []byte
+	var err error
+	nasMsg, err = buildRegistrationAccept(ue)
+	if err != nil {
+		return nasMsg, err
+	}
+	pdu, err = BuildDownlinkNasTransport(ue, nasMsg, nil)
+	if err != nil {
+		return pdu, err
+	}
+	return pdu, err
+}
+
+func buildRegistrationAccept(ue *context.UEContext) ([]byte, error) {
+
+	m := nas.NewMessage()
+	m.GmmMessage = nas.NewGmmMessage()
+	m.GmmHeader.SetMessageType(nas.MsgTypeRegistrationAccept)
+
+	m.SecurityHeader = nas.SecurityHeader{
+		ProtocolDiscriminator: nasMessage.Epd5GSMobilityManagementMessage,
+		SecurityHeaderType:    nas.SecurityHeaderTypeIntegrityProtectedAndCiphered,
+	}
+
+	registrationAccept := nasMessage.NewRegistrationAccept(0)
+	registrationAccept.ExtendedProtocolDiscriminator.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSMobilityManagementMessage)
+	registrationAccept.SpareHalfOctetAndSecurityHeaderType.SetSecurityHeaderType(nas.SecurityHeaderTypePlainNas)
+	registrationAccept.SpareHalfOctetAndSecurityHeaderType.SetSpareHalfOctet(0)
+	registrationAccept.RegistrationAcceptMessageIdentity.SetMessageType(nas.MsgTypeRegistrationAccept)
+
+	// registered over the access of the RG only
+	registrationAccept.RegistrationResult5GS.SetLen(1)
+	registrationAccept.RegistrationResult5GS.SetRegistrationResultValue5GS(ue.AccessType())
+
+	if ue.Guti != "" {
+		gutiNas := nasConvert.GutiToNas(ue.Guti)
+		registrationAccept.GUTI5G = &gutiNas
+		registrationAccept.GUTI5G.SetIei(nasMessage.RegistrationAcceptGUTI5GType)
+	}
+
+	if len(ue.CurrentAMF.EquivalentPlmns) > 0 {
+		registrationAccept.EquivalentPlmns = nasType.NewEquivalentPlmns(nasMessage.RegistrationAcceptEquivalentPlmnsType)
+		var buf []uint8
+		for _, plmnId := range ue.CurrentAMF.EquivalentPlmns {
+			buf = append(buf, nasConvert.PlmnIDToNas(plmnId)...)
+		}
+		registrationAccept.EquivalentPlmns.SetLen(uint8(len(buf)))
+		copy(registrationAccept.EquivalentPlmns.Octet[:], buf)
+	}
+
+	if len(ue.TAIList) > 0 {
+		registrationAccept.TAIList = nasType.NewTAIList(nasMessage.RegistrationAcceptTAIListType)
+		taiListNas := nasConvert.TaiListToNas(ue.TAIList)
+		registrationAccept.TAIList.SetLen(uint8(len(taiListNas)))
+		registrationAccept.TAIList.SetPartialTrackingAreaIdentityList(taiListNas)
+	}
+
+	if len(ue.AllowedNssai) > 0 {
+		registrationAccept.AllowedNSSAI = util.AllowedNssaiToNas(nasMessage.RegistrationAcceptAllowedNSSAIType,
+			ue.AllowedNssai)
+	}
+
+	if len(ue.RejectedNssaiInPlmn) != 0 || len(ue.RejectedNssaiInTai) != 0 {
+		registrationAccept.RejectedNSSAI = util.RejectedNssaiToNas(nasMessage.RegistrationAcceptRejectedNSSAIType,
+			ue.RejectedNssaiInPlmn, ue.RejectedNssaiInTai)
+	}
+
+	if len(ue.ConfiguredNssai) > 0 {
+		registrationAccept.ConfiguredNSSAI = util.ConfiguredNssaiToNas(nasMessage.RegistrationAcceptConfiguredNSSAIType,
+			ue.ConfiguredNssai)
+	}
+
+	// IMS voice over PS as configured for the UE, no emergency services nor MPS
+	registrationAccept.NetworkFeatureSupport5GS = nasType.NewNetworkFeatureSupport5GS(nasMessage.RegistrationAcceptNetworkFeatureSupport5GSType)
+	registrationAccept.NetworkFeatureSupport5GS.SetLen(2)
+	registrationAccept.NetworkFeatureSupport5GS.SetIMSVoPS3GPP(ue.IMSVoiceSupported)
+	registrationAccept.NetworkFeatureSupport5GS.SetIMSVoPSN3GPP(ue.IMSVoiceSupported)
+
+	registrationAccept.PDUSessionStatus = nasType.NewPDUSessionStatus(nasMessage.RegistrationAcceptPDUSessionStatusType)
+	registrationAccept.PDUSessionStatus.SetLen(2)
+	registrationAccept.PDUSessionStatus.Buffer = nasConvert.PSIToBuf(*ue.GetPDUSessionStatus())
+
+	if ue.RegistrationType != nasMessage.RegistrationType5GSInitialRegistration && ue.UplinkDataStatus != [16]bool{} {
+		registrationAccept.PDUSessionReactivationResult = nasType.NewPDUSessionReactivationResult(nasMessage.RegistrationAcceptPDUSessionReactivationResultType)
+		registrationAccept.PDUSessionReactivationResult.SetLen(2)
+		registrationAccept.PDUSessionReactivationResult.Buffer = nasConvert.PSIToBuf(ue.PduSessionReactivationResult)
+	}
+
+	if ue.T3512Value != 0 {
+		registrationAccept.T3512Value = nasType.NewT3512Value(nasMessage.RegistrationAcceptT3512ValueType)
+		registrationAccept.T3512Value.SetLen(1)
+		registrationAccept.T3512Value.Octet = nasConvert.GPRSTimer3ToNas(ue.T3512Value)
+	}
+
+	if ue.Non3GppDeregistrationTimerValue != 0 {
+		registrationAccept.Non3GppDeregistrationTimerValue = nasType.NewNon3GppDeregistrationTimerValue(nasMessage.RegistrationAcceptNon3GppDeregistrationTimerValueType)
+		registrationAccept.Non3GppDeregistrationTimerValue.SetLen(1)
+		registrationAccept.Non3GppDeregistrationTimerValue.SetGPRSTimer2Value(nasConvert.GPRSTimer2ToNas(ue.Non3GppDeregistrationTimerValue))
+	}
+
+	m.GmmMessage.RegistrationAccept = registrationAccept
+	return amf_nas.Encode(ue, m, false)
+}
+
+// <5G-GUTI> = <GUAMI><5G-TMSI>,
+// <GUAMI> := <MCC> <MNC> <AMF Region ID> <AMF Set ID> <AMF Pointer>
+// <AMF Identifier> = <AMF Region ID><AMF Set ID><AMF Pointer>
+// MCC and MNC shall have the same field size as in earlier 3GPP systems.
+// 5G-TMSI shall be of 32 bits length.
+// AMF Region ID shall be of 8 bits length.
+// AMF Set ID shall be of 10 bits length.
+// AMF Pointer shall be of 6 bits length.
+func buildGuami(ue *context.UEContext) *ngapType.GUAMI {
+	guami := new(ngapType.GUAMI)
+	*guami = ue.CurrentAMF.ServedGuamiList.List[0].GUAMI
+
+	return guami
+}
+
+// amf/gmm/message/build.go: BuildDeregistrationRequest
+func BuildDeregistrationRequestUETerminated(ue *context.UEContext, reRegistrationRequired bool, cause5GMM uint8) ([]byte, error) {
+	var nasMsg []byte
+	var pdu []byte
+	var err error
+	nasMsg, err = buildDeregistrationRequestUETerminated(ue, reRegistrationRequired, cause5GMM)
+	if err != nil {
+		return nasMsg, err
+	}
+	pdu, err = BuildDownlinkNasTransport(ue, nasMsg, nil)
+	if err != nil {
+		return pdu, err
+	}
+	return pdu, err
+}
+
+func buildDeregistrationRequestUETerminated(ue *context.UEContext, reRegistrationRequired bool, cause5GMM uint8) ([]byte, error) {
+	m := nas.NewMessage()
+	m.GmmMessage = nas.NewGmmMessage()
+	m.GmmHeader.SetMessageType(nas.MsgTypeDeregistrationRequestUETerminatedDeregistration)
+
+	m.SecurityHeader = nas.SecurityHeader{
+		ProtocolDiscriminator: nasMessage.Epd5GSMobilityManagementMessage,
+		SecurityHeaderType:    nas.SecurityHeaderTypeIntegrityProtectedAndCiphered,
+	}
+
+	deregistrationRequest := nasMessage.NewDeregistrationRequestUETerminatedDeregistration(0)
+	deregistrationRequest.ExtendedProtocolDiscriminator.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSMobilityManagementMessage)
+	deregistrationRequest.SpareHalfOctetAndSecurityHeaderType.SetSecurityHeaderType(nas.SecurityHeaderTypePlainNas)
+	deregistrationRequest.SpareHalfOctetAndSecurityHeaderType.SetSpareHalfOctet(0)
+	deregistrationRequest.DeregistrationRequestMessageIdentity.SetMessageType(nas.MsgTypeDeregistrationRequestUETerminatedDeregistration)
+
+	deregistrationRequest.SpareHalfOctetAndDeregistrationType.SetAccessType(ue.AccessType())
+	deregistrationRequest.SpareHalfOctetAndDeregistrationType.SetSwitchOff(0)
+	if reRegistrationRequired {
+		deregistrationRequest.SpareHalfOctetAndDeregistrationType.SetReRegistrationRequired(nasMessage.ReRegistrationRequired)
+	} else {
+		deregistrationRequest.SpareHalfOctetAndDeregistrationType.SetReRegistrationRequired(nasMessage.ReRegistrationNotRequired)
+	}
+
+	if cause5GMM != 0 {
+		deregistrationRequest.Cause5GMM = nasType.NewCause5GMM(nasMessage.DeregistrationRequestUETerminatedDeregistrationCause5GMMType)
+		deregistrationRequest.Cause5GMM.SetCauseValue(cause5GMM)
+	}
+
+	m.GmmMessage.DeregistrationRequestUETerminatedDeregistration = deregistrationRequest
+	return amf_nas.Encode(ue, m, false)
+}
+
+// amf/gmm/message/build.go: BuildDeregistrationAccept
+func BuildDeregistrationAccept(ue *context.UEContext) ([]byte, error) {
+	nasMsg, err := buildDeregistrationAccept(ue)
+	if err != nil {
+		return nil, err
+	}
+	return BuildDownlinkNasTransport(ue, nasMsg, nil)
+}
+
+func buildDeregistrationAccept(ue *context.UEContext) ([]byte, error) {
+	m := nas.NewMessage()
+	m.GmmMessage = nas.NewGmmMessage()
+	m.GmmHeader.SetMessageType(nas.MsgTypeDeregistrationAcceptUEOriginatingDeregistration)
+
+	m.SecurityHeader = nas.SecurityHeader{
+		ProtocolDiscriminator: nasMessage.Epd5GSMobilityManagementMessage,
+		SecurityHeaderType:    nas.SecurityHeaderTypeIntegrityProtectedAndCiphered,
+	}
+
+	deregistrationAccept := nasMessage.NewDeregistrationAcceptUEOriginatingDeregistration(0)
+	deregistrationAccept.ExtendedProtocolDiscriminator.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSMobilityManagementMessage)
+	deregistrationAccept.SpareHalfOctetAndSecurityHeaderType.SetSecurityHeaderType(nas.SecurityHeaderTypePlainNas)
+	deregistrationAccept.SpareHalfOctetAndSecurityHeaderType.SetSpareHalfOctet(0)
+	deregistrationAccept.SetMessageType(nas.MsgTypeDeregistrationAcceptUEOriginatingDeregistration)
+
+	m.GmmMessage.DeregistrationAcceptUEOriginatingDeregistration = deregistrationAccept
+	return amf_nas.Encode(ue, m, false)
+}
+
+// amf/gmm/message/build.go: BuildRegistrationReject
+func BuildRegistrationReject(ue *context.UEContext, cause5GMM uint8) ([]byte, error) {
+	nasMsg, err := buildRegistrationReject(ue, cause5GMM)
+	if err != nil {
+		return nil, err
+	}
+	return BuildDownlinkNasTransport(ue, nasMsg, nil)
+}
+
+func buildRegistrationReject(ue *context.UEContext, cause5GMM uint8) ([]byte, error) {
+	m := nas.NewMessage()
+	m.GmmMessage = nas.NewGmmMessage()
+	m.GmmHeader.SetMessageType(nas.MsgTypeRegistrationReject)
+
+	m.SecurityHeader = nas.SecurityHeader{
+		ProtocolDiscriminator: nasMessage.Epd5GSMobilityManagementMessage,
+		SecurityHeaderType:    nas.SecurityHeaderTypePlainNas,
+	}
+
+	registrationReject := nasMessage.NewRegistrationReject(0)
+	registrationReject.ExtendedProtocolDiscriminator.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSMobilityManagementMessage)
+	registrationReject.SpareHalfOctetAndSecurityHeaderType.SetSecurityHeaderType(nas.SecurityHeaderTypePlainNas)
+	registrationReject.SpareHalfOctetAndSecurityHeaderType.SetSpareHalfOctet(0)
+	registrationReject.RegistrationRejectMessageIdentity.SetMessageType(nas.MsgTypeRegistrationReject)
+	registrationReject.Cause5GMM.SetCauseValue(cause5GMM)
+
+	m.GmmMessage.RegistrationReject = registrationReject
+	return amf_nas.Encode(ue, m, false)
+}
+
+// amf/gmm/message/build.go: BuildStatus5GMM
+func BuildStatus5GMM(ue *context.UEContext, cause uint8) ([]byte, error) {
+	nasMsg, err := buildStatus5GMM(ue, cause)
+	if err != nil {
+		return nil, err
+	}
+	return BuildDownlinkNasTransport(ue, nasMsg, nil)
+}
+
+func buildStatus5GMM(ue *context.UEContext, cause uint8) ([]byte, error) {
+	m := nas.NewMessage()
+	m.GmmMessage = nas.NewGmmMessage()
+	m.GmmHeader.SetMessageType(nas.MsgTypeStatus5GMM)
+
+	m.SecurityHeader = nas.SecurityHeader{
+		ProtocolDiscriminator: nasMessage.Epd5GSMobilityManagementMessage,
+		SecurityHeaderType:    nas.SecurityHeaderTypeIntegrityProtectedAndCiphered,
+	}
+
+	status5GMM := nasMessage.NewStatus5GMM(0)
+	status5GMM.ExtendedProtocolDiscriminator.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSMobilityManagementMessage)
+	status5GMM.SpareHalfOctetAndSecurityHeaderType.SetSecurityHeaderType(nas.SecurityHeaderTypePlainNas)
+	status5GMM.SpareHalfOctetAndSecurityHeaderType.SetSpareHalfOctet(0)
+	status5GMM.SetMessageType(nas.MsgTypeStatus5GMM)
+	status5GMM.SetCauseValue(cause)
+
+	m.GmmMessage.Status5GMM = status5GMM
+	return amf_nas.Encode(ue, m, false)
+}
+
+// BuildStatus5GSM returns the 5GSM STATUS of the PDU session and PTI of an uplink 5GSM message which cannot be
+// processed, in a Downlink NAS Transport
+//
+// TS 24.501 8.3.16 5GSM status
+func BuildStatus5GSM(ue *context.UEContext, pduSessionID uint8, pti uint8, cause5GSM uint8) ([]byte, error) {
+	m := nas.NewMessage()
+	m.GsmMessage = nas.NewGsmMessage()
+	m.GsmHeader.SetMessageType(nas.MsgTypeStatus5GSM)
+
+	status5GSM := nasMessage.NewStatus5GSM(0)
+	status5GSM.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSSessionManagementMessage)
+	status5GSM.SetPDUSessionID(pduSessionID)
+	status5GSM.SetPTI(pti)
+	status5GSM.SetMessageType(nas.MsgTypeStatus5GSM)
+	status5GSM.SetCauseValue(cause5GSM)
+
+	m.GsmMessage.Status5GSM = status5GSM
+	nasMsg, err := m.PlainNasEncode()
+	if err != nil {
+		return nil, err
+	}
+	nasMsg, err = BuildDLNASTransport(ue, nasMsg, &pduSessionID, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return BuildDownlinkNasTransport(ue, nasMsg, nil)
+}
+
+// amf/ngap/message/build.go: BuildUEContextReleaseCommand
+func BuildUEContextReleaseCommand(ue *context.UEContext, cause ngapType.Cause) ([]byte, error) {
+
+	var pdu ngapType.NGAPPDU
+
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodeUEContextRelease
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentReject
+
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentUEContextReleaseCommand
+	initiatingMessage.Value.UEContextReleaseCommand = new(ngapType.UEContextReleaseCommand)
+
+	ueContextReleaseCommand := initiatingMessage.Value.UEContextReleaseCommand
+	ueContextReleaseCommandIEs := &ueContextReleaseCommand.ProtocolIEs
+
+	// UE NGAP IDs
+	ie := ngapType.UEContextReleaseCommandIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDUENGAPIDs
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.UEContextReleaseCommandIEsPresentUENGAPIDs
+	ie.Value.UENGAPIDs = new(ngapType.UENGAPIDs)
+
+	ueNGAPIDs := ie.Value.UENGAPIDs
+
+	if ue.RanUeNgapId == context.RanUeNgapIdUnspecified {
+		ueNGAPIDs.Present = ngapType.UENGAPIDsPresentAMFUENGAPID
+		ueNGAPIDs.AMFUENGAPID = new(ngapType.AMFUENGAPID)
+
+		ueNGAPIDs.AMFUENGAPID.Value = ue.AmfUeNgapId
+	} else {
+		ueNGAPIDs.Present = ngapType.UENGAPIDsPresentUENGAPIDPair
+		ueNGAPIDs.UENGAPIDPair = new(ngapType.UENGAPIDPair)
+
+		ueNGAPIDs.UENGAPIDPair.AMFUENGAPID.Value = ue.AmfUeNgapId
+		ueNGAPIDs.UENGAPIDPair.RANUENGAPID.Value = ue.RanUeNgapId
+	}
+
+	ueContextReleaseCommandIEs.List = append(ueContextReleaseCommandIEs.List, ie)
+
+	// Cause
+	ie = ngapType.UEContextReleaseCommandIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDCause
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.UEContextReleaseCommandIEsPresentCause
+	ie.Value.Cause = &cause
+
+	ueContextReleaseCommandIEs.List = append(ueContextReleaseCommandIEs.List, ie)
+
+	return ngap.Encoder(pdu)
+}
+
+func BuildPDUSessionResourceModifyRequest(ue *context.UEContext, pduSessionID uint8, ambrUL int64, ambrDL int64) ([]byte, error) {
+	var nasMsg []byte
+	var pdu []byte
+	var err error
+
+	nasMsg, err = BuildPDUSessionModificationCommand(ue, pduSessionID, ambrUL, ambrDL)
+	if err != nil {
+		return nasMsg, err
+	}
+	pdu, err = buildPDUSessionResourceModifyRequest(ue, pduSessionID, nasMsg, ambrUL, ambrDL)
+	if err != nil {
+		return pdu, err
+	}
+	return pdu, err
+}
+
+// smf/context/gsm_build.go: BuildGSMPDUSessionModificationCommand
+func BuildPDUSessionModificationCommand(ue *context.UEContext, pduSessionID uint8, ambrUL int64, ambrDL int64) ([]byte, error) {
+	m := nas.NewMessage()
+	m.GsmMessage = nas.NewGsmMessage()
+	m.GsmHeader.SetMessageType(nas.MsgTypePDUSessionModificationCommand)
+
+	pduSessionModificationCommand := nasMessage.NewPDUSessionModificationCommand(0)
+	pduSessionModificationCommand.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSSessionManagementMessage)
+	pduSessionModificationCommand.SetPDUSessionID(pduSessionID)
+	pduSessionModificationCommand.SetPTI(0x00)
+	pduSessionModificationCommand.SetMessageType(nas.MsgTypePDUSessionModificationCommand)
+
+	if ambrUL > 0 && ambrDL > 0 {
+		pduSessionModificationCommand.SessionAMBR = nasType.NewSessionAMBR(nasMessage.PDUSessionModificationCommandSessionAMBRType)
+		pduSessionModificationCommand.SessionAMBR.SetLen(6)
+		unitDL, valueDL := util.BitRateToNasAMBR(ambrDL)
+		pduSessionModificationCommand.SessionAMBR.SetUnitForSessionAMBRForDownlink(unitDL)
+		pduSessionModificationCommand.SessionAMBR.SetSessionAMBRForDownlink(valueDL)
+		unitUL, valueUL := util.BitRateToNasAMBR(ambrUL)
+		pduSessionModificationCommand.SessionAMBR.SetUnitForSessionAMBRForUplink(unitUL)
+		pduSessionModificationCommand.SessionAMBR.SetSessionAMBRForUplink(valueUL)
+	}
+
+	m.GsmMessage.PDUSessionModificationCommand = pduSessionModificationCommand
+	nasMsg, err := m.PlainNasEncode()
+	if err != nil {
+		return nasMsg, err
+	}
+
+	return BuildDLNASTransport(ue, nasMsg, &pduSessionID, nil, nil)
+}
+
+// amf/ngap/message/build.go: BuildPDUSessionResourceModifyRequest
+func buildPDUSessionResourceModifyRequest(ue *context.UEContext, pduSessionID uint8, nasPdu []byte, ambrUL int64, ambrDL int64) ([]byte, error) {
+	var pdu ngapType.NGAPPDU
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodePDUSessionResourceModify
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentReject
+
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentPDUSessionResourceModifyRequest
+	initiatingMessage.Value.PDUSessionResourceModifyRequest = new(ngapType.PDUSessionResourceModifyRequest)
+
+	pDUSessionResourceModifyRequest := initiatingMessage.Value.PDUSessionResourceModifyRequest
+	pDUSessionResourceModifyRequestIEs := &pDUSessionResourceModifyRequest.ProtocolIEs
+
+	// AMF UE NGAP ID
+	ie := ngapType.PDUSessionResourceModifyRequestIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDAMFUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.PDUSessionResourceModifyRequestIEsPresentAMFUENGAPID
+	ie.Value.AMFUENGAPID = new(ngapType.AMFUENGAPID)
+
+	aMFUENGAPID := ie.Value.AMFUENGAPID
+	aMFUENGAPID.Value = ue.AmfUeNgapId
+
+	pDUSessionResourceModifyRequestIEs.List = append(pDUSessionResourceModifyRequestIEs.List, ie)
+
+	// RAN UE NGAP ID
+	ie = ngapType.PDUSessionResourceModifyRequestIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.PDUSessionResourceModifyRequestIEsPresentRANUENGAPID
+	ie.Value.RANUENGAPID = new(ngapType.RANUENGAPID)
+
+	rANUENGAPID := ie.Value.RANUENGAPID
+	rANUENGAPID.Value = ue.RanUeNgapId
+
+	pDUSessionResourceModifyRequestIEs.List = append(pDUSessionResourceModifyRequestIEs.List, ie)
+
+	// PDU Session Resource Modify Request List
+	ie = ngapType.PDUSessionResourceModifyRequestIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDPDUSessionResourceModifyListModReq
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.PDUSessionResourceModifyRequestIEsPresentPDUSessionResourceModifyListModReq
+	ie.Value.PDUSessionResourceModifyListModReq = new(ngapType.PDUSessionResourceModifyListModReq)
+
+	modifyReqItem := ngapType.PDUSessionResourceModifyItemModReq{}
+	modifyReqItem.PDUSessionID.Value = int64(pduSessionID)
+	modifyReqItem.NASPDU = new(ngapType.NASPDU)
+	modifyReqItem.NASPDU.Value = nasPdu
+	transfer, err := buildPDUSessionResourceModifyRequestTransfer(ambrUL, ambrDL)
+	if err != nil {
+		return nil, err
+	}
+	modifyReqItem.PDUSessionResourceModifyRequestTransfer = transfer
+	ie.Value.PDUSessionResourceModifyListModReq.List = append(ie.Value.PDUSessionResourceModifyListModReq.List, modifyReqItem)
+
+	pDUSessionResourceModifyRequestIEs.List = append(pDUSessionResourceModifyRequestIEs.List, ie)
+
+	return ngap.Encoder(pdu)
+}
+
+// TS 38.413 9.3.4.3 PDU Session Resource Modify Request Transfer
+func buildPDUSessionResourceModifyRequestTransfer(ambrUL int64, ambrDL int64) ([]byte, error) {
+	transfer := ngapType.PDUSessionResourceModifyRequestTransfer{}
+
+	// PDU Session Aggregate Maximum Bit Rate
+	if ambrUL > 0 && ambrDL > 0 {
+		ie := ngapType.PDUSessionResourceModifyRequestTransferIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDPDUSessionAggregateMaximumBitRate
+		ie.Criticality.Value = ngapType.CriticalityPresentReject
+		ie.Value.Present = ngapType.PDUSessionResourceModifyRequestTransferIEsPresentPDUSessionAggregateMaximumBitRate
+		ie.Value.PDUSessionAggregateMaximumBitRate = new(ngapType.PDUSessionAggregateMaximumBitRate)
+		ie.Value.PDUSessionAggregateMaximumBitRate.PDUSessionAggregateMaximumBitRateUL.Value = ambrUL
+		ie.Value.PDUSessionAggregateMaximumBitRate.PDUSessionAggregateMaximumBitRateDL.Value = ambrDL
+
+		transfer.ProtocolIEs.List = append(transfer.ProtocolIEs.List, ie)
+	}
+
+	return aper.MarshalWithParams(transfer, "valueExt")
+}
+
+// amf/ngap/message/build.go: BuildPaging
+func BuildPaging(ue *context.UEContext) ([]byte, error) {
+	if ue.AGF == nil || ue.AGF.SupportedTAList == nil || len(ue.AGF.SupportedTAList.List) == 0 {
+		return nil, fmt.Errorf("No supported TA of the AGF for paging")
+	}
+
+	var pdu ngapType.NGAPPDU
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodePaging
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentIgnore
+
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentPaging
+	initiatingMessage.Value.Paging = new(ngapType.Paging)
+
+	paging := initiatingMessage.Value.Paging
+	pagingIEs := &paging.ProtocolIEs
+
+	// UE Paging Identity
+	ie := ngapType.PagingIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDUEPagingIdentity
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.PagingIEsPresentUEPagingIdentity
+	ie.Value.UEPagingIdentity = new(ngapType.UEPagingIdentity)
+
+	uePagingIdentity := ie.Value.UEPagingIdentity
+	uePagingIdentity.Present = ngapType.UEPagingIdentityPresentFiveGSTMSI
+	uePagingIdentity.FiveGSTMSI = new(ngapType.FiveGSTMSI)
+
+	guami := buildGuami(ue)
+	uePagingIdentity.FiveGSTMSI.AMFSetID = guami.AMFSetID
+	uePagingIdentity.FiveGSTMSI.AMFPointer = guami.AMFPointer
+	uePagingIdentity.FiveGSTMSI.FiveGTMSI.Value = ue.TMSI5G[:]
+
+	pagingIEs.List = append(pagingIEs.List, ie)
+
+	// TAI List for Paging
+	ie = ngapType.PagingIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDTAIListForPaging
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.PagingIEsPresentTAIListForPaging
+	ie.Value.TAIListForPaging = new(ngapType.TAIListForPaging)
+
+	taiListForPaging := ie.Value.TAIListForPaging
+	for _, supportedTAItem := range ue.AGF.SupportedTAList.List {
+		for _, broadcastPLMNItem := range supportedTAItem.BroadcastPLMNList.List {
+			taiListforPagingItem := ngapType.TAIListForPagingItem{}
+			taiListforPagingItem.TAI.PLMNIdentity = broadcastPLMNItem.PLMNIdentity
+			taiListforPagingItem.TAI.TAC = supportedTAItem.TAC
+			taiListForPaging.List = append(taiListForPaging.List, taiListforPagingItem)
+		}
+	}
+
+	pagingIEs.List = append(pagingIEs.List, ie)
+
+	// Paging Origin (optional)
+	ie = ngapType.PagingIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDPagingOrigin
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.PagingIEsPresentPagingOrigin
+	ie.Value.PagingOrigin = new(ngapType.PagingOrigin)
+	ie.Value.PagingOrigin.Value = ngapType.PagingOriginPresentNon3gpp
+
+	pagingIEs.List = append(pagingIEs.List, ie)
+
+	return ngap.Encoder(pdu)
+}
+
+// amf/ngap/message/build.go: BuildNGReset
+func BuildNGReset(cause ngapType.Cause, partOfNGInterface *ngapType.UEAssociatedLogicalNGConnectionList) ([]byte, error) {
+
+	var pdu ngapType.NGAPPDU
+
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodeNGReset
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentReject
+
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentNGReset
+	initiatingMessage.Value.NGReset = new(ngapType.NGReset)
+
+	nGReset := initiatingMessage.Value.NGReset
+	nGResetIEs := &nGReset.ProtocolIEs
+
+	// Cause
+	ie := ngapType.NGResetIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDCause
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.NGResetIEsPresentCause
+	ie.Value.Cause = &cause
+
+	nGResetIEs.List = append(nGResetIEs.List, ie)
+
+	// Reset Type
+	ie = ngapType.NGResetIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDResetType
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.NGResetIEsPresentResetType
+	ie.Value.ResetType = new(ngapType.ResetType)
+
+	resetType := ie.Value.ResetType
+
+	if partOfNGInterface == nil {
+		resetType.Present = ngapType.ResetTypePresentNGInterface
+		resetType.NGInterface = new(ngapType.ResetAll)
+		resetType.NGInterface.Value = ngapType.ResetAllPresentResetAll
+	} else {
+		resetType.Present = ngapType.ResetTypePresentPartOfNGInterface
+		resetType.PartOfNGInterface = partOfNGInterface
+	}
+
+	nGResetIEs.List = append(nGResetIEs.List, ie)
+
+	return ngap.Encoder(pdu)
+}
+
+// BuildRerouteNASRequest builds a Reroute NAS Request of the Initial UE Message of a UE towards the AMF set
+//
+// TS 38.413 8.6.5 Reroute NAS Request
+func BuildRerouteNASRequest(ranUeNgapId int64, initialUEMessage []byte, amfSetID aper.BitString) ([]byte, error) {
+
+	var pdu ngapType.NGAPPDU
+
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodeRerouteNASRequest
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentReject
+
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentRerouteNASRequest
+	initiatingMessage.Value.RerouteNASRequest = new(ngapType.RerouteNASRequest)
+
+	rerouteNASRequest := initiatingMessage.Value.RerouteNASRequest
+	rerouteNASRequestIEs := &rerouteNASRequest.ProtocolIEs
+
+	// RAN UE NGAP ID
+	ie := ngapType.RerouteNASRequestIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.RerouteNASRequestIEsPresentRANUENGAPID
+	ie.Value.RANUENGAPID = new(ngapType.RANUENGAPID)
+	ie.Value.RANUENGAPID.Value = ranUeNgapId
+
+	rerouteNASRequestIEs.List = append(rerouteNASRequestIEs.List, ie)
+
+	// NGAP Message
+	ie = ngapType.RerouteNASRequestIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDNGAPMessage
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.RerouteNASRequestIEsPresentNGAPMessage
+	ie.Value.NGAPMessage = new(aper.OctetString)
+	*ie.Value.NGAPMessage = initialUEMessage
+
+	rerouteNASRequestIEs.List = append(rerouteNASRequestIEs.List, ie)
+
+	// AMF Set ID
+	ie = ngapType.RerouteNASRequestIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDAMFSetID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.RerouteNASRequestIEsPresentAMFSetID
+	ie.Value.AMFSetID = new(ngapType.AMFSetID)
+	ie.Value.AMFSetID.Value = amfSetID
+
+	rerouteNASRequestIEs.List = append(rerouteNASRequestIEs.List, ie)
+
+	return ngap.Encoder(pdu)
+}
+
+// BuildAMFStatusIndication builds an AMF Status Indication of the GUAMIs served by an AMF, indicated unavailable
+// together with the name of the AMF taking them over if backupAMFName is not empty
+//
+// TS 38.413 8.7.6 AMF Status Indication
+func BuildAMFStatusIndication(servedGUAMIList *ngapType.ServedGUAMIList, backupAMFName string) ([]byte, error) {
+
+	var pdu ngapType.NGAPPDU
+
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodeAMFStatusIndication
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentIgnore
+
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentAMFStatusIndication
+	initiatingMessage.Value.AMFStatusIndication = new(ngapType.AMFStatusIndication)
+
+	aMFStatusIndication := initiatingMessage.Value.AMFStatusIndication
+	aMFStatusIndicationIEs := &aMFStatusIndication.ProtocolIEs
+
+	// Unavailable GUAMI List
+	ie := ngapType.AMFStatusIndicationIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDUnavailableGUAMIList
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.AMFStatusIndicationIEsPresentUnavailableGUAMIList
+	ie.Value.UnavailableGUAMIList = new(ngapType.UnavailableGUAMIList)
+
+	unavailableGUAMIList := ie.Value.UnavailableGUAMIList
+	for _, servedGUAMIItem := range servedGUAMIList.List {
+		item := ngapType.UnavailableGUAMIItem{GUAMI: servedGUAMIItem.GUAMI}
+		if backupAMFName != "" {
+			item.BackupAMFName = &ngapType.AMFName{Value: backupAMFName}
+		}
+		unavailableGUAMIList.List = append(unavailableGUAMIList.List, item)
+	}
+
+	aMFStatusIndicationIEs.List = append(aMFStatusIndicationIEs.List, ie)
+
+	return ngap.Encoder(pdu)
+}
+
+// BuildAMFConfigurationUpdate builds an AMF Configuration Update of the endpoints of the AMF the AGF sets up, removes
+// or updates TNL associations to
+//
+// TS 38.413 8.7.3 AMF Configuration Update
+func BuildAMFConfigurationUpdate(toAdd, toRemove, toUpdate []*context.AMFTNLAssociationItem) ([]byte, error) {
+
+	var pdu ngapType.NGAPPDU
+
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodeAMFConfigurationUpdate
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentReject
+
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentAMFConfigurationUpdate
+	initiatingMessage.Value.AMFConfigurationUpdate = new(ngapType.AMFConfigurationUpdate)
+
+	aMFConfigurationUpdate := initiatingMessage.Value.AMFConfigurationUpdate
+	aMFConfigurationUpdateIEs := &aMFConfigurationUpdate.ProtocolIEs
+
+	// AMF TNL Association to Add List (optional)
+	if len(toAdd) > 0 {
+		ie := ngapType.AMFConfigurationUpdateIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDAMFTNLAssociationToAddList
+		ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+		ie.Value.Present = ngapType.AMFConfigurationUpdateIEsPresentAMFTNLAssociationToAddList
+		ie.Value.AMFTNLAssociationToAddList = new(ngapType.AMFTNLAssociationToAddList)
+
+		aMFTNLAssociationToAddList := ie.Value.AMFTNLAssociationToAddList
+		for _, item := range toAdd {
+			aMFTNLAssociationToAddList.List = append(aMFTNLAssociationToAddList.List,
+				ngapType.AMFTNLAssociationToAddItem{
+					AMFTNLAssociationAddress: item.CPTransportLayerInformation(),
+					TNLAssociationUsage:      item.TNLAssociationUsage,
+					TNLAddressWeightFactor:   ngapType.TNLAddressWeightFactor{Value: *item.TNLAddressWeightFactor},
+				})
+		}
+
+		aMFConfigurationUpdateIEs.List = append(aMFConfigurationUpdateIEs.List, ie)
+	}
+
+	// AMF TNL Association to Remove List (optional)
+	if len(toRemove) > 0 {
+		ie := ngapType.AMFConfigurationUpdateIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDAMFTNLAssociationToRemoveList
+		ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+		ie.Value.Present = ngapType.AMFConfigurationUpdateIEsPresentAMFTNLAssociationToRemoveList
+		ie.Value.AMFTNLAssociationToRemoveList = new(ngapType.AMFTNLAssociationToRemoveList)
+
+		aMFTNLAssociationToRemoveList := ie.Value.AMFTNLAssociationToRemoveList
+		for _, item := range toRemove {
+			aMFTNLAssociationToRemoveList.List = append(aMFTNLAssociationToRemoveList.List,
+				ngapType.AMFTNLAssociationToRemoveItem{
+					AMFTNLAssociationAddress: item.CPTransportLayerInformation(),
+				})
+		}
+
+		aMFConfigurationUpdateIEs.List = append(aMFConfigurationUpdateIEs.List, ie)
+	}
+
+	// AMF TNL Association to Update List (optional)
+	if len(toUpdate) > 0 {
+		ie := ngapType.AMFConfigurationUpdateIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDAMFTNLAssociationToUpdateList
+		ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+		ie.Value.Present = ngapType.AMFConfigurationUpdateIEsPresentAMFTNLAssociationToUpdateList
+		ie.Value.AMFTNLAssociationToUpdateList = new(ngapType.AMFTNLAssociationToUpdateList)
+
+		aMFTNLAssociationToUpdateList := ie.Value.AMFTNLAssociationToUpdateList
+		for _, item := range toUpdate {
+			updateItem := ngapType.AMFTNLAssociationToUpdateItem{
+				AMFTNLAssociationAddress: item.CPTransportLayerInformation(),
+				TNLAssociationUsage:      item.TNLAssociationUsage,
+			}
+			if item.TNLAddressWeightFactor != nil {
+				updateItem.TNLAddressWeightFactor = &ngapType.TNLAddressWeightFactor{Value: *item.TNLAddressWeightFactor}
+			}
+			aMFTNLAssociationToUpdateList.List = append(aMFTNLAssociationToUpdateList.List, updateItem)
+		}
+
+		aMFConfigurationUpdateIEs.List = append(aMFConfigurationUpdateIEs.List, ie)
+	}
+
+	return ngap.Encoder(pdu)
+}
+
+// BuildUETNLABindingReleaseRequest builds a UE TNLA Binding Release Request of the UE
+//
+// TS 38.413 8.13.1 UE TNLA Binding Release
+func BuildUETNLABindingReleaseRequest(ue *context.UEContext) ([]byte, error) {
+
+	var pdu ngapType.NGAPPDU
+
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodeUETNLABindingRelease
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentIgnore
+
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentUETNLABindingReleaseRequest
+	initiatingMessage.Value.UETNLABindingReleaseRequest = new(ngapType.UETNLABindingReleaseRequest)
+
+	uETNLABindingReleaseRequest := initiatingMessage.Value.UETNLABindingReleaseRequest
+	uETNLABindingReleaseRequestIEs := &uETNLABindingReleaseRequest.ProtocolIEs
+
+	// AMF UE NGAP ID
+	ie := ngapType.UETNLABindingReleaseRequestIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDAMFUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.UETNLABindingReleaseRequestIEsPresentAMFUENGAPID
+	ie.Value.AMFUENGAPID = new(ngapType.AMFUENGAPID)
+	ie.Value.AMFUENGAPID.Value = ue.AmfUeNgapId
+
+	uETNLABindingReleaseRequestIEs.List = append(uETNLABindingReleaseRequestIEs.List, ie)
+
+	// RAN UE NGAP ID
+	ie = ngapType.UETNLABindingReleaseRequestIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.UETNLABindingReleaseRequestIEsPresentRANUENGAPID
+	ie.Value.RANUENGAPID = new(ngapType.RANUENGAPID)
+	ie.Value.RANUENGAPID.Value = ue.RanUeNgapId
+
+	uETNLABindingReleaseRequestIEs.List = append(uETNLABindingReleaseRequestIEs.List, ie)
+
+	return ngap.Encoder(pdu)
+}
+
+// BuildAMFCPRelocationIndication builds an AMF CP Relocation Indication of the UE, with its Allowed NSSAI
+//
+// TS 38.413 8.3.7 AMF CP Relocation Indication
+func BuildAMFCPRelocationIndication(ue *context.UEContext) ([]byte, error) {
+
+	var pdu ngapType.NGAPPDU
+
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodeAMFCPRelocationIndication
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentReject
+
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentAMFCPRelocationIndication
+	initiatingMessage.Value.AMFCPRelocationIndication = new(ngapType.AMFCPRelocationIndication)
+
+	aMFCPRelocationIndication := initiatingMessage.Value.AMFCPRelocationIndication
+	aMFCPRelocationIndicationIEs := &aMFCPRelocationIndication.ProtocolIEs
+
+	// AMF UE NGAP ID
+	ie := ngapType.AMFCPRelocationIndicationIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDAMFUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.AMFCPRelocationIndicationIEsPresentAMFUENGAPID
+	ie.Value.AMFUENGAPID = new(ngapType.AMFUENGAPID)
+	ie.Value.AMFUENGAPID.Value = ue.AmfUeNgapId
+
+	aMFCPRelocationIndicationIEs.List = append(aMFCPRelocationIndicationIEs.List, ie)
+
+	// RAN UE NGAP ID
+	ie = ngapType.AMFCPRelocationIndicationIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.AMFCPRelocationIndicationIEsPresentRANUENGAPID
+	ie.Value.RANUENGAPID = new(ngapType.RANUENGAPID)
+	ie.Value.RANUENGAPID.Value = ue.RanUeNgapId
+
+	aMFCPRelocationIndicationIEs.List = append(aMFCPRelocationIndicationIEs.List, ie)
+
+	// S-NSSAI and Allowed NSSAI (optional)
+	if len(ue.AllowedNssai) > 0 {
+		ie = ngapType.AMFCPRelocationIndicationIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDSNSSAI
+		ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+		ie.Value.Present = ngapType.AMFCPRelocationIndicationIEsPresentSNSSAI
+		ie.Value.SNSSAI = new(ngapType.SNSSAI)
+		*ie.Value.SNSSAI = ngapConvert.SNssaiToNgap(ue.AllowedNssai[0])
+
+		aMFCPRelocationIndicationIEs.List = append(aMFCPRelocationIndicationIEs.List, ie)
+
+		ie = ngapType.AMFCPRelocationIndicationIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDAllowedNSSAI
+		ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+		ie.Value.Present = ngapType.AMFCPRelocationIndicationIEsPresentAllowedNSSAI
+		ie.Value.AllowedNSSAI = new(ngapType.AllowedNSSAI)
+		for _, snssai := range ue.AllowedNssai {
+			ie.Value.AllowedNSSAI.List = append(ie.Value.AllowedNSSAI.List, ngapType.AllowedNSSAIItem{
+				SNSSAI: ngapConvert.SNssaiToNgap(snssai),
+			})
+		}
+
+		aMFCPRelocationIndicationIEs.List = append(aMFCPRelocationIndicationIEs.List, ie)
+	}
+
+	return ngap.Encoder(pdu)
+}
+
+// buildTraceActivation builds the Trace Activation of a trace session
+//
+// TS 38.413 9.3.1.14 Trace Activation
+func buildTraceActivation(trace *context.TraceSettings) *ngapType.TraceActivation {
+	traceActivation := new(ngapType.TraceActivation)
+	traceActivation.NGRANTraceID.Value = trace.TraceID
+	traceActivation.InterfacesToTrace.Value = aper.BitString{Bytes: []byte{trace.InterfacesToTrace}, BitLength: 8}
+	traceActivation.TraceDepth.Value = trace.Depth
+	if ip := trace.CollectionEntity.To4(); ip != nil {
+		traceActivation.TraceCollectionEntityIPAddress = ngapConvert.IPAddressToNgap(ip.String(), "")
+	} else {
+		traceActivation.TraceCollectionEntityIPAddress = ngapConvert.IPAddressToNgap("", trace.CollectionEntity.String())
+	}
+	return traceActivation
+}
+
+// BuildTraceStart builds a Trace Start of the UE, activating the trace session in the AGF
+//
+// TS 38.413 8.12.1 Trace Start
+func BuildTraceStart(ue *context.UEContext, trace *context.TraceSettings) ([]byte, error) {
+
+	var pdu ngapType.NGAPPDU
+
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodeTraceStart
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentIgnore
+
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentTraceStart
+	initiatingMessage.Value.TraceStart = new(ngapType.TraceStart)
+
+	traceStart := initiatingMessage.Value.TraceStart
+	traceStartIEs := &traceStart.ProtocolIEs
+
+	// AMF UE NGAP ID
+	ie := ngapType.TraceStartIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDAMFUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.TraceStartIEsPresentAMFUENGAPID
+	ie.Value.AMFUENGAPID = new(ngapType.AMFUENGAPID)
+	ie.Value.AMFUENGAPID.Value = ue.AmfUeNgapId
+
+	traceStartIEs.List = append(traceStartIEs.List, ie)
+
+	// RAN UE NGAP ID
+	ie = ngapType.TraceStartIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.TraceStartIEsPresentRANUENGAPID
+	ie.Value.RANUENGAPID = new(ngapType.RANUENGAPID)
+	ie.Value.RANUENGAPID.Value = ue.RanUeNgapId
+
+	traceStartIEs.List = append(traceStartIEs.List, ie)
+
+	// Trace Activation
+	ie = ngapType.TraceStartIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDTraceActivation
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.TraceStartIEsPresentTraceActivation
+	ie.Value.TraceActivation = buildTraceActivation(trace)
+
+	traceStartIEs.List = append(traceStartIEs.List, ie)
+
+	return ngap.Encoder(pdu)
+}
+
+// BuildDeactivateTrace builds a Deactivate Trace of the trace session of the UE identified by its NG-RAN Trace ID
+//
+// TS 38.413 8.12.3 Deactivate Trace
+func BuildDeactivateTrace(ue *context.UEContext, traceID []byte) ([]byte, error) {
+
+	var pdu ngapType.NGAPPDU
+
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodeDeactivateTrace
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentIgnore
+
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentDeactivateTrace
+	initiatingMessage.Value.DeactivateTrace = new(ngapType.DeactivateTrace)
+
+	deactivateTrace := initiatingMessage.Value.DeactivateTrace
+	deactivateTraceIEs := &deactivateTrace.ProtocolIEs
+
+	// AMF UE NGAP ID
+	ie := ngapType.DeactivateTraceIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDAMFUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.DeactivateTraceIEsPresentAMFUENGAPID
+	ie.Value.AMFUENGAPID = new(ngapType.AMFUENGAPID)
+	ie.Value.AMFUENGAPID.Value = ue.AmfUeNgapId
+
+	deactivateTraceIEs.List = append(deactivateTraceIEs.List, ie)
+
+	// RAN UE NGAP ID
+	ie = ngapType.DeactivateTraceIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.DeactivateTraceIEsPresentRANUENGAPID
+	ie.Value.RANUENGAPID = new(ngapType.RANUENGAPID)
+	ie.Value.RANUENGAPID.Value = ue.RanUeNgapId
+
+	deactivateTraceIEs.List = append(deactivateTraceIEs.List, ie)
+
+	// NG-RAN Trace ID
+	ie = ngapType.DeactivateTraceIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDNGRANTraceID
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.DeactivateTraceIEsPresentNGRANTraceID
+	ie.Value.NGRANTraceID = new(ngapType.NGRANTraceID)
+	ie.Value.NGRANTraceID.Value = traceID
+
+	deactivateTraceIEs.List = append(deactivateTraceIEs.List, ie)
+
+	return ngap.Encoder(pdu)
+}
+
+// BuildLocationReportingControl builds a Location Reporting Control requesting the AGF to report the location of the UE
+// as given by the Location Reporting Request Type
+//
+// TS 38.413 8.17.1 Location Reporting Control
+func BuildLocationReportingControl(ue *context.UEContext,
+	requestType *ngapType.LocationReportingRequestType) ([]byte, error) {
+
+	var pdu ngapType.NGAPPDU
+
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodeLocationReportingControl
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentIgnore
+
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentLocationReportingControl
+	initiatingMessage.Value.LocationReportingControl = new(ngapType.LocationReportingControl)
+
+	locationReportingControl := initiatingMessage.Value.LocationReportingControl
+	locationReportingControlIEs := &locationReportingControl.ProtocolIEs
+
+	// AMF UE NGAP ID
+	ie := ngapType.LocationReportingControlIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDAMFUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.LocationReportingControlIEsPresentAMFUENGAPID
+	ie.Value.AMFUENGAPID = new(ngapType.AMFUENGAPID)
+	ie.Value.AMFUENGAPID.Value = ue.AmfUeNgapId
+
+	locationReportingControlIEs.List = append(locationReportingControlIEs.List, ie)
+
+	// RAN UE NGAP ID
+	ie = ngapType.LocationReportingControlIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.LocationReportingControlIEsPresentRANUENGAPID
+	ie.Value.RANUENGAPID = new(ngapType.RANUENGAPID)
+	ie.Value.RANUENGAPID.Value = ue.RanUeNgapId
+
+	locationReportingControlIEs.List = append(locationReportingControlIEs.List, ie)
+
+	// Location Reporting Request Type
+	ie = ngapType.LocationReportingControlIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDLocationReportingRequestType
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.LocationReportingControlIEsPresentLocationReportingRequestType
+	ie.Value.LocationReportingRequestType = requestType
+
+	locationReportingControlIEs.List = append(locationReportingControlIEs.List, ie)
+
+	return ngap.Encoder(pdu)
+}
+
+// BuildUEContextModificationRequest builds a UE Context Modification Request of the parameters of the modification
+//
+// TS 38.413 8.3.4 UE Context Modification
+func BuildUEContextModificationRequest(ue *context.UEContext, modification *context.UEContextModification) ([]byte,
+	error) {
+
+	var pdu ngapType.NGAPPDU
+
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodeUEContextModification
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentReject
+
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentUEContextModificationRequest
+	initiatingMessage.Value.UEContextModificationRequest = new(ngapType.UEContextModificationRequest)
+
+	uEContextModificationRequest := initiatingMessage.Value.UEContextModificationRequest
+	uEContextModificationRequestIEs := &uEContextModificationRequest.ProtocolIEs
+
+	// AMF UE NGAP ID
+	ie := ngapType.UEContextModificationRequestIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDAMFUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.UEContextModificationRequestIEsPresentAMFUENGAPID
+	ie.Value.AMFUENGAPID = new(ngapType.AMFUENGAPID)
+	ie.Value.AMFUENGAPID.Value = ue.AmfUeNgapId
+
+	uEContextModificationRequestIEs.List = append(uEContextModificationRequestIEs.List, ie)
+
+	// RAN UE NGAP ID
+	ie = ngapType.UEContextModificationRequestIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.UEContextModificationRequestIEsPresentRANUENGAPID
+	ie.Value.RANUENGAPID = new(ngapType.RANUENGAPID)
+	ie.Value.RANUENGAPID.Value = ue.RanUeNgapId
+
+	uEContextModificationRequestIEs.List = append(uEContextModificationRequestIEs.List, ie)
+
+	// Security Key (optional)
+	if modification.Kwagf != nil {
+		ie = ngapType.UEContextModificationRequestIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDSecurityKey
+		ie.Criticality.Value = ngapType.CriticalityPresentReject
+		ie.Value.Present = ngapType.UEContextModificationRequestIEsPresentSecurityKey
+		ie.Value.SecurityKey = new(ngapType.SecurityKey)
+		ie.Value.SecurityKey.Value = ngapConvert.ByteToBitString(modification.Kwagf, 256)
+
+		uEContextModificationRequestIEs.List = append(uEContextModificationRequestIEs.List, ie)
+	}
+
+	// Index to RAT/Frequency Selection Priority (optional)
+	if modification.IndexToRfsp != 0 {
+		ie = ngapType.UEContextModificationRequestIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDIndexToRFSP
+		ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+		ie.Value.Present = ngapType.UEContextModificationRequestIEsPresentIndexToRFSP
+		ie.Value.IndexToRFSP = &ngapType.IndexToRFSP{Value: modification.IndexToRfsp}
+
+		uEContextModificationRequestIEs.List = append(uEContextModificationRequestIEs.List, ie)
+	}
+
+	// UE Aggregate Maximum Bit Rate (optional)
+	if modification.Ambr != nil {
+		ie = ngapType.UEContextModificationRequestIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDUEAggregateMaximumBitRate
+		ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+		ie.Value.Present = ngapType.UEContextModificationRequestIEsPresentUEAggregateMaximumBitRate
+		ie.Value.UEAggregateMaximumBitRate = modification.Ambr
+
+		uEContextModificationRequestIEs.List = append(uEContextModificationRequestIEs.List, ie)
+	}
+
+	// UE Security Capabilities (optional)
+	if modification.SecurityCapabilities != nil {
+		ie = ngapType.UEContextModificationRequestIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDUESecurityCapabilities
+		ie.Criticality.Value = ngapType.CriticalityPresentReject
+		ie.Value.Present = ngapType.UEContextModificationRequestIEsPresentUESecurityCapabilities
+		ie.Value.UESecurityCapabilities = modification.SecurityCapabilities
+
+		uEContextModificationRequestIEs.List = append(uEContextModificationRequestIEs.List, ie)
+	}
+
+	// Core Network Assistance Information for RRC INACTIVE (optional)
+	if modification.CoreNetworkAssistanceInformation != nil {
+		ie = ngapType.UEContextModificationRequestIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDCoreNetworkAssistanceInformation
+		ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+		ie.Value.Present = ngapType.UEContextModificationRequestIEsPresentCoreNetworkAssistanceInformation
+		ie.Value.CoreNetworkAssistanceInformation = modification.CoreNetworkAssistanceInformation
+
+		uEContextModificationRequestIEs.List = append(uEContextModificationRequestIEs.List, ie)
+	}
+
+	return ngap.Encoder(pdu)
+}
+
+// buildCoreNetworkAssistanceInformation builds the Core Network Assistance Information of the UE: its UE identity
+// index value, the 5G-S-TMSI mod 1024, its periodic registration update timer and its registration area
+//
+// TS 38.413 9.3.1.15 Core Network Assistance Information for RRC INACTIVE, TS 38.304 7.1 Paging frame
+func buildCoreNetworkAssistanceInformation(ue *context.UEContext) *ngapType.CoreNetworkAssistanceInformation {
+	information := new(ngapType.CoreNetworkAssistanceInformation)
+
+	// the 10 least significant bits of the 5G-S-TMSI, those of the 5G-TMSI
+	index := uint16(ue.TMSI5G[2])<<8 | uint16(ue.TMSI5G[3])
+	information.UEIdentityIndexValue.Present = ngapType.UEIdentityIndexValuePresentIndexLength10
+	information.UEIdentityIndexValue.IndexLength10 = &aper.BitString{
+		Bytes:     []byte{uint8(index >> 2), uint8(index << 6)},
+		BitLength: 10,
+	}
+
+	information.PeriodicRegistrationUpdateTimer.Value = aper.BitString{
+		Bytes:     []byte{nasConvert.GPRSTimer3ToNas(ue.T3512Value)},
+		BitLength: 8,
+	}
+
+	for _, tai := range ue.TAIList {
+		information.TAIListForInactive.List = append(information.TAIListForInactive.List,
+			ngapType.TAIListForInactiveItem{TAI: ngapConvert.TaiToNgap(tai)})
+	}
+	return information
+}
@@ -0,0 +1,112 @@
+package simamf
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	lib_ngap "free5gc/lib/ngap"
+	"free5gc/lib/ngap/ngapType"
+	"sim-amf/pkg/context"
+	"sim-amf/pkg/logger"
+	"sim-amf/pkg/pcap"
+
+	"gitlab.casa-systems.com/opensource/sctp"
+)
+
+var (
+	pcapFile         string
+	pcapDecryptedNAS bool
+	pcapPerUEDir     string
+)
+
+// openCapture opens the AMF wide capture file
+func openCapture() error {
+	if pcapPerUEDir != "" {
+		if err := os.MkdirAll(pcapPerUEDir, 0755); err != nil {
+			return err
+		}
+	}
+	if pcapFile == "" {
+		return nil
+	}
+	w, err := pcap.Create(pcapFile)
+	if err != nil {
+		return err
+	}
+	w.DecryptedNAS = pcapDecryptedNAS
+	context.AMFSelf.Capture = w
+	logger.MainLog.Info("Capturing NGAP to %s", pcapFile)
+	return nil
+}
+
+// openUECapture opens the capture file of a new UE and writes the Initial UE Message which created it
+func openUECapture(agf *context.AGFContext, ue *context.UEContext, pdu *ngapType.NGAPPDU) {
+	if pcapPerUEDir == "" {
+		return
+	}
+	name := fmt.Sprintf("ue-%d", ue.AmfUeNgapId)
+	if ue.MAC != "" {
+		name += "-" + strings.Replace(ue.MAC, ":", "", -1)
+	}
+	w, err := pcap.Create(filepath.Join(pcapPerUEDir, name+".pcapng"))
+	if err != nil {
+		logger.MainLog.Error("Open UE capture failed: %+v", err)
+		return
+	}
+	w.DecryptedNAS = pcapDecryptedNAS
+	ue.Capture = w
+
+	pkt, err := lib_ngap.Encoder(*pdu)
+	if err != nil {
+		logger.MainLog.Error("Encode Initial UE Message failed: %+v", err)
+		return
+	}
+	local, remote := sctpEndpoints(agf.SCTPConn)
+	ue.Capture.WriteNGAP(time.Now(), remote, local, pkt, "")
+}
+
+// captureNGAP writes an NGAP message sent or received on the association to the AMF and the UE captures
+func captureNGAP(conn *sctp.SCTPConn, pkt []byte, ue *context.UEContext, received bool) {
+	if context.AMFSelf.Capture == nil && (ue == nil || ue.Capture == nil) {
+		return
+	}
+
+	now := time.Now()
+	src, dst := sctpEndpoints(conn)
+	if received {
+		src, dst = dst, src
+	}
+	if err := context.AMFSelf.Capture.WriteNGAP(now, src, dst, pkt, ""); err != nil {
+		logger.MainLog.Warn("Capture NGAP failed: %+v", err)
+	}
+	if ue != nil {
+		ue.Capture.WriteNGAP(now, src, dst, pkt, "")
+	}
+}
+
+// sctpEndpoints returns the primary local and remote addresses of the association
+func sctpEndpoints(conn *sctp.SCTPConn) (local, remote *net.TCPAddr) {
+	return parseSCTPAddr(conn.LocalAddr()), parseSCTPAddr(conn.RemoteAddr())
+}
+
+// parseSCTPAddr parses a multi-homed "ip1/ip2:port" SCTP address, keeping the first IP address
+func parseSCTPAddr(addr net.Addr) *net.TCPAddr {
+	tcpAddr := &net.TCPAddr{IP: net.IPv4zero}
+	if addr == nil {
+		return tcpAddr
+	}
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return tcpAddr
+	}
+	if ip := net.ParseIP(strings.Split(host, "/")[0]); ip != nil {
+		tcpAddr.IP = ip
+	}
+	tcpAddr.Port, _ = strconv.Atoi(port)
+	return tcpAddr
+}
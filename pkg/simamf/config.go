@@ -0,0 +1,479 @@
+package simamf
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"free5gc/lib/aper"
+	"free5gc/lib/nas/nasMessage"
+	"free5gc/lib/ngap/ngapConvert"
+	"free5gc/lib/ngap/ngapType"
+	"free5gc/lib/openapi/models"
+	"sim-amf/pkg/context"
+	"sim-amf/pkg/suci"
+	"sim-amf/pkg/util"
+)
+
+var (
+	amfName             string
+	plmnID              string
+	amfID               string
+	equivalentPlmnIDs   []string
+	t3512Value          int
+	non3gppDeregTimer   int
+	amfRelativeCapacity int64
+	supportedNssai      []string
+	subscribedNssai     []string
+	subscribers         []string
+	homeNetworkKeys     []string
+	amfInstances        []string
+	amfTNLEndpoints     []string
+	dnnPolicies         []string
+	pduSessionBackoff   int
+)
+
+var (
+	plmnIDRegexp = regexp.MustCompile(`^[0-9]{5,6}$`)
+	amfIDRegexp  = regexp.MustCompile(`^[0-9a-fA-F]{6}$`)
+	snssaiRegexp = regexp.MustCompile(`^([0-9]{1,3})(?:-([0-9a-fA-F]{6}))?$`)
+)
+
+// parsePlmnID parses a PLMN ID given as MCC followed by the 2 or 3 digits MNC, e.g. 20790
+func parsePlmnID(plmn string) (models.PlmnId, error) {
+	if !plmnIDRegexp.MatchString(plmn) {
+		return models.PlmnId{}, fmt.Errorf("invalid PLMN ID %s, expecting MCC and MNC digits", plmn)
+	}
+	return models.PlmnId{Mcc: plmn[:3], Mnc: plmn[3:]}, nil
+}
+
+// parseSnssai parses an S-NSSAI given as SST optionally followed by a dash and the 6 hex digits SD, e.g. 1-112233
+func parseSnssai(s string) (models.Snssai, error) {
+	match := snssaiRegexp.FindStringSubmatch(s)
+	if match == nil {
+		return models.Snssai{}, fmt.Errorf("invalid S-NSSAI %s, expecting <SST>[-<SD>]", s)
+	}
+	sst, err := strconv.Atoi(match[1])
+	if err != nil || sst > 255 {
+		return models.Snssai{}, fmt.Errorf("invalid S-NSSAI %s, SST out of range", s)
+	}
+	return models.Snssai{Sst: int32(sst), Sd: strings.ToLower(match[2])}, nil
+}
+
+// parseSubscribedNssai parses a subscribed NSSAI given as S-NSSAIs, the default ones followed by a star, e.g.
+// 1-112233*,2
+func parseSubscribedNssai(s []string) ([]models.SubscribedSnssai, error) {
+	var nssai []models.SubscribedSnssai
+	for _, item := range s {
+		item = strings.TrimSpace(item)
+		defaultIndication := strings.HasSuffix(item, "*")
+		snssai, err := parseSnssai(strings.TrimSuffix(item, "*"))
+		if err != nil {
+			return nil, err
+		}
+		nssai = append(nssai, models.SubscribedSnssai{
+			SubscribedSnssai:  &snssai,
+			DefaultIndication: defaultIndication,
+		})
+	}
+	return nssai, nil
+}
+
+// parseSubscriber parses the subscription data of a UE given as its identity, an equal sign and its subscribed NSSAI,
+// e.g. imsi-208930000000001=1-112233*,2
+func parseSubscriber(s string) (*context.Subscriber, error) {
+	i := strings.LastIndex(s, "=")
+	if i <= 0 {
+		return nil, fmt.Errorf("invalid subscriber %s, expecting <identity>=<subscribed NSSAI>", s)
+	}
+	nssai, err := parseSubscribedNssai(strings.Split(s[i+1:], ","))
+	if err != nil {
+		return nil, err
+	}
+	return &context.Subscriber{ID: s[:i], SubscribedNssai: nssai}, nil
+}
+
+// amfInstance is an AMF of the AMF set besides AMFSelf, given as comma separated options, e.g.
+// name=TestAMF2,addr=127.0.0.1:38413,amf-id=454512,capacity=100,slices=1-010203,1-112233,reroute=true. The options
+// without an equal sign continue the list of the previous one. The capacity and slices default to the ones of AMFSelf.
+type amfInstance struct {
+	name     string
+	addr     string
+	amfID    string
+	capacity int64
+	slices   []string
+	reroute  bool
+}
+
+// parseAMFInstance parses the options of an AMF of the AMF set
+func parseAMFInstance(s string) (amfInstance, error) {
+	instance := amfInstance{capacity: amfRelativeCapacity, slices: supportedNssai}
+	var key string
+	var slices []string
+	for _, option := range strings.Split(s, ",") {
+		value := option
+		if i := strings.Index(option, "="); i >= 0 {
+			key, value = option[:i], option[i+1:]
+		} else if key != "slices" {
+			return instance, fmt.Errorf("invalid AMF instance option %s, expecting <key>=<value>", option)
+		}
+		var err error
+		switch key {
+		case "name":
+			instance.name = value
+		case "addr":
+			instance.addr = value
+		case "amf-id":
+			instance.amfID = value
+		case "capacity":
+			instance.capacity, err = strconv.ParseInt(value, 10, 64)
+		case "slices":
+			slices = append(slices, value)
+		case "reroute":
+			instance.reroute, err = strconv.ParseBool(value)
+		default:
+			return instance, fmt.Errorf("unknown AMF instance option %s", key)
+		}
+		if err != nil {
+			return instance, fmt.Errorf("invalid AMF instance option %s: %v", option, err)
+		}
+	}
+	if slices != nil {
+		instance.slices = slices
+	}
+	if instance.name == "" || instance.addr == "" || instance.amfID == "" {
+		return instance, fmt.Errorf("invalid AMF instance %s, expecting at least name, addr and amf-id", s)
+	}
+	if instance.capacity < 0 || instance.capacity > 255 {
+		return instance, fmt.Errorf("invalid AMF instance %s, capacity out of range", s)
+	}
+	return instance, nil
+}
+
+// configureAMF sets the identity of AMFSelf and of the other AMFs of the AMF set, advertised in the NG Setup Response,
+// the home network keys the SUCIs of the 5G-RGs are deconcealed with and the subscribers
+func configureAMF() error {
+	plmn, err := parsePlmnID(plmnID)
+	if err != nil {
+		return err
+	}
+	var equivalentPlmns []models.PlmnId
+	for _, equivalentPlmnID := range equivalentPlmnIDs {
+		equivalentPlmn, err := parsePlmnID(equivalentPlmnID)
+		if err != nil {
+			return err
+		}
+		equivalentPlmns = append(equivalentPlmns, equivalentPlmn)
+	}
+
+	self := amfInstance{
+		name:     amfName,
+		addr:     ngapAddr,
+		amfID:    amfID,
+		capacity: amfRelativeCapacity,
+		slices:   supportedNssai,
+	}
+	if err := configureAMFContext(context.AMFSelf, self, plmn, equivalentPlmns); err != nil {
+		return err
+	}
+	for _, s := range amfInstances {
+		instance, err := parseAMFInstance(s)
+		if err != nil {
+			return err
+		}
+		if _, ok := context.LoadAMFContextName(instance.name); ok {
+			return fmt.Errorf("duplicate AMF name %s", instance.name)
+		}
+		if err := configureAMFContext(context.NewAMFSetMember(), instance, plmn, equivalentPlmns); err != nil {
+			return err
+		}
+	}
+
+	for _, s := range amfTNLEndpoints {
+		if err := configureTNLEndpoint(s); err != nil {
+			return err
+		}
+	}
+
+	amf := context.AMFSelf
+	amf.HomeNetworkKeys = make(map[uint8]suci.HomeNetworkKey)
+	for _, item := range homeNetworkKeys {
+		key, err := suci.ParseHomeNetworkKey(item)
+		if err != nil {
+			return err
+		}
+		amf.HomeNetworkKeys[key.ID] = key
+	}
+
+	if err := configureDNNs(amf); err != nil {
+		return err
+	}
+
+	_, err = loadSubscribers()
+	return err
+}
+
+// configureAMFContext sets the identity of an AMF of the AMF set: its name, the served GUAMI of which the 5G-GUTIs are
+// allocated, and the supported PLMN and slices
+func configureAMFContext(amf *context.AMFContext, instance amfInstance, plmn models.PlmnId,
+	equivalentPlmns []models.PlmnId) error {
+	if !amfIDRegexp.MatchString(instance.amfID) {
+		return fmt.Errorf("invalid AMF ID %s, expecting 6 hex digits <AMF Region ID><AMF Set ID><AMF Pointer>",
+			instance.amfID)
+	}
+	amf.SCTPAddr = instance.addr
+	amf.AMFName = &ngapType.AMFName{Value: instance.name}
+	amf.RelativeAMFCapacity = &ngapType.RelativeAMFCapacity{Value: instance.capacity}
+	amf.Reroute = instance.reroute
+
+	servedGUAMIItem := ngapType.ServedGUAMIItem{}
+	servedGUAMIItem.GUAMI.PLMNIdentity = util.PlmnIdToNgap(plmn.Mcc, plmn.Mnc)
+	servedGUAMIItem.GUAMI.AMFRegionID.Value, servedGUAMIItem.GUAMI.AMFSetID.Value,
+		servedGUAMIItem.GUAMI.AMFPointer.Value = ngapConvert.AmfIdToNgap(instance.amfID)
+	amf.ServedGuamiList = &ngapType.ServedGUAMIList{List: []ngapType.ServedGUAMIItem{servedGUAMIItem}}
+
+	sliceSupportList := ngapType.SliceSupportList{}
+	for _, item := range instance.slices {
+		snssai, err := parseSnssai(item)
+		if err != nil {
+			return err
+		}
+		sliceSupportList.List = append(sliceSupportList.List, ngapType.SliceSupportItem{
+			SNSSAI: ngapConvert.SNssaiToNgap(snssai),
+		})
+	}
+	amf.PlmnSupportList = &ngapType.PLMNSupportList{
+		List: []ngapType.PLMNSupportItem{
+			{
+				PLMNIdentity:     util.PlmnIdToNgap(plmn.Mcc, plmn.Mnc),
+				SliceSupportList: sliceSupportList,
+			},
+		},
+	}
+	amf.EquivalentPlmns = equivalentPlmns
+	return nil
+}
+
+var pduSessionTypes = map[string]uint8{
+	"ipv4":         nasMessage.PDUSessionTypeIPv4,
+	"ipv6":         nasMessage.PDUSessionTypeIPv6,
+	"ipv4v6":       nasMessage.PDUSessionTypeIPv4IPv6,
+	"unstructured": nasMessage.PDUSessionTypeUnstructured,
+	"ethernet":     nasMessage.PDUSessionTypeEthernet,
+}
+
+// parseDNN parses the session policy of a DNN given as comma separated options, e.g.
+// name=internet,types=ipv4,ipv6,ssc-modes=1,slices=1-112233,ambr-ul=100000000,ambr-dl=200000000,pools=10.60.0.0/16,
+// dns=8.8.8.8,mtu=1400,users=user1@dn.example,default=true,backoff=60. The options without an equal sign continue the
+// list of the previous one. The back-off timer in seconds defaults to the one of --pdu-session-backoff.
+func parseDNN(s string) (dnn *context.DNN, isDefault bool, err error) {
+	dnn = &context.DNN{Backoff: time.Duration(pduSessionBackoff) * time.Second}
+	var key string
+	lists := map[string]bool{"types": true, "ssc-modes": true, "slices": true, "pools": true, "dns": true, "users": true}
+	for _, option := range strings.Split(s, ",") {
+		value := option
+		if i := strings.Index(option, "="); i >= 0 {
+			key, value = option[:i], option[i+1:]
+		} else if !lists[key] {
+			return nil, false, fmt.Errorf("invalid DNN option %s, expecting <key>=<value>", option)
+		}
+		switch key {
+		case "name":
+			dnn.Name = value
+		case "types":
+			pduSessionType, ok := pduSessionTypes[value]
+			if !ok {
+				return nil, false, fmt.Errorf("invalid DNN %s, expecting types ipv4, ipv6, ipv4v6, unstructured or "+
+					"ethernet", s)
+			}
+			dnn.PDUSessionTypes = append(dnn.PDUSessionTypes, pduSessionType)
+		case "ssc-modes":
+			var sscMode uint64
+			if sscMode, err = strconv.ParseUint(value, 10, 8); err == nil && (sscMode < 1 || sscMode > 3) {
+				err = fmt.Errorf("expecting SSC mode 1, 2 or 3")
+			}
+			dnn.SSCModes = append(dnn.SSCModes, uint8(sscMode))
+		case "slices":
+			var snssai models.Snssai
+			snssai, err = parseSnssai(value)
+			dnn.Snssais = append(dnn.Snssais, snssai)
+		case "ambr-ul":
+			dnn.SessionAmbrUL, err = strconv.ParseInt(value, 10, 64)
+		case "ambr-dl":
+			dnn.SessionAmbrDL, err = strconv.ParseInt(value, 10, 64)
+		case "pools":
+			var pool *context.AddressPool
+			if pool, err = context.NewAddressPool(value); err != nil {
+				break
+			}
+			if pool.IPv4() {
+				dnn.IPv4Pool = pool
+			} else {
+				dnn.IPv6Pool = pool
+			}
+		case "dns":
+			ip := net.ParseIP(value)
+			if ip == nil {
+				err = fmt.Errorf("expecting an IP address")
+			}
+			dnn.DNS = append(dnn.DNS, ip)
+		case "mtu":
+			var mtu uint64
+			mtu, err = strconv.ParseUint(value, 10, 16)
+			dnn.MTU = uint16(mtu)
+		case "users":
+			dnn.Users = append(dnn.Users, value)
+		case "default":
+			isDefault, err = strconv.ParseBool(value)
+		case "backoff":
+			var seconds uint64
+			seconds, err = strconv.ParseUint(value, 10, 32)
+			dnn.Backoff = time.Duration(seconds) * time.Second
+		default:
+			return nil, false, fmt.Errorf("unknown DNN option %s", key)
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid DNN option %s: %v", option, err)
+		}
+	}
+	if dnn.Name == "" {
+		return nil, false, fmt.Errorf("invalid DNN %s, expecting at least name", s)
+	}
+	if (dnn.SessionAmbrUL > 0) != (dnn.SessionAmbrDL > 0) || dnn.SessionAmbrUL < 0 || dnn.SessionAmbrDL < 0 {
+		return nil, false, fmt.Errorf("invalid DNN %s, expecting both ambr-ul and ambr-dl", s)
+	}
+	return dnn, isDefault, nil
+}
+
+// configureDNNs sets the session policy of the DNNs of the AMF set, the PDU Session Establishment Requests to other
+// DNNs being rejected. Without DNN, any PDU session is accepted.
+func configureDNNs(amf *context.AMFContext) error {
+	amf.DNNs = make(map[string]*context.DNN)
+	for _, s := range dnnPolicies {
+		dnn, isDefault, err := parseDNN(s)
+		if err != nil {
+			return err
+		}
+		name := strings.ToLower(dnn.Name)
+		if _, ok := amf.DNNs[name]; ok {
+			return fmt.Errorf("duplicate DNN %s", dnn.Name)
+		}
+		amf.DNNs[name] = dnn
+		if isDefault {
+			if amf.DefaultDNN != nil {
+				return fmt.Errorf("duplicate default DNN %s, %s being the default", dnn.Name, amf.DefaultDNN.Name)
+			}
+			amf.DefaultDNN = dnn
+		}
+	}
+	return nil
+}
+
+var tnlAssociationUsages = map[string]aper.Enumerated{
+	"ue":     ngapType.TNLAssociationUsagePresentUe,
+	"non-ue": ngapType.TNLAssociationUsagePresentNonUe,
+	"both":   ngapType.TNLAssociationUsagePresentBoth,
+}
+
+// parseTNLEndpoint parses an endpoint of an AMF given as comma separated options, e.g.
+// amf=TestAMF1,addr=127.0.0.2:38412,usage=ue,weight=10. The AMF defaults to AMFSelf, the usage to both and the weight
+// factor to 1.
+func parseTNLEndpoint(s string) (amf *context.AMFContext, item *context.AMFTNLAssociationItem, err error) {
+	amf = context.AMFSelf
+	usage := ngapType.TNLAssociationUsagePresentBoth
+	var weight int64 = 1
+	item = &context.AMFTNLAssociationItem{}
+	for _, option := range strings.Split(s, ",") {
+		i := strings.Index(option, "=")
+		if i < 0 {
+			return nil, nil, fmt.Errorf("invalid TNL endpoint option %s, expecting <key>=<value>", option)
+		}
+		key, value := option[:i], option[i+1:]
+		var ok bool
+		switch key {
+		case "amf":
+			if amf, ok = context.LoadAMFContextName(value); !ok {
+				return nil, nil, fmt.Errorf("invalid TNL endpoint %s, unknown AMF %s", s, value)
+			}
+		case "addr":
+			item.SCTPAddr = value
+		case "usage":
+			if usage, ok = tnlAssociationUsages[value]; !ok {
+				return nil, nil, fmt.Errorf("invalid TNL endpoint %s, expecting usage ue, non-ue or both", s)
+			}
+		case "weight":
+			if weight, err = strconv.ParseInt(value, 10, 64); err != nil || weight < 0 || weight > 255 {
+				return nil, nil, fmt.Errorf("invalid TNL endpoint %s, weight factor out of range", s)
+			}
+		default:
+			return nil, nil, fmt.Errorf("unknown TNL endpoint option %s", key)
+		}
+	}
+
+	host, _, err := net.SplitHostPort(item.SCTPAddr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid TNL endpoint %s: %v", s, err)
+	}
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		return nil, nil, fmt.Errorf("invalid TNL endpoint %s, expecting an IP address", s)
+	case ip.To4() != nil:
+		item.Ipv4 = ip.String()
+	default:
+		item.Ipv6 = ip.String()
+	}
+	item.TNLAssociationUsage = &ngapType.TNLAssociationUsage{Value: usage}
+	item.TNLAddressWeightFactor = &weight
+	return amf, item, nil
+}
+
+// configureTNLEndpoint adds an endpoint to an AMF, on which the AGFs set up additional TNL associations once it is
+// advertised in an AMF Configuration Update
+//
+// TS 38.412 7 Transport layer
+func configureTNLEndpoint(s string) error {
+	amf, item, err := parseTNLEndpoint(s)
+	if err != nil {
+		return err
+	}
+	for _, a := range context.AMFSet {
+		if _, ok := a.FindTNLEndpoint(item.SCTPAddr); ok || a.SCTPAddr == item.SCTPAddr {
+			return fmt.Errorf("duplicate TNL endpoint %s", item.SCTPAddr)
+		}
+	}
+	if amf.FindAMFTNLAssociationItem(item.CPTransportLayerInformation()) != nil {
+		return fmt.Errorf("duplicate TNL endpoint IP address %s%s of AMF %s", item.Ipv4, item.Ipv6, amf.AMFName.Value)
+	}
+	amf.TNLEndpoints = append(amf.TNLEndpoints, item)
+	amf.StoreAMFTNLAssociationItem(item)
+	return nil
+}
+
+// supportedSnssais returns the S-NSSAIs supported by the AMF in all its PLMNs
+func supportedSnssais(amf *context.AMFContext) (snssais []models.Snssai) {
+	if amf.PlmnSupportList == nil {
+		return nil
+	}
+	for _, plmnSupportItem := range amf.PlmnSupportList.List {
+		for _, sliceSupportItem := range plmnSupportItem.SliceSupportList.List {
+			snssai := ngapConvert.SNssaiToModels(sliceSupportItem.SNSSAI)
+			if !containsSnssai(snssais, snssai) {
+				snssais = append(snssais, snssai)
+			}
+		}
+	}
+	return snssais
+}
+
+func containsSnssai(snssais []models.Snssai, snssai models.Snssai) bool {
+	for _, s := range snssais {
+		if s.Sst == snssai.Sst && s.Sd == snssai.Sd {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package simamf
+
+import (
+	"free5gc/lib/ngap/ngapType"
+	"sim-amf/pkg/conformance"
+	"sim-amf/pkg/logger"
+)
+
+var (
+	conformanceChecks bool
+	conformanceReport string
+)
+
+// openConformance enables the conformance checks of the messages received from the AGFs
+func openConformance() error {
+	if !conformanceChecks && conformanceReport == "" {
+		return nil
+	}
+	reporter, err := conformance.Create(conformanceReport)
+	if err != nil {
+		return err
+	}
+	conformance.Global = reporter
+	if conformanceReport != "" {
+		logger.MainLog.Info("Reporting the conformance violations to %s", conformanceReport)
+	}
+	return nil
+}
+
+// checkConformance checks an NGAP message received from the AGF before it is handled, the NAS PDUs it carries being
+// deciphered in place by the handlers
+func checkConformance(agf string, pdu *ngapType.NGAPPDU, err error) {
+	if conformance.Global == nil {
+		return
+	}
+	if err != nil {
+		pdu = nil
+	}
+	conformance.Global.Report(conformance.CheckNGAP(agf, pdu, err))
+}
@@ -0,0 +1,171 @@
+package simamf
+
+import (
+	"fmt"
+	"strings"
+
+	"free5gc/lib/aper"
+	"free5gc/lib/ngap/ngapType"
+	"sim-amf/pkg/api"
+	"sim-amf/pkg/context"
+	"sim-amf/pkg/event"
+	"sim-amf/pkg/logger"
+	"sim-amf/pkg/util"
+)
+
+// securityAlgorithms are the bits of the UE Security Capabilities by algorithm, the first bit of each bitmap being the
+// one of 128-NEA1, 128-NIA1, 128-EEA1 or 128-EIA1
+//
+// TS 38.413 9.3.1.86 UE Security Capabilities
+var securityAlgorithms = map[string]struct {
+	bitmap int // 0 NR encryption, 1 NR integrity, 2 E-UTRA encryption, 3 E-UTRA integrity
+	bit    uint
+}{
+	"nea1": {0, 0}, "nea2": {0, 1}, "nea3": {0, 2},
+	"nia1": {1, 0}, "nia2": {1, 1}, "nia3": {1, 2},
+	"eea1": {2, 0}, "eea2": {2, 1}, "eea3": {2, 2},
+	"eia1": {3, 0}, "eia2": {3, 1}, "eia3": {3, 2},
+}
+
+// parseUESecurityCapabilities parses the UE security capabilities given as the names of the supported algorithms among
+// nea1, nea2, nea3, nia1, nia2, nia3, eea1, eea2, eea3, eia1, eia2 and eia3
+func parseUESecurityCapabilities(names []string) (*ngapType.UESecurityCapabilities, error) {
+	var bitmaps [4][2]byte
+	for _, name := range names {
+		algorithm, ok := securityAlgorithms[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("invalid security algorithm %s", name)
+		}
+		bitmaps[algorithm.bitmap][0] |= 0x80 >> algorithm.bit
+	}
+	bitString := func(i int) aper.BitString {
+		return aper.BitString{Bytes: []byte{bitmaps[i][0], bitmaps[i][1]}, BitLength: 16}
+	}
+	return &ngapType.UESecurityCapabilities{
+		NRencryptionAlgorithms:             ngapType.NRencryptionAlgorithms{Value: bitString(0)},
+		NRintegrityProtectionAlgorithms:    ngapType.NRintegrityProtectionAlgorithms{Value: bitString(1)},
+		EUTRAencryptionAlgorithms:          ngapType.EUTRAencryptionAlgorithms{Value: bitString(2)},
+		EUTRAintegrityProtectionAlgorithms: ngapType.EUTRAintegrityProtectionAlgorithms{Value: bitString(3)},
+	}, nil
+}
+
+// newUEContextModification returns the UE context modification of the request, a new Security Key being derived from
+// the KAMF of the UE
+func newUEContextModification(ue *context.UEContext, req *api.ModifyUEContextRequest) (*context.UEContextModification,
+	error) {
+	modification := new(context.UEContextModification)
+	if req.NewSecurityKey {
+		if len(ue.Kamf) == 0 {
+			return nil, fmt.Errorf("no KAMF of UE %d to derive a Security Key from", ue.AmfUeNgapId)
+		}
+		modification.Kwagf = ue.AnKey()
+	}
+	if req.UeAmbrUL != 0 || req.UeAmbrDL != 0 {
+		if req.UeAmbrUL <= 0 || req.UeAmbrDL <= 0 {
+			return nil, fmt.Errorf("UE-AMBR must be positive")
+		}
+		modification.Ambr = new(ngapType.UEAggregateMaximumBitRate)
+		modification.Ambr.UEAggregateMaximumBitRateUL.Value = req.UeAmbrUL
+		modification.Ambr.UEAggregateMaximumBitRateDL.Value = req.UeAmbrDL
+	}
+	if len(req.SecurityAlgorithms) > 0 {
+		var err error
+		if modification.SecurityCapabilities, err = parseUESecurityCapabilities(req.SecurityAlgorithms); err != nil {
+			return nil, err
+		}
+	}
+	if req.IndexToRfsp != 0 {
+		if req.IndexToRfsp < 1 || req.IndexToRfsp > 256 {
+			return nil, fmt.Errorf("invalid index to RFSP %d, expecting 1 to 256", req.IndexToRfsp)
+		}
+		modification.IndexToRfsp = req.IndexToRfsp
+	}
+	if req.CoreNetworkAssistanceInformation {
+		if len(ue.TAIList) == 0 {
+			return nil, fmt.Errorf("no registration area of UE %d", ue.AmfUeNgapId)
+		}
+		modification.CoreNetworkAssistanceInformation = buildCoreNetworkAssistanceInformation(ue)
+	}
+	if modification.Kwagf == nil && modification.Ambr == nil && modification.SecurityCapabilities == nil &&
+		modification.IndexToRfsp == 0 && modification.CoreNetworkAssistanceInformation == nil {
+		return nil, fmt.Errorf("no UE context parameter to modify")
+	}
+	return modification, nil
+}
+
+// handleUEContextModificationResponse applies the UE context modification acknowledged by the AGF
+//
+// TS 38.413 8.3.4.2 Successful Operation
+func handleUEContextModificationResponse(agf *context.AGFContext, pdu *ngapType.NGAPPDU) {
+	var aMFUENGAPID *ngapType.AMFUENGAPID
+	var rANUENGAPID *ngapType.RANUENGAPID
+	var userLocationInformation *ngapType.UserLocationInformation
+
+	uEContextModificationResponse := pdu.SuccessfulOutcome.Value.UEContextModificationResponse
+	if uEContextModificationResponse == nil {
+		logger.MainLog.Error("UEContextModificationResponse is nil")
+		return
+	}
+	for _, ie := range uEContextModificationResponse.ProtocolIEs.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDAMFUENGAPID:
+			aMFUENGAPID = ie.Value.AMFUENGAPID
+		case ngapType.ProtocolIEIDRANUENGAPID:
+			rANUENGAPID = ie.Value.RANUENGAPID
+		case ngapType.ProtocolIEIDUserLocationInformation:
+			userLocationInformation = ie.Value.UserLocationInformation
+		}
+	}
+
+	ue := findUEContext(agf, aMFUENGAPID, rANUENGAPID)
+	if ue == nil {
+		return
+	}
+	recordUserLocation(ue, util.NgapProcedureName(ngapType.ProcedureCodeUEContextModification),
+		userLocationInformation, nil, false)
+	if ue.ContextModification == nil {
+		logger.MainLog.Warn("[%s] UE Context Modification Response without request", ue.LogTag("NGAP"))
+		return
+	}
+	ue.ApplyContextModification(ue.ContextModification)
+	ue.ContextModification = nil
+	logger.MainLog.Info("[%s] UE context modified", ue.LogTag("NGAP"))
+	event.Publish(ue, event.Event{Type: event.UEContextModified})
+}
+
+// handleUEContextModificationFailure discards the UE context modification the AGF failed to apply
+//
+// TS 38.413 8.3.4.3 Unsuccessful Operation
+func handleUEContextModificationFailure(agf *context.AGFContext, pdu *ngapType.NGAPPDU) {
+	var aMFUENGAPID *ngapType.AMFUENGAPID
+	var rANUENGAPID *ngapType.RANUENGAPID
+	var cause *ngapType.Cause
+
+	uEContextModificationFailure := pdu.UnsuccessfulOutcome.Value.UEContextModificationFailure
+	if uEContextModificationFailure == nil {
+		logger.MainLog.Error("UEContextModificationFailure is nil")
+		return
+	}
+	for _, ie := range uEContextModificationFailure.ProtocolIEs.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDAMFUENGAPID:
+			aMFUENGAPID = ie.Value.AMFUENGAPID
+		case ngapType.ProtocolIEIDRANUENGAPID:
+			rANUENGAPID = ie.Value.RANUENGAPID
+		case ngapType.ProtocolIEIDCause:
+			cause = ie.Value.Cause
+		}
+	}
+
+	ue := findUEContext(agf, aMFUENGAPID, rANUENGAPID)
+	if ue == nil {
+		return
+	}
+	ue.ContextModification = nil
+	detail := "no cause"
+	if cause != nil {
+		detail = "cause " + util.NgapCauseString(cause)
+	}
+	logger.MainLog.Warn("[%s] UE Context Modification Failure, %s", ue.LogTag("NGAP"), detail)
+	event.Publish(ue, event.Event{Type: event.UEContextModificationFailed, Detail: detail})
+}
@@ -0,0 +1,183 @@
+package simamf
+
+import (
+	"errors"
+	"hash/fnv"
+	"strconv"
+	"sync"
+
+	"free5gc/lib/ngap/ngapType"
+	"sim-amf/pkg/context"
+	"sim-amf/pkg/logger"
+	"sim-amf/pkg/metrics"
+	"sim-amf/pkg/recording"
+
+	"gitlab.casa-systems.com/opensource/sctp"
+)
+
+var (
+	dispatchShards    int
+	dispatchQueueSize int
+)
+
+// ueDispatcher runs the NGAP handlers and the control API operations of sim-amf
+var ueDispatcher *dispatcher
+
+// dispatcher runs jobs on a fixed set of shards, each one a goroutine processing its queue in order. All the jobs of a
+// UE run on the same shard, so the messages of a UE are handled in the order they are received and never concurrently,
+// while the UEs on different shards run in parallel.
+type dispatcher struct {
+	shards   []chan func()
+	stopping chan struct{}
+	running  sync.WaitGroup
+	stopOnce sync.Once
+}
+
+// errDispatcherStopped is returned by runOnUE once sim-amf is stopped
+var errDispatcherStopped = errors.New("sim-amf stopped")
+
+func newDispatcher(shards int, queueSize int) *dispatcher {
+	if shards < 1 {
+		shards = 1
+	}
+	d := &dispatcher{shards: make([]chan func(), shards), stopping: make(chan struct{})}
+	for i := range d.shards {
+		d.shards[i] = make(chan func(), queueSize)
+		d.running.Add(1)
+		go d.run(d.shards[i])
+	}
+	return d
+}
+
+func (d *dispatcher) run(shard chan func()) {
+	defer d.running.Done()
+	for {
+		select {
+		case job := <-shard:
+			job()
+		case <-d.stopping:
+			return
+		}
+	}
+}
+
+// stop ends the shards once the jobs already queued have run, the jobs dispatched from then on being dropped
+func (d *dispatcher) stop() {
+	d.stopOnce.Do(func() {
+		var queued sync.WaitGroup
+		for i := range d.shards {
+			queued.Add(1)
+			d.shards[i] <- queued.Done
+		}
+		queued.Wait()
+		close(d.stopping)
+	})
+	d.running.Wait()
+}
+
+// shardKey returns the key of the shard of the Initial UE Message of a UE of the AGF, the UE created keeping it for
+// its whole life, or of the AGF itself for RanUeNgapIdUnspecified
+func shardKey(agf *context.AGFContext, ranUeNgapId int64) uint32 {
+	h := fnv.New32a()
+	if agf != nil {
+		h.Write([]byte(agf.SCTPAddr))
+	}
+	h.Write([]byte(strconv.FormatInt(ranUeNgapId, 10)))
+	return h.Sum32()
+}
+
+// dispatch queues the job on the shard of the key, blocking while the shard queue is full which slows down the
+// reception of the AGF messages. The job is dropped once the dispatcher is stopped.
+func (d *dispatcher) dispatch(key uint32, job func()) bool {
+	select {
+	case <-d.stopping:
+		return false
+	default:
+	}
+	select {
+	case <-d.stopping:
+		return false
+	case d.shards[key%uint32(len(d.shards))] <- job:
+		return true
+	}
+}
+
+// dispatchUE queues the job on the shard of the UE
+func dispatchUE(ue *context.UEContext, job func()) bool {
+	return ueDispatcher.dispatch(ue.Shard, job)
+}
+
+// runOnUE runs the job on the shard of the UE and waits for its result, it must not be called from a dispatched job
+func runOnUE(ue *context.UEContext, job func() error) error {
+	d := ueDispatcher
+	done := make(chan error, 1)
+	dispatchUE(ue, func() {
+		done <- job()
+	})
+	select {
+	case err := <-done:
+		return err
+	case <-d.stopping:
+		return errDispatcherStopped
+	}
+}
+
+// dispatchPDU queues an NGAP message received on a TNL association of the AGF on the shard of the UE it is associated
+// with, or of the AGF. The message pkt is recorded once handled if not nil.
+func dispatchPDU(agf *context.AGFContext, conn *sctp.SCTPConn, pdu *ngapType.NGAPPDU, pkt []byte) {
+	ueDispatcher.dispatch(pduShardKey(agf, pdu), func() {
+		handlePDU(agf, conn, pdu, pkt)
+	})
+}
+
+// pduShardKey returns the key of the shard of the UE an NGAP message received from the AGF is associated with, or of
+// the AGF. The UE is looked up by its AMF UE NGAP ID, which never changes unlike the RAN UE NGAP ID, an Initial UE
+// Message running on the shard its UE is then created with.
+func pduShardKey(agf *context.AGFContext, pdu *ngapType.NGAPPDU) uint32 {
+	amfUeNgapId, ranUeNgapId := ueNGAPIDs(pdu)
+	if amfUeNgapId != context.AmfUeNgapIdUnspecified {
+		if ue, ok := agf.AMF.LoadUEContextAMFUENGAPID(amfUeNgapId); ok {
+			return ue.Shard
+		}
+	} else if ranUeNgapId != context.RanUeNgapIdUnspecified && !initialUEMessage(pdu) {
+		if ue, ok := agf.LoadUEContextRANUENGAPID(ranUeNgapId); ok {
+			return ue.Shard
+		}
+	}
+	return shardKey(agf, ranUeNgapId)
+}
+
+// initialUEMessage tells whether the NGAP message is an Initial UE Message, creating its UE
+func initialUEMessage(pdu *ngapType.NGAPPDU) bool {
+	return pdu.Present == ngapType.NGAPPDUPresentInitiatingMessage && pdu.InitiatingMessage != nil &&
+		pdu.InitiatingMessage.ProcedureCode.Value == ngapType.ProcedureCodeInitialUEMessage
+}
+
+// handlePDU handles an NGAP message received on a TNL association of the AGF, on the shard of the UE it is associated
+// with. The message pkt is recorded once handled if not nil.
+func handlePDU(agf *context.AGFContext, conn *sctp.SCTPConn, pdu *ngapType.NGAPPDU, pkt []byte) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.MainLog.Error("NGAP handler panic: %v", r)
+		}
+	}()
+	// the UE released by the message is recorded too
+	var ue *context.UEContext
+	if pkt != nil {
+		ue = lookupUEContext(conn, pdu)
+	}
+	bindUETNLA(agf, conn, pdu)
+	if replayer != nil {
+		replayer.handle(agf, conn, pdu)
+	} else {
+		end2end_serverHandler(agf, pdu)
+	}
+	// the UE created by an Initial UE Message
+	bindUETNLA(agf, conn, pdu)
+	if pkt != nil {
+		if ue == nil {
+			ue = lookupUEContext(conn, pdu)
+		}
+		recording.Global.NGAP(agf.SCTPAddr, ue, metrics.DirectionReceived, pkt)
+	}
+}
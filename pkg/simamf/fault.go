@@ -0,0 +1,327 @@
+package simamf
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	lib_ngap "free5gc/lib/ngap"
+	"free5gc/lib/ngap/ngapType"
+	"sim-amf/pkg/context"
+	"sim-amf/pkg/event"
+	"sim-amf/pkg/fault"
+	"sim-amf/pkg/logger"
+	"sim-amf/pkg/metrics"
+	amf_nas "sim-amf/pkg/nas"
+	"sim-amf/pkg/recording"
+	"sim-amf/pkg/util"
+
+	"gitlab.casa-systems.com/opensource/sctp"
+)
+
+var faultRules []string
+
+// openFaults starts the fault injection with the configured rules, more being added by the control API
+func openFaults() error {
+	injector := fault.NewInjector()
+	for _, s := range faultRules {
+		rule, err := fault.ParseRule(s)
+		if err == nil {
+			_, err = injector.Add(rule)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	fault.Global = injector
+	return nil
+}
+
+// heldKey identifies the messages of a direction held by a reorder fault, by UE or by TNL association for the non UE
+// associated ones
+type heldKey struct {
+	direction string
+	owner     interface{}
+}
+
+// heldMessage is a message held by a reorder fault, released once by the next message of the same key or its timer
+type heldMessage struct {
+	once    sync.Once
+	release func()
+}
+
+var held = struct {
+	sync.Mutex
+	messages map[heldKey]*heldMessage
+}{messages: make(map[heldKey]*heldMessage)}
+
+// holdMessage holds a message until the next message of the key is sent or handled, at most for d, a message already
+// held for the key being released first
+func holdMessage(key heldKey, d time.Duration, release func()) {
+	message := &heldMessage{release: release}
+	held.Lock()
+	previous := held.messages[key]
+	held.messages[key] = message
+	held.Unlock()
+	if previous != nil {
+		previous.once.Do(previous.release)
+	}
+	time.AfterFunc(d, func() {
+		held.Lock()
+		if held.messages[key] == message {
+			delete(held.messages, key)
+		}
+		held.Unlock()
+		message.once.Do(message.release)
+	})
+}
+
+// releaseHeldMessage releases the message held for the key, if any
+func releaseHeldMessage(key heldKey) {
+	held.Lock()
+	message := held.messages[key]
+	delete(held.messages, key)
+	held.Unlock()
+	if message != nil {
+		message.once.Do(message.release)
+	}
+}
+
+// dropHeldMessages drops the messages held when the Server stops, none of them being released afterwards
+func dropHeldMessages() {
+	held.Lock()
+	messages := held.messages
+	held.messages = make(map[heldKey]*heldMessage)
+	held.Unlock()
+	for _, message := range messages {
+		message.once.Do(func() {})
+	}
+}
+
+// faultOwner returns the owner of the held messages of the UE, or of the TNL association for ue nil
+func faultOwner(conn *sctp.SCTPConn, ue *context.UEContext) interface{} {
+	if ue != nil {
+		return ue
+	}
+	return conn
+}
+
+// ngapMessageNames returns the names of the procedure of an NGAP message exchanged with the UE and of the NAS
+// messages its NAS-PDU IEs carry, the ones of the PDU session resource lists excluded
+func ngapMessageNames(ue *context.UEContext, direction string, pdu *ngapType.NGAPPDU) []string {
+	var procedureCode int64
+	var value reflect.Value
+	switch {
+	case pdu.InitiatingMessage != nil:
+		procedureCode, value = pdu.InitiatingMessage.ProcedureCode.Value, reflect.ValueOf(pdu.InitiatingMessage.Value)
+	case pdu.SuccessfulOutcome != nil:
+		procedureCode, value = pdu.SuccessfulOutcome.ProcedureCode.Value, reflect.ValueOf(pdu.SuccessfulOutcome.Value)
+	case pdu.UnsuccessfulOutcome != nil:
+		procedureCode, value = pdu.UnsuccessfulOutcome.ProcedureCode.Value,
+			reflect.ValueOf(pdu.UnsuccessfulOutcome.Value)
+	default:
+		return nil
+	}
+	names := []string{util.NgapProcedureName(procedureCode)}
+	if ue == nil {
+		return names
+	}
+
+	// the message is the field selected by Present, as for the aper encoding
+	present := int(value.FieldByName("Present").Int())
+	if present <= 0 || present >= value.NumField() || value.Field(present).IsNil() {
+		return names
+	}
+	protocolIEs := value.Field(present).Elem().FieldByName("ProtocolIEs")
+	if !protocolIEs.IsValid() {
+		return names
+	}
+	ies := protocolIEs.FieldByName("List")
+	for i := 0; i < ies.Len(); i++ {
+		field := ies.Index(i).FieldByName("Value").FieldByName("NASPDU")
+		if !field.IsValid() || field.IsNil() {
+			continue
+		}
+		if msg, err := amf_nas.Peek(ue, direction, field.Interface().(*ngapType.NASPDU).Value); err == nil {
+			names = append(names, metrics.NASMessageNames(msg)...)
+		}
+	}
+	return names
+}
+
+// setWrongUENGAPIDs replaces the AMF or RAN UE NGAP IDs of a UE associated NGAP message by ones the AGF does not know,
+// the most significant bit of the ID being inverted
+func setWrongUENGAPIDs(pdu *ngapType.NGAPPDU, amfUeNgapId, ranUeNgapId bool) {
+	var value reflect.Value
+	switch {
+	case pdu.InitiatingMessage != nil:
+		value = reflect.ValueOf(pdu.InitiatingMessage.Value)
+	case pdu.SuccessfulOutcome != nil:
+		value = reflect.ValueOf(pdu.SuccessfulOutcome.Value)
+	case pdu.UnsuccessfulOutcome != nil:
+		value = reflect.ValueOf(pdu.UnsuccessfulOutcome.Value)
+	default:
+		return
+	}
+	present := int(value.FieldByName("Present").Int())
+	if present <= 0 || present >= value.NumField() || value.Field(present).IsNil() {
+		return
+	}
+	protocolIEs := value.Field(present).Elem().FieldByName("ProtocolIEs")
+	if !protocolIEs.IsValid() {
+		return
+	}
+	// TS 38.413 9.3.3.1 AMF UE NGAP ID, 0 to 2^40-1, 9.3.3.2 RAN UE NGAP ID, 0 to 2^32-1
+	wrongAMFUENGAPID := func(id *ngapType.AMFUENGAPID) {
+		if amfUeNgapId {
+			id.Value ^= 1 << 39
+		}
+	}
+	wrongRANUENGAPID := func(id *ngapType.RANUENGAPID) {
+		if ranUeNgapId {
+			id.Value ^= 1 << 31
+		}
+	}
+	ies := protocolIEs.FieldByName("List")
+	for i := 0; i < ies.Len(); i++ {
+		ie := ies.Index(i).FieldByName("Value")
+		if field := ie.FieldByName("AMFUENGAPID"); field.IsValid() && !field.IsNil() {
+			wrongAMFUENGAPID(field.Interface().(*ngapType.AMFUENGAPID))
+		}
+		if field := ie.FieldByName("RANUENGAPID"); field.IsValid() && !field.IsNil() {
+			wrongRANUENGAPID(field.Interface().(*ngapType.RANUENGAPID))
+		}
+		if field := ie.FieldByName("UENGAPIDs"); field.IsValid() && !field.IsNil() {
+			ids := field.Interface().(*ngapType.UENGAPIDs)
+			switch ids.Present {
+			case ngapType.UENGAPIDsPresentUENGAPIDPair:
+				wrongAMFUENGAPID(&ids.UENGAPIDPair.AMFUENGAPID)
+				wrongRANUENGAPID(&ids.UENGAPIDPair.RANUENGAPID)
+			case ngapType.UENGAPIDsPresentAMFUENGAPID:
+				wrongAMFUENGAPID(ids.AMFUENGAPID)
+			}
+		}
+	}
+}
+
+// reportFault logs and publishes the faults injected in an NGAP message exchanged with the UE, nil for a non UE
+// associated message
+func reportFault(ue *context.UEContext, direction string, names []string, faults *fault.Faults) {
+	message := strings.Join(names, "/")
+	if ue != nil {
+		logger.MainLog.Warn("[%s] Fault injected in %s %s: %s", ue.LogTag("NGAP"), direction, message,
+			faults.String())
+	} else {
+		logger.MainLog.Warn("Fault injected in %s %s: %s", direction, message, faults.String())
+	}
+	event.Publish(ue, event.Event{Type: event.FaultInjected, Procedure: names[0],
+		Detail: direction + " " + message + " " + faults.String()})
+}
+
+// sendFaultyData sends an NGAP message to the AGF with the faults drawn for it: dropped, corrupted, sent with wrong UE
+// NGAP IDs, held until the next message of the UE, delayed or duplicated. The message is reported sent when dropped or
+// deferred.
+func sendFaultyData(conn *sctp.SCTPConn, pkt []byte, info string) (int, error) {
+	pdu, err := lib_ngap.Decoder(pkt)
+	if err != nil {
+		return writeData(conn, pkt, info)
+	}
+	ue := lookupUEContext(conn, pdu)
+	key := heldKey{metrics.DirectionSent, faultOwner(conn, ue)}
+	names := ngapMessageNames(ue, metrics.DirectionSent, pdu)
+	faults := fault.Global.NGAP(metrics.DirectionSent, ue, names)
+	if len(faults.Actions) == 0 {
+		defer releaseHeldMessage(key)
+		return writeData(conn, pkt, info)
+	}
+	reportFault(ue, metrics.DirectionSent, names, &faults)
+	if faults.Drop {
+		return len(pkt), nil
+	}
+
+	if faults.WrongAMFUENGAPID || faults.WrongRANUENGAPID {
+		setWrongUENGAPIDs(pdu, faults.WrongAMFUENGAPID, faults.WrongRANUENGAPID)
+		if encoded, err := lib_ngap.Encoder(*pdu); err == nil {
+			pkt = encoded
+		} else {
+			logger.MainLog.Error("Encode NGAP message with wrong UE NGAP IDs failed: %+v", err)
+		}
+	}
+	if faults.Corrupt {
+		pkt = append([]byte(nil), pkt...)
+		fault.Global.Flip(pkt, 0)
+	}
+	send := func() {
+		writeData(conn, pkt, info)
+		if faults.Duplicate {
+			writeData(conn, pkt, info)
+		}
+	}
+	switch {
+	case faults.Reorder:
+		holdMessage(key, faults.Hold, send)
+		return len(pkt), nil
+	case faults.Delay > 0:
+		time.AfterFunc(faults.Delay, send)
+		return len(pkt), nil
+	}
+	defer releaseHeldMessage(key)
+	n, err := writeData(conn, pkt, info)
+	if err == nil && faults.Duplicate {
+		n, err = writeData(conn, pkt, info)
+	}
+	return n, err
+}
+
+// dispatchFaultyPDU handles an NGAP message received from the AGF with the faults drawn for it on the shard of its UE:
+// dropped, corrupted, held until the next message of the UE, delayed or handled twice
+func dispatchFaultyPDU(agf *context.AGFContext, conn *sctp.SCTPConn, pdu *ngapType.NGAPPDU, pkt []byte) {
+	// the held and delayed messages are dropped by the dispatcher once stopped, not handled by the next Server
+	d, shard := ueDispatcher, pduShardKey(agf, pdu)
+	d.dispatch(shard, func() {
+		ue := lookupUEContext(conn, pdu)
+		key := heldKey{metrics.DirectionReceived, faultOwner(conn, ue)}
+		names := ngapMessageNames(ue, metrics.DirectionReceived, pdu)
+		faults := fault.Global.NGAP(metrics.DirectionReceived, ue, names)
+		if len(faults.Actions) == 0 {
+			handlePDU(agf, conn, pdu, recording.Global.Copy(pkt))
+			releaseHeldMessage(key)
+			return
+		}
+		reportFault(ue, metrics.DirectionReceived, names, &faults)
+		if faults.Drop {
+			return
+		}
+
+		if faults.Corrupt {
+			pkt = append([]byte(nil), pkt...)
+			fault.Global.Flip(pkt, 0)
+			corrupted, err := lib_ngap.Decoder(pkt)
+			if err != nil {
+				logger.MainLog.Error("Server NGAP decode error: %+v", err)
+				return
+			}
+			pdu = corrupted
+		}
+		// the NAS PDUs are deciphered in place by the handlers, the duplicate is decoded again
+		handle := func() {
+			handlePDU(agf, conn, pdu, recording.Global.Copy(pkt))
+			if !faults.Duplicate {
+				return
+			}
+			if duplicate, err := lib_ngap.Decoder(pkt); err == nil {
+				handlePDU(agf, conn, duplicate, recording.Global.Copy(pkt))
+			}
+		}
+		switch {
+		case faults.Reorder:
+			holdMessage(key, faults.Hold, func() { d.dispatch(shard, handle) })
+		case faults.Delay > 0:
+			time.AfterFunc(faults.Delay, func() { d.dispatch(shard, handle) })
+		default:
+			handle()
+			releaseHeldMessage(key)
+		}
+	})
+}
@@ -0,0 +1,454 @@
+package simamf
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"free5gc/lib/UeauCommon"
+	"free5gc/lib/aper"
+	"free5gc/lib/milenage"
+	lib_nas "free5gc/lib/nas"
+	"free5gc/lib/nas/nasMessage"
+	"free5gc/lib/nas/nasTestpacket"
+	"free5gc/lib/nas/nasType"
+	"free5gc/lib/nas/security"
+	lib_ngap "free5gc/lib/ngap"
+	"free5gc/lib/ngap/ngapType"
+	"sim-amf/pkg/context"
+	"sim-amf/pkg/nas"
+	"sim-amf/pkg/recording"
+
+	"gitlab.casa-systems.com/opensource/sctp"
+)
+
+// Subscription of the 5G-RG of the tests, of which the SUCI is concealed with the null scheme
+const (
+	testSupi = "imsi-2079000007487"
+	testK    = "8baf473f2f8fd09487cccbd7097c6862"
+	testOPc  = "8e27b6af0e692e750f32667a3b14605d"
+)
+
+var (
+	// testSuci is the SUCI of testSupi in the PLMN 20790, with the routing indicator 0
+	testSuci = nasType.MobileIdentity5GS{
+		Len:    12,
+		Buffer: []uint8{0x01, 0x02, 0xf7, 0x09, 0xf0, 0xff, 0x00, 0x00, 0x00, 0x00, 0x47, 0x78},
+	}
+	// testSecurityCapability is 128-5G-EA0 and 128-5G-IA1, NIA2 being left out of the tests
+	testSecurityCapability = &nasType.UESecurityCapability{
+		Iei:    nasMessage.RegistrationRequestUESecurityCapabilityType,
+		Len:    2,
+		Buffer: []uint8{0x80, 0x40},
+	}
+)
+
+// testAGF is a W-AGF connected to the AMF in the tests. The NGAP messages it sends are handled by the dispatcher as if
+// read from its TNL association, and the ones the AMF sends it are captured.
+type testAGF struct {
+	t    *testing.T
+	agf  *context.AGFContext
+	sent chan *ngapType.NGAPPDU
+}
+
+// newTestAGF configures the AMF with the options and the subscriber of testSupi, and connects a testAGF to it. The
+// dispatcher is stopped and the AMF set reset at the end of the test.
+func newTestAGF(t *testing.T, opts Options) *testAGF {
+	t.Helper()
+	context.ResetAMFSet()
+	opts.apply()
+	if err := configureAMF(); err != nil {
+		t.Fatalf("configureAMF() error = %v", err)
+	}
+	nssai, err := parseSubscribedNssai(subscribedNssai)
+	if err != nil {
+		t.Fatalf("parseSubscribedNssai() error = %v", err)
+	}
+	k, _ := hex.DecodeString(testK)
+	opc, _ := hex.DecodeString(testOPc)
+	subscriber := &context.Subscriber{ID: testSupi, SubscribedNssai: nssai, K: k, OPc: opc}
+	context.AMFSelf.ReplaceSubscribers(map[string]*context.Subscriber{testSupi: subscriber})
+
+	a := &testAGF{t: t, sent: make(chan *ngapType.NGAPPDU, 64)}
+	write := writeTNLA
+	writeTNLA = func(conn *sctp.SCTPConn, pkt []byte) (int, error) {
+		pdu, err := lib_ngap.Decoder(pkt)
+		if err != nil {
+			t.Errorf("NGAP message sent by the AMF: %v", err)
+			return len(pkt), nil
+		}
+		a.sent <- pdu
+		return len(pkt), nil
+	}
+	ueDispatcher = newDispatcher(1, 64)
+	t.Cleanup(func() {
+		ueDispatcher.stop()
+		writeTNLA = write
+		context.ResetAMFSet()
+	})
+
+	amf := context.AMFSelf
+	a.agf = context.NewAGFContext(amf, new(sctp.SCTPConn))
+	a.agf.SCTPAddr = "192.0.2.1:38412"
+	plmnSupportItem := amf.PlmnSupportList.List[0]
+	a.agf.SupportedTAList = &ngapType.SupportedTAList{List: []ngapType.SupportedTAItem{{
+		TAC: ngapType.TAC{Value: aper.OctetString{0x00, 0x00, 0x01}},
+		BroadcastPLMNList: ngapType.BroadcastPLMNList{List: []ngapType.BroadcastPLMNItem{{
+			PLMNIdentity:        plmnSupportItem.PLMNIdentity,
+			TAISliceSupportList: plmnSupportItem.SliceSupportList,
+		}}},
+	}}}
+	a.agf.NGSetupDone = true
+	amf.StoreAGFContextSCTPAddr(a.agf)
+	return a
+}
+
+// send hands an NGAP message of the AGF to the dispatcher
+func (a *testAGF) send(pdu *ngapType.NGAPPDU) {
+	dispatchPDU(a.agf, a.agf.SCTPConn, pdu, nil)
+}
+
+// receive returns the next NGAP message the AMF sends the AGF, failing the test unless it is the message named
+func (a *testAGF) receive(message string) *ngapType.NGAPPDU {
+	a.t.Helper()
+	select {
+	case pdu := <-a.sent:
+		if _, name := recording.Message(pdu); name != message {
+			a.t.Fatalf("AMF sent %s, want %s", name, message)
+		}
+		return pdu
+	case <-time.After(5 * time.Second):
+		a.t.Fatalf("AMF sent no %s", message)
+	}
+	return nil
+}
+
+// settle waits until the dispatcher has run the jobs of the messages sent to the AMF, and the jobs they dispatched
+func (a *testAGF) settle() {
+	for {
+		done := make(chan struct{})
+		ueDispatcher.dispatch(0, func() { close(done) })
+		<-done
+		if len(ueDispatcher.shards[0]) == 0 {
+			return
+		}
+	}
+}
+
+// silent fails the test if the AMF sent the AGF a message once the dispatcher has settled
+func (a *testAGF) silent() {
+	a.t.Helper()
+	a.settle()
+	select {
+	case pdu := <-a.sent:
+		_, name := recording.Message(pdu)
+		a.t.Fatalf("AMF sent %s, want none", name)
+	default:
+	}
+}
+
+// testRG is a 5G-RG registering through a testAGF. It runs 5G AKA with the K and OPc of testSupi, and protects its NAS
+// messages with the NAS security context it shares with the AMF, its keys being derived as the AMF does.
+type testRG struct {
+	agf         *testAGF
+	ranUeNgapId int64
+	amfUeNgapId int64
+	keys        *context.UEContext // KAMF, NAS security algorithms and keys of the RG
+	newKamf     bool               // the next Security Mode Command takes a new KAMF into use
+	ulCount     uint32             // NAS COUNT of the next uplink message
+	dlCount     uint32             // NAS COUNT of the next downlink message
+	guti        nasType.MobileIdentity5GS
+}
+
+func (a *testAGF) newRG(ranUeNgapId int64) *testRG {
+	keys := new(context.UEContext)
+	keys.Supi = testSupi
+	return &testRG{agf: a, ranUeNgapId: ranUeNgapId, keys: keys}
+}
+
+// ue returns the UE context of the RG in the AMF
+func (rg *testRG) ue() *context.UEContext {
+	rg.agf.t.Helper()
+	rg.agf.settle()
+	ue, ok := context.AMFSelf.LoadUEContextAMFUENGAPID(rg.amfUeNgapId)
+	if !ok {
+		rg.agf.t.Fatalf("no UE context of AMF UE NGAP ID %d", rg.amfUeNgapId)
+	}
+	return ue
+}
+
+// register runs the initial registration of the RG with 5G AKA and returns its UE context, registered
+func (rg *testRG) register() *context.UEContext {
+	t := rg.agf.t
+	t.Helper()
+	rg.initialUEMessage(nasTestpacket.GetRegistrationRequestWith5GMM(nasMessage.RegistrationType5GSInitialRegistration,
+		testSuci, nil, nil, testSecurityCapability))
+	authenticationRequest := rg.receiveNAS("DownlinkNASTransport", lib_nas.MsgTypeAuthenticationRequest)
+	rg.uplinkNAS(rg.authenticate(authenticationRequest.AuthenticationRequest))
+	rg.receiveNAS("DownlinkNASTransport", lib_nas.MsgTypeSecurityModeCommand)
+	rg.uplinkNAS(rg.protect(nasTestpacket.GetSecurityModeComplete(nil),
+		lib_nas.SecurityHeaderTypeIntegrityProtectedAndCipheredWithNew5gNasSecurityContext))
+	rg.receive("InitialContextSetupRequest")
+	rg.agf.send(rg.initialContextSetupResponse())
+	registrationAccept := rg.receiveNAS("DownlinkNASTransport", lib_nas.MsgTypeRegistrationAccept)
+	guti := registrationAccept.RegistrationAccept.GUTI5G
+	if guti == nil {
+		t.Fatalf("Registration Accept without 5G-GUTI")
+	}
+	rg.guti = nasType.MobileIdentity5GS{Len: guti.Len, Buffer: append([]uint8(nil), guti.Octet[:]...)}
+	rg.uplinkNAS(rg.protect(nasTestpacket.GetRegistrationComplete(nil),
+		lib_nas.SecurityHeaderTypeIntegrityProtectedAndCiphered))
+	ue := rg.ue()
+	if !ue.Registered() {
+		t.Fatalf("UE %s after the Registration Complete, want %s", ue.StateMachineIndex, context.GmmRegistered)
+	}
+	return ue
+}
+
+// authenticate checks the AUTN of an Authentication Request, derives the KAMF and returns the Authentication Response
+//
+// TS 33.501 6.1.3.2 Authentication procedure for 5G AKA
+func (rg *testRG) authenticate(authenticationRequest *nasMessage.AuthenticationRequest) []byte {
+	t := rg.agf.t
+	t.Helper()
+	k, _ := hex.DecodeString(testK)
+	opc, _ := hex.DecodeString(testOPc)
+	rand := authenticationRequest.AuthenticationParameterRAND.GetRANDValue()
+	autn := authenticationRequest.AuthenticationParameterAUTN.GetAUTN()
+	ik, ck, res, auts := make([]byte, 16), make([]byte, 16), make([]byte, 8), make([]byte, 14)
+	var resLen uint
+	// any SQN of the network is fresh for the SQN 0 of the RG
+	if milenage.Milenage_check(opc, k, make([]byte, 6), rand[:], autn[:], ik, ck, res, &resLen, auts) != 0 {
+		t.Fatalf("AUTN of the Authentication Request rejected")
+	}
+
+	key := append(ck, ik...)
+	snName := []byte(servingNetworkName())
+	resStar := UeauCommon.GetKDFValue(key, UeauCommon.FC_FOR_RES_STAR_XRES_STAR_DERIVATION,
+		snName, UeauCommon.KDFLen(snName), rand[:], UeauCommon.KDFLen(rand[:]), res, UeauCommon.KDFLen(res))
+	kausf := UeauCommon.GetKDFValue(key, UeauCommon.FC_FOR_KAUSF_DERIVATION,
+		snName, UeauCommon.KDFLen(snName), autn[:6], UeauCommon.KDFLen(autn[:6]))
+	kseaf := UeauCommon.GetKDFValue(kausf, UeauCommon.FC_FOR_KSEAF_DERIVATION, snName, UeauCommon.KDFLen(snName))
+	rg.keys.ABBA = authenticationRequest.ABBA.GetABBAContents()
+	rg.keys.DerivateKamf(kseaf)
+	rg.newKamf = true
+	return nasTestpacket.GetAuthenticationResponse(resStar[16:], "")
+}
+
+// securityModeCommand takes into use the NAS security context of a Security Mode Command: the K'AMF derived from the
+// KAMF with the NAS COUNT of the command if requested, and the NAS keys of the selected algorithms
+//
+// TS 33.501 6.7.2 NAS security mode command procedure, 6.9.3 Key-change-on-the-fly
+func (rg *testRG) securityModeCommand(securityModeCommand *nasMessage.SecurityModeCommand) {
+	if info := securityModeCommand.Additional5GSecurityInformation; info != nil && info.GetHDP() == 1 {
+		rg.keys.ULCount.Set(0, uint8(rg.dlCount))
+		rg.keys.DerivateHorizontalKamf()
+		rg.newKamf = true
+	}
+	algorithms := securityModeCommand.SelectedNASSecurityAlgorithms
+	rg.keys.IntegrityAlg = algorithms.GetTypeOfIntegrityProtectionAlgorithm()
+	rg.keys.CipheringAlg = algorithms.GetTypeOfCipheringAlgorithm()
+	rg.keys.DerivateAlgKey()
+	if rg.newKamf {
+		rg.ulCount, rg.dlCount, rg.newKamf = 0, 0, false
+	}
+}
+
+// protect ciphers and integrity protects a plain uplink NAS message with the next uplink NAS COUNT
+func (rg *testRG) protect(plain []byte, securityHeaderType uint8) []byte {
+	t := rg.agf.t
+	t.Helper()
+	count := rg.ulCount
+	rg.ulCount++
+	payload := append([]byte(nil), plain...)
+	if securityHeaderType == lib_nas.SecurityHeaderTypeIntegrityProtectedAndCiphered ||
+		securityHeaderType == lib_nas.SecurityHeaderTypeIntegrityProtectedAndCipheredWithNew5gNasSecurityContext {
+		if err := nas.Encrypt(rg.keys.CipheringAlg, rg.keys.KnasEnc, count, security.Bearer3GPP,
+			security.DirectionUplink, payload); err != nil {
+			t.Fatalf("NASEncrypt() error = %v", err)
+		}
+	}
+	payload = append([]byte{uint8(count)}, payload...)
+	mac, err := nas.MacCalculate(rg.keys.IntegrityAlg, rg.keys.KnasInt, count, security.Bearer3GPP,
+		security.DirectionUplink, payload)
+	if err != nil {
+		t.Fatalf("NASMacCalculate() error = %v", err)
+	}
+	return append(append([]byte{nasMessage.Epd5GSMobilityManagementMessage, securityHeaderType}, mac...), payload...)
+}
+
+// decode returns the plain NAS message of a downlink NAS PDU, checking its MAC with the NAS security context of the
+// RG, or the one of the Security Mode Command it carries
+func (rg *testRG) decode(pdu []byte) *lib_nas.Message {
+	t := rg.agf.t
+	t.Helper()
+	msg := new(lib_nas.Message)
+	securityHeaderType := pdu[1] & 0x0f
+	if securityHeaderType == lib_nas.SecurityHeaderTypePlainNas {
+		if err := msg.PlainNasDecode(&pdu); err != nil {
+			t.Fatalf("PlainNasDecode() error = %v", err)
+		}
+		return msg
+	}
+
+	// the NAS COUNT overflow is not reached by the tests
+	count := uint32(pdu[6])
+	payload := append([]byte(nil), pdu[7:]...)
+	if securityHeaderType == lib_nas.SecurityHeaderTypeIntegrityProtectedAndCiphered ||
+		securityHeaderType == lib_nas.SecurityHeaderTypeIntegrityProtectedAndCipheredWithNew5gNasSecurityContext {
+		if err := nas.Encrypt(rg.keys.CipheringAlg, rg.keys.KnasEnc, count, security.Bearer3GPP,
+			security.DirectionDownlink, payload); err != nil {
+			t.Fatalf("NASEncrypt() error = %v", err)
+		}
+	}
+	if err := msg.PlainNasDecode(&payload); err != nil {
+		t.Fatalf("PlainNasDecode() error = %v", err)
+	}
+	if msg.GmmMessage != nil && msg.GmmMessage.GetMessageType() == lib_nas.MsgTypeSecurityModeCommand {
+		rg.securityModeCommand(msg.GmmMessage.SecurityModeCommand)
+	}
+	mac, err := nas.MacCalculate(rg.keys.IntegrityAlg, rg.keys.KnasInt, count, security.Bearer3GPP,
+		security.DirectionDownlink, pdu[6:])
+	if err != nil {
+		t.Fatalf("NASMacCalculate() error = %v", err)
+	}
+	if !bytes.Equal(mac, pdu[2:6]) {
+		t.Errorf("MAC of downlink NAS COUNT %d = %x, want %x", count, pdu[2:6], mac)
+	}
+	rg.dlCount = count + 1
+	msg.SecurityHeaderType = securityHeaderType
+	return msg
+}
+
+// receive returns the next NGAP message the AMF sends the RG, failing the test unless it is the message named
+func (rg *testRG) receive(message string) *ngapType.NGAPPDU {
+	rg.agf.t.Helper()
+	pdu := rg.agf.receive(message)
+	amfUeNgapId, ranUeNgapId := ueNGAPIDs(pdu)
+	if ranUeNgapId != rg.ranUeNgapId {
+		rg.agf.t.Fatalf("%s to RAN UE NGAP ID %d, want %d", message, ranUeNgapId, rg.ranUeNgapId)
+	}
+	if amfUeNgapId != context.AmfUeNgapIdUnspecified {
+		rg.amfUeNgapId = amfUeNgapId
+	}
+	return pdu
+}
+
+// receiveNAS returns the 5GMM message carried by the next NGAP message the AMF sends the RG, failing the test unless
+// they are the messages expected
+func (rg *testRG) receiveNAS(message string, messageType uint8) *lib_nas.GmmMessage {
+	t := rg.agf.t
+	t.Helper()
+	nasPdus := recording.NASPDUs(rg.receive(message))
+	if len(nasPdus) == 0 {
+		t.Fatalf("%s without NAS-PDU", message)
+	}
+	msg := rg.decode(nasPdus[0].Value)
+	if msg.GmmMessage == nil || msg.GmmMessage.GetMessageType() != messageType {
+		t.Fatalf("%s carrying NAS message %v, want %d", message, msg.GmmHeader, messageType)
+	}
+	return msg.GmmMessage
+}
+
+// initialUEMessage sends the first NAS message of the RG on a new NG connection
+func (rg *testRG) initialUEMessage(nasPdu []byte) {
+	rg.amfUeNgapId = context.AmfUeNgapIdUnspecified
+	pdu := ngapType.NGAPPDU{Present: ngapType.NGAPPDUPresentInitiatingMessage}
+	pdu.InitiatingMessage = &ngapType.InitiatingMessage{
+		ProcedureCode: ngapType.ProcedureCode{Value: ngapType.ProcedureCodeInitialUEMessage},
+		Criticality:   ngapType.Criticality{Value: ngapType.CriticalityPresentIgnore},
+	}
+	pdu.InitiatingMessage.Value.Present = ngapType.InitiatingMessagePresentInitialUEMessage
+	message := new(ngapType.InitialUEMessage)
+	ies := &message.ProtocolIEs
+	ie := ngapType.InitialUEMessageIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+	ie.Value.Present = ngapType.InitialUEMessageIEsPresentRANUENGAPID
+	ie.Value.RANUENGAPID = &ngapType.RANUENGAPID{Value: rg.ranUeNgapId}
+	ies.List = append(ies.List, ie)
+	ie = ngapType.InitialUEMessageIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDNASPDU
+	ie.Value.Present = ngapType.InitialUEMessageIEsPresentNASPDU
+	ie.Value.NASPDU = &ngapType.NASPDU{Value: nasPdu}
+	ies.List = append(ies.List, ie)
+	pdu.InitiatingMessage.Value.InitialUEMessage = message
+	rg.agf.send(&pdu)
+}
+
+// uplinkNAS sends a NAS message of the RG on its NG connection
+func (rg *testRG) uplinkNAS(nasPdu []byte) {
+	pdu := ngapType.NGAPPDU{Present: ngapType.NGAPPDUPresentInitiatingMessage}
+	pdu.InitiatingMessage = &ngapType.InitiatingMessage{
+		ProcedureCode: ngapType.ProcedureCode{Value: ngapType.ProcedureCodeUplinkNASTransport},
+		Criticality:   ngapType.Criticality{Value: ngapType.CriticalityPresentIgnore},
+	}
+	pdu.InitiatingMessage.Value.Present = ngapType.InitiatingMessagePresentUplinkNASTransport
+	uplinkNASTransport := new(ngapType.UplinkNASTransport)
+	ies := &uplinkNASTransport.ProtocolIEs
+	ie := ngapType.UplinkNASTransportIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDAMFUENGAPID
+	ie.Value.Present = ngapType.UplinkNASTransportIEsPresentAMFUENGAPID
+	ie.Value.AMFUENGAPID = &ngapType.AMFUENGAPID{Value: rg.amfUeNgapId}
+	ies.List = append(ies.List, ie)
+	ie = ngapType.UplinkNASTransportIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+	ie.Value.Present = ngapType.UplinkNASTransportIEsPresentRANUENGAPID
+	ie.Value.RANUENGAPID = &ngapType.RANUENGAPID{Value: rg.ranUeNgapId}
+	ies.List = append(ies.List, ie)
+	ie = ngapType.UplinkNASTransportIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDNASPDU
+	ie.Value.Present = ngapType.UplinkNASTransportIEsPresentNASPDU
+	ie.Value.NASPDU = &ngapType.NASPDU{Value: nasPdu}
+	ies.List = append(ies.List, ie)
+	pdu.InitiatingMessage.Value.UplinkNASTransport = uplinkNASTransport
+	rg.agf.send(&pdu)
+}
+
+// initialContextSetupResponse returns the Initial Context Setup Response of the NG connection of the RG
+func (rg *testRG) initialContextSetupResponse() *ngapType.NGAPPDU {
+	pdu := ngapType.NGAPPDU{Present: ngapType.NGAPPDUPresentSuccessfulOutcome}
+	pdu.SuccessfulOutcome = &ngapType.SuccessfulOutcome{
+		ProcedureCode: ngapType.ProcedureCode{Value: ngapType.ProcedureCodeInitialContextSetup},
+		Criticality:   ngapType.Criticality{Value: ngapType.CriticalityPresentReject},
+	}
+	pdu.SuccessfulOutcome.Value.Present = ngapType.SuccessfulOutcomePresentInitialContextSetupResponse
+	response := new(ngapType.InitialContextSetupResponse)
+	ies := &response.ProtocolIEs
+	ie := ngapType.InitialContextSetupResponseIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDAMFUENGAPID
+	ie.Value.Present = ngapType.InitialContextSetupResponseIEsPresentAMFUENGAPID
+	ie.Value.AMFUENGAPID = &ngapType.AMFUENGAPID{Value: rg.amfUeNgapId}
+	ies.List = append(ies.List, ie)
+	ie = ngapType.InitialContextSetupResponseIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+	ie.Value.Present = ngapType.InitialContextSetupResponseIEsPresentRANUENGAPID
+	ie.Value.RANUENGAPID = &ngapType.RANUENGAPID{Value: rg.ranUeNgapId}
+	ies.List = append(ies.List, ie)
+	pdu.SuccessfulOutcome.Value.InitialContextSetupResponse = response
+	return &pdu
+}
+
+// ueContextReleaseComplete returns the UE Context Release Complete of the NG connection of the RG
+func (rg *testRG) ueContextReleaseComplete() *ngapType.NGAPPDU {
+	pdu := ngapType.NGAPPDU{Present: ngapType.NGAPPDUPresentSuccessfulOutcome}
+	pdu.SuccessfulOutcome = &ngapType.SuccessfulOutcome{
+		ProcedureCode: ngapType.ProcedureCode{Value: ngapType.ProcedureCodeUEContextRelease},
+		Criticality:   ngapType.Criticality{Value: ngapType.CriticalityPresentReject},
+	}
+	pdu.SuccessfulOutcome.Value.Present = ngapType.SuccessfulOutcomePresentUEContextReleaseComplete
+	complete := new(ngapType.UEContextReleaseComplete)
+	ies := &complete.ProtocolIEs
+	ie := ngapType.UEContextReleaseCompleteIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDAMFUENGAPID
+	ie.Value.Present = ngapType.UEContextReleaseCompleteIEsPresentAMFUENGAPID
+	ie.Value.AMFUENGAPID = &ngapType.AMFUENGAPID{Value: rg.amfUeNgapId}
+	ies.List = append(ies.List, ie)
+	ie = ngapType.UEContextReleaseCompleteIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+	ie.Value.Present = ngapType.UEContextReleaseCompleteIEsPresentRANUENGAPID
+	ie.Value.RANUENGAPID = &ngapType.RANUENGAPID{Value: rg.ranUeNgapId}
+	ies.List = append(ies.List, ie)
+	pdu.SuccessfulOutcome.Value.UEContextReleaseComplete = complete
+	return &pdu
+}
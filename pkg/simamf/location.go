@@ -0,0 +1,255 @@
+package simamf
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"free5gc/lib/aper"
+	"free5gc/lib/ngap/ngapConvert"
+	"free5gc/lib/ngap/ngapType"
+	"free5gc/lib/openapi/models"
+	"sim-amf/pkg/api"
+	"sim-amf/pkg/context"
+	"sim-amf/pkg/event"
+	"sim-amf/pkg/logger"
+	"sim-amf/pkg/util"
+)
+
+var locationEventTypes = map[string]aper.Enumerated{
+	"direct":                               ngapType.EventTypePresentDirect,
+	"change-of-serve-cell":                 ngapType.EventTypePresentChangeOfServeCell,
+	"ue-presence-in-area-of-interest":      ngapType.EventTypePresentUePresenceInAreaOfInterest,
+	"stop-change-of-serve-cell":            ngapType.EventTypePresentStopChangeOfServeCell,
+	"stop-ue-presence-in-area-of-interest": ngapType.EventTypePresentStopUePresenceInAreaOfInterest,
+	"cancel-location-reporting-for-the-ue": ngapType.EventTypePresentCancelLocationReportingForTheUe,
+}
+
+var uePresences = map[aper.Enumerated]string{
+	ngapType.UEPresencePresentIn:      "in",
+	ngapType.UEPresencePresentOut:     "out",
+	ngapType.UEPresencePresentUnknown: "unknown",
+}
+
+// locationEventTypeName returns the name of a location reporting event type
+func locationEventTypeName(eventType aper.Enumerated) string {
+	for name, value := range locationEventTypes {
+		if value == eventType {
+			return name
+		}
+	}
+	return fmt.Sprintf("event type %d", eventType)
+}
+
+// buildLocationReportingRequestType builds the Location Reporting Request Type of a Location Reporting Control of the
+// UE, the areas of interest being made of TAIs or of the W-AGF serving the UE, the cell of a wireline UE being its line
+//
+// TS 38.413 9.3.1.65 Location Reporting Request Type
+func buildLocationReportingRequestType(ue *context.UEContext, req *api.LocationReportingControlRequest) (
+	*ngapType.LocationReportingRequestType, error) {
+	eventType, ok := locationEventTypes[strings.ToLower(req.EventType)]
+	if !ok {
+		return nil, fmt.Errorf("invalid event type %s", req.EventType)
+	}
+	requestType := &ngapType.LocationReportingRequestType{
+		EventType:  ngapType.EventType{Value: eventType},
+		ReportArea: ngapType.ReportArea{Value: ngapType.ReportAreaPresentCell},
+	}
+
+	switch eventType {
+	case ngapType.EventTypePresentUePresenceInAreaOfInterest:
+		if len(req.AreasOfInterest) == 0 || len(req.AreasOfInterest) > 64 {
+			return nil, fmt.Errorf("%s expects 1 to 64 areas of interest", req.EventType)
+		}
+		requestType.AreaOfInterestList = new(ngapType.AreaOfInterestList)
+		for _, area := range req.AreasOfInterest {
+			item, err := buildAreaOfInterestItem(ue, area)
+			if err != nil {
+				return nil, err
+			}
+			requestType.AreaOfInterestList.List = append(requestType.AreaOfInterestList.List, item)
+		}
+	case ngapType.EventTypePresentStopUePresenceInAreaOfInterest:
+		if req.ReferenceIDToBeCancelled < 1 || req.ReferenceIDToBeCancelled > 64 {
+			return nil, fmt.Errorf("%s expects the location reporting reference ID to be cancelled, from 1 to 64",
+				req.EventType)
+		}
+		requestType.LocationReportingReferenceIDToBeCancelled = &ngapType.LocationReportingReferenceID{
+			Value: req.ReferenceIDToBeCancelled,
+		}
+	}
+	return requestType, nil
+}
+
+// buildAreaOfInterestItem builds an area of interest made of TAIs, <MCC><MNC>-<TAC>, and of the W-AGF serving the UE
+//
+// TS 38.413 9.3.1.66 Area of Interest
+func buildAreaOfInterestItem(ue *context.UEContext, area api.AreaOfInterest) (ngapType.AreaOfInterestItem, error) {
+	var item ngapType.AreaOfInterestItem
+	if area.ReferenceID < 1 || area.ReferenceID > 64 {
+		return item, fmt.Errorf("invalid location reporting reference ID %d, expecting 1 to 64", area.ReferenceID)
+	}
+	item.LocationReportingReferenceID.Value = area.ReferenceID
+	if len(area.TAIs) == 0 && !area.ServingAGF {
+		return item, fmt.Errorf("empty area of interest %d", area.ReferenceID)
+	}
+	if len(area.TAIs) > 16 {
+		return item, fmt.Errorf("area of interest %d has more than 16 TAIs", area.ReferenceID)
+	}
+	for _, s := range area.TAIs {
+		i := strings.Index(s, "-")
+		if i < 0 {
+			return item, fmt.Errorf("invalid TAI %s, expecting <MCC><MNC>-<TAC>", s)
+		}
+		plmnID, err := parsePlmnID(s[:i])
+		if err != nil {
+			return item, err
+		}
+		if tac, err := hex.DecodeString(s[i+1:]); err != nil || len(tac) != 3 {
+			return item, fmt.Errorf("invalid TAC %s, expecting 6 hex digits", s[i+1:])
+		}
+		if item.AreaOfInterest.AreaOfInterestTAIList == nil {
+			item.AreaOfInterest.AreaOfInterestTAIList = new(ngapType.AreaOfInterestTAIList)
+		}
+		item.AreaOfInterest.AreaOfInterestTAIList.List = append(item.AreaOfInterest.AreaOfInterestTAIList.List,
+			ngapType.AreaOfInterestTAIItem{
+				TAI: ngapConvert.TaiToNgap(models.Tai{PlmnId: &plmnID, Tac: strings.ToLower(s[i+1:])}),
+			})
+	}
+	if area.ServingAGF {
+		if ue.AGF == nil || ue.AGF.GlobalRANNodeID == nil {
+			return item, fmt.Errorf("Global RAN Node ID of the AGF of UE %d unknown", ue.AmfUeNgapId)
+		}
+		item.AreaOfInterest.AreaOfInterestRANNodeList = &ngapType.AreaOfInterestRANNodeList{
+			List: []ngapType.AreaOfInterestRANNodeItem{{GlobalRANNodeID: *ue.AGF.GlobalRANNodeID}},
+		}
+	}
+	return item, nil
+}
+
+// recordUserLocation stores the line identity of the User Location Information reported in the procedure, appending it
+// to the location history of the UE on a change of line or if report is set, i.e. on a Location Report, and reports a
+// change of line
+func recordUserLocation(ue *context.UEContext, procedure string,
+	userLocationInformation *ngapType.UserLocationInformation, presence map[int64]string, report bool) {
+	location, ok := context.UserLocationFromNgap(userLocationInformation)
+	if !ok {
+		return
+	}
+	ue.UpdateUserLocationInformation(userLocationInformation)
+	previous := ue.LastUserLocation()
+	if previous != nil && previous.SameLine(&location) && !report {
+		return
+	}
+	location.Time, location.Procedure, location.Presence = time.Now(), procedure, presence
+	ue.AddUserLocation(location)
+	if previous == nil || previous.SameLine(&location) {
+		return
+	}
+	detail := fmt.Sprintf("%s, previously %s", location.LineString(), previous.LineString())
+	logger.MainLog.Warn("[%s] Line identity changed in %s: %s", ue.LogTag("NGAP"), procedure, detail)
+	event.Publish(ue, event.Event{Type: event.LineIdentityChanged, Procedure: procedure, Detail: detail})
+}
+
+// handleLocationReport stores the location of the UE reported by the AGF, its line identity and its presence in the
+// areas of interest
+//
+// TS 38.413 8.17.3 Location Report
+func handleLocationReport(agf *context.AGFContext, pdu *ngapType.NGAPPDU) {
+	var aMFUENGAPID *ngapType.AMFUENGAPID
+	var rANUENGAPID *ngapType.RANUENGAPID
+	var userLocationInformation *ngapType.UserLocationInformation
+	var uePresenceInAreaOfInterestList *ngapType.UEPresenceInAreaOfInterestList
+	var locationReportingRequestType *ngapType.LocationReportingRequestType
+
+	locationReport := pdu.InitiatingMessage.Value.LocationReport
+	if locationReport == nil {
+		logger.MainLog.Error("LocationReport is nil")
+		return
+	}
+	for _, ie := range locationReport.ProtocolIEs.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDAMFUENGAPID:
+			aMFUENGAPID = ie.Value.AMFUENGAPID
+		case ngapType.ProtocolIEIDRANUENGAPID:
+			rANUENGAPID = ie.Value.RANUENGAPID
+		case ngapType.ProtocolIEIDUserLocationInformation:
+			userLocationInformation = ie.Value.UserLocationInformation
+		case ngapType.ProtocolIEIDUEPresenceInAreaOfInterestList:
+			uePresenceInAreaOfInterestList = ie.Value.UEPresenceInAreaOfInterestList
+		case ngapType.ProtocolIEIDLocationReportingRequestType:
+			locationReportingRequestType = ie.Value.LocationReportingRequestType
+		}
+	}
+
+	ue := findUEContext(agf, aMFUENGAPID, rANUENGAPID)
+	if ue == nil {
+		return
+	}
+	var details []string
+	if locationReportingRequestType != nil {
+		details = append(details, locationEventTypeName(locationReportingRequestType.EventType.Value))
+	}
+	location, ok := context.UserLocationFromNgap(userLocationInformation)
+	if ok {
+		details = append(details, location.LineString())
+	} else {
+		logger.MainLog.Warn("[%s] Location Report without W-AGF User Location Information", ue.LogTag("NGAP"))
+	}
+	var presence map[int64]string
+	if uePresenceInAreaOfInterestList != nil {
+		presence = make(map[int64]string)
+		var ids []int64
+		for _, item := range uePresenceInAreaOfInterestList.List {
+			presence[item.LocationReportingReferenceID.Value] = uePresences[item.UEPresence.Value]
+			ids = append(ids, item.LocationReportingReferenceID.Value)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		for _, id := range ids {
+			details = append(details, fmt.Sprintf("area of interest %d %s", id, presence[id]))
+		}
+	}
+	detail := strings.Join(details, ", ")
+	logger.MainLog.Info("[%s] Location Report, %s", ue.LogTag("NGAP"), detail)
+	recordUserLocation(ue, util.NgapProcedureName(ngapType.ProcedureCodeLocationReport), userLocationInformation,
+		presence, true)
+	event.Publish(ue, event.Event{Type: event.LocationReport, Detail: detail})
+}
+
+// handleLocationReportingFailureIndication reports the Location Reporting Control the AGF could not perform
+//
+// TS 38.413 8.17.2 Location Reporting Failure Indication
+func handleLocationReportingFailureIndication(agf *context.AGFContext, pdu *ngapType.NGAPPDU) {
+	var aMFUENGAPID *ngapType.AMFUENGAPID
+	var rANUENGAPID *ngapType.RANUENGAPID
+	var cause *ngapType.Cause
+
+	locationReportingFailureIndication := pdu.InitiatingMessage.Value.LocationReportingFailureIndication
+	if locationReportingFailureIndication == nil {
+		logger.MainLog.Error("LocationReportingFailureIndication is nil")
+		return
+	}
+	for _, ie := range locationReportingFailureIndication.ProtocolIEs.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDAMFUENGAPID:
+			aMFUENGAPID = ie.Value.AMFUENGAPID
+		case ngapType.ProtocolIEIDRANUENGAPID:
+			rANUENGAPID = ie.Value.RANUENGAPID
+		case ngapType.ProtocolIEIDCause:
+			cause = ie.Value.Cause
+		}
+	}
+
+	ue := findUEContext(agf, aMFUENGAPID, rANUENGAPID)
+	if ue == nil {
+		return
+	}
+	detail := "no cause"
+	if cause != nil {
+		detail = "cause " + util.NgapCauseString(cause)
+	}
+	logger.MainLog.Warn("[%s] Location Reporting Failure Indication, %s", ue.LogTag("NGAP"), detail)
+	event.Publish(ue, event.Event{Type: event.LocationReportingFailure, Detail: detail})
+}
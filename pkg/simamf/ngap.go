@@ -0,0 +1,1161 @@
+package simamf
+
+import (
+	"encoding/hex"
+	"fmt"
+	"free5gc/lib/fsm"
+	lib_nas "free5gc/lib/nas"
+	"free5gc/lib/nas/nasMessage"
+	lib_ngap "free5gc/lib/ngap"
+	"free5gc/lib/ngap/ngapConvert"
+	"free5gc/lib/ngap/ngapType"
+	"free5gc/lib/openapi/models"
+	"io"
+	"os"
+	"reflect"
+	"sim-amf/pkg/event"
+	"sim-amf/pkg/fault"
+	"sim-amf/pkg/logger"
+	"sim-amf/pkg/metrics"
+	"sim-amf/pkg/recording"
+	"sim-amf/pkg/trace"
+	"sim-amf/pkg/types"
+	"sim-amf/pkg/util"
+	"sync"
+	"time"
+
+	"sim-amf/pkg/context"
+
+	"github.com/davecgh/go-spew/spew"
+	"gitlab.casa-systems.com/opensource/sctp"
+)
+
+const NGAPPPIDBigEndian = 0x3c000000
+
+var SctpListener struct {
+	lock     sync.Mutex
+	listener *sctp.SCTPListener
+}
+var SctpClientConn struct {
+	lock        sync.Mutex
+	sctpCliConn *sctp.SCTPConn
+}
+
+var RanIDAmfIDMap sync.Map
+
+var (
+	ngapAddr    string
+	apiAddr     string
+	metricsAddr string
+
+	traceFormat     string
+	traceFile       string
+	traceProcedures []string
+	traceUEs        []string
+	traceOut        io.Closer // trace file, nil if tracing to stdout
+)
+
+// acceptAGFs accepts the NGAP associations of the AGFs to an AMF of the set, one association per AGF
+func acceptAGFs(amf *context.AMFContext, listener *sctp.SCTPListener) {
+	for {
+		serverConn, err := acceptSCTP(listener)
+		if err != nil {
+			if isStopping() {
+				return
+			}
+			continue
+		}
+
+		agf := context.NewAGFContext(amf, serverConn)
+		amf.StoreAGFContextSCTPAddr(agf)
+		logger.MainLog.Info("AGF[%s] connected to AMF[%s]", agf.SCTPAddr, amf.AMFName.Value)
+
+		serving.Add(1)
+		go func() {
+			defer serving.Done()
+			serveAGF(agf)
+		}()
+	}
+}
+
+// acceptSCTP accepts an NGAP association, its messages being sent with the NGAP PPID
+func acceptSCTP(listener *sctp.SCTPListener) (*sctp.SCTPConn, error) {
+	serverConn, err := listener.AcceptSCTP()
+	if err != nil {
+		if !isStopping() {
+			logger.MainLog.Error("Accept failed: %s", err)
+		}
+		return nil, err
+	}
+	info, err := serverConn.GetDefaultSentParam()
+	if err != nil {
+		logger.MainLog.Error("GetDefaultSentParam(): %+v", err)
+		serverConn.Close()
+		return nil, err
+	}
+	info.PPID = NGAPPPIDBigEndian
+	err = serverConn.SetDefaultSentParam(info)
+	if err != nil {
+		logger.MainLog.Error("SetDefaultSentParam(): %+v", err)
+		serverConn.Close()
+		return nil, err
+	}
+	return serverConn, nil
+}
+
+// serveAGF reads the NGAP messages of an AGF until its first association goes down, which also ends its other TNL
+// associations
+func serveAGF(agf *context.AGFContext) {
+	defer func() {
+		agf.SCTPConn.Close()
+		agf.AMF.DeleteAGFContextSCTPAddr(agf.SCTPAddr)
+		agf.RangeTNLA(func(conn *sctp.SCTPConn) bool {
+			conn.Close()
+			return true
+		})
+		agf.RangeUEContext(func(ue *context.UEContext) bool {
+			dispatchUE(ue, func() { releaseUEContext(agf, ue) })
+			return true
+		})
+		logger.MainLog.Info("AGF[%s] disconnected", agf.SCTPAddr)
+	}()
+
+	readNGAP(agf, agf.SCTPConn)
+}
+
+// readNGAP reads and dispatches the NGAP messages received on a TNL association of the AGF until it goes down
+func readNGAP(agf *context.AGFContext, conn *sctp.SCTPConn) {
+	for {
+		msg, err := ReadData(conn, "Server")
+		if err != nil {
+			logger.MainLog.Error("read failed: %v", err)
+			return
+		}
+		pdu, err := lib_ngap.Decoder(msg)
+		metrics.CountNGAPMessage(metrics.DirectionReceived, msg, err)
+		recordNGAP(conn, msg, pdu, metrics.DirectionReceived)
+		checkConformance(agf.SCTPAddr, pdu, err)
+		if err != nil {
+			logger.MainLog.Error("Server NGAP decode error: %+v", err)
+			continue
+		}
+		if fault.Global.Active(metrics.DirectionReceived) {
+			dispatchFaultyPDU(agf, conn, pdu, msg)
+			continue
+		}
+		// the NAS PDUs are deciphered in place by the handlers, the message is recorded once handled
+		dispatchPDU(agf, conn, pdu, recording.Global.Copy(msg))
+	}
+}
+
+// openTrace opens the message trace
+func openTrace() error {
+	if traceFormat == "" {
+		return nil
+	}
+	out := os.Stdout
+	if traceFile != "" {
+		f, err := os.Create(traceFile)
+		if err != nil {
+			return err
+		}
+		out = f
+		traceOut = f
+	}
+	tracer, err := trace.NewTracer(out, traceFormat)
+	if err != nil {
+		closeTrace()
+		return err
+	}
+	tracer.SetProcedures(traceProcedures)
+	tracer.SetUEs(traceUEs)
+	trace.Global = tracer
+	return nil
+}
+
+// closeTrace stops the message trace and closes its file
+func closeTrace() {
+	trace.Global = nil
+	if traceOut != nil {
+		traceOut.Close()
+		traceOut = nil
+	}
+}
+
+func SetSctpListener(lis *sctp.SCTPListener) {
+	SctpListener.lock.Lock()
+	SctpListener.listener = lis
+	SctpListener.lock.Unlock()
+}
+
+func ReadData(conn *sctp.SCTPConn, info string) ([]byte, error) {
+	msg := make([]byte, 65535)
+	n, sctpInfo, err := conn.SCTPRead(msg)
+	if err != nil {
+		return msg, err
+	} else {
+		logger.MainLog.Debug("%s: read %d bytes successfully", info, n)
+		if sctpInfo == nil {
+			logger.MainLog.Debug("No SctpInfo")
+		} else if sctpInfo.PPID != NGAPPPIDBigEndian {
+			logger.MainLog.Warn("Received SCTP PPID = %v", sctpInfo.PPID)
+		}
+
+		return msg[:n], err
+	}
+}
+
+func SendData(conn *sctp.SCTPConn, pkt []byte, info string) (int, error) {
+	if fault.Global.Active(metrics.DirectionSent) {
+		return sendFaultyData(conn, pkt, info)
+	}
+	return writeData(conn, pkt, info)
+}
+
+// writeTNLA writes an NGAP message to the SCTP socket of a TNL association, replaced by the tests
+var writeTNLA = func(conn *sctp.SCTPConn, pkt []byte) (int, error) {
+	return conn.Write(pkt)
+}
+
+// writeData writes an NGAP message to the TNL association, then counts, captures, traces and records it
+func writeData(conn *sctp.SCTPConn, pkt []byte, info string) (int, error) {
+	var n int
+	var err error
+	if n, err = writeTNLA(conn, pkt); err != nil {
+		logger.MainLog.Error("%s: write to SCTP socket failed: %+v", info, err)
+	} else {
+		logger.MainLog.Debug("[%s: wrote %d bytes successfully", info, n)
+	}
+	metrics.CountNGAPMessage(metrics.DirectionSent, pkt, err)
+	if err == nil {
+		recordNGAP(conn, pkt, nil, metrics.DirectionSent)
+	}
+	return n, err
+}
+
+// recordNGAP captures, traces and records an NGAP message sent or received on the association, pdu is nil if not
+// decoded yet. The received messages are recorded by dispatchPDU once handled.
+func recordNGAP(conn *sctp.SCTPConn, pkt []byte, pdu *ngapType.NGAPPDU, direction string) {
+	var ue *context.UEContext
+	if pcapPerUEDir != "" || trace.Global != nil || recording.Global != nil {
+		if pdu == nil {
+			pdu, _ = lib_ngap.Decoder(pkt)
+		}
+		if pdu != nil {
+			ue = lookupUEContext(conn, pdu)
+		}
+	}
+	captureNGAP(conn, pkt, ue, direction == metrics.DirectionReceived)
+	trace.Global.NGAP(ue, direction, pdu)
+	if direction == metrics.DirectionSent && recording.Global != nil {
+		recording.Global.NGAP(agfSCTPAddr(conn), ue, direction, pkt)
+	}
+}
+
+func SendToAmf(amf *context.AMFContext, pkt []byte) {
+	if amf == nil {
+		logger.MainLog.Error("[NGAP] AMF Context is nil")
+		return
+	}
+	if amf.SCTPConn == nil {
+		logger.MainLog.Error("[NGAP] SCTP Connection is nil")
+		return
+	}
+	if n, err := amf.SCTPConn.Write(pkt); err != nil {
+		logger.MainLog.Error("[NGAP] Write to SCTP socket failed: %+v", err)
+	} else {
+		logger.MainLog.Debug("[NGAP] Wrote %d bytes", n)
+	}
+}
+
+func DumpPdu(pdu *ngapType.NGAPPDU, info string) {
+	logger.MainLog.Debug("DUMP start: %s", info)
+	spew.Dump(pdu)
+	logger.MainLog.Debug("DUMP end: %s", info)
+}
+
+func InitTestUe(ue *context.UEContext) {
+	// init
+	rgCtx := &types.RGContext{
+		RGType:           types.RGType_FN_RG,
+		MAC:              "02:42:d5:32:74:11",
+		CircuitID:        "987",
+		RemoteID:         "4567",
+		LineType:         "PON",
+		CreatePDUSession: false,
+		MacUnique:        true,
+	}
+
+	if rgCtx.LineType == types.LineType_CABLE {
+		ue.GlobalID, ue.GlobalIDStr, ue.GlobalIDSUPI = context.InitGlobalCableID(rgCtx.CableID)
+	} else {
+		ue.LineID, ue.GlobalID, ue.GlobalIDStr, ue.GlobalIDSUPI = context.InitGlobalLineID(
+			rgCtx.MAC,
+			context.StringToNgap(rgCtx.LineID),
+			rgCtx.CircuitID,
+			rgCtx.RemoteID)
+	}
+	ue.Init()
+	ue.RGAttach(rgCtx)
+
+	ue.Kwagf = []uint8{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1}
+
+	// overwrite timer default values fo test
+	ue.T3502Value = 2
+	ue.T3510Value = 1
+	ue.T3511Value = 1
+	ue.T3517Value = 1
+	ue.T3521Value = 1
+	ue.T3525Value = 1
+	ue.T3540Value = 1
+	ue.Non3GppDeregistrationTimerValue = 1
+
+	ue.MaxRegistrationRetryTime = 1
+	ue.MaxRegistrationAttemptTime = 2
+	initNASTimers(ue)
+	ue.ServiceType = nasMessage.ServiceTypeSignalling
+}
+
+func end2end_serverHandler(agf *context.AGFContext, pdu *ngapType.NGAPPDU) {
+	switch pdu.Present {
+	case ngapType.NGAPPDUPresentInitiatingMessage:
+		initiatingMessage := pdu.InitiatingMessage
+		if initiatingMessage == nil {
+			logger.MainLog.Error("Initiating Message is nil")
+			return
+		}
+		switch initiatingMessage.ProcedureCode.Value {
+		case ngapType.ProcedureCodeNGSetup:
+			handleNGSetupRequest(agf, pdu)
+		case ngapType.ProcedureCodeInitialUEMessage:
+			handleInitialUEMessage(agf, pdu)
+		case ngapType.ProcedureCodeUplinkNASTransport:
+			handleUplinkNASTransport(agf, pdu)
+		case ngapType.ProcedureCodeUEContextReleaseRequest:
+			handleUEContextReleaseRequest(agf, pdu)
+		case ngapType.ProcedureCodeTraceFailureIndication:
+			handleTraceFailureIndication(agf, pdu)
+		case ngapType.ProcedureCodeCellTrafficTrace:
+			handleCellTrafficTrace(agf, pdu)
+		case ngapType.ProcedureCodeLocationReport:
+			handleLocationReport(agf, pdu)
+		case ngapType.ProcedureCodeLocationReportingFailureIndication:
+			handleLocationReportingFailureIndication(agf, pdu)
+		default:
+			logger.MainLog.Error("Not implemented NGAP message(initiatingMessage), procedureCode:%d", initiatingMessage.ProcedureCode.Value)
+		}
+	case ngapType.NGAPPDUPresentSuccessfulOutcome:
+		successfulOutcome := pdu.SuccessfulOutcome
+		if successfulOutcome == nil {
+			logger.MainLog.Error("SuccessfulOutcome is nil")
+			return
+		}
+		switch successfulOutcome.ProcedureCode.Value {
+		case ngapType.ProcedureCodeInitialContextSetup:
+			switch successfulOutcome.Value.Present {
+			case ngapType.SuccessfulOutcomePresentInitialContextSetupResponse:
+				handleInitialContextSetupResponse(agf, pdu)
+			default:
+				logger.MainLog.Error("[TEST] Server unexpected successfulOutcome(InitialContextSetup) response:%d", successfulOutcome.Value.Present)
+			}
+		case ngapType.ProcedureCodePDUSessionResourceSetup:
+			handlePDUSessionResourceSetupResponse(agf, pdu)
+		case ngapType.ProcedureCodePDUSessionResourceModify:
+			handlePDUSessionResourceModifyResponse(agf, pdu)
+		case ngapType.ProcedureCodePDUSessionResourceRelease:
+			handlePDUSessionResourceReleaseResponse(agf, pdu)
+		case ngapType.ProcedureCodeUEContextRelease:
+			handleUEContextReleaseComplete(agf, pdu)
+		case ngapType.ProcedureCodeNGReset:
+			handleNGResetAcknowledge(agf, pdu)
+		case ngapType.ProcedureCodeAMFConfigurationUpdate:
+			handleAMFConfigurationUpdateAcknowledge(agf, pdu)
+		case ngapType.ProcedureCodeUEContextModification:
+			handleUEContextModificationResponse(agf, pdu)
+		default:
+			logger.MainLog.Error("Server unexpected successfulOutcome procedure:%d", successfulOutcome.ProcedureCode.Value)
+		}
+	case ngapType.NGAPPDUPresentUnsuccessfulOutcome:
+		unsuccessfulOutcome := pdu.UnsuccessfulOutcome
+		if unsuccessfulOutcome == nil {
+			logger.MainLog.Error("UnsuccessfulOutcome is nil")
+			return
+		}
+		switch unsuccessfulOutcome.ProcedureCode.Value {
+		case ngapType.ProcedureCodeAMFConfigurationUpdate:
+			handleAMFConfigurationUpdateFailure(agf, pdu)
+		case ngapType.ProcedureCodeUEContextModification:
+			handleUEContextModificationFailure(agf, pdu)
+		default:
+			logger.MainLog.Error("Server unexpected unsuccessfulOutcome procedure:%d", unsuccessfulOutcome.ProcedureCode.Value)
+		}
+	default:
+		logger.MainLog.Error("Server Not implemented NGAP message, Present:%d", pdu.Present)
+
+	}
+}
+
+// findUEContext returns the UEContext addressed by a UE-associated NGAP message of the AGF
+func findUEContext(agf *context.AGFContext, aMFUENGAPID *ngapType.AMFUENGAPID, rANUENGAPID *ngapType.RANUENGAPID) *context.UEContext {
+	if aMFUENGAPID == nil {
+		logger.MainLog.Error("Missing AMF UE NGAP ID")
+		return nil
+	}
+	ue, ok := agf.AMF.LoadUEContextAMFUENGAPID(aMFUENGAPID.Value)
+	if !ok {
+		logger.MainLog.Error("No UE Context[AmfUeNgapID: %d]", aMFUENGAPID.Value)
+		return nil
+	}
+	if ue.AGF != agf {
+		logger.MainLog.Error("UE Context[AmfUeNgapID: %d] is not served by AGF[%s]", aMFUENGAPID.Value, agf.SCTPAddr)
+		return nil
+	}
+	if rANUENGAPID != nil && rANUENGAPID.Value != ue.RanUeNgapId {
+		logger.MainLog.Warn("UE Context[AmfUeNgapID: %d] RanUeNgapID changed from %d to %d", ue.AmfUeNgapId,
+			ue.RanUeNgapId, rANUENGAPID.Value)
+		ue.DetachAGF()
+		ue.RanUeNgapId = rANUENGAPID.Value
+		ue.AttachAGF(agf)
+	}
+	return ue
+}
+
+// lookupUEContext returns the UEContext addressed by a UE-associated NGAP message, without checking the association
+func lookupUEContext(conn *sctp.SCTPConn, pdu *ngapType.NGAPPDU) *context.UEContext {
+	amfUeNgapId, ranUeNgapId := ueNGAPIDs(pdu)
+	if amfUeNgapId != context.AmfUeNgapIdUnspecified {
+		ue, _ := context.LoadSetUEContextAMFUENGAPID(amfUeNgapId)
+		return ue
+	}
+	if ranUeNgapId == context.RanUeNgapIdUnspecified {
+		return nil
+	}
+	if agf := agfOfConn(conn); agf != nil {
+		ue, _ := agf.LoadUEContextRANUENGAPID(ranUeNgapId)
+		return ue
+	}
+	return nil
+}
+
+// ueNGAPIDs returns the AMF and RAN UE NGAP IDs carried in a UE associated NGAP message
+func ueNGAPIDs(pdu *ngapType.NGAPPDU) (amfUeNgapId, ranUeNgapId int64) {
+	amfUeNgapId, ranUeNgapId = context.AmfUeNgapIdUnspecified, context.RanUeNgapIdUnspecified
+
+	var value reflect.Value
+	switch {
+	case pdu.InitiatingMessage != nil:
+		value = reflect.ValueOf(pdu.InitiatingMessage.Value)
+	case pdu.SuccessfulOutcome != nil:
+		value = reflect.ValueOf(pdu.SuccessfulOutcome.Value)
+	case pdu.UnsuccessfulOutcome != nil:
+		value = reflect.ValueOf(pdu.UnsuccessfulOutcome.Value)
+	default:
+		return
+	}
+
+	// the message is the field selected by Present, as for the aper encoding
+	present := int(value.FieldByName("Present").Int())
+	if present <= 0 || present >= value.NumField() || value.Field(present).IsNil() {
+		return
+	}
+	protocolIEs := value.Field(present).Elem().FieldByName("ProtocolIEs")
+	if !protocolIEs.IsValid() {
+		return
+	}
+	ies := protocolIEs.FieldByName("List")
+	for i := 0; i < ies.Len(); i++ {
+		ie := ies.Index(i).FieldByName("Value")
+		if field := ie.FieldByName("AMFUENGAPID"); field.IsValid() && !field.IsNil() {
+			amfUeNgapId = field.Interface().(*ngapType.AMFUENGAPID).Value
+		}
+		if field := ie.FieldByName("RANUENGAPID"); field.IsValid() && !field.IsNil() {
+			ranUeNgapId = field.Interface().(*ngapType.RANUENGAPID).Value
+		}
+		if field := ie.FieldByName("UENGAPIDs"); field.IsValid() && !field.IsNil() {
+			ids := field.Interface().(*ngapType.UENGAPIDs)
+			switch ids.Present {
+			case ngapType.UENGAPIDsPresentUENGAPIDPair:
+				amfUeNgapId = ids.UENGAPIDPair.AMFUENGAPID.Value
+				ranUeNgapId = ids.UENGAPIDPair.RANUENGAPID.Value
+			case ngapType.UENGAPIDsPresentAMFUENGAPID:
+				amfUeNgapId = ids.AMFUENGAPID.Value
+			}
+		}
+	}
+	return
+}
+
+func handleInitialUEMessage(agf *context.AGFContext, pdu *ngapType.NGAPPDU) {
+	var rANUENGAPID *ngapType.RANUENGAPID
+	var nASPDU *ngapType.NASPDU
+	var userLocationInformation *ngapType.UserLocationInformation
+
+	initiatingMessage := pdu.InitiatingMessage
+	switch initiatingMessage.Value.Present {
+	case ngapType.InitiatingMessagePresentInitialUEMessage:
+		initialUEMessage := initiatingMessage.Value.InitialUEMessage
+		for i := 0; i < len(initialUEMessage.ProtocolIEs.List); i++ {
+			ie := initialUEMessage.ProtocolIEs.List[i]
+			switch ie.Id.Value {
+			case ngapType.ProtocolIEIDRANUENGAPID:
+				rANUENGAPID = ie.Value.RANUENGAPID
+			case ngapType.ProtocolIEIDNASPDU:
+				nASPDU = ie.Value.NASPDU
+			case ngapType.ProtocolIEIDUserLocationInformation:
+				userLocationInformation = ie.Value.UserLocationInformation
+			default:
+				logger.MainLog.Info("Server Recvd IE(InitialUEMessage) %d", ie.Id.Value)
+			}
+		}
+	default:
+		return
+	}
+
+	if rANUENGAPID == nil {
+		logger.MainLog.Error("Missing RAN UE NGAP ID")
+		return
+	}
+	if nASPDU == nil {
+		logger.MainLog.Error("Missing nasPDU")
+		return
+	}
+
+	if old, ok := agf.LoadUEContextRANUENGAPID(rANUENGAPID.Value); ok {
+		logger.MainLog.Warn("Release stale UE Context[AmfUeNgapID: %d] of RanUeNgapID %d", old.AmfUeNgapId, old.RanUeNgapId)
+		releaseUEContext(agf, old)
+	}
+	if agf.AMF.Reroute || agf.AMF.Unavailable {
+		rerouteInitialUEMessage(agf, pdu, rANUENGAPID)
+		return
+	}
+	ue, err := agf.AMF.NewUEContext(agf, rANUENGAPID.Value, shardKey(agf, rANUENGAPID.Value))
+	if err != nil {
+		logger.MainLog.Error("Allocate AMF UE NGAP ID failed: %+v", err)
+		return
+	}
+	InitTestUe(ue)
+	recordUserLocation(ue, util.NgapProcedureName(ngapType.ProcedureCodeInitialUEMessage), userLocationInformation, nil,
+		false)
+	openUECapture(agf, ue, pdu)
+	cmEvent(ue, context.CmEventConnected)
+
+	msg := receiveNAS(ue, nASPDU.Value)
+	if msg == nil {
+		return
+	}
+	switch msg.GmmMessage.GetMessageType() {
+	case lib_nas.MsgTypeRegistrationRequest:
+		handleRegistrationRequest(agf, ue, msg.GmmMessage.RegistrationRequest, msg.SecurityHeaderType,
+			nASPDU.Value, userLocationInformation)
+	default:
+		logger.MainLog.Warn("[%s] %s not implemented in InitialUEMessage", ue.LogTag("NAS"),
+			util.NasMessageTypeName(msg.GmmMessage.GetMessageType()))
+		sendStatus5GMM(ue, nasMessage.Cause5GMMMessageTypeNonExistentOrNotImplemented)
+	}
+}
+
+func handleNGSetupRequest(agf *context.AGFContext, pdu *ngapType.NGAPPDU) {
+	nGSetupRequest := pdu.InitiatingMessage.Value.NGSetupRequest
+	if nGSetupRequest == nil {
+		logger.MainLog.Error("NGSetupRequest is nil")
+		return
+	}
+	for i := 0; i < len(nGSetupRequest.ProtocolIEs.List); i++ {
+		ie := nGSetupRequest.ProtocolIEs.List[i]
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDGlobalRANNodeID:
+			agf.GlobalRANNodeID = ie.Value.GlobalRANNodeID
+		case ngapType.ProtocolIEIDRANNodeName:
+			if ie.Value.RANNodeName != nil {
+				agf.RANNodeName = ie.Value.RANNodeName.Value
+			}
+		case ngapType.ProtocolIEIDSupportedTAList:
+			agf.SupportedTAList = ie.Value.SupportedTAList
+		case ngapType.ProtocolIEIDDefaultPagingDRX:
+			agf.DefaultPagingDRX = ie.Value.DefaultPagingDRX
+		}
+	}
+
+	pkt, err := sendNGSetupResponse(agf.AMF)
+	if err != nil {
+		logger.MainLog.Error("Error %v", err)
+		return
+	}
+	if _, err = SendData(agf.SCTPConn, pkt, "Server"); err == nil {
+		agf.NGSetupDone = true
+		advertiseTNLEndpoints(agf)
+	}
+}
+
+func sendNGSetupResponse(amf *context.AMFContext) ([]byte, error) {
+	pdu := buildNGSetupResponse(amf.AMFName.Value, amf.ServedGuamiList.List, amf.PlmnSupportList.List,
+		amf.RelativeAMFCapacity.Value)
+
+	return lib_ngap.Encoder(pdu)
+}
+
+func handleUplinkNASTransport(agf *context.AGFContext, pdu *ngapType.NGAPPDU) {
+	var aMFUENGAPID *ngapType.AMFUENGAPID
+	var rANUENGAPID *ngapType.RANUENGAPID
+	var nASPDU *ngapType.NASPDU
+	var userLocationInformation *ngapType.UserLocationInformation
+
+	initiatingMessage := pdu.InitiatingMessage
+	uplinkNasTransport := initiatingMessage.Value.UplinkNASTransport
+	for i := 0; i < len(uplinkNasTransport.ProtocolIEs.List); i++ {
+		ie := uplinkNasTransport.ProtocolIEs.List[i]
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDAMFUENGAPID:
+			aMFUENGAPID = ie.Value.AMFUENGAPID
+		case ngapType.ProtocolIEIDRANUENGAPID:
+			rANUENGAPID = ie.Value.RANUENGAPID
+		case ngapType.ProtocolIEIDNASPDU:
+			nASPDU = ie.Value.NASPDU
+		case ngapType.ProtocolIEIDUserLocationInformation:
+			userLocationInformation = ie.Value.UserLocationInformation
+		default:
+			logger.MainLog.Info("Server Recvd IE(UplinkNASTransport) %d", ie.Id.Value)
+		}
+	}
+
+	ue := findUEContext(agf, aMFUENGAPID, rANUENGAPID)
+	if ue == nil {
+		return
+	}
+	if nASPDU == nil {
+		logger.MainLog.Error("Missing nasPDU")
+		return
+	}
+	recordUserLocation(ue, util.NgapProcedureName(ngapType.ProcedureCodeUplinkNASTransport), userLocationInformation,
+		nil, false)
+
+	msg := receiveNAS(ue, nASPDU.Value)
+	if msg == nil {
+		return
+	}
+	switch msg.GmmMessage.GetMessageType() {
+	case lib_nas.MsgTypeAuthenticationResponse:
+		handleAuthenticationResponse(ue, msg.GmmMessage.AuthenticationResponse)
+	case lib_nas.MsgTypeAuthenticationFailure:
+		handleAuthenticationFailure(ue, msg.GmmMessage.AuthenticationFailure)
+	case lib_nas.MsgTypeSecurityModeComplete:
+		ue.StopNASTimer(context.T3560)
+		if ue.PreviousSecurityContext != nil {
+			completeRekeying(ue)
+			return
+		}
+		if len(ue.Kamf) > 0 {
+			ue.DerivateAnKey()
+		}
+		pkt, err := BuildInitialContextSetupRequest(ue, nil)
+		if err != nil {
+			logger.MainLog.Error("Error %v", err)
+			return
+		}
+		_, err = SendData(ue.SCTPConn(), pkt, "Server")
+		if err != nil {
+			logger.MainLog.Error("Error %v", err)
+		}
+	case lib_nas.MsgTypeSecurityModeReject:
+		ue.StopNASTimer(context.T3560)
+		logger.MainLog.Warn("[%s] Security Mode Reject cause %d", ue.LogTag("NAS"),
+			msg.GmmMessage.SecurityModeReject.GetCauseValue())
+		if ue.PreviousSecurityContext != nil {
+			// the UE stays registered with the NAS security context in use
+			abortRekeying(ue, fmt.Sprintf("Security Mode Reject cause %d",
+				msg.GmmMessage.SecurityModeReject.GetCauseValue()))
+			return
+		}
+		gmmEvent(ue, context.GmmEventRegistrationRejected)
+		sendUEContextReleaseCommand(ue, ngapType.CauseNasPresentUnspecified)
+	case lib_nas.MsgTypeRegistrationRequest:
+		handleRegistrationUpdate(ue, msg.GmmMessage.RegistrationRequest)
+	case lib_nas.MsgTypeRegistrationComplete:
+		ue.StopNASTimer(context.T3550)
+		completeRegistration(ue)
+	case lib_nas.MsgTypeULNASTransport:
+		end2end_handleGMMMsgULNASTransport(agf, ue, msg.GmmMessage.ULNASTransport, msg.SecurityHeaderType)
+	case lib_nas.MsgTypeStatus5GMM:
+		handleStatus5GMM(ue, msg.GmmMessage.Status5GMM)
+	case lib_nas.MsgTypeDeregistrationRequestUEOriginatingDeregistration:
+		ue.StopNASTimers()
+		ue.SetAttached(0)
+		gmmEvent(ue, context.GmmEventDeregistered)
+		event.Publish(ue, event.Event{Type: event.Deregistered, Detail: "UE-initiated"})
+		// no Deregistration Accept for a switch off
+		deregistrationRequest := msg.GmmMessage.DeregistrationRequestUEOriginatingDeregistration
+		if deregistrationRequest.NgksiAndDeregistrationType.GetSwitchOff() == 0 {
+			pkt, err := BuildDeregistrationAccept(ue)
+			if err != nil {
+				logger.MainLog.Error("Error %v", err)
+				return
+			}
+			_, err = SendData(ue.SCTPConn(), pkt, "Server")
+			if err != nil {
+				logger.MainLog.Error("Error %v", err)
+				return
+			}
+		}
+		sendUEContextReleaseCommand(ue, ngapType.CauseNasPresentDeregister)
+	case lib_nas.MsgTypeDeregistrationAcceptUETerminatedDeregistration:
+		ue.StopNASTimer(context.T3522)
+		ue.SetAttached(0)
+		gmmEvent(ue, context.GmmEventDeregistered)
+		event.Publish(ue, event.Event{Type: event.Deregistered, Detail: "network-initiated"})
+		cause, _ := util.NgapCause(ngapType.CausePresentNas, ngapType.CauseNasPresentDeregister)
+		pkt, err := BuildUEContextReleaseCommand(ue, cause)
+		if err != nil {
+			logger.MainLog.Error("Error %v", err)
+			return
+		}
+		_, err = SendData(ue.SCTPConn(), pkt, "Server")
+		if err != nil {
+			logger.MainLog.Error("Error %v", err)
+		}
+	default:
+		logger.MainLog.Warn("[%s] %s not implemented in UplinkNASTransport", ue.LogTag("NAS"),
+			util.NasMessageTypeName(msg.GmmMessage.GetMessageType()))
+		sendStatus5GMM(ue, nasMessage.Cause5GMMMessageTypeNonExistentOrNotImplemented)
+	}
+}
+
+func end2end_handleGMMMsgULNASTransport(agf *context.AGFContext, ue *context.UEContext, uLNASTransport *nasMessage.ULNASTransport, securityHeaderType uint8) {
+	switch uLNASTransport.GetPayloadContainerType() {
+	case nasMessage.PayloadContainerTypeN1SMInfo:
+		m := receiveN1SM(ue, uLNASTransport.GetPayloadContainerContents())
+		if m == nil {
+			return
+		}
+		messageType := m.GsmMessage.GetMessageType()
+
+		// The UE shall include Request Type IE when the PDU session ID IE is included and
+		// the Payload container IE contains the PDU SESSION ESTABLISHMENT REQUEST message or
+		// the PDU SESSION MODIFICATION REQUEST.
+		if messageType == lib_nas.MsgTypePDUSessionEstablishmentRequest {
+			var requestType uint8
+			if uLNASTransport.RequestType != nil {
+				requestType = uLNASTransport.GetRequestTypeValue()
+			}
+			if requestType != nasMessage.ULNASTransportRequestTypeInitialRequest {
+				logger.MainLog.Error("[TEST] Unexpected RequestType %v in NAS.UplinkNASTransport", requestType)
+				return
+			}
+		}
+
+		pduSessionID := uLNASTransport.GetPduSessionID2Value()
+		switch messageType {
+		case lib_nas.MsgTypePDUSessionEstablishmentRequest:
+			// the S-NSSAI requested by the UE, or the first allowed one, has to be in the Allowed NSSAI, and the DNN,
+			// or the first subscribed one, subscribed
+			var snssai models.Snssai
+			if uLNASTransport.SNSSAI != nil {
+				snssai = util.NasSnssaiIEToModels(uLNASTransport.SNSSAI)
+			} else if len(ue.AllowedNssai) > 0 {
+				snssai = ue.AllowedNssai[0]
+			}
+			var dnn string
+			if uLNASTransport.DNN != nil {
+				dnn = util.NasDnnToModels(uLNASTransport.DNN.GetDNN())
+			} else if ue.Subscriber != nil && len(ue.Subscriber.Dnns) > 0 {
+				dnn = ue.Subscriber.Dnns[0]
+			}
+			var cause5GMM uint8
+			if !containsSnssai(ue.AllowedNssai, snssai) {
+				logger.MainLog.Warn("[%s] PDU Session[ID:%d] S-NSSAI %+v not allowed", ue.LogTag("NAS"),
+					pduSessionID, snssai)
+				cause5GMM = nasMessage.Cause5GMMPayloadWasNotForwarded
+			} else if ue.Subscriber != nil && !ue.Subscriber.DnnAllowed(dnn) {
+				logger.MainLog.Warn("[%s] PDU Session[ID:%d] DNN %s not subscribed", ue.LogTag("NAS"),
+					pduSessionID, dnn)
+				cause5GMM = nasMessage.Cause5GMMDNNNotSupportedOrNotSubscribedInTheSlice
+			}
+			if cause5GMM != 0 {
+				pkt, err := BuildPayloadNotForwarded(ue, pduSessionID,
+					uLNASTransport.PayloadContainer.GetPayloadContainerContents(), cause5GMM)
+				if err != nil {
+					logger.MainLog.Error("Error %v", err)
+					return
+				}
+				if _, err = SendData(ue.SCTPConn(), pkt, "Server"); err != nil {
+					logger.MainLog.Error("Error %v", err)
+				}
+				return
+			}
+			// the PDU session type, SSC mode, slice and DN-specific identity have to be allowed by the policy of the
+			// DNN, if configured
+			request := m.GsmMessage.PDUSessionEstablishmentRequest
+			selection, rejection := selectSession(dnn, snssai, request)
+			if rejection != nil {
+				sendPDUSessionEstablishmentReject(ue, pduSessionID, request.GetPTI(), rejection)
+				return
+			}
+			pduSession, err := ue.CreatePDUSession(int64(pduSessionID), ngapConvert.SNssaiToNgap(snssai))
+			if err != nil {
+				logger.MainLog.Error("Error %v", err)
+				return
+			}
+			pduSession.Dnn = dnn
+			if selection != nil && !applySession(ue, pduSession, selection) {
+				ue.DeletePDUSession(pduSession.Id)
+				sendPDUSessionEstablishmentReject(ue, pduSessionID, request.GetPTI(), &sessionRejection{
+					cause5GSM: nasMessage.Cause5GSMInsufficientResources,
+					backoff:   selection.policy.Backoff,
+					reason:    fmt.Sprintf("address pool of DNN %s exhausted", selection.policy.Name),
+				})
+				return
+			}
+			pkt, err := BuildPDUSessionResourceSetupRequest(ue, pduSessionID)
+			if err != nil {
+				logger.MainLog.Error("Error %v", err)
+				return
+			}
+			pduSession.SetupStartTime = time.Now()
+			_, err = SendData(ue.SCTPConn(), pkt, "Server")
+			if err != nil {
+				logger.MainLog.Error("Error %v", err)
+			}
+		case lib_nas.MsgTypePDUSessionReleaseRequest:
+			pkt, err := BuildPDUSessionResourceReleaseCommand(ue, pduSessionID, nasMessage.Cause5GSMRegularDeactivation)
+			if err == nil {
+				SendData(ue.SCTPConn(), pkt, "Server")
+			}
+		case lib_nas.MsgTypePDUSessionReleaseComplete:
+			// !!! client send !!!
+			SendDeregistrationRequest(ue, 1)
+		case lib_nas.MsgTypePDUSessionModificationComplete, lib_nas.MsgTypePDUSessionModificationCommandReject:
+			logger.MainLog.Info("[%s] PDU Session[ID:%d] %s", ue.LogTag("NAS"), pduSessionID,
+				util.NasMessageTypeName(messageType))
+		case lib_nas.MsgTypeStatus5GSM:
+			handleStatus5GSM(ue, m.GsmMessage.Status5GSM)
+		}
+	}
+}
+
+// gmmEvent drives the 5GMM state machine of the UE, logging the events not allowed in its current state
+func gmmEvent(ue *context.UEContext, event fsm.Event) {
+	if err := ue.SendGmmEvent(event); err != nil {
+		logger.MainLog.Warn("[%s] 5GMM %+v", ue.LogTag("NAS"), err)
+	}
+}
+
+// cmEvent drives the CM state machine of the UE
+func cmEvent(ue *context.UEContext, event fsm.Event) {
+	if err := ue.SendCmEvent(event); err != nil {
+		logger.MainLog.Warn("[%s] CM %+v", ue.LogTag("NGAP"), err)
+	}
+}
+
+func SendDeregistrationRequest(ue *context.UEContext, switchOff uint8) {
+	nasMsg, err := BuildDeregistrationRequest(ue, switchOff, false)
+	if err != nil {
+		logger.MainLog.Error(err.Error())
+		return
+	}
+
+	SendUplinkNASTransport(ue.CurrentAMF, ue, nasMsg)
+}
+
+func SendUplinkNASTransport(amf *context.AMFContext, ue *context.UEContext, nasPdu []byte) {
+	if len(nasPdu) == 0 {
+		logger.MainLog.Error("NAS Pdu is nil")
+		return
+	}
+
+	pkt, err := BuildUplinkNASTransport(ue, nasPdu)
+	if err != nil {
+		logger.MainLog.Error("Build Uplink NAS Transport failed : %+v", err)
+		return
+	}
+
+	SendToAmf(amf, pkt)
+}
+
+func handleInitialContextSetupResponse(agf *context.AGFContext, pdu *ngapType.NGAPPDU) {
+	var aMFUENGAPID *ngapType.AMFUENGAPID
+	var rANUENGAPID *ngapType.RANUENGAPID
+	var failedListCxtRes *ngapType.PDUSessionResourceFailedToSetupListCxtRes
+
+	initialContextSetupRsp := pdu.SuccessfulOutcome.Value.InitialContextSetupResponse
+	for i := 0; i < len(initialContextSetupRsp.ProtocolIEs.List); i++ {
+		ie := initialContextSetupRsp.ProtocolIEs.List[i]
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDAMFUENGAPID:
+			aMFUENGAPID = ie.Value.AMFUENGAPID
+		case ngapType.ProtocolIEIDRANUENGAPID:
+			rANUENGAPID = ie.Value.RANUENGAPID
+		case ngapType.ProtocolIEIDPDUSessionResourceFailedToSetupListCxtRes:
+			failedListCxtRes = ie.Value.PDUSessionResourceFailedToSetupListCxtRes
+		}
+	}
+
+	ue := findUEContext(agf, aMFUENGAPID, rANUENGAPID)
+	if ue == nil {
+		return
+	}
+	// the user plane of the PDU sessions the AGF failed to set up is not re-established
+	if failedListCxtRes != nil {
+		for _, item := range failedListCxtRes.List {
+			logger.MainLog.Warn("[%s] PDU Session[ID:%d] user plane not re-established", ue.LogTag("NGAP"),
+				item.PDUSessionID.Value)
+			if item.PDUSessionID.Value > 0 && item.PDUSessionID.Value < 16 {
+				ue.PduSessionReactivationResult[item.PDUSessionID.Value] = true
+			}
+		}
+	}
+	sendRegistrationAccept(ue)
+}
+
+// allocateRegistration allocates the 5G-GUTI and registration area given to the UE in the Registration Accept
+//
+// TS 23.502 4.2.2.2.2 General Registration
+func allocateRegistration(ue *context.UEContext) {
+	if err := ue.CurrentAMF.AllocateGuti(ue); err != nil {
+		logger.MainLog.Warn("[%s] Allocate 5G-GUTI failed: %+v", ue.LogTag("NAS"), err)
+	}
+
+	// the registration area is made of the tracking areas supported by the AGF, at most 16 in a TAI list
+	ue.TAIList = nil
+	if ue.AGF != nil && ue.AGF.SupportedTAList != nil {
+		for _, supportedTAItem := range ue.AGF.SupportedTAList.List {
+			for _, broadcastPLMNItem := range supportedTAItem.BroadcastPLMNList.List {
+				if len(ue.TAIList) == 16 {
+					break
+				}
+				plmnId := ngapConvert.PlmnIdToModels(broadcastPLMNItem.PLMNIdentity)
+				ue.TAIList = append(ue.TAIList, models.Tai{
+					PlmnId: &plmnId,
+					Tac:    hex.EncodeToString(supportedTAItem.TAC.Value),
+				})
+			}
+		}
+	}
+
+}
+
+func handlePDUSessionResourceSetupResponse(agf *context.AGFContext, pdu *ngapType.NGAPPDU) {
+	var aMFUENGAPID *ngapType.AMFUENGAPID
+	var rANUENGAPID *ngapType.RANUENGAPID
+	var pDUSessionResourceSetupListSURes *ngapType.PDUSessionResourceSetupListSURes
+	var pDUSessionResourceFailedToSetupListSURes *ngapType.PDUSessionResourceFailedToSetupListSURes
+
+	pDUSessionResourceSetupResponse := pdu.SuccessfulOutcome.Value.PDUSessionResourceSetupResponse
+	if pDUSessionResourceSetupResponse == nil {
+		logger.MainLog.Error("PDUSessionResourceSetupResponse is nil")
+		return
+	}
+	for i := 0; i < len(pDUSessionResourceSetupResponse.ProtocolIEs.List); i++ {
+		ie := pDUSessionResourceSetupResponse.ProtocolIEs.List[i]
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDAMFUENGAPID:
+			aMFUENGAPID = ie.Value.AMFUENGAPID
+		case ngapType.ProtocolIEIDRANUENGAPID:
+			rANUENGAPID = ie.Value.RANUENGAPID
+		case ngapType.ProtocolIEIDPDUSessionResourceSetupListSURes:
+			pDUSessionResourceSetupListSURes = ie.Value.PDUSessionResourceSetupListSURes
+		case ngapType.ProtocolIEIDPDUSessionResourceFailedToSetupListSURes:
+			pDUSessionResourceFailedToSetupListSURes = ie.Value.PDUSessionResourceFailedToSetupListSURes
+		}
+	}
+
+	ue := findUEContext(agf, aMFUENGAPID, rANUENGAPID)
+	if ue == nil {
+		return
+	}
+	if pDUSessionResourceSetupListSURes != nil {
+		for _, item := range pDUSessionResourceSetupListSURes.List {
+			if pduSession := ue.FindPDUSession(item.PDUSessionID.Value); pduSession != nil {
+				metrics.ObserveProcedure(metrics.ProcedurePDUSessionResourceSetup, pduSession.SetupStartTime)
+				pduSession.SetupStartTime = time.Time{}
+			}
+			ue.StorePDUSessionExtendedStateCause(item.PDUSessionID.Value, context.PDUSessionStateEstablished, "")
+			event.Publish(ue, event.Event{Type: event.PDUSessionEstablished, PDUSessionID: item.PDUSessionID.Value})
+		}
+	}
+	if pDUSessionResourceFailedToSetupListSURes != nil {
+		for _, item := range pDUSessionResourceFailedToSetupListSURes.List {
+			if pduSession := ue.FindPDUSession(item.PDUSessionID.Value); pduSession != nil {
+				metrics.ObserveProcedure(metrics.ProcedurePDUSessionResourceSetup, pduSession.SetupStartTime)
+			}
+			if err := ue.DeletePDUSession(item.PDUSessionID.Value); err != nil {
+				logger.MainLog.Warn("Error %v", err)
+			}
+			ue.StorePDUSessionExtendedStateCause(item.PDUSessionID.Value, context.PDUSessionStateEstablishmentFailed, "")
+			event.Publish(ue, event.Event{Type: event.PDUSessionEstablishmentFailed, PDUSessionID: item.PDUSessionID.Value})
+		}
+	}
+}
+
+func handlePDUSessionResourceModifyResponse(agf *context.AGFContext, pdu *ngapType.NGAPPDU) {
+	var aMFUENGAPID *ngapType.AMFUENGAPID
+	var rANUENGAPID *ngapType.RANUENGAPID
+	var pDUSessionResourceFailedToModifyListModRes *ngapType.PDUSessionResourceFailedToModifyListModRes
+
+	pDUSessionResourceModifyResponse := pdu.SuccessfulOutcome.Value.PDUSessionResourceModifyResponse
+	if pDUSessionResourceModifyResponse == nil {
+		logger.MainLog.Error("PDUSessionResourceModifyResponse is nil")
+		return
+	}
+	for i := 0; i < len(pDUSessionResourceModifyResponse.ProtocolIEs.List); i++ {
+		ie := pDUSessionResourceModifyResponse.ProtocolIEs.List[i]
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDAMFUENGAPID:
+			aMFUENGAPID = ie.Value.AMFUENGAPID
+		case ngapType.ProtocolIEIDRANUENGAPID:
+			rANUENGAPID = ie.Value.RANUENGAPID
+		case ngapType.ProtocolIEIDPDUSessionResourceFailedToModifyListModRes:
+			pDUSessionResourceFailedToModifyListModRes = ie.Value.PDUSessionResourceFailedToModifyListModRes
+		}
+	}
+
+	ue := findUEContext(agf, aMFUENGAPID, rANUENGAPID)
+	if ue == nil {
+		return
+	}
+	if pDUSessionResourceFailedToModifyListModRes != nil {
+		for _, item := range pDUSessionResourceFailedToModifyListModRes.List {
+			logger.MainLog.Warn("%s PDU Session[ID:%d] failed to modify", ue.LogTag("NGAP"), item.PDUSessionID.Value)
+		}
+	}
+}
+
+func handlePDUSessionResourceReleaseResponse(agf *context.AGFContext, pdu *ngapType.NGAPPDU) {
+	var aMFUENGAPID *ngapType.AMFUENGAPID
+	var rANUENGAPID *ngapType.RANUENGAPID
+	var pDUSessionResourceReleasedListRelRes *ngapType.PDUSessionResourceReleasedListRelRes
+
+	pDUSessionResourceReleaseResponse := pdu.SuccessfulOutcome.Value.PDUSessionResourceReleaseResponse
+	if pDUSessionResourceReleaseResponse == nil {
+		logger.MainLog.Error("PDUSessionResourceReleaseResponse is nil")
+		return
+	}
+	for i := 0; i < len(pDUSessionResourceReleaseResponse.ProtocolIEs.List); i++ {
+		ie := pDUSessionResourceReleaseResponse.ProtocolIEs.List[i]
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDAMFUENGAPID:
+			aMFUENGAPID = ie.Value.AMFUENGAPID
+		case ngapType.ProtocolIEIDRANUENGAPID:
+			rANUENGAPID = ie.Value.RANUENGAPID
+		case ngapType.ProtocolIEIDPDUSessionResourceReleasedListRelRes:
+			pDUSessionResourceReleasedListRelRes = ie.Value.PDUSessionResourceReleasedListRelRes
+		}
+	}
+
+	ue := findUEContext(agf, aMFUENGAPID, rANUENGAPID)
+	if ue == nil {
+		return
+	}
+	if pDUSessionResourceReleasedListRelRes != nil {
+		for _, item := range pDUSessionResourceReleasedListRelRes.List {
+			if err := ue.DeletePDUSession(item.PDUSessionID.Value); err != nil {
+				logger.MainLog.Warn("Error %v", err)
+			}
+			event.Publish(ue, event.Event{Type: event.PDUSessionReleased, PDUSessionID: item.PDUSessionID.Value})
+		}
+	}
+}
+
+func handleUEContextReleaseRequest(agf *context.AGFContext, pdu *ngapType.NGAPPDU) {
+	var aMFUENGAPID *ngapType.AMFUENGAPID
+	var rANUENGAPID *ngapType.RANUENGAPID
+	var cause *ngapType.Cause
+
+	uEContextReleaseRequest := pdu.InitiatingMessage.Value.UEContextReleaseRequest
+	if uEContextReleaseRequest == nil {
+		logger.MainLog.Error("UEContextReleaseRequest is nil")
+		return
+	}
+	for i := 0; i < len(uEContextReleaseRequest.ProtocolIEs.List); i++ {
+		ie := uEContextReleaseRequest.ProtocolIEs.List[i]
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDAMFUENGAPID:
+			aMFUENGAPID = ie.Value.AMFUENGAPID
+		case ngapType.ProtocolIEIDRANUENGAPID:
+			rANUENGAPID = ie.Value.RANUENGAPID
+		case ngapType.ProtocolIEIDCause:
+			cause = ie.Value.Cause
+		}
+	}
+
+	ue := findUEContext(agf, aMFUENGAPID, rANUENGAPID)
+	if ue == nil {
+		return
+	}
+	if cause == nil {
+		logger.MainLog.Error("Missing Cause")
+		return
+	}
+	pkt, err := BuildUEContextReleaseCommand(ue, *cause)
+	if err != nil {
+		logger.MainLog.Error("Error %v", err)
+		return
+	}
+	_, err = SendData(ue.SCTPConn(), pkt, "Server")
+	if err != nil {
+		logger.MainLog.Error("Error %v", err)
+	}
+}
+
+func handleUEContextReleaseComplete(agf *context.AGFContext, pdu *ngapType.NGAPPDU) {
+	var aMFUENGAPID *ngapType.AMFUENGAPID
+	var rANUENGAPID *ngapType.RANUENGAPID
+
+	uEContextReleaseComplete := pdu.SuccessfulOutcome.Value.UEContextReleaseComplete
+	if uEContextReleaseComplete == nil {
+		logger.MainLog.Error("UEContextReleaseComplete is nil")
+		return
+	}
+	for i := 0; i < len(uEContextReleaseComplete.ProtocolIEs.List); i++ {
+		ie := uEContextReleaseComplete.ProtocolIEs.List[i]
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDAMFUENGAPID:
+			aMFUENGAPID = ie.Value.AMFUENGAPID
+		case ngapType.ProtocolIEIDRANUENGAPID:
+			rANUENGAPID = ie.Value.RANUENGAPID
+		}
+	}
+
+	ue := findUEContext(agf, aMFUENGAPID, rANUENGAPID)
+	if ue == nil {
+		return
+	}
+	releaseUEContext(agf, ue)
+}
+
+func handleNGResetAcknowledge(agf *context.AGFContext, pdu *ngapType.NGAPPDU) {
+	var uEAssociatedLogicalNGConnectionList *ngapType.UEAssociatedLogicalNGConnectionList
+
+	nGResetAcknowledge := pdu.SuccessfulOutcome.Value.NGResetAcknowledge
+	if nGResetAcknowledge == nil {
+		logger.MainLog.Error("NGResetAcknowledge is nil")
+		return
+	}
+	for i := 0; i < len(nGResetAcknowledge.ProtocolIEs.List); i++ {
+		ie := nGResetAcknowledge.ProtocolIEs.List[i]
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDUEAssociatedLogicalNGConnectionList:
+			uEAssociatedLogicalNGConnectionList = ie.Value.UEAssociatedLogicalNGConnectionList
+		}
+	}
+
+	// NG interface reset as a whole
+	// the UEs are released by their own workers
+	if uEAssociatedLogicalNGConnectionList == nil {
+		agf.RangeUEContext(func(ue *context.UEContext) bool {
+			dispatchUE(ue, func() { releaseUEContext(agf, ue) })
+			return true
+		})
+		return
+	}
+
+	for _, item := range uEAssociatedLogicalNGConnectionList.List {
+		if item.AMFUENGAPID != nil {
+			if ue := findUEContext(agf, item.AMFUENGAPID, nil); ue != nil {
+				dispatchUE(ue, func() { releaseUEContext(agf, ue) })
+			}
+		} else if item.RANUENGAPID != nil {
+			if ue, ok := agf.LoadUEContextRANUENGAPID(item.RANUENGAPID.Value); ok {
+				dispatchUE(ue, func() { releaseUEContext(agf, ue) })
+			}
+		}
+	}
+}
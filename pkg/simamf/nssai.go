@@ -0,0 +1,78 @@
+package simamf
+
+import (
+	"free5gc/lib/ngap/ngapConvert"
+	"free5gc/lib/openapi/models"
+	"sim-amf/pkg/context"
+	"sim-amf/pkg/logger"
+)
+
+// cause5GMMNoNetworkSlicesAvailable is the 5GMM cause #62 of TS 24.501 9.11.3.2, missing in free5gc/lib/nas
+const cause5GMMNoNetworkSlicesAvailable uint8 = 0x3e
+
+// selectNssai computes the network slices of the UE from the subscribed NSSAI of its Subscriber: the Configured NSSAI
+// of the subscribed S-NSSAIs supported in the PLMN, the Allowed NSSAI of the requested S-NSSAIs available in the
+// registration area, or of the default subscribed S-NSSAIs if none is, and the Rejected NSSAI of the other requested
+// S-NSSAIs. It returns false if no S-NSSAI is allowed to the UE.
+//
+// TS 23.501 5.15.5.2.1 Registration to a set of Network Slices
+func selectNssai(ue *context.UEContext) bool {
+	ue.SubscribedNssai = ue.Subscriber.SubscribedNssai
+
+	supportedNssai := supportedSnssais(ue.CurrentAMF)
+	availableNssai := registrationAreaSnssais(ue.CurrentAMF, ue.AGF)
+	ue.ConfiguredNssai = nil
+	for _, subscribedSnssai := range ue.SubscribedNssai {
+		snssai := *subscribedSnssai.SubscribedSnssai
+		if containsSnssai(supportedNssai, snssai) && !containsSnssai(ue.ConfiguredNssai, snssai) {
+			ue.ConfiguredNssai = append(ue.ConfiguredNssai, snssai)
+		}
+	}
+
+	ue.AllowedNssai = nil
+	ue.RejectedNssaiInPlmn = nil
+	ue.RejectedNssaiInTai = nil
+	for _, snssai := range ue.RequestedNssai {
+		switch {
+		case !containsSnssai(ue.ConfiguredNssai, snssai):
+			ue.RejectedNssaiInPlmn = append(ue.RejectedNssaiInPlmn, snssai)
+		case !containsSnssai(availableNssai, snssai):
+			ue.RejectedNssaiInTai = append(ue.RejectedNssaiInTai, snssai)
+		case len(ue.AllowedNssai) < 8 && !containsSnssai(ue.AllowedNssai, snssai):
+			ue.AllowedNssai = append(ue.AllowedNssai, snssai)
+		}
+	}
+	if len(ue.AllowedNssai) == 0 {
+		for _, subscribedSnssai := range ue.SubscribedNssai {
+			snssai := *subscribedSnssai.SubscribedSnssai
+			if subscribedSnssai.DefaultIndication && len(ue.AllowedNssai) < 8 &&
+				containsSnssai(ue.ConfiguredNssai, snssai) && containsSnssai(availableNssai, snssai) {
+				ue.AllowedNssai = append(ue.AllowedNssai, snssai)
+			}
+		}
+	}
+	if len(ue.AllowedNssai) == 0 {
+		logger.MainLog.Warn("[%s] No S-NSSAI allowed, requested %v", ue.LogTag("NAS"), ue.RequestedNssai)
+		return false
+	}
+	return true
+}
+
+// registrationAreaSnssais returns the S-NSSAIs supported in the tracking areas of the AGF, or the ones supported by
+// the AMF in the PLMN if the AGF is unknown
+func registrationAreaSnssais(amf *context.AMFContext, agf *context.AGFContext) (snssais []models.Snssai) {
+	if agf == nil || agf.SupportedTAList == nil {
+		return supportedSnssais(amf)
+	}
+	for _, supportedTAItem := range agf.SupportedTAList.List {
+		for _, broadcastPLMNItem := range supportedTAItem.BroadcastPLMNList.List {
+			for _, sliceSupportItem := range broadcastPLMNItem.TAISliceSupportList.List {
+				snssai := ngapConvert.SNssaiToModels(sliceSupportItem.SNSSAI)
+				if !containsSnssai(snssais, snssai) {
+					snssais = append(snssais, snssai)
+				}
+			}
+		}
+	}
+	return snssais
+}
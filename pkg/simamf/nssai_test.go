@@ -0,0 +1,133 @@
+package simamf
+
+import (
+	"reflect"
+	"testing"
+
+	"free5gc/lib/ngap/ngapConvert"
+	"free5gc/lib/ngap/ngapType"
+	"free5gc/lib/openapi/models"
+	"sim-amf/pkg/context"
+)
+
+func TestSelectNssai(t *testing.T) {
+	var (
+		embb      = models.Snssai{Sst: 1}
+		embbSlice = models.Snssai{Sst: 1, Sd: "112233"}
+		urllc     = models.Snssai{Sst: 2}
+		miot      = models.Snssai{Sst: 3}
+	)
+	sliceSupportList := func(snssais ...models.Snssai) (list ngapType.SliceSupportList) {
+		for _, snssai := range snssais {
+			list.List = append(list.List, ngapType.SliceSupportItem{SNSSAI: ngapConvert.SNssaiToNgap(snssai)})
+		}
+		return list
+	}
+	subscribed := func(snssai models.Snssai, defaultIndication bool) models.SubscribedSnssai {
+		return models.SubscribedSnssai{SubscribedSnssai: &snssai, DefaultIndication: defaultIndication}
+	}
+
+	amf, agf := new(context.AMFContext), new(context.AGFContext)
+	amf.PlmnSupportList = &ngapType.PLMNSupportList{
+		List: []ngapType.PLMNSupportItem{{SliceSupportList: sliceSupportList(embb, embbSlice, urllc)}},
+	}
+	agf.SupportedTAList = &ngapType.SupportedTAList{
+		List: []ngapType.SupportedTAItem{{BroadcastPLMNList: ngapType.BroadcastPLMNList{
+			List: []ngapType.BroadcastPLMNItem{{TAISliceSupportList: sliceSupportList(embb, embbSlice)}},
+		}}},
+	}
+	subscribedNssai := []models.SubscribedSnssai{
+		subscribed(embb, true),
+		subscribed(embbSlice, false),
+		subscribed(urllc, false),
+		subscribed(miot, false),
+	}
+	configured := []models.Snssai{embb, embbSlice, urllc}
+
+	tests := []struct {
+		name            string
+		subscribedNssai []models.SubscribedSnssai
+		unknownAGF      bool
+		requested       []models.Snssai
+		allowed         []models.Snssai
+		rejectedInPlmn  []models.Snssai
+		rejectedInTai   []models.Snssai
+		ok              bool
+	}{
+		{name: "none requested", allowed: []models.Snssai{embb}, ok: true},
+		{name: "requested", requested: []models.Snssai{embbSlice}, allowed: []models.Snssai{embbSlice}, ok: true},
+		{
+			name:          "not available in the registration area",
+			requested:     []models.Snssai{urllc},
+			allowed:       []models.Snssai{embb},
+			rejectedInTai: []models.Snssai{urllc},
+			ok:            true,
+		},
+		{
+			name:           "not supported in the PLMN",
+			requested:      []models.Snssai{miot},
+			allowed:        []models.Snssai{embb},
+			rejectedInPlmn: []models.Snssai{miot},
+			ok:             true,
+		},
+		{
+			name:           "allowed and rejected",
+			requested:      []models.Snssai{embbSlice, urllc, miot, embbSlice},
+			allowed:        []models.Snssai{embbSlice},
+			rejectedInPlmn: []models.Snssai{miot},
+			rejectedInTai:  []models.Snssai{urllc},
+			ok:             true,
+		},
+		{
+			name:       "unknown AGF",
+			unknownAGF: true,
+			requested:  []models.Snssai{urllc},
+			allowed:    []models.Snssai{urllc},
+			ok:         true,
+		},
+		{
+			name:            "no default subscribed S-NSSAI",
+			subscribedNssai: []models.SubscribedSnssai{subscribed(embb, false)},
+			requested:       []models.Snssai{miot},
+			rejectedInPlmn:  []models.Snssai{miot},
+		},
+		{
+			name:            "default subscribed S-NSSAI not available",
+			subscribedNssai: []models.SubscribedSnssai{subscribed(urllc, true)},
+		},
+	}
+	for _, tt := range tests {
+		ue := new(context.UEContext)
+		ue.CurrentAMF = amf
+		if !tt.unknownAGF {
+			ue.AGF = agf
+		}
+		ue.Subscriber = &context.Subscriber{SubscribedNssai: subscribedNssai}
+		wantConfigured := configured
+		if tt.subscribedNssai != nil {
+			ue.Subscriber.SubscribedNssai = tt.subscribedNssai
+			wantConfigured = nil
+			for _, s := range tt.subscribedNssai {
+				wantConfigured = append(wantConfigured, *s.SubscribedSnssai)
+			}
+		}
+		ue.RequestedNssai = tt.requested
+
+		if ok := selectNssai(ue); ok != tt.ok {
+			t.Errorf("%s: selectNssai() = %v, want %v", tt.name, ok, tt.ok)
+		}
+		if !reflect.DeepEqual(ue.ConfiguredNssai, wantConfigured) {
+			t.Errorf("%s: Configured NSSAI = %v, want %v", tt.name, ue.ConfiguredNssai, wantConfigured)
+		}
+		if !reflect.DeepEqual(ue.AllowedNssai, tt.allowed) {
+			t.Errorf("%s: Allowed NSSAI = %v, want %v", tt.name, ue.AllowedNssai, tt.allowed)
+		}
+		if !reflect.DeepEqual(ue.RejectedNssaiInPlmn, tt.rejectedInPlmn) {
+			t.Errorf("%s: Rejected NSSAI in the PLMN = %v, want %v", tt.name, ue.RejectedNssaiInPlmn,
+				tt.rejectedInPlmn)
+		}
+		if !reflect.DeepEqual(ue.RejectedNssaiInTai, tt.rejectedInTai) {
+			t.Errorf("%s: Rejected NSSAI in the TA = %v, want %v", tt.name, ue.RejectedNssaiInTai, tt.rejectedInTai)
+		}
+	}
+}
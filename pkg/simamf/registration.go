@@ -0,0 +1,368 @@
+package simamf
+
+import (
+	"fmt"
+	"time"
+
+	lib_nas "free5gc/lib/nas"
+	"free5gc/lib/nas/nasConvert"
+	"free5gc/lib/nas/nasMessage"
+	"free5gc/lib/nas/nasType"
+	"free5gc/lib/ngap/ngapType"
+	"sim-amf/pkg/conformance"
+	"sim-amf/pkg/context"
+	"sim-amf/pkg/event"
+	"sim-amf/pkg/logger"
+	"sim-amf/pkg/metrics"
+	"sim-amf/pkg/nas"
+	"sim-amf/pkg/suci"
+	"sim-amf/pkg/types"
+	"sim-amf/pkg/util"
+)
+
+// handleRegistrationRequest handles a Registration Request received in an Initial UE Message. A mobility or periodic
+// registration update resolves the registered UE by its 5G-GUTI and reuses its NAS security context and PDU sessions
+// once the request passes the integrity check with it, an initial registration or a UE without NAS security context
+// starts with the Security Mode Command. A 5G-RG running its own NAS is identified by the SUPI deconcealed from its
+// SUCI and authenticated with 5G AKA, unless its NAS security context is reused.
+//
+// TS 24.501 5.5.1.2 Registration procedure for initial registration, 5.5.1.3 Registration procedure for mobility and
+// periodic registration update, TS 23.316 7.2.1 Registration Management procedures
+func handleRegistrationRequest(agf *context.AGFContext, ue *context.UEContext,
+	registrationRequest *nasMessage.RegistrationRequest, securityHeaderType uint8, nasPdu []byte,
+	userLocationInformation *ngapType.UserLocationInformation) {
+	registrationType := registrationRequest.NgksiAndRegistrationType5GS.GetRegistrationType5GS()
+	guti := registrationGUTI(registrationRequest.MobileIdentity5GS)
+	registered, _ := context.LoadSetUEContextGUTI(guti)
+	ue.RGType = registrationRGType(registrationRequest.MobileIdentity5GS)
+	switch {
+	case registrationType != nasMessage.RegistrationType5GSMobilityRegistrationUpdating &&
+		registrationType != nasMessage.RegistrationType5GSPeriodicRegistrationUpdating:
+		// the context of the previous registration is replaced, removed on its shard which hands its RG type back
+		if registered != nil {
+			conn := ue
+			dispatchUE(registered, func() {
+				logger.MainLog.Info("[%s] Remove UE Context[AmfUeNgapID: %d] of 5G-GUTI %s on initial registration",
+					registered.LogTag("NAS"), registered.AmfUeNgapId, guti)
+				rgType := registered.RGType
+				registered.Remove()
+				dispatchUE(conn, func() {
+					conn.RGType = rgType
+					continueRegistration(conn, registrationRequest, securityHeaderType)
+				})
+			})
+			return
+		}
+	case registered != nil:
+		// the registered UE is resumed on its shard once the Initial UE Message is handled on the shard of the NG
+		// connection context created for it
+		conn := ue
+		dispatchUE(conn, func() {
+			dispatchUE(registered, func() {
+				resumeRegistration(registered, conn, guti, registrationRequest, securityHeaderType, nasPdu,
+					userLocationInformation)
+			})
+		})
+		return
+	case guti != "":
+		// the 5G-GUTI is unknown, e.g. sim-amf restarted, and the UE registers again with an initial registration
+		logger.MainLog.Warn("[%s] Unknown 5G-GUTI %s in registration update", ue.LogTag("NAS"), guti)
+		rejectRegistration(ue, nasMessage.Cause5GMMUEIdentityCannotBeDerivedByTheNetwork)
+		return
+	}
+	continueRegistration(ue, registrationRequest, securityHeaderType)
+}
+
+// resumeRegistration resumes the registered UE with the NG connection of its mobility or periodic registration update
+// and continues the registration, on the shard of the registered UE. The NG connection context created by the Initial
+// UE Message is dropped. The NAS PDU of the Registration Request, decoded without NAS security context on the NG
+// connection, is integrity checked with the NAS security context of the registered UE.
+//
+// TS 24.501 4.4.4.3 Integrity checking of NAS signalling messages in the AMF
+func resumeRegistration(registered *context.UEContext, conn *context.UEContext, guti string,
+	registrationRequest *nasMessage.RegistrationRequest, securityHeaderType uint8, nasPdu []byte,
+	userLocationInformation *ngapType.UserLocationInformation) {
+	if current, _ := context.LoadSetUEContextGUTI(guti); current != registered {
+		// the UE context was removed meanwhile, e.g. deregistered
+		dispatchUE(conn, func() {
+			logger.MainLog.Warn("[%s] Unknown 5G-GUTI %s in registration update", conn.LogTag("NAS"), guti)
+			rejectRegistration(conn, nasMessage.Cause5GMMUEIdentityCannotBeDerivedByTheNetwork)
+		})
+		return
+	}
+	if registered.AGF != nil {
+		// the NG connection of the UE is stale, e.g. the AGF restarted
+		logger.MainLog.Warn("[%s] Release stale NG connection[AmfUeNgapID: %d, RanUeNgapID: %d]",
+			registered.LogTag("NGAP"), registered.AmfUeNgapId, registered.RanUeNgapId)
+		if agf, ok := registered.AGF.AMF.LoadAGFContextSCTPAddr(registered.AGF.SCTPAddr); ok && agf == registered.AGF {
+			sendUEContextReleaseCommand(registered, ngapType.CauseNasPresentNormalRelease)
+		}
+	}
+	registered.ResumeNGConnection(conn)
+	recordUserLocation(registered, util.NgapProcedureName(ngapType.ProcedureCodeInitialUEMessage),
+		userLocationInformation, nil, false)
+	cmEvent(registered, context.CmEventConnected)
+	if registered.SecurityContextAvailable && securityHeaderType != lib_nas.SecurityHeaderTypePlainNas &&
+		!nas.CheckIntegrity(registered, nasPdu) {
+		logger.MainLog.Warn("[%s] Registration Request failed the integrity check, NAS security context not reused",
+			registered.LogTag("NAS"))
+		conformance.Global.ReportNAS(registered, util.NasMessageTypeName(lib_nas.MsgTypeRegistrationRequest),
+			conformance.RuleNASIntegrity, "MAC verification failed")
+	}
+	continueRegistration(registered, registrationRequest, securityHeaderType)
+}
+
+// continueRegistration handles the Registration Request once the UE context it is handled with is resolved
+func continueRegistration(ue *context.UEContext, registrationRequest *nasMessage.RegistrationRequest,
+	securityHeaderType uint8) {
+	registrationType := registrationRequest.NgksiAndRegistrationType5GS.GetRegistrationType5GS()
+	ue.RegistrationStartTime = time.Now()
+	ue.RegistrationType = registrationType
+	ue.FollowOnRequest = registrationRequest.NgksiAndRegistrationType5GS.GetFOR()
+	ue.UpdateMobileIdentity(registrationRequest.MobileIdentity5GS)
+	if ue.RGType == types.RGType_FIVEG_RG {
+		if ue.IdentityType == nasMessage.MobileIdentity5GSTypeSuci {
+			supi, err := suci.ToSupi(ue.Suci, context.AMFSelf.HomeNetworkKeys)
+			if err != nil {
+				logger.MainLog.Warn("[%s] SUCI deconcealment failed: %v", ue.LogTag("NAS"), err)
+				rejectRegistration(ue, nasMessage.Cause5GMMIllegalUE)
+				return
+			}
+			ue.Supi = supi
+		}
+		if registrationRequest.UESecurityCapability != nil {
+			ue.NasUESecurityCapability = registrationRequest.UESecurityCapability
+		}
+	} else if ue.IdentityType == nasMessage.MobileIdentity5GSTypeSuci {
+		// the SUCI of GLI or GCI of an FN-RG is not concealed, e.g. gci-<GCI>@<realm>
+		if supi, err := suci.ToSupi(ue.Suci, nil); err == nil {
+			ue.Supi = supi
+		}
+	}
+	if registrationRequest.RequestedNSSAI != nil {
+		ue.RequestedNssai = nasConvert.RequestedNssaiToModels(registrationRequest.RequestedNSSAI)
+	}
+	if cause5GMM := authorizeRegistration(ue); cause5GMM != 0 {
+		rejectRegistration(ue, cause5GMM)
+		return
+	}
+	updatePDUSessionStatus(ue, registrationRequest)
+
+	// the Registration Request of a registered UE which passed the integrity check with its current NAS security
+	// context keeps it, the W-AGF getting the Kwagf derived from the uplink NAS COUNT of the request
+	if ue.Registered() && securityHeaderType != lib_nas.SecurityHeaderTypePlainNas &&
+		!(ue.SecurityContextAvailable && ue.MacFailed) {
+		if len(ue.Kamf) > 0 {
+			ue.DerivateAnKey()
+		}
+		pkt, err := BuildInitialContextSetupRequest(ue, nil)
+		if err != nil {
+			logger.MainLog.Error("Error %v", err)
+			return
+		}
+		if _, err = SendData(ue.SCTPConn(), pkt, "Server"); err != nil {
+			logger.MainLog.Error("Error %v", err)
+		}
+		return
+	}
+	if ue.RGType == types.RGType_FIVEG_RG {
+		if err := startAuthentication(ue); err != nil {
+			logger.MainLog.Warn("[%s] Authentication failed: %v", ue.LogTag("NAS"), err)
+			rejectRegistration(ue, nasMessage.Cause5GMMIllegalUE)
+		}
+		return
+	}
+	sendSecurityModeCommand(ue)
+}
+
+// handleRegistrationUpdate handles a Registration Request of a mobility or periodic registration update received on
+// the NG connection of the UE, accepted at once with its current NAS security context and user plane
+//
+// TS 24.501 5.5.1.3 Registration procedure for mobility and periodic registration update
+func handleRegistrationUpdate(ue *context.UEContext, registrationRequest *nasMessage.RegistrationRequest) {
+	registrationType := registrationRequest.NgksiAndRegistrationType5GS.GetRegistrationType5GS()
+	if registrationType != nasMessage.RegistrationType5GSMobilityRegistrationUpdating &&
+		registrationType != nasMessage.RegistrationType5GSPeriodicRegistrationUpdating {
+		logger.MainLog.Error("[%s] Unexpected registration type %d on NG connection", ue.LogTag("NAS"),
+			registrationType)
+		return
+	}
+	ue.StopNASTimers()
+	ue.RegistrationStartTime = time.Now()
+	ue.RegistrationType = registrationType
+	// the NG connection was not established for the registration update and is kept
+	ue.FollowOnRequest = nasMessage.FollowOnRequestPending
+	if registrationRequest.RequestedNSSAI != nil {
+		ue.RequestedNssai = nasConvert.RequestedNssaiToModels(registrationRequest.RequestedNSSAI)
+	}
+	if cause5GMM := authorizeRegistration(ue); cause5GMM != 0 {
+		rejectRegistration(ue, cause5GMM)
+		return
+	}
+	updatePDUSessionStatus(ue, registrationRequest)
+	sendRegistrationAccept(ue)
+}
+
+// authorizeRegistration resolves the subscription data and network slices of the UE, returning the 5GMM cause the
+// registration is rejected with, or 0: #3 illegal UE for a UE unknown in the subscriber database, #7 5GS services not
+// allowed for a barred subscriber and #62 no network slices available
+func authorizeRegistration(ue *context.UEContext) uint8 {
+	subscriber := context.AMFSelf.FindSubscriber(ue)
+	switch {
+	case subscriber == nil:
+		logger.MainLog.Warn("[%s] Unknown subscriber", ue.LogTag("NAS"))
+		return nasMessage.Cause5GMMIllegalUE
+	case subscriber.Barred:
+		logger.MainLog.Warn("[%s] Subscriber %s barred", ue.LogTag("NAS"), subscriber.ID)
+		return nasMessage.Cause5GMM5GSServicesNotAllowed
+	}
+	ue.Subscriber = subscriber
+	ue.Ambr = &ngapType.UEAggregateMaximumBitRate{}
+	ue.Ambr.UEAggregateMaximumBitRateUL.Value = defaultUeAmbrUL
+	ue.Ambr.UEAggregateMaximumBitRateDL.Value = defaultUeAmbrDL
+	if subscriber.UeAmbrUL > 0 && subscriber.UeAmbrDL > 0 {
+		ue.Ambr.UEAggregateMaximumBitRateUL.Value = subscriber.UeAmbrUL
+		ue.Ambr.UEAggregateMaximumBitRateDL.Value = subscriber.UeAmbrDL
+	}
+
+	if !selectNssai(ue) {
+		return cause5GMMNoNetworkSlicesAvailable
+	}
+	return 0
+}
+
+// registrationRGType returns the type of the RG presenting the mobile identity of a Registration Request: a SUCI of
+// IMSI or network specific identifier is concealed by a 5G-RG running its own NAS, a SUCI of GLI or GCI or a MAC address
+// is presented by the W-AGF on behalf of an FN-RG
+//
+// TS 24.501 9.11.3.4 5GS mobile identity
+func registrationRGType(mobileIdentity nasType.MobileIdentity5GS) types.RGType {
+	contents := mobileIdentity.GetMobileIdentity5GSContents()
+	if len(contents) > 0 && contents[0]&0x07 == nasMessage.MobileIdentity5GSTypeSuci {
+		switch (contents[0] & 0x70) >> 4 {
+		case nasMessage.SupiFormatImsi, nasMessage.SupiFormatNai:
+			return types.RGType_FIVEG_RG
+		}
+	}
+	return types.RGType_FN_RG
+}
+
+// registrationGUTI returns the 5G-GUTI presented in a Registration Request, or "" for another identity
+func registrationGUTI(mobileIdentity nasType.MobileIdentity5GS) string {
+	contents := mobileIdentity.GetMobileIdentity5GSContents()
+	if len(contents) < 11 || contents[0]&0x07 != nasMessage.MobileIdentity5GSType5gGuti {
+		return ""
+	}
+	_, guti := nasConvert.GutiToString(contents)
+	return guti
+}
+
+// updatePDUSessionStatus locally releases the PDU sessions the UE reports inactive in the PDU session status of its
+// Registration Request, and records the PDU sessions of which it requests the user plane re-establishment
+//
+// TS 24.501 5.5.1.3.4 Mobility and periodic registration update accepted by the network
+func updatePDUSessionStatus(ue *context.UEContext, registrationRequest *nasMessage.RegistrationRequest) {
+	if registrationRequest.PDUSessionStatus != nil {
+		pduSessionStatus := nasConvert.PSIToBooleanArray(registrationRequest.PDUSessionStatus.Buffer)
+		for psi, active := range ue.GetPDUSessionStatus() {
+			if active && !pduSessionStatus[psi] {
+				logger.MainLog.Info("[%s] Release PDU Session[ID:%d] inactive in the UE", ue.LogTag("NAS"), psi)
+				if err := ue.DeletePDUSession(int64(psi)); err != nil {
+					logger.MainLog.Warn("[%s] %v", ue.LogTag("NAS"), err)
+				}
+			}
+		}
+	}
+
+	ue.UplinkDataStatus = [16]bool{}
+	ue.PduSessionReactivationResult = [16]bool{}
+	if registrationRequest.UplinkDataStatus != nil {
+		ue.UplinkDataStatus = nasConvert.PSIToBooleanArray(registrationRequest.UplinkDataStatus.Buffer)
+		for psi, requested := range ue.UplinkDataStatus {
+			if requested && ue.FindPDUSession(int64(psi)) == nil {
+				ue.PduSessionReactivationResult[psi] = true
+			}
+		}
+	}
+}
+
+// sendRegistrationAccept allocates the registration of the UE and sends the Registration Accept, the registration
+// completing with the Registration Complete acknowledging a new 5G-GUTI
+func sendRegistrationAccept(ue *context.UEContext) {
+	allocateRegistration(ue)
+	if ue.Guti == "" {
+		pkt, err := BuildRegistrationAccept(ue)
+		if err != nil {
+			logger.MainLog.Error("[TEST] Error %v", err)
+			return
+		}
+		if ue.AGF == nil {
+			return
+		}
+		_, err = SendData(ue.SCTPConn(), pkt, "Server")
+		if err != nil {
+			logger.MainLog.Error("[TEST] Error %v", err)
+			return
+		}
+		gmmEvent(ue, context.GmmEventRegistrationAccepted)
+		completeRegistration(ue)
+		return
+	}
+	err := sendGuardedNAS(ue, context.T3550, lib_nas.MsgTypeRegistrationAccept, func() ([]byte, error) {
+		return BuildRegistrationAccept(ue)
+	})
+	if err != nil {
+		logger.MainLog.Error("[TEST] Error %v", err)
+		return
+	}
+	gmmEvent(ue, context.GmmEventRegistrationAccepted)
+}
+
+// completeRegistration ends the registration procedure of the UE. The NG connection of a registration update without
+// follow-on request pending nor user plane to re-establish is released.
+//
+// TS 24.501 5.3.1.3 Release of the N1 NAS signalling connection
+func completeRegistration(ue *context.UEContext) {
+	ue.SetAttached(1)
+	metrics.ObserveProcedure(metrics.ProcedureRegistration, ue.RegistrationStartTime)
+	ue.RegistrationStartTime = time.Time{}
+	event.Publish(ue, event.Event{Type: event.Registered})
+
+	if ue.RegistrationType == nasMessage.RegistrationType5GSInitialRegistration ||
+		ue.FollowOnRequest == nasMessage.FollowOnRequestPending || ue.UplinkDataStatus != [16]bool{} {
+		return
+	}
+	sendUEContextReleaseCommand(ue, ngapType.CauseNasPresentNormalRelease)
+}
+
+// rejectRegistration sends a Registration Reject and releases the NG connection of the UE
+func rejectRegistration(ue *context.UEContext, cause5GMM uint8) {
+	pkt, err := BuildRegistrationReject(ue, cause5GMM)
+	if err != nil {
+		logger.MainLog.Error("Error %v", err)
+		return
+	}
+	if _, err = SendData(ue.SCTPConn(), pkt, "Server"); err != nil {
+		logger.MainLog.Error("Error %v", err)
+		return
+	}
+	gmmEvent(ue, context.GmmEventRegistrationRejected)
+	event.Publish(ue, event.Event{Type: event.RegistrationRejected, Detail: fmt.Sprintf("5GMM cause %d", cause5GMM)})
+	sendUEContextReleaseCommand(ue, ngapType.CauseNasPresentUnspecified)
+}
+
+// releaseUEContext ends the UE-associated NG connection of the UE served by the AGF. A registered UE enters CM-IDLE,
+// keeping its context to be resolved by its 5G-GUTI on its next registration, the other ones are removed.
+func releaseUEContext(agf *context.AGFContext, ue *context.UEContext) {
+	if ue.AGF != agf {
+		// the UE resumed its registration on another NG connection
+		return
+	}
+	cmEvent(ue, context.CmEventReleased)
+	event.Publish(ue, event.Event{Type: event.UEContextReleased})
+	if ue.Registered() && ue.Guti != "" {
+		ue.ReleaseNGConnection()
+		return
+	}
+	ue.Remove()
+}
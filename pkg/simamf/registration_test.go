@@ -0,0 +1,151 @@
+package simamf
+
+import (
+	"bytes"
+	gocontext "context"
+	"testing"
+
+	"free5gc/lib/fsm"
+	lib_nas "free5gc/lib/nas"
+	"free5gc/lib/nas/nasMessage"
+	"free5gc/lib/nas/nasTestpacket"
+	"free5gc/lib/ngap/ngapType"
+	"sim-amf/pkg/api"
+	"sim-amf/pkg/context"
+)
+
+func TestGmmStates(t *testing.T) {
+	a := newTestAGF(t, DefaultOptions())
+	rg := a.newRG(1)
+	wantState := func(step string, want fsm.State) *context.UEContext {
+		t.Helper()
+		ue := rg.ue()
+		if ue.StateMachineIndex != want {
+			t.Fatalf("UE %s after the %s, want %s", ue.StateMachineIndex, step, want)
+		}
+		return ue
+	}
+
+	// registration
+	rg.initialUEMessage(nasTestpacket.GetRegistrationRequestWith5GMM(nasMessage.RegistrationType5GSInitialRegistration,
+		testSuci, nil, nil, testSecurityCapability))
+	authenticationRequest := rg.receiveNAS("DownlinkNASTransport", lib_nas.MsgTypeAuthenticationRequest)
+	ue := wantState("Authentication Request", context.GmmCommonProcedureInitiated)
+	if got := ue.CmState(); got != string(context.CmConnected) {
+		t.Errorf("UE %s after the Initial UE Message, want %s", got, context.CmConnected)
+	}
+	rg.uplinkNAS(rg.authenticate(authenticationRequest.AuthenticationRequest))
+	rg.receiveNAS("DownlinkNASTransport", lib_nas.MsgTypeSecurityModeCommand)
+	wantState("Security Mode Command", context.GmmCommonProcedureInitiated)
+	rg.uplinkNAS(rg.protect(nasTestpacket.GetSecurityModeComplete(nil),
+		lib_nas.SecurityHeaderTypeIntegrityProtectedAndCipheredWithNew5gNasSecurityContext))
+	rg.receive("InitialContextSetupRequest")
+	wantState("Initial Context Setup Request", context.GmmCommonProcedureInitiated)
+	rg.agf.send(rg.initialContextSetupResponse())
+	registrationAccept := rg.receiveNAS("DownlinkNASTransport", lib_nas.MsgTypeRegistrationAccept)
+	wantState("Registration Accept", context.GmmRegistered)
+	guti := registrationAccept.RegistrationAccept.GUTI5G
+	rg.guti.Len, rg.guti.Buffer = guti.Len, append([]uint8(nil), guti.Octet[:]...)
+	rg.uplinkNAS(rg.protect(nasTestpacket.GetRegistrationComplete(nil),
+		lib_nas.SecurityHeaderTypeIntegrityProtectedAndCiphered))
+	ue = wantState("Registration Complete", context.GmmRegistered)
+
+	// NAS security rekeying, the UE staying in 5GMM-REGISTERED
+	req := &api.RekeyNASRequest{UESelector: api.UESelector{AmfUeNgapID: ue.AmfUeNgapId}, NewNgKsi: true}
+	if _, err := new(apiServer).RekeyNAS(gocontext.Background(), req); err != nil {
+		t.Fatalf("RekeyNAS() error = %v", err)
+	}
+	rg.receiveNAS("DownlinkNASTransport", lib_nas.MsgTypeSecurityModeCommand)
+	wantState("Security Mode Command of the rekeying", context.GmmRegistered)
+	rg.uplinkNAS(rg.protect(nasTestpacket.GetSecurityModeComplete(nil),
+		lib_nas.SecurityHeaderTypeIntegrityProtectedAndCipheredWithNew5gNasSecurityContext))
+	rg.receive("UEContextModificationRequest")
+	ue = wantState("Security Mode Complete of the rekeying", context.GmmRegistered)
+
+	// UE-initiated deregistration
+	rg.uplinkNAS(rg.protect(nasTestpacket.GetDeregistrationRequest(nasMessage.AccessTypeNon3GPP, 0,
+		uint8(ue.NgKsi.Ksi), rg.guti), lib_nas.SecurityHeaderTypeIntegrityProtectedAndCiphered))
+	rg.receiveNAS("DownlinkNASTransport", lib_nas.MsgTypeDeregistrationAcceptUEOriginatingDeregistration)
+	rg.receive("UEContextReleaseCommand")
+	wantState("Deregistration Request", context.GmmDeregistered)
+	a.send(rg.ueContextReleaseComplete())
+	a.silent()
+	if _, ok := context.AMFSelf.LoadUEContextAMFUENGAPID(rg.amfUeNgapId); ok {
+		t.Errorf("UE context kept after the deregistration")
+	}
+}
+
+// initialContextSetupKey returns the Security Key of an Initial Context Setup Request
+func initialContextSetupKey(pdu *ngapType.NGAPPDU) []byte {
+	for _, ie := range pdu.InitiatingMessage.Value.InitialContextSetupRequest.ProtocolIEs.List {
+		if ie.Id.Value == ngapType.ProtocolIEIDSecurityKey {
+			return ie.Value.SecurityKey.Value.Bytes
+		}
+	}
+	return nil
+}
+
+func TestRegistrationUpdate(t *testing.T) {
+	tests := []struct {
+		name       string
+		invalidMAC bool
+	}{
+		{name: "NAS security context reused"},
+		{name: "integrity check failed", invalidMAC: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAGF(t, DefaultOptions())
+			rg := a.newRG(1)
+			registered := rg.register()
+			kamf := registered.Kamf
+			// the AGF releases the NG connection of the RG, which stays registered in CM-IDLE
+			a.send(rg.ueContextReleaseComplete())
+			a.silent()
+
+			// mobility registration update over a new NG connection, integrity protected with the NAS security context
+			rg.ranUeNgapId = 2
+			count := rg.ulCount
+			registrationRequest := rg.protect(nasTestpacket.GetRegistrationRequestWith5GMM(
+				nasMessage.RegistrationType5GSMobilityRegistrationUpdating, rg.guti, nil, nil, testSecurityCapability),
+				lib_nas.SecurityHeaderTypeIntegrityProtected)
+			if tt.invalidMAC {
+				registrationRequest[2] ^= 0xff
+			}
+			rg.initialUEMessage(registrationRequest)
+
+			if tt.invalidMAC {
+				// the RG is authenticated again and gets a new NAS security context
+				authenticationRequest := rg.receiveNAS("DownlinkNASTransport", lib_nas.MsgTypeAuthenticationRequest)
+				rg.uplinkNAS(rg.authenticate(authenticationRequest.AuthenticationRequest))
+				rg.receiveNAS("DownlinkNASTransport", lib_nas.MsgTypeSecurityModeCommand)
+				rg.uplinkNAS(rg.protect(nasTestpacket.GetSecurityModeComplete(nil),
+					lib_nas.SecurityHeaderTypeIntegrityProtectedAndCipheredWithNew5gNasSecurityContext))
+				count = 0
+			}
+			initialContextSetupRequest := rg.receive("InitialContextSetupRequest")
+			ue := rg.ue()
+			if ue != registered {
+				t.Fatalf("registration update handled with another UE context than the registered one")
+			}
+			if reused := bytes.Equal(ue.Kamf, kamf); reused == tt.invalidMAC {
+				t.Errorf("KAMF reused %v, want %v", reused, !tt.invalidMAC)
+			}
+			// the Kwagf is derived from the uplink NAS COUNT of the Registration Request or Security Mode Complete
+			rg.keys.RGType = ue.RGType
+			rg.keys.DLCount.Set(0, uint8(count))
+			if key, want := initialContextSetupKey(initialContextSetupRequest), rg.keys.AnKey(); !bytes.Equal(key, want) {
+				t.Errorf("Initial Context Setup Request Security Key = %x, want %x", key, want)
+			}
+
+			rg.agf.send(rg.initialContextSetupResponse())
+			rg.receiveNAS("DownlinkNASTransport", lib_nas.MsgTypeRegistrationAccept)
+			rg.uplinkNAS(rg.protect(nasTestpacket.GetRegistrationComplete(nil),
+				lib_nas.SecurityHeaderTypeIntegrityProtectedAndCiphered))
+			if ue = rg.ue(); !ue.Registered() || ue.MacFailed {
+				t.Errorf("UE %s, MAC failed %v after the Registration Complete, want %s", ue.StateMachineIndex,
+					ue.MacFailed, context.GmmRegistered)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package simamf
+
+import (
+	"fmt"
+	"strings"
+
+	"free5gc/lib/nas/nasType"
+	"free5gc/lib/nas/security"
+	"sim-amf/pkg/context"
+	"sim-amf/pkg/event"
+	"sim-amf/pkg/logger"
+)
+
+// NAS security algorithms a rekeying may select, the ones of the initial selection, see context.SelectSecurityAlg
+var (
+	integrityAlgorithms = map[string]uint8{
+		"nia1": security.AlgIntegrity128NIA1,
+		"nia2": security.AlgIntegrity128NIA2,
+	}
+	cipheringAlgorithms = map[string]uint8{
+		"nea0": security.AlgCiphering128NEA0,
+		"nea1": security.AlgCiphering128NEA1,
+		"nea2": security.AlgCiphering128NEA2,
+	}
+)
+
+// supportsSecurityAlg tells whether the UE security capability of the UE supports the algorithm
+func supportsSecurityAlg(capability *nasType.UESecurityCapability, integrity bool, alg uint8) bool {
+	switch {
+	case integrity && alg == security.AlgIntegrity128NIA1:
+		return capability.GetIA1_128_5G() == 1
+	case integrity && alg == security.AlgIntegrity128NIA2:
+		return capability.GetIA2_128_5G() == 1
+	case !integrity && alg == security.AlgCiphering128NEA0:
+		return capability.GetEA0_5G() == 1
+	case !integrity && alg == security.AlgCiphering128NEA1:
+		return capability.GetEA1_128_5G() == 1
+	case !integrity && alg == security.AlgCiphering128NEA2:
+		return capability.GetEA2_128_5G() == 1
+	}
+	return false
+}
+
+// rekeyingAlgorithms returns the NAS security algorithms of a rekeying of the UE, the ones in use unless given, which
+// must be supported by the UE security capability. Either the algorithms or the KAMF, derived horizontally, must change.
+func rekeyingAlgorithms(ue *context.UEContext, horizontalDerivation bool, integrityAlgorithm,
+	cipheringAlgorithm string) (integrityAlg, cipheringAlg uint8, err error) {
+	integrityAlg, cipheringAlg = ue.IntegrityAlg, ue.CipheringAlg
+	if integrityAlgorithm != "" {
+		var ok bool
+		if integrityAlg, ok = integrityAlgorithms[strings.ToLower(integrityAlgorithm)]; !ok {
+			return 0, 0, fmt.Errorf("invalid integrity algorithm %s, expecting nia1 or nia2", integrityAlgorithm)
+		}
+		if !supportsSecurityAlg(ue.NasUESecurityCapability, true, integrityAlg) {
+			return 0, 0, fmt.Errorf("integrity algorithm %s not supported by UE %d", integrityAlgorithm, ue.AmfUeNgapId)
+		}
+	}
+	if cipheringAlgorithm != "" {
+		var ok bool
+		if cipheringAlg, ok = cipheringAlgorithms[strings.ToLower(cipheringAlgorithm)]; !ok {
+			return 0, 0, fmt.Errorf("invalid ciphering algorithm %s, expecting nea0, nea1 or nea2", cipheringAlgorithm)
+		}
+		if !supportsSecurityAlg(ue.NasUESecurityCapability, false, cipheringAlg) {
+			return 0, 0, fmt.Errorf("ciphering algorithm %s not supported by UE %d", cipheringAlgorithm, ue.AmfUeNgapId)
+		}
+	}
+	if !horizontalDerivation && integrityAlg == ue.IntegrityAlg && cipheringAlg == ue.CipheringAlg {
+		return 0, 0, fmt.Errorf("neither a new ngKSI nor new NAS security algorithms for UE %d", ue.AmfUeNgapId)
+	}
+	return integrityAlg, cipheringAlg, nil
+}
+
+// startRekeying runs the Security Mode Command procedure on a registered UE to take into use a K'AMF derived
+// horizontally with a new ngKSI, or new NAS security algorithms. The current NAS security context is kept until the
+// Security Mode Complete.
+//
+// TS 33.501 6.9.3 Key-change-on-the-fly, 6.7.2 NAS Security Mode Command procedure, TS 24.501 5.4.2 Security mode
+// control procedure
+func startRekeying(ue *context.UEContext, horizontalDerivation bool, integrityAlg, cipheringAlg uint8) error {
+	previous := ue.CurrentNASSecurityContext()
+	if horizontalDerivation {
+		ue.DerivateHorizontalKamf()
+	}
+	ue.IntegrityAlg, ue.CipheringAlg = integrityAlg, cipheringAlg
+	ue.DerivateAlgKey()
+	ue.PreviousSecurityContext, ue.HorizontalDerivation = previous, horizontalDerivation
+
+	if err := sendGuardedSecurityModeCommand(ue); err != nil {
+		ue.RestorePreviousSecurityContext()
+		return err
+	}
+	logger.MainLog.Info("[%s] Rekeying with ngKSI %d, NIA%d and NEA%d", ue.LogTag("NAS"), ue.NgKsi.Ksi,
+		ue.IntegrityAlg, ue.CipheringAlg)
+	return nil
+}
+
+// completeRekeying ends the rekeying of the UE on the Security Mode Complete, the W-AGF getting the Kwagf derived from
+// the new NAS security context in a UE Context Modification
+//
+// TS 33.501 6.9.3 Key-change-on-the-fly, TS 38.413 8.3.4 UE Context Modification
+func completeRekeying(ue *context.UEContext) {
+	ue.PreviousSecurityContext, ue.HorizontalDerivation = nil, false
+	detail := fmt.Sprintf("ngKSI %d, NIA%d, NEA%d", ue.NgKsi.Ksi, ue.IntegrityAlg, ue.CipheringAlg)
+	logger.MainLog.Info("[%s] Rekeying completed, %s", ue.LogTag("NAS"), detail)
+	event.Publish(ue, event.Event{Type: event.NASSecurityRekeyed, Detail: detail})
+
+	if ue.ContextModification != nil {
+		logger.MainLog.Warn("[%s] UE Context Modification in progress, Kwagf not updated", ue.LogTag("NGAP"))
+		return
+	}
+	modification := &context.UEContextModification{Kwagf: ue.AnKey()}
+	pkt, err := BuildUEContextModificationRequest(ue, modification)
+	if err := sendToUE(ue, pkt, err); err != nil {
+		logger.MainLog.Error("Error %v", err)
+		return
+	}
+	ue.ContextModification = modification
+}
+
+// abortRekeying takes back into use the NAS security context of the UE the Security Mode Command of the rekeying did
+// not replace
+//
+// TS 24.501 5.4.2.5 NAS security mode command not accepted by the UE, 5.4.2.7 Abnormal cases on the network side
+func abortRekeying(ue *context.UEContext, reason string) {
+	ue.RestorePreviousSecurityContext()
+	logger.MainLog.Warn("[%s] Rekeying aborted, %s", ue.LogTag("NAS"), reason)
+	event.Publish(ue, event.Event{Type: event.NASSecurityRekeyingFailed, Detail: reason})
+}
@@ -0,0 +1,132 @@
+package simamf
+
+import (
+	"bytes"
+	gocontext "context"
+	"testing"
+
+	lib_nas "free5gc/lib/nas"
+	"free5gc/lib/nas/nasMessage"
+	"free5gc/lib/nas/nasTestpacket"
+	"free5gc/lib/nas/nasType"
+	"free5gc/lib/nas/security"
+	"sim-amf/pkg/api"
+	"sim-amf/pkg/context"
+)
+
+func TestRekeyingAlgorithms(t *testing.T) {
+	const (
+		nia1 = security.AlgIntegrity128NIA1
+		nea0 = security.AlgCiphering128NEA0
+		nea1 = security.AlgCiphering128NEA1
+	)
+	ue := new(context.UEContext)
+	ue.IntegrityAlg, ue.CipheringAlg = nia1, nea0
+	// 128-5G-EA0 and 128-5G-EA1, 128-5G-IA1
+	ue.NasUESecurityCapability = &nasType.UESecurityCapability{Len: 2, Buffer: []uint8{0xc0, 0x40}}
+
+	tests := []struct {
+		name                 string
+		horizontalDerivation bool
+		integrityAlgorithm   string
+		cipheringAlgorithm   string
+		integrityAlg         uint8
+		cipheringAlg         uint8
+		wantErr              bool
+	}{
+		{name: "new KAMF", horizontalDerivation: true, integrityAlg: nia1, cipheringAlg: nea0},
+		{name: "nothing new", wantErr: true},
+		{name: "algorithms in use", integrityAlgorithm: "nia1", cipheringAlgorithm: "nea0", wantErr: true},
+		{name: "new ciphering algorithm", cipheringAlgorithm: "NEA1", integrityAlg: nia1, cipheringAlg: nea1},
+		{
+			name:                 "new KAMF and algorithms in use",
+			horizontalDerivation: true,
+			integrityAlgorithm:   "nia1",
+			cipheringAlgorithm:   "nea0",
+			integrityAlg:         nia1,
+			cipheringAlg:         nea0,
+		},
+		{name: "integrity algorithm not supported", integrityAlgorithm: "nia2", wantErr: true},
+		{name: "ciphering algorithm not supported", cipheringAlgorithm: "nea2", wantErr: true},
+		{name: "null integrity algorithm", integrityAlgorithm: "nia0", wantErr: true},
+		{name: "unknown ciphering algorithm", cipheringAlgorithm: "nea3", wantErr: true},
+	}
+	for _, tt := range tests {
+		integrityAlg, cipheringAlg, err := rekeyingAlgorithms(ue, tt.horizontalDerivation, tt.integrityAlgorithm,
+			tt.cipheringAlgorithm)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: rekeyingAlgorithms() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && (integrityAlg != tt.integrityAlg || cipheringAlg != tt.cipheringAlg) {
+			t.Errorf("%s: rekeyingAlgorithms() = NIA%d NEA%d, want NIA%d NEA%d", tt.name, integrityAlg, cipheringAlg,
+				tt.integrityAlg, tt.cipheringAlg)
+		}
+	}
+}
+
+func TestRekeyNAS(t *testing.T) {
+	a := newTestAGF(t, DefaultOptions())
+	rg := a.newRG(1)
+	ue := rg.register()
+	previous := ue.CurrentNASSecurityContext()
+
+	req := &api.RekeyNASRequest{UESelector: api.UESelector{AmfUeNgapID: ue.AmfUeNgapId}, NewNgKsi: true}
+	if _, err := new(apiServer).RekeyNAS(gocontext.Background(), req); err != nil {
+		t.Fatalf("RekeyNAS() error = %v", err)
+	}
+	// the Security Mode Command is checked with the K'AMF the RG derives
+	msg := rg.receiveNAS("DownlinkNASTransport", lib_nas.MsgTypeSecurityModeCommand)
+	if ksi := msg.SecurityModeCommand.GetNasKeySetIdentifiler(); int32(ksi) == previous.NgKsi.Ksi {
+		t.Errorf("Security Mode Command ngKSI = %d, want a new one", ksi)
+	}
+	rg.uplinkNAS(rg.protect(nasTestpacket.GetSecurityModeComplete(nil),
+		lib_nas.SecurityHeaderTypeIntegrityProtectedAndCipheredWithNew5gNasSecurityContext))
+	rg.receive("UEContextModificationRequest")
+	a.silent()
+
+	ue = rg.ue()
+	if ue.PreviousSecurityContext != nil || !ue.Registered() {
+		t.Fatalf("UE %s, rekeying in progress %v, want %s with the rekeying completed", ue.StateMachineIndex,
+			ue.PreviousSecurityContext != nil, context.GmmRegistered)
+	}
+	if bytes.Equal(ue.Kamf, previous.Kamf) || !bytes.Equal(ue.Kamf, rg.keys.Kamf) {
+		t.Errorf("KAMF = %x, want the K'AMF %x derived from %x", ue.Kamf, rg.keys.Kamf, previous.Kamf)
+	}
+	if ue.KnasInt != rg.keys.KnasInt {
+		t.Errorf("KNASint = %x, want %x", ue.KnasInt, rg.keys.KnasInt)
+	}
+
+	// the next uplink message is integrity checked with the new NAS security context
+	rg.uplinkNAS(rg.protect(nasTestpacket.GetStatus5GMM(nasMessage.Cause5GMMProtocolErrorUnspecified),
+		lib_nas.SecurityHeaderTypeIntegrityProtectedAndCiphered))
+	a.silent()
+	if ue = rg.ue(); ue.MacFailed {
+		t.Errorf("MAC check of the 5GMM STATUS failed")
+	}
+}
+
+func TestRekeyNASRejected(t *testing.T) {
+	a := newTestAGF(t, DefaultOptions())
+	rg := a.newRG(1)
+	ue := rg.register()
+	previous := ue.CurrentNASSecurityContext()
+
+	req := &api.RekeyNASRequest{UESelector: api.UESelector{AmfUeNgapID: ue.AmfUeNgapId}, NewNgKsi: true}
+	if _, err := new(apiServer).RekeyNAS(gocontext.Background(), req); err != nil {
+		t.Fatalf("RekeyNAS() error = %v", err)
+	}
+	rg.receiveNAS("DownlinkNASTransport", lib_nas.MsgTypeSecurityModeCommand)
+	rg.uplinkNAS(nasTestpacket.GetSecurityModeReject(nasMessage.Cause5GMMSecurityModeRejectedUnspecified))
+	a.silent()
+
+	ue = rg.ue()
+	if ue.PreviousSecurityContext != nil || !ue.Registered() {
+		t.Fatalf("UE %s, rekeying in progress %v, want %s with the rekeying aborted", ue.StateMachineIndex,
+			ue.PreviousSecurityContext != nil, context.GmmRegistered)
+	}
+	if !bytes.Equal(ue.Kamf, previous.Kamf) || ue.NgKsi != previous.NgKsi || ue.ULCount != previous.ULCount {
+		t.Errorf("NAS security context ngKSI %d, KAMF %x, want the previous one ngKSI %d, KAMF %x", ue.NgKsi.Ksi,
+			ue.Kamf, previous.NgKsi.Ksi, previous.Kamf)
+	}
+}
@@ -0,0 +1,415 @@
+package simamf
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	lib_nas "free5gc/lib/nas"
+	"free5gc/lib/nas/nasMessage"
+	lib_ngap "free5gc/lib/ngap"
+	"free5gc/lib/ngap/ngapType"
+	"sim-amf/pkg/context"
+	"sim-amf/pkg/event"
+	"sim-amf/pkg/logger"
+	"sim-amf/pkg/metrics"
+	"sim-amf/pkg/nas"
+	"sim-amf/pkg/recording"
+	"sim-amf/pkg/util"
+
+	"gitlab.casa-systems.com/opensource/sctp"
+)
+
+var (
+	recordFile   string
+	replayFile   string
+	replayDelays bool
+)
+
+// replayer answers the AGFs with the recording being replayed, nil if the AGFs are served by the NGAP handlers
+var replayer *replay
+
+// replay answers the messages of the AGFs with the AMF-side messages of a recording. The k-th AGF connected replays
+// the k-th AGF of the recording, each new UE one of the recorded UE-associated NG connections of its AGF. The
+// messages of the AGFs are checked against the recorded ones, any divergence being logged and published as a
+// replay_divergence event.
+type replay struct {
+	mu   sync.Mutex
+	agfs []*replayAGF
+	ues  map[*context.UEContext]*replayStream
+}
+
+// replayAGF is an AGF of the recording
+type replayAGF struct {
+	addr  string              // SCTP address of the recorded AGF
+	agf   *context.AGFContext // AGF replaying it, nil until one connects
+	nonUE *replayStream       // non UE associated messages
+	ues   []*replayStream     // UE-associated NG connections in the order they were set up
+}
+
+// replayStream is a sequence of recorded steps replayed in order
+type replayStream struct {
+	steps       []*recording.Step
+	next        int // index of the next step
+	generation  int // incremented on each received message, cancelling the delayed sends
+	waited      int // index of the step sent once its recorded delay elapsed
+	taken       bool
+	divergences int
+}
+
+// openRecording opens the recording of the NGAP messages
+func openRecording() error {
+	if recordFile == "" {
+		return nil
+	}
+	recorder, err := recording.Create(recordFile)
+	if err != nil {
+		return err
+	}
+	recording.Global = recorder
+	logger.MainLog.Info("Recording NGAP to %s", recordFile)
+	return nil
+}
+
+// openReplay loads the recording replayed to the AGFs
+func openReplay() error {
+	if replayFile == "" {
+		return nil
+	}
+	steps, err := recording.Load(replayFile)
+	if err != nil {
+		return err
+	}
+	r := &replay{ues: make(map[*context.UEContext]*replayStream)}
+	agfs := make(map[string]*replayAGF)
+	ues := make(map[int64]*replayStream) // current NG connection by recorded AMF UE NGAP ID
+	for _, step := range steps {
+		ra, ok := agfs[step.AGF]
+		if !ok {
+			ra = &replayAGF{addr: step.AGF, nonUE: new(replayStream)}
+			agfs[step.AGF] = ra
+			r.agfs = append(r.agfs, ra)
+		}
+		if step.AmfUeNgapID == 0 {
+			ra.nonUE.steps = append(ra.nonUE.steps, step)
+			continue
+		}
+		// an Initial UE Message starts a new UE-associated NG connection
+		stream, ok := ues[step.AmfUeNgapID]
+		if !ok || (step.Direction == metrics.DirectionReceived && step.Message == "InitialUEMessage") {
+			stream = new(replayStream)
+			ues[step.AmfUeNgapID] = stream
+			ra.ues = append(ra.ues, stream)
+		}
+		stream.steps = append(stream.steps, step)
+	}
+	replayer = r
+	logger.MainLog.Info("Replaying %d steps of %d AGFs from %s", len(steps), len(r.agfs), replayFile)
+	return nil
+}
+
+// handle checks a message received from the AGF against the recording and sends the recorded answers
+func (r *replay) handle(agf *context.AGFContext, conn *sctp.SCTPConn, pdu *ngapType.NGAPPDU) {
+	_, message := recording.Message(pdu)
+	ra := r.replayAGF(agf)
+	if ra == nil {
+		logger.MainLog.Warn("AGF[%s] replay divergence: %s of an AGF not in the recording", agf.SCTPAddr, message)
+		return
+	}
+
+	var ue *context.UEContext
+	var stream *replayStream
+	amfUeNgapId, ranUeNgapId := ueNGAPIDs(pdu)
+	switch {
+	case message == "InitialUEMessage":
+		if ue, stream = r.newUE(agf, ra, pdu); ue == nil {
+			return
+		}
+	case amfUeNgapId != context.AmfUeNgapIdUnspecified || ranUeNgapId != context.RanUeNgapIdUnspecified:
+		if ue = lookupUEContext(conn, pdu); ue != nil {
+			r.mu.Lock()
+			stream = r.ues[ue]
+			r.mu.Unlock()
+		}
+		if stream == nil {
+			r.diverge(agf, nil, ra.nonUE, "%s of an unknown UE", message)
+			return
+		}
+	default:
+		stream = ra.nonUE
+	}
+
+	r.receive(agf, ue, stream, pdu)
+	if message == "UEContextReleaseComplete" && ue != nil {
+		logger.MainLog.Info("[%s] replay of the NG connection done, %d divergences", ue.LogTag("NGAP"),
+			stream.divergences)
+		r.mu.Lock()
+		delete(r.ues, ue)
+		r.mu.Unlock()
+		ue.Remove()
+	}
+}
+
+// replayAGF returns the recorded AGF replayed by the AGF, the next one not replayed yet for a new AGF
+func (r *replay) replayAGF(agf *context.AGFContext) *replayAGF {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, ra := range r.agfs {
+		if ra.agf == agf {
+			return ra
+		}
+	}
+	for _, ra := range r.agfs {
+		if ra.agf == nil {
+			ra.agf = agf
+			logger.MainLog.Info("AGF[%s] replays AGF[%s]", agf.SCTPAddr, ra.addr)
+			return ra
+		}
+	}
+	return nil
+}
+
+// newUE creates the UE of an Initial UE Message, replaying the recorded NG connection with the same initial NAS
+// message if any, the first one not replayed yet otherwise
+func (r *replay) newUE(agf *context.AGFContext, ra *replayAGF, pdu *ngapType.NGAPPDU) (*context.UEContext,
+	*replayStream) {
+	var initialNAS []byte
+	if nasPdus := recording.NASPDUs(pdu); len(nasPdus) > 0 {
+		initialNAS = nasPdus[0].Value
+	}
+
+	r.mu.Lock()
+	var stream *replayStream
+	for _, s := range ra.ues {
+		if s.taken || s.steps[0].Message != "InitialUEMessage" {
+			continue
+		}
+		if len(s.steps[0].NAS) > 0 && bytes.Equal(s.steps[0].NAS[0], initialNAS) {
+			stream = s
+			break
+		}
+		if stream == nil {
+			stream = s
+		}
+	}
+	if stream != nil {
+		stream.taken = true
+	}
+	r.mu.Unlock()
+	if stream == nil {
+		logger.MainLog.Warn("AGF[%s] replay divergence: Initial UE Message of no recorded UE", agf.SCTPAddr)
+		return nil, nil
+	}
+
+	_, ranUeNgapId := ueNGAPIDs(pdu)
+	ue, err := agf.AMF.NewUEContext(agf, ranUeNgapId, shardKey(agf, ranUeNgapId))
+	if err != nil {
+		logger.MainLog.Error("Allocate AMF UE NGAP ID failed: %+v", err)
+		return nil, nil
+	}
+	InitTestUe(ue)
+	openUECapture(agf, ue, pdu)
+	logger.MainLog.Info("[%s] replays the NG connection of AMF UE NGAP ID %d", ue.LogTag("NGAP"),
+		stream.steps[0].AmfUeNgapID)
+
+	r.mu.Lock()
+	r.ues[ue] = stream
+	r.mu.Unlock()
+	return ue, stream
+}
+
+// receive matches a received message with the next recorded one of the stream and sends the recorded messages
+// following it. The recorded messages skipped to find a match are reported as missing.
+func (r *replay) receive(agf *context.AGFContext, ue *context.UEContext, stream *replayStream,
+	pdu *ngapType.NGAPPDU) {
+	procedureCode, message := recording.Message(pdu)
+	procedure := util.NgapProcedureName(procedureCode)
+	nasMessages := receiveReplayNAS(ue, pdu)
+
+	stream.generation++
+	match := -1
+	for i := stream.next; i < len(stream.steps); i++ {
+		step := stream.steps[i]
+		if step.Direction == metrics.DirectionReceived && step.Procedure == procedure && step.Message == message {
+			match = i
+			break
+		}
+	}
+	if match < 0 {
+		r.diverge(agf, ue, stream, "unexpected %s", message)
+		return
+	}
+	for i := stream.next; i < match; i++ {
+		if step := stream.steps[i]; step.Direction == metrics.DirectionReceived {
+			r.diverge(agf, ue, stream, "missing %s", step.Message)
+		}
+	}
+
+	step := stream.steps[match]
+	recorded, err := lib_ngap.Decoder(step.NGAP)
+	if err != nil {
+		logger.MainLog.Error("Decode recorded %s failed: %+v", step.Message, err)
+	} else if ids, recordedIDs := recording.IEIDs(pdu), recording.IEIDs(recorded); !equalIDs(ids, recordedIDs) {
+		r.diverge(agf, ue, stream, "%s with IEs %v instead of %v", message, ids, recordedIDs)
+	}
+	for i, plain := range step.NAS {
+		recordedType, ok := plainNASMessageType(plain)
+		switch {
+		case !ok:
+		case i >= len(nasMessages):
+			r.diverge(agf, ue, stream, "%s without the NAS %s", message, util.NasMessageTypeName(recordedType))
+		case nasMessages[i] == nil:
+			r.diverge(agf, ue, stream, "%s with an undecodable NAS message instead of %s", message,
+				util.NasMessageTypeName(recordedType))
+		case nasMessages[i].GmmMessage == nil || nasMessages[i].GmmMessage.GetMessageType() != recordedType:
+			r.diverge(agf, ue, stream, "%s with the NAS %s instead of %s", message,
+				util.NasMessageTypeName(nasMessageType(nasMessages[i])), util.NasMessageTypeName(recordedType))
+		}
+	}
+	if ue != nil && ue.MacFailed && ue.SecurityContextAvailable {
+		r.diverge(agf, ue, stream, "%s failed the NAS integrity check", message)
+	}
+
+	stream.next = match + 1
+	r.sendSteps(agf, ue, stream)
+}
+
+// sendSteps sends the recorded messages following the last received one, with their recorded delays if enabled
+func (r *replay) sendSteps(agf *context.AGFContext, ue *context.UEContext, stream *replayStream) {
+	for stream.next < len(stream.steps) && stream.steps[stream.next].Direction == metrics.DirectionSent {
+		step := stream.steps[stream.next]
+		delay := step.Time.Sub(stream.steps[stream.next-1].Time)
+		if replayDelays && delay > 0 && stream.waited != stream.next {
+			stream.waited = stream.next
+			generation := stream.generation
+			// dropped by the dispatcher once stopped, not sent by the next Server
+			d, shard := ueDispatcher, shardKey(agf, context.RanUeNgapIdUnspecified)
+			if ue != nil {
+				shard = ue.Shard
+			}
+			time.AfterFunc(delay, func() {
+				d.dispatch(shard, func() {
+					if stream.generation == generation {
+						r.sendSteps(agf, ue, stream)
+					}
+				})
+			})
+			return
+		}
+		stream.next++
+		if err := r.send(agf, ue, step); err != nil {
+			logger.MainLog.Error("Replay %s failed: %+v", step.Message, err)
+		}
+	}
+}
+
+// send sends a recorded message with the NGAP IDs of the UE, its NAS messages being protected with the recorded NAS
+// security context and the NAS COUNTs of the UE
+func (r *replay) send(agf *context.AGFContext, ue *context.UEContext, step *recording.Step) error {
+	pdu, err := lib_ngap.Decoder(step.NGAP)
+	if err != nil {
+		return err
+	}
+	conn := agf.SCTPConn
+	if ue != nil {
+		conn = ue.SCTPConn()
+		if step.Security != nil {
+			step.Security.Apply(ue)
+		}
+		recording.SetUENGAPIDs(pdu, ue.AmfUeNgapId, ue.RanUeNgapId)
+		for i, nasPdu := range recording.NASPDUs(pdu) {
+			if i >= len(step.NAS) || step.NAS[i] == nil {
+				logger.MainLog.Warn("[%s] replay %s without the plain NAS message, sent as recorded",
+					ue.LogTag("NAS"), step.Message)
+				continue
+			}
+			payload, err := nas.EncodePlain(ue, nas.SecurityHeaderType(nasPdu.Value), step.NAS[i])
+			if err != nil {
+				return err
+			}
+			nasPdu.Value = payload
+		}
+		if len(ue.Kamf) > 0 {
+			kwagf := ue.Kwagf
+			ue.DerivateAnKey()
+			if !recording.SetSecurityKey(pdu, ue.Kwagf) {
+				ue.Kwagf = kwagf
+			}
+		}
+	}
+
+	pkt, err := lib_ngap.Encoder(*pdu)
+	if err != nil {
+		return err
+	}
+	if _, err := SendData(conn, pkt, "Server"); err != nil {
+		return err
+	}
+	if step.Message == "NGSetupResponse" {
+		agf.NGSetupDone = true
+	}
+	return nil
+}
+
+// diverge reports a received message differing from the recording
+func (r *replay) diverge(agf *context.AGFContext, ue *context.UEContext, stream *replayStream, format string,
+	args ...interface{}) {
+	r.mu.Lock()
+	stream.divergences++
+	r.mu.Unlock()
+	detail := fmt.Sprintf(format, args...)
+	if ue != nil {
+		logger.MainLog.Warn("[%s] replay divergence: %s", ue.LogTag("NGAP"), detail)
+	} else {
+		logger.MainLog.Warn("AGF[%s] replay divergence: %s", agf.SCTPAddr, detail)
+	}
+	event.Publish(ue, event.Event{Type: event.ReplayDivergence, Detail: detail})
+}
+
+// receiveReplayNAS decodes the NAS messages of a message received from the AGF with the NAS security context of the
+// UE, nil for the ones which cannot be decoded
+func receiveReplayNAS(ue *context.UEContext, pdu *ngapType.NGAPPDU) (msgs []*lib_nas.Message) {
+	if ue == nil {
+		return nil
+	}
+	for _, nasPdu := range recording.NASPDUs(pdu) {
+		msg, err := nas.Decode(ue, ue.RGType, nas.SecurityHeaderType(nasPdu.Value), nasPdu.Value)
+		if err != nil {
+			logger.MainLog.Warn("[%s] replay NAS PDU undecodable: %v", ue.LogTag("NAS"), err)
+			msg = nil
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+// plainNASMessageType returns the message type of a plain 5GMM message
+func plainNASMessageType(plain []byte) (uint8, bool) {
+	if len(plain) < 3 || plain[0] != nasMessage.Epd5GSMobilityManagementMessage {
+		return 0, false
+	}
+	return plain[2], true
+}
+
+func nasMessageType(msg *lib_nas.Message) uint8 {
+	switch {
+	case msg.GmmMessage != nil:
+		return msg.GmmMessage.GetMessageType()
+	case msg.GsmMessage != nil:
+		return msg.GsmMessage.GetMessageType()
+	}
+	return 0
+}
+
+func equalIDs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
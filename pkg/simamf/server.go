@@ -0,0 +1,367 @@
+// Package simamf emulates the AMFs of an AMF set serving the W-AGFs over NGAP. The sim-amf command runs it as a
+// process, the tests of an AGF can embed it to drive and observe the procedures of the UEs in-process.
+//
+// The AMF set, the message handlers, the fault injection, the recording, the trace and the metrics are process wide:
+// one Server runs at a time, a new Server being started once the previous one is stopped. The Prometheus counters
+// accumulate across the Servers of the process.
+package simamf
+
+import (
+	gocontext "context"
+	"errors"
+	"net"
+	"net/http"
+	"runtime"
+	"sync"
+
+	"sim-amf/pkg/conformance"
+	"sim-amf/pkg/context"
+	"sim-amf/pkg/event"
+	"sim-amf/pkg/fault"
+	"sim-amf/pkg/logger"
+	"sim-amf/pkg/metrics"
+	"sim-amf/pkg/recording"
+
+	"gitlab.casa-systems.com/opensource/sctp"
+	"google.golang.org/grpc"
+)
+
+// Options configures a Server, the sim-amf command flags of the same name setting them
+type Options struct {
+	NGAPAddr    string // SCTP address the NGAP server listens on
+	APIAddr     string // TCP address the gRPC control API listens on, empty to disable
+	MetricsAddr string // TCP address the Prometheus metrics are served on, empty to disable
+
+	PcapFile         string // pcapng file all the NGAP messages are written to
+	PcapDecryptedNAS bool   // also write the decrypted NAS messages to the pcapng files
+	PcapPerUEDir     string // directory a pcapng file per UE is written to
+
+	Shards     int // workers handling the UEs, the messages of a UE being handled in order by one worker
+	ShardQueue int // messages queued per worker before the NGAP reception blocks
+
+	TraceFormat     string   // message trace format, text or json, empty to disable
+	TraceFile       string   // file the message trace is written to instead of stdout
+	TraceProcedures []string // NGAP procedures and NAS message types traced
+	TraceUEs        []string // AMF UE NGAP IDs or MAC addresses of the UEs traced
+
+	RecordFile   string // file the NGAP messages, their plain NAS messages and the NAS security contexts are recorded to
+	ReplayFile   string // recording the AGFs are answered with instead of the NGAP handlers
+	ReplayDelays bool   // send the replayed messages with their recorded delays
+
+	Conformance       bool   // check the messages received from the AGFs against TS 38.413, TS 24.501 and TS 23.316
+	ConformanceReport string // file the conformance violations are written to as JSON lines, implies Conformance
+
+	Faults []string // fault injection rules, e.g. action=drop,messages=registration_accept,ues=1,probability=0.5
+
+	AMFName            string
+	PLMN               string   // PLMN ID of the served GUAMI, MCC followed by MNC
+	AMFID              string   // <AMF Region ID><AMF Set ID><AMF Pointer> in hex
+	EquivalentPLMNs    []string // equivalent PLMN IDs sent in the Registration Accept
+	Slices             []string // S-NSSAIs supported in the PLMN, <SST>[-<SD>]
+	SubscribedNSSAI    []string // subscribed NSSAI of the UEs not configured as subscribers
+	Subscribers        []string // subscribed NSSAI of a UE by SUPI, SUCI, MAC address or Global Line ID
+	SubscribersFile    string   // YAML or JSON subscriber database
+	HomeNetworkKeys    []string // <id>=<A|B>:<hex>
+	AMFCapacity        int64    // relative AMF capacity advertised in the NG Setup Response
+	AMFInstances       []string // other AMFs of the AMF set
+	AMFTNLEndpoints    []string // other endpoints of the AMFs advertised in the AMF Configuration Update
+	DNNs               []string // session policy of the DNNs, e.g. name=internet,types=ipv4, any DNN accepted if none
+	PDUSessionBackoff  int      // seconds, back-off timer of the PDU Session Establishment Rejects, none if 0
+	T3512              int      // seconds
+	Non3GPPDeregTimer  int      // seconds
+	T3522              int      // seconds
+	T3550              int      // seconds
+	T3560              int      // seconds
+	T3570              int      // seconds
+	NASRetransmissions int      // NAS retransmissions before the procedure is aborted
+	EventBuffer        int      // events buffered in the Events channel before they are dropped
+}
+
+// DefaultOptions returns the defaults of the sim-amf command
+func DefaultOptions() Options {
+	return Options{
+		NGAPAddr:           "127.0.0.1:38412",
+		APIAddr:            "127.0.0.1:50051",
+		MetricsAddr:        "127.0.0.1:9095",
+		Shards:             4 * runtime.NumCPU(),
+		ShardQueue:         1024,
+		AMFName:            "TestAMF1",
+		PLMN:               "20790",
+		AMFID:              "454511",
+		Slices:             []string{"1-010203", "1-112233"},
+		SubscribedNSSAI:    []string{"1-112233*"},
+		AMFCapacity:        200,
+		T3512:              context.DefaultT3512Value,
+		Non3GPPDeregTimer:  context.DefaultNon3GppDeregistrationTimerValue,
+		T3522:              context.DefaultT3522Value,
+		T3550:              context.DefaultT3550Value,
+		T3560:              context.DefaultT3560Value,
+		T3570:              context.DefaultT3570Value,
+		NASRetransmissions: context.MaxT3560RetryTimes,
+		EventBuffer:        1024,
+	}
+}
+
+// apply sets the configuration of the AMFs and of the message handlers
+func (o *Options) apply() {
+	ngapAddr, apiAddr, metricsAddr = o.NGAPAddr, o.APIAddr, o.MetricsAddr
+	pcapFile, pcapDecryptedNAS, pcapPerUEDir = o.PcapFile, o.PcapDecryptedNAS, o.PcapPerUEDir
+	dispatchShards, dispatchQueueSize = o.Shards, o.ShardQueue
+	traceFormat, traceFile, traceProcedures, traceUEs = o.TraceFormat, o.TraceFile, o.TraceProcedures, o.TraceUEs
+	recordFile, replayFile, replayDelays = o.RecordFile, o.ReplayFile, o.ReplayDelays
+	conformanceChecks, conformanceReport = o.Conformance, o.ConformanceReport
+	faultRules = o.Faults
+	amfName, plmnID, amfID, equivalentPlmnIDs = o.AMFName, o.PLMN, o.AMFID, o.EquivalentPLMNs
+	supportedNssai, subscribedNssai, subscribers = o.Slices, o.SubscribedNSSAI, o.Subscribers
+	subscribersFile, homeNetworkKeys = o.SubscribersFile, o.HomeNetworkKeys
+	amfRelativeCapacity, amfInstances, amfTNLEndpoints = o.AMFCapacity, o.AMFInstances, o.AMFTNLEndpoints
+	dnnPolicies, pduSessionBackoff = o.DNNs, o.PDUSessionBackoff
+	t3512Value, non3gppDeregTimer = o.T3512, o.Non3GPPDeregTimer
+	t3522Value, t3550Value, t3560Value, t3570Value = o.T3522, o.T3550, o.T3560, o.T3570
+	nasMaxRetransmissions = o.NASRetransmissions
+}
+
+var (
+	// running is the started Server, the AMF set and the message handlers being process wide
+	running   *Server
+	runningMu sync.Mutex
+
+	// stopping is closed when the running Server stops, ending the accept loops
+	stopping chan struct{}
+	// accepting tracks the accept loops, serving the goroutines reading the TNL associations
+	accepting sync.WaitGroup
+	serving   sync.WaitGroup
+)
+
+// ErrRunning is returned by Start while another Server of the process is running
+var ErrRunning = errors.New("a sim-amf server is already running")
+
+// isStopping reports whether the running Server is stopping
+func isStopping() bool {
+	select {
+	case <-stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// Server runs the AMF set. The methods of the control API trigger the AMF-initiated procedures in-process, e.g.
+// Deregister, ReleaseUEContext, ModifyPDUSession or Page, and Events delivers the outcomes of the UE procedures. Only one
+// Server runs at a time in a process, Start returning ErrRunning until the running one is stopped.
+type Server struct {
+	apiServer
+
+	opts          Options
+	listeners     []*sctp.SCTPListener
+	grpcServer    *grpc.Server
+	metricsServer *http.Server
+	events        <-chan event.Event
+	unsubscribe   func()
+	done          chan struct{}
+	stopOnce      sync.Once
+}
+
+// New returns a Server configured with opts, DefaultOptions giving the defaults of the sim-amf command
+func New(opts Options) *Server {
+	return &Server{opts: opts, done: make(chan struct{})}
+}
+
+// Events returns the channel of the outcomes of the UE procedures, e.g. registered or pdu_session_established, published
+// once the Server is started. The events are dropped while the channel is full, it is closed by Stop.
+func (s *Server) Events() <-chan event.Event {
+	return s.events
+}
+
+// Done returns a channel closed once the Server is stopped
+func (s *Server) Done() <-chan struct{} {
+	return s.done
+}
+
+// Start configures the AMF set and listens on its NGAP addresses, the control API and metrics addresses, then serves the
+// AGFs in the background until Stop is called or ctx is done
+func (s *Server) Start(ctx gocontext.Context) error {
+	runningMu.Lock()
+	defer runningMu.Unlock()
+	if running != nil {
+		return ErrRunning
+	}
+	select {
+	case <-s.done:
+		return errors.New("sim-amf server stopped")
+	default:
+	}
+
+	context.ResetAMFSet()
+	s.opts.apply()
+	if err := configureAMF(); err != nil {
+		return err
+	}
+	buffer := s.opts.EventBuffer
+	if buffer < 1 {
+		buffer = 1
+	}
+	s.events, s.unsubscribe = event.Subscribe(buffer)
+	stopping = make(chan struct{})
+	ueDispatcher = newDispatcher(dispatchShards, dispatchQueueSize)
+	if err := s.open(); err != nil {
+		s.stop()
+		return err
+	}
+	running = s
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Stop()
+		case <-s.done:
+		}
+	}()
+	return nil
+}
+
+// open opens the capture, trace, recording, conformance report and replay files, starts the fault injection, then
+// accepts the AGFs on the listeners
+func (s *Server) open() error {
+	if err := openCapture(); err != nil {
+		return err
+	}
+	if err := openTrace(); err != nil {
+		return err
+	}
+	if err := openRecording(); err != nil {
+		return err
+	}
+	if err := openConformance(); err != nil {
+		return err
+	}
+	if err := openReplay(); err != nil {
+		return err
+	}
+	if err := openFaults(); err != nil {
+		return err
+	}
+
+	// ngap server listeners, one per AMF of the set
+	for _, amf := range context.AMFSet {
+		listener, err := listenSCTP(amf.SCTPAddr)
+		if err != nil {
+			return err
+		}
+		s.listeners = append(s.listeners, listener)
+		logger.MainLog.Info("AMF[%s] listening on %s", amf.AMFName.Value, amf.SCTPAddr)
+		accepting.Add(1)
+		go func(amf *context.AMFContext) {
+			defer accepting.Done()
+			acceptAGFs(amf, listener)
+		}(amf)
+	}
+	SetSctpListener(s.listeners[0])
+	for _, amf := range context.AMFSet {
+		for _, endpoint := range amf.TNLEndpoints {
+			listener, err := listenSCTP(endpoint.SCTPAddr)
+			if err != nil {
+				return err
+			}
+			s.listeners = append(s.listeners, listener)
+			logger.MainLog.Info("AMF[%s] TNL endpoint listening on %s", amf.AMFName.Value, endpoint.SCTPAddr)
+			accepting.Add(1)
+			go func(amf *context.AMFContext) {
+				defer accepting.Done()
+				acceptTNLAs(amf, listener)
+			}(amf)
+		}
+	}
+
+	if apiAddr != "" {
+		server, err := listenAPI(apiAddr)
+		if err != nil {
+			return err
+		}
+		s.grpcServer = server
+	}
+	if metricsAddr != "" {
+		listener, err := net.Listen("tcp", metricsAddr)
+		if err != nil {
+			return err
+		}
+		s.metricsServer = &http.Server{Handler: metrics.Handler()}
+		logger.MainLog.Info("Metrics server listening on %s", metricsAddr)
+		go func() {
+			if err := s.metricsServer.Serve(listener); err != http.ErrServerClosed {
+				logger.MainLog.Error("Metrics serve failed: %s", err)
+			}
+		}()
+	}
+	return nil
+}
+
+func listenSCTP(address string) (*sctp.SCTPListener, error) {
+	addr, err := sctp.ResolveSCTPAddr("sctp", address)
+	if err != nil {
+		return nil, err
+	}
+	return sctp.ListenSCTP("sctp", addr)
+}
+
+// Stop closes the listeners and the NGAP associations of the AGFs, waits for the messages being handled, then closes the
+// capture, trace, recording and conformance report files. The Server cannot be started again, a new Server can be
+// once Stop returns.
+func (s *Server) Stop() {
+	runningMu.Lock()
+	defer runningMu.Unlock()
+	if running != s {
+		return
+	}
+	s.stop()
+	running = nil
+}
+
+// stop releases what Start acquired, the UE contexts being left in the AMF set until the next Start
+func (s *Server) stop() {
+	s.stopOnce.Do(func() {
+		close(stopping)
+		if s.grpcServer != nil {
+			s.grpcServer.Stop()
+		}
+		if s.metricsServer != nil {
+			s.metricsServer.Close()
+		}
+		for _, listener := range s.listeners {
+			listener.Close()
+		}
+		accepting.Wait()
+		context.RangeSetAGFContext(func(agf *context.AGFContext) bool {
+			agf.SCTPConn.Close()
+			agf.RangeTNLA(func(conn *sctp.SCTPConn) bool {
+				conn.Close()
+				return true
+			})
+			return true
+		})
+		serving.Wait()
+		ueDispatcher.stop()
+		context.RangeSetUEContext(func(ue *context.UEContext) bool {
+			ue.StopNASTimers()
+			if ue.Capture != nil {
+				ue.Capture.Close()
+				ue.Capture = nil
+			}
+			return true
+		})
+
+		context.AMFSelf.Capture.Close()
+		context.AMFSelf.Capture = nil
+		closeTrace()
+		recording.Global.Close()
+		recording.Global = nil
+		conformance.Global.Close()
+		conformance.Global = nil
+		replayer = nil
+		dropHeldMessages()
+		fault.Global = nil
+		s.unsubscribe()
+		close(s.done)
+		logger.MainLog.Info("sim-amf stopped")
+	})
+}
@@ -0,0 +1,263 @@
+package simamf
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"free5gc/lib/nas/nasMessage"
+	"free5gc/lib/ngap/ngapType"
+	"free5gc/lib/openapi/models"
+	"sim-amf/pkg/context"
+	"sim-amf/pkg/event"
+	"sim-amf/pkg/logger"
+)
+
+// cause5GSMRequestedServiceOptionNotSubscribed is the 5GSM cause #33 requested service option not subscribed, missing
+// from the nasMessage causes
+//
+// TS 24.501 9.11.4.2 5GSM cause
+const cause5GSMRequestedServiceOptionNotSubscribed uint8 = 0x21
+
+// sessionSelection is what the policy of the DNN selects for a PDU session accepted
+type sessionSelection struct {
+	policy         *context.DNN
+	pduSessionType uint8
+	sscMode        uint8
+	cause5GSM      uint8 // #50 or #51 if the IPv4v6 PDU session type requested is not allowed, or 0
+}
+
+// sessionRejection is a PDU Session Establishment Request not accepted by the policy of the DNN
+type sessionRejection struct {
+	cause5GSM       uint8
+	allowedSSCModes []uint8 // for #68 not supported SSC mode
+	backoff         time.Duration
+	reason          string
+}
+
+// ngapPDUSessionTypes are the NGAP PDU session types of the NAS ones
+var ngapPDUSessionTypes = map[uint8]ngapType.PDUSessionType{
+	nasMessage.PDUSessionTypeIPv4:         {Value: ngapType.PDUSessionTypePresentIpv4},
+	nasMessage.PDUSessionTypeIPv6:         {Value: ngapType.PDUSessionTypePresentIpv6},
+	nasMessage.PDUSessionTypeIPv4IPv6:     {Value: ngapType.PDUSessionTypePresentIpv4v6},
+	nasMessage.PDUSessionTypeUnstructured: {Value: ngapType.PDUSessionTypePresentUnstructured},
+	nasMessage.PDUSessionTypeEthernet:     {Value: ngapType.PDUSessionTypePresentEthernet},
+}
+
+// selectSession checks a PDU Session Establishment Request to the DNN and the slice against the policy of the DNN and
+// selects the PDU session type and SSC mode of the PDU session. Without DNN configured, the request is accepted with
+// a nil selection.
+//
+// TS 24.501 6.4.1.3 UE-requested PDU session establishment procedure accepted by the network, 6.4.1.4 not accepted
+// by the network
+func selectSession(dnn string, snssai models.Snssai, request *nasMessage.PDUSessionEstablishmentRequest) (
+	*sessionSelection, *sessionRejection) {
+	amf := context.AMFSelf
+	if len(amf.DNNs) == 0 {
+		return nil, nil
+	}
+	backoff := time.Duration(pduSessionBackoff) * time.Second
+	policy, ok := amf.FindDNN(dnn)
+	if !ok {
+		reason := fmt.Sprintf("DNN %s unknown", dnn)
+		if dnn == "" {
+			reason = "DNN missing"
+		}
+		return nil, &sessionRejection{cause5GSM: nasMessage.Cause5GSMMissingOrUnknownDNN, backoff: backoff,
+			reason: reason}
+	}
+	selection := &sessionSelection{policy: policy}
+	reject := func(cause5GSM uint8, format string, a ...interface{}) (*sessionSelection, *sessionRejection) {
+		return nil, &sessionRejection{cause5GSM: cause5GSM, backoff: policy.Backoff, reason: fmt.Sprintf(format, a...)}
+	}
+
+	var requestedType uint8
+	if request.PDUSessionType != nil {
+		requestedType = request.PDUSessionType.GetPDUSessionTypeValue()
+	}
+	var cause5GSM uint8
+	selection.pduSessionType, selection.cause5GSM, cause5GSM = selectPDUSessionType(policy, requestedType)
+	if cause5GSM != 0 {
+		return reject(cause5GSM, "PDU session type %d not allowed to DNN %s", requestedType, policy.Name)
+	}
+
+	if !policy.SnssaiAllowed(snssai) {
+		return reject(cause5GSMRequestedServiceOptionNotSubscribed, "DNN %s not served in S-NSSAI %+v", policy.Name,
+			snssai)
+	}
+
+	var identity string
+	if request.SMPDUDNRequestContainer != nil {
+		identity = string(request.SMPDUDNRequestContainer.GetDNSpecificIdentity())
+	}
+	if !policy.UserAllowed(identity) {
+		return reject(nasMessage.Cause5GSMUserAuthenticationOrAuthorizationFailed,
+			"DN-specific identity %q not authorized to DNN %s", identity, policy.Name)
+	}
+
+	selection.sscMode = 1
+	if len(policy.SSCModes) > 0 {
+		selection.sscMode = policy.SSCModes[0]
+	}
+	if request.SSCMode != nil {
+		selection.sscMode = request.SSCMode.GetSSCMode()
+	}
+	if !policy.SSCModeAllowed(selection.sscMode) {
+		_, rejection := reject(nasMessage.Cause5GSMNotSupportedSSCMode, "SSC mode %d not allowed to DNN %s",
+			selection.sscMode, policy.Name)
+		rejection.allowedSSCModes = policy.SSCModes
+		return nil, rejection
+	}
+	return selection, nil
+}
+
+// selectPDUSessionType returns the PDU session type selected for the one requested, 0 for none, with the 5GSM cause
+// #50 or #51 of an IPv4v6 PDU session type restricted to a single IP version, or the 5GSM cause of the PDU Session
+// Establishment Reject
+//
+// TS 24.501 6.4.1.3 UE-requested PDU session establishment procedure accepted by the network
+func selectPDUSessionType(policy *context.DNN, requested uint8) (selected uint8, cause5GSM uint8, rejectCause uint8) {
+	ipv4 := ipVersionAllowed(policy, nasMessage.PDUSessionTypeIPv4)
+	ipv6 := ipVersionAllowed(policy, nasMessage.PDUSessionTypeIPv6)
+	switch requested {
+	case 0:
+		selected = nasMessage.PDUSessionTypeIPv4
+		if len(policy.PDUSessionTypes) > 0 {
+			selected = policy.PDUSessionTypes[0]
+		}
+		if selected == nasMessage.PDUSessionTypeIPv4IPv6 && !(ipv4 && ipv6) && (ipv4 || ipv6) {
+			selected = nasMessage.PDUSessionTypeIPv4
+			if !ipv4 {
+				selected = nasMessage.PDUSessionTypeIPv6
+			}
+		}
+		return selected, 0, 0
+	case nasMessage.PDUSessionTypeIPv4IPv6:
+		switch {
+		case policy.PDUSessionTypeAllowed(nasMessage.PDUSessionTypeIPv4IPv6) && ipv4 && ipv6:
+			return requested, 0, 0
+		case ipv4:
+			return nasMessage.PDUSessionTypeIPv4, nasMessage.Cause5GSMPDUSessionTypeIPv4OnlyAllowed, 0
+		case ipv6:
+			return nasMessage.PDUSessionTypeIPv6, nasMessage.Cause5GSMPDUSessionTypeIPv6OnlyAllowed, 0
+		}
+	case nasMessage.PDUSessionTypeIPv4:
+		switch {
+		case ipv4:
+			return requested, 0, 0
+		case ipv6:
+			return 0, 0, nasMessage.Cause5GSMPDUSessionTypeIPv6OnlyAllowed
+		}
+	case nasMessage.PDUSessionTypeIPv6:
+		switch {
+		case ipv6:
+			return requested, 0, 0
+		case ipv4:
+			return 0, 0, nasMessage.Cause5GSMPDUSessionTypeIPv4OnlyAllowed
+		}
+	case nasMessage.PDUSessionTypeUnstructured, nasMessage.PDUSessionTypeEthernet:
+		if policy.PDUSessionTypeAllowed(requested) {
+			return requested, 0, 0
+		}
+	}
+	return 0, 0, nasMessage.Cause5GSMUnknownPDUSessionType
+}
+
+// ipVersionAllowed tells whether the PDU sessions to the DNN may be of the IPv4 or IPv6 PDU session type: the type is
+// allowed and, if the DNN allocates the addresses of the PDU sessions, it has a pool of the IP version, so that the
+// PDU address of an IPv4v6 PDU session carries both addresses
+func ipVersionAllowed(policy *context.DNN, pduSessionType uint8) bool {
+	if !policy.PDUSessionTypeAllowed(pduSessionType) {
+		return false
+	}
+	if pduSessionType == nasMessage.PDUSessionTypeIPv4 {
+		return policy.IPv4Pool != nil || policy.IPv6Pool == nil
+	}
+	return policy.IPv6Pool != nil || policy.IPv4Pool == nil
+}
+
+// applySession sets the policy, the selections and the Session-AMBR of the PDU session, the one of the subscriber
+// first, and allocates its addresses from the pools of the DNN, the static IPv4 address of the subscriber being
+// reserved in the IPv4 pool it belongs to. It returns false if a pool is exhausted or the static IPv4 address is
+// already allocated.
+func applySession(ue *context.UEContext, pduSession *context.PDUSession, selection *sessionSelection) bool {
+	policy := selection.policy
+	pduSession.Policy = policy
+	pduSession.Dnn = policy.Name
+	pduSession.PDUSessionType, pduSession.SSCMode = selection.pduSessionType, selection.sscMode
+	pduSession.Cause5GSM = selection.cause5GSM
+	ambrUL, ambrDL := policy.SessionAmbrUL, policy.SessionAmbrDL
+	if subscriber := ue.Subscriber; subscriber != nil && subscriber.SessionAmbrUL > 0 && subscriber.SessionAmbrDL > 0 {
+		ambrUL, ambrDL = subscriber.SessionAmbrUL, subscriber.SessionAmbrDL
+	}
+	if ambrUL > 0 && ambrDL > 0 {
+		pduSession.Ambr = &ngapType.PDUSessionAggregateMaximumBitRate{
+			PDUSessionAggregateMaximumBitRateUL: ngapType.BitRate{Value: ambrUL},
+			PDUSessionAggregateMaximumBitRateDL: ngapType.BitRate{Value: ambrDL},
+		}
+	}
+
+	ipv4 := selection.pduSessionType == nasMessage.PDUSessionTypeIPv4 ||
+		selection.pduSessionType == nasMessage.PDUSessionTypeIPv4IPv6
+	ipv6 := selection.pduSessionType == nasMessage.PDUSessionTypeIPv6 ||
+		selection.pduSessionType == nasMessage.PDUSessionTypeIPv4IPv6
+	var staticIP net.IP
+	if ue.Subscriber != nil {
+		staticIP = ue.Subscriber.StaticIPs[pduSession.Dnn]
+	}
+	switch {
+	case !ipv4:
+	case staticIP != nil:
+		if policy.IPv4Pool != nil && policy.IPv4Pool.Contains(staticIP) && !policy.IPv4Pool.Reserve(staticIP) {
+			logger.MainLog.Warn("[%s] Static IPv4 address %s of DNN %s already allocated from pool %s",
+				ue.LogTag("NAS"), staticIP, policy.Name, policy.IPv4Pool)
+			return false
+		}
+		pduSession.IPv4Address = staticIP
+	case policy.IPv4Pool != nil:
+		if pduSession.IPv4Address = policy.IPv4Pool.Allocate(); pduSession.IPv4Address == nil {
+			return false
+		}
+	}
+	if ipv6 && policy.IPv6Pool != nil {
+		if pduSession.IPv6Address = policy.IPv6Pool.Allocate(); pduSession.IPv6Address == nil {
+			pduSession.ReleaseAddresses()
+			return false
+		}
+	}
+
+	// an IPv4v6 PDU session addressed with a single IP version, e.g. the static IPv4 address of a DNN without pools,
+	// is restricted to it
+	if selection.pduSessionType == nasMessage.PDUSessionTypeIPv4IPv6 &&
+		(pduSession.IPv4Address == nil) != (pduSession.IPv6Address == nil) {
+		pduSession.PDUSessionType = nasMessage.PDUSessionTypeIPv4
+		pduSession.Cause5GSM = nasMessage.Cause5GSMPDUSessionTypeIPv4OnlyAllowed
+		if pduSession.IPv4Address == nil {
+			pduSession.PDUSessionType = nasMessage.PDUSessionTypeIPv6
+			pduSession.Cause5GSM = nasMessage.Cause5GSMPDUSessionTypeIPv6OnlyAllowed
+		}
+	}
+	if pduSessionType, ok := ngapPDUSessionTypes[pduSession.PDUSessionType]; ok {
+		pduSession.Type = &pduSessionType
+	}
+	return true
+}
+
+// sendPDUSessionEstablishmentReject rejects a PDU Session Establishment Request of the UE
+func sendPDUSessionEstablishmentReject(ue *context.UEContext, pduSessionID uint8, pti uint8,
+	rejection *sessionRejection) {
+	logger.MainLog.Warn("[%s] PDU Session[ID:%d] establishment rejected, 5GSM cause %d: %s", ue.LogTag("NAS"),
+		pduSessionID, rejection.cause5GSM, rejection.reason)
+	pkt, err := BuildPDUSessionEstablishmentReject(ue, pduSessionID, pti, rejection.cause5GSM,
+		rejection.allowedSSCModes, rejection.backoff)
+	if err != nil {
+		logger.MainLog.Error("Build PDU Session Establishment Reject failed: %+v", err)
+		return
+	}
+	if _, err = SendData(ue.SCTPConn(), pkt, "Server"); err != nil {
+		logger.MainLog.Error("Error %v", err)
+		return
+	}
+	event.Publish(ue, event.Event{Type: event.PDUSessionEstablishmentRejected, PDUSessionID: int64(pduSessionID),
+		Detail: fmt.Sprintf("5GSM cause %d: %s", rejection.cause5GSM, rejection.reason)})
+}
@@ -0,0 +1,77 @@
+package simamf
+
+import (
+	"testing"
+
+	"free5gc/lib/nas/nasMessage"
+	"sim-amf/pkg/context"
+)
+
+func TestSelectPDUSessionType(t *testing.T) {
+	const (
+		ipv4         = nasMessage.PDUSessionTypeIPv4
+		ipv6         = nasMessage.PDUSessionTypeIPv6
+		ipv4v6       = nasMessage.PDUSessionTypeIPv4IPv6
+		unstructured = nasMessage.PDUSessionTypeUnstructured
+		ethernet     = nasMessage.PDUSessionTypeEthernet
+		ipv4Only     = nasMessage.Cause5GSMPDUSessionTypeIPv4OnlyAllowed
+		ipv6Only     = nasMessage.Cause5GSMPDUSessionTypeIPv6OnlyAllowed
+		unknownType  = nasMessage.Cause5GSMUnknownPDUSessionType
+	)
+	pool := func(cidr string) *context.AddressPool {
+		pool, err := context.NewAddressPool(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pool
+	}
+	tests := []struct {
+		name        string
+		types       []uint8
+		ipv4Pool    string
+		ipv6Pool    string
+		requested   uint8
+		selected    uint8
+		cause5GSM   uint8
+		rejectCause uint8
+	}{
+		{name: "none requested, any allowed", requested: 0, selected: ipv4},
+		{name: "none requested, first allowed", types: []uint8{ipv6, ipv4}, requested: 0, selected: ipv6},
+		{name: "none requested, IPv4v6 with an IPv6 pool only", types: []uint8{ipv4v6}, ipv6Pool: "2001:db8::/64",
+			requested: 0, selected: ipv6},
+		{name: "IPv4v6 allowed", types: []uint8{ipv4v6}, requested: ipv4v6, selected: ipv4v6},
+		{name: "IPv4v6 with both pools", ipv4Pool: "10.60.0.0/16", ipv6Pool: "2001:db8::/64", requested: ipv4v6,
+			selected: ipv4v6},
+		{name: "IPv4v6 with an IPv4 pool only", types: []uint8{ipv4v6}, ipv4Pool: "10.60.0.0/16", requested: ipv4v6,
+			selected: ipv4, cause5GSM: ipv4Only},
+		{name: "IPv4v6 with an IPv6 pool only", ipv6Pool: "2001:db8::/64", requested: ipv4v6, selected: ipv6,
+			cause5GSM: ipv6Only},
+		{name: "IPv4v6 to an IPv4 DNN", types: []uint8{ipv4}, requested: ipv4v6, selected: ipv4, cause5GSM: ipv4Only},
+		{name: "IPv4v6 to an IPv6 DNN", types: []uint8{ipv6}, requested: ipv4v6, selected: ipv6, cause5GSM: ipv6Only},
+		{name: "IPv4v6 to an Ethernet DNN", types: []uint8{ethernet}, requested: ipv4v6, rejectCause: unknownType},
+		{name: "IPv4 allowed by IPv4v6", types: []uint8{ipv4v6}, requested: ipv4, selected: ipv4},
+		{name: "IPv4 to an IPv6 DNN", types: []uint8{ipv6}, requested: ipv4, rejectCause: ipv6Only},
+		{name: "IPv4 with an IPv6 pool only", ipv6Pool: "2001:db8::/64", requested: ipv4, rejectCause: ipv6Only},
+		{name: "IPv6 to an IPv4 DNN", types: []uint8{ipv4}, requested: ipv6, rejectCause: ipv4Only},
+		{name: "IPv6 with an IPv4 pool only", ipv4Pool: "10.60.0.0/16", requested: ipv6, rejectCause: ipv4Only},
+		{name: "IPv6 to an unstructured DNN", types: []uint8{unstructured}, requested: ipv6,
+			rejectCause: unknownType},
+		{name: "unstructured allowed", types: []uint8{unstructured}, requested: unstructured, selected: unstructured},
+		{name: "Ethernet to an IP DNN", types: []uint8{ipv4v6}, requested: ethernet, rejectCause: unknownType},
+		{name: "unknown type", requested: 7, rejectCause: unknownType},
+	}
+	for _, tt := range tests {
+		policy := &context.DNN{Name: "internet", PDUSessionTypes: tt.types}
+		if tt.ipv4Pool != "" {
+			policy.IPv4Pool = pool(tt.ipv4Pool)
+		}
+		if tt.ipv6Pool != "" {
+			policy.IPv6Pool = pool(tt.ipv6Pool)
+		}
+		selected, cause5GSM, rejectCause := selectPDUSessionType(policy, tt.requested)
+		if selected != tt.selected || cause5GSM != tt.cause5GSM || rejectCause != tt.rejectCause {
+			t.Errorf("%s: selectPDUSessionType() = %d, %d, %d, want %d, %d, %d", tt.name, selected, cause5GSM,
+				rejectCause, tt.selected, tt.cause5GSM, tt.rejectCause)
+		}
+	}
+}
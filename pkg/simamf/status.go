@@ -0,0 +1,268 @@
+package simamf
+
+import (
+	"errors"
+	"fmt"
+
+	lib_nas "free5gc/lib/nas"
+	"free5gc/lib/nas/nasMessage"
+	"sim-amf/pkg/conformance"
+	"sim-amf/pkg/context"
+	"sim-amf/pkg/logger"
+	"sim-amf/pkg/nas"
+	"sim-amf/pkg/util"
+)
+
+// Values of the PDU session identity and procedure transaction identity, TS 24.007 11.2.3.1b and 11.2.3.1a
+const (
+	pduSessionIDUnassigned uint8 = 0
+	pduSessionIDMax        uint8 = 15
+	ptiUnassigned          uint8 = 0
+	ptiReserved            uint8 = 0xff
+)
+
+// receiveNAS decodes an uplink 5GMM message of the UE and returns it if it may be processed. The message is answered
+// with a 5GMM STATUS if it is of an unknown type, has invalid mandatory or conditional IEs, is semantically incorrect or
+// is not compatible with the 5GMM state of the UE, and ignored if it is too short, of another protocol or fails the
+// integrity check.
+//
+// TS 24.501 clause 7 Handling of unknown, unforeseen, and erroneous protocol data
+func receiveNAS(ue *context.UEContext, nasPdu []byte) *lib_nas.Message {
+	msg, err := nas.Decode(ue, ue.RGType, nas.SecurityHeaderType(nasPdu), nasPdu)
+	var cause5GMM uint8
+	switch {
+	case err == nil:
+	case errors.Is(err, nas.ErrMessageTypeNonExistent):
+		cause5GMM = nasMessage.Cause5GMMMessageTypeNonExistentOrNotImplemented
+		conformance.Global.ReportNAS(ue, "", conformance.RuleNASMessageType, err.Error())
+	case errors.Is(err, nas.ErrInvalidMandatoryInformation):
+		cause5GMM = nasMessage.Cause5GMMInvalidMandatoryInformation
+	default:
+		logger.MainLog.Warn("[%s] NAS PDU ignored: %v", ue.LogTag("NAS"), err)
+		conformance.Global.ReportNAS(ue, "", conformance.RuleNASHeader, err.Error())
+		return nil
+	}
+	if msg.GmmMessage == nil {
+		logger.MainLog.Warn("[%s] 5GSM message ignored out of an UL NAS Transport", ue.LogTag("NAS"))
+		return nil
+	}
+
+	messageType := msg.GmmMessage.GetMessageType()
+	if !integrityChecked(ue, msg) {
+		logger.MainLog.Warn("[%s] %s failed the integrity check, discarded", ue.LogTag("NAS"),
+			util.NasMessageTypeName(messageType))
+		detail := "not integrity protected with a 5G NAS security context"
+		if ue.MacFailed {
+			detail = "MAC verification failed"
+		}
+		conformance.Global.ReportNAS(ue, util.NasMessageTypeName(messageType), conformance.RuleNASIntegrity, detail)
+		return nil
+	}
+	if cause5GMM == 0 {
+		cause5GMM = gmmMessageCause(msg.GmmMessage)
+	}
+	if cause5GMM != 0 && cause5GMM != nasMessage.Cause5GMMMessageTypeNonExistentOrNotImplemented {
+		conformance.Global.ReportNAS(ue, util.NasMessageTypeName(messageType), conformance.RuleNASMandatoryIE,
+			fmt.Sprintf("5GMM cause %d", cause5GMM))
+	}
+	if cause5GMM == 0 && !ue.GmmMessageCompatible(messageType) {
+		cause5GMM = nasMessage.Cause5GMMMessageTypeNotCompatibleWithTheProtocolState
+		conformance.Global.ReportNAS(ue, util.NasMessageTypeName(messageType), conformance.RuleNASProtocolState,
+			"message type not compatible with the 5GMM state")
+	}
+	if cause5GMM != 0 {
+		logger.MainLog.Warn("[%s] %s not processed, 5GMM cause %d: %v", ue.LogTag("NAS"),
+			util.NasMessageTypeName(messageType), cause5GMM, err)
+		sendStatus5GMM(ue, cause5GMM)
+		return nil
+	}
+	return msg
+}
+
+// gmmMessageCause returns the 5GMM cause of an uplink 5GMM message of which a mandatory IE is empty, a conditional IE
+// is missing or the contents are semantically incorrect, or 0 for a valid message
+//
+// TS 24.501 7.5 Non-semantical mandatory information element errors, 7.7 Non-imperative message part errors, 7.8
+// Messages with semantically incorrect contents
+func gmmMessageCause(gmmMessage *lib_nas.GmmMessage) uint8 {
+	switch gmmMessage.GetMessageType() {
+	case lib_nas.MsgTypeRegistrationRequest:
+		registrationRequest := gmmMessage.RegistrationRequest
+		contents := registrationRequest.MobileIdentity5GS.GetMobileIdentity5GSContents()
+		if len(contents) == 0 {
+			return nasMessage.Cause5GMMInvalidMandatoryInformation
+		}
+		// no identity is only presented for an emergency registration
+		if contents[0]&0x07 == nasMessage.MobileIdentity5GSTypeNoIdentity &&
+			registrationRequest.NgksiAndRegistrationType5GS.GetRegistrationType5GS() !=
+				nasMessage.RegistrationType5GSEmergencyRegistration {
+			return nasMessage.Cause5GMMSemanticallyIncorrectMessage
+		}
+	case lib_nas.MsgTypeDeregistrationRequestUEOriginatingDeregistration:
+		deregistrationRequest := gmmMessage.DeregistrationRequestUEOriginatingDeregistration
+		if len(deregistrationRequest.MobileIdentity5GS.GetMobileIdentity5GSContents()) == 0 {
+			return nasMessage.Cause5GMMInvalidMandatoryInformation
+		}
+	case lib_nas.MsgTypeServiceRequest:
+		if gmmMessage.ServiceRequest.TMSI5GS.GetLen() == 0 {
+			return nasMessage.Cause5GMMInvalidMandatoryInformation
+		}
+	case lib_nas.MsgTypeIdentityResponse:
+		if gmmMessage.IdentityResponse.MobileIdentity.GetLen() == 0 {
+			return nasMessage.Cause5GMMInvalidMandatoryInformation
+		}
+	case lib_nas.MsgTypeULNASTransport:
+		ulNASTransport := gmmMessage.ULNASTransport
+		if ulNASTransport.PayloadContainer.GetLen() == 0 {
+			return nasMessage.Cause5GMMInvalidMandatoryInformation
+		}
+		switch ulNASTransport.GetPayloadContainerType() {
+		case nasMessage.PayloadContainerTypeN1SMInfo:
+			// the PDU session ID is included with an N1 SM information, TS 24.501 8.2.10.2
+			if ulNASTransport.PduSessionID2Value == nil {
+				return nasMessage.Cause5GMMConditionalIEError
+			}
+		case 0:
+			// reserved payload container type, TS 24.501 9.11.3.40
+			return nasMessage.Cause5GMMSemanticallyIncorrectMessage
+		}
+	}
+	return 0
+}
+
+// sendStatus5GMM reports to the UE an uplink 5GMM message which cannot be processed
+//
+// TS 24.501 5.4.6 5GMM status procedure
+func sendStatus5GMM(ue *context.UEContext, cause5GMM uint8) {
+	if ue.AGF == nil {
+		return
+	}
+	pkt, err := BuildStatus5GMM(ue, cause5GMM)
+	if err != nil {
+		logger.MainLog.Error("Error %v", err)
+		return
+	}
+	if _, err = SendData(ue.SCTPConn(), pkt, "Server"); err != nil {
+		logger.MainLog.Error("Error %v", err)
+	}
+}
+
+// handleStatus5GMM handles a 5GMM STATUS of the UE, of which the actions are implementation dependent: the erroneous
+// message of sim-amf is only reported
+//
+// TS 24.501 5.4.6 5GMM status procedure
+func handleStatus5GMM(ue *context.UEContext, status5GMM *nasMessage.Status5GMM) {
+	logger.MainLog.Warn("[%s] 5GMM STATUS cause %d", ue.LogTag("NAS"), status5GMM.GetCauseValue())
+}
+
+// receiveN1SM decodes the 5GSM message of an UL NAS Transport and returns it if it may be processed. The message is
+// answered with a 5GSM STATUS if it is of an unknown type, has invalid mandatory IEs, an invalid PTI or PDU session ID,
+// or is not compatible with the protocol state, and ignored if it is too short.
+//
+// TS 24.501 7.3 Unknown or unforeseen procedure transaction identity or PDU session identity, 7.4 Message type
+// non-existent or not implemented, 7.5 Non-semantical mandatory information element errors
+func receiveN1SM(ue *context.UEContext, payload []byte) *lib_nas.Message {
+	msg, err := nas.DecodeN1SM(payload)
+	var cause5GSM uint8
+	switch {
+	case err == nil:
+	case errors.Is(err, nas.ErrMessageTypeNonExistent):
+		cause5GSM = nasMessage.Cause5GSMMessageTypeNonExistentOrNotImplemented
+	case errors.Is(err, nas.ErrInvalidMandatoryInformation):
+		cause5GSM = nasMessage.Cause5GSMInvalidMandatoryInformation
+	default:
+		logger.MainLog.Warn("[%s] N1 SM information ignored: %v", ue.LogTag("NAS"), err)
+		return nil
+	}
+
+	// PDU session ID and PTI are the 2nd and 3rd octets of the 5GSM header, TS 24.501 8.3.1
+	pduSessionID, pti := payload[1], payload[2]
+	var messageType uint8
+	if msg.GsmMessage != nil {
+		messageType = msg.GsmMessage.GetMessageType()
+	}
+	if cause5GSM == 0 {
+		cause5GSM = gsmMessageCause(ue, messageType, pduSessionID, pti)
+	}
+	if cause5GSM != 0 {
+		logger.MainLog.Warn("[%s] PDU Session[ID:%d] %s not processed, 5GSM cause %d: %v", ue.LogTag("NAS"),
+			pduSessionID, util.NasMessageTypeName(messageType), cause5GSM, err)
+		sendStatus5GSM(ue, pduSessionID, pti, cause5GSM)
+		return nil
+	}
+	return msg
+}
+
+// gsmMessageCause returns the 5GSM cause of an uplink 5GSM message not sent by a UE, not implemented, or of an invalid
+// PTI or PDU session ID, or 0 for a valid message
+//
+// TS 24.501 7.3.1 Procedure transaction identity, 7.3.2 PDU session identity, 7.4 Message type non-existent or not
+// implemented
+func gsmMessageCause(ue *context.UEContext, messageType uint8, pduSessionID uint8, pti uint8) uint8 {
+	switch messageType {
+	case lib_nas.MsgTypePDUSessionEstablishmentAccept,
+		lib_nas.MsgTypePDUSessionEstablishmentReject,
+		lib_nas.MsgTypePDUSessionAuthenticationCommand,
+		lib_nas.MsgTypePDUSessionAuthenticationResult,
+		lib_nas.MsgTypePDUSessionModificationReject,
+		lib_nas.MsgTypePDUSessionModificationCommand,
+		lib_nas.MsgTypePDUSessionReleaseReject,
+		lib_nas.MsgTypePDUSessionReleaseCommand:
+		// sent by the network only
+		return nasMessage.Cause5GSMMessageTypeNotCompatibleWithTheProtocolState
+	case lib_nas.MsgTypePDUSessionAuthenticationComplete,
+		lib_nas.MsgTypePDUSessionModificationRequest:
+		return nasMessage.Cause5GSMMessageTypeNonExistentOrNotImplemented
+	}
+
+	if pduSessionID == pduSessionIDUnassigned || pduSessionID > pduSessionIDMax {
+		return nasMessage.Cause5GSMInvalidPDUSessionIdentity
+	}
+	switch messageType {
+	case lib_nas.MsgTypePDUSessionEstablishmentRequest, lib_nas.MsgTypePDUSessionReleaseRequest:
+		// the UE requested procedures are assigned a PTI
+		if pti == ptiUnassigned || pti == ptiReserved {
+			return nasMessage.Cause5GSMInvalidPTIValue
+		}
+	}
+	switch messageType {
+	case lib_nas.MsgTypePDUSessionReleaseRequest, lib_nas.MsgTypePDUSessionModificationComplete,
+		lib_nas.MsgTypePDUSessionModificationCommandReject:
+		if ue.FindPDUSession(int64(pduSessionID)) == nil {
+			return nasMessage.Cause5GSMInvalidPDUSessionIdentity
+		}
+	}
+	return 0
+}
+
+// sendStatus5GSM reports to the UE an uplink 5GSM message which cannot be processed, in a DL NAS Transport
+//
+// TS 24.501 6.5.3 5GSM status procedure
+func sendStatus5GSM(ue *context.UEContext, pduSessionID uint8, pti uint8, cause5GSM uint8) {
+	if ue.AGF == nil {
+		return
+	}
+	pkt, err := BuildStatus5GSM(ue, pduSessionID, pti, cause5GSM)
+	if err != nil {
+		logger.MainLog.Error("Error %v", err)
+		return
+	}
+	if _, err = SendData(ue.SCTPConn(), pkt, "Server"); err != nil {
+		logger.MainLog.Error("Error %v", err)
+	}
+}
+
+// handleStatus5GSM handles a 5GSM STATUS of the UE: the PDU session the UE reports an invalid PDU session identity
+// for is released locally, the other causes are only reported
+//
+// TS 24.501 6.5.3 5GSM status procedure
+func handleStatus5GSM(ue *context.UEContext, status5GSM *nasMessage.Status5GSM) {
+	pduSessionID, cause5GSM := status5GSM.GetPDUSessionID(), status5GSM.GetCauseValue()
+	logger.MainLog.Warn("[%s] PDU Session[ID:%d] 5GSM STATUS cause %d", ue.LogTag("NAS"), pduSessionID, cause5GSM)
+	if cause5GSM == nasMessage.Cause5GSMInvalidPDUSessionIdentity && ue.FindPDUSession(int64(pduSessionID)) != nil {
+		logger.MainLog.Info("[%s] Release PDU Session[ID:%d] unknown to the UE", ue.LogTag("NAS"), pduSessionID)
+		if err := ue.DeletePDUSession(int64(pduSessionID)); err != nil {
+			logger.MainLog.Warn("[%s] %v", ue.LogTag("NAS"), err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package simamf
+
+import (
+	"testing"
+
+	lib_nas "free5gc/lib/nas"
+	"free5gc/lib/nas/nasMessage"
+	"free5gc/lib/nas/nasTestpacket"
+	"sim-amf/pkg/context"
+)
+
+func TestStatus5GMM(t *testing.T) {
+	tests := []struct {
+		name               string
+		nasPdu             []byte
+		securityHeaderType uint8
+		cause5GMM          uint8
+	}{
+		{
+			name:               "security mode complete out of a security mode control procedure",
+			nasPdu:             nasTestpacket.GetSecurityModeComplete(nil),
+			securityHeaderType: lib_nas.SecurityHeaderTypeIntegrityProtectedAndCiphered,
+			cause5GMM:          nasMessage.Cause5GMMMessageTypeNotCompatibleWithTheProtocolState,
+		},
+		{
+			name:               "authentication response out of an authentication procedure",
+			nasPdu:             nasTestpacket.GetAuthenticationResponse(make([]uint8, 16), ""),
+			securityHeaderType: lib_nas.SecurityHeaderTypePlainNas,
+			cause5GMM:          nasMessage.Cause5GMMMessageTypeNotCompatibleWithTheProtocolState,
+		},
+		{
+			name:               "unknown message type",
+			nasPdu:             []byte{nasMessage.Epd5GSMobilityManagementMessage, lib_nas.SecurityHeaderTypePlainNas, 0xff},
+			securityHeaderType: lib_nas.SecurityHeaderTypeIntegrityProtectedAndCiphered,
+			cause5GMM:          nasMessage.Cause5GMMMessageTypeNonExistentOrNotImplemented,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAGF(t, DefaultOptions())
+			rg := a.newRG(1)
+			rg.register()
+
+			nasPdu := tt.nasPdu
+			if tt.securityHeaderType != lib_nas.SecurityHeaderTypePlainNas {
+				nasPdu = rg.protect(nasPdu, tt.securityHeaderType)
+			}
+			rg.uplinkNAS(nasPdu)
+			status := rg.receiveNAS("DownlinkNASTransport", lib_nas.MsgTypeStatus5GMM)
+			if cause := status.Status5GMM.Cause5GMM.GetCauseValue(); cause != tt.cause5GMM {
+				t.Errorf("5GMM STATUS cause %d, want %d", cause, tt.cause5GMM)
+			}
+			a.silent()
+			if ue := rg.ue(); !ue.Registered() {
+				t.Errorf("UE %s after the 5GMM STATUS, want %s", ue.StateMachineIndex, context.GmmRegistered)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package simamf
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"free5gc/lib/openapi/models"
+	"sim-amf/pkg/context"
+
+	"gopkg.in/yaml.v2"
+)
+
+// UE-AMBR of the subscribers without one, in bps
+const (
+	defaultUeAmbrUL int64 = 100000000
+	defaultUeAmbrDL int64 = 200000000
+)
+
+var (
+	// subscribersFile is the YAML or JSON subscriber database, the UEs not found in it being rejected
+	subscribersFile string
+	// subscribersMu serializes the reloads of the subscribers
+	subscribersMu sync.Mutex
+)
+
+// subscribersFileContents is the subscriber database, e.g.
+//
+//	subscribers:
+//	- supi: type2.rid0.schid0.userid00077...@5gc.mnc93.mcc208.3gppnetwork.org
+//	  mac: 02:42:d5:32:74:11
+//	  nssai: [1-112233*, 2]
+//	  dnns: [internet]
+//	  ueAmbr: {uplink: 100000000, downlink: 200000000}
+//	  staticIps: {internet: 10.60.0.1}
+//	- imsi: "208930000000001"
+//	  k: 8baf473f2f8fd09487cccbd7097c6862
+//	  opc: 8e27b6af0e692e750f32667a3b14605d
+//	  barred: true
+//	- gci: cm-0011.2233.4455
+//	  dnns: [internet]
+//	  trace: {id: 02f8390000010001, interfaces: [ng-c], depth: maximum, collectionEntity: 10.100.200.1}
+type subscribersFileContents struct {
+	Subscribers []subscriberEntry `yaml:"subscribers" json:"subscribers"`
+}
+
+// subscriberEntry is the subscription data of a UE keyed by its SUPI, IMSI, Global Cable Identifier and MAC address,
+// any of them
+type subscriberEntry struct {
+	Supi        string            `yaml:"supi,omitempty" json:"supi,omitempty"`
+	Imsi        string            `yaml:"imsi,omitempty" json:"imsi,omitempty"`
+	Gci         string            `yaml:"gci,omitempty" json:"gci,omitempty"`
+	MAC         string            `yaml:"mac,omitempty" json:"mac,omitempty"`
+	K           string            `yaml:"k,omitempty" json:"k,omitempty"`
+	OPc         string            `yaml:"opc,omitempty" json:"opc,omitempty"`
+	Nssai       []string          `yaml:"nssai,omitempty" json:"nssai,omitempty"`
+	Dnns        []string          `yaml:"dnns,omitempty" json:"dnns,omitempty"`
+	UeAmbr      bitRates          `yaml:"ueAmbr,omitempty" json:"ueAmbr,omitempty"`
+	SessionAmbr bitRates          `yaml:"sessionAmbr,omitempty" json:"sessionAmbr,omitempty"`
+	StaticIPs   map[string]string `yaml:"staticIps,omitempty" json:"staticIps,omitempty"`
+	Barred      bool              `yaml:"barred,omitempty" json:"barred,omitempty"`
+	Trace       *traceEntry       `yaml:"trace,omitempty" json:"trace,omitempty"`
+}
+
+// bitRates is an aggregate maximum bit rate in bps
+type bitRates struct {
+	Uplink   int64 `yaml:"uplink" json:"uplink"`
+	Downlink int64 `yaml:"downlink" json:"downlink"`
+}
+
+// loadSubscribers sets the subscribers of AMFSelf from the --subscriber flags and the subscriber database, and returns
+// their number. The subscribers are left unchanged on error.
+func loadSubscribers() (int, error) {
+	subscribersMu.Lock()
+	defer subscribersMu.Unlock()
+
+	defaultNssai, err := parseSubscribedNssai(subscribedNssai)
+	if err != nil {
+		return 0, err
+	}
+
+	subscriberMap := make(map[string]*context.Subscriber)
+	for _, item := range subscribers {
+		subscriber, err := parseSubscriber(item)
+		if err != nil {
+			return 0, err
+		}
+		subscriberMap[subscriber.ID] = subscriber
+	}
+
+	var defaultSubscriber *context.Subscriber
+	if subscribersFile == "" {
+		// the UEs not configured as subscribers share the subscribed NSSAI of the default subscriber
+		defaultSubscriber = &context.Subscriber{SubscribedNssai: defaultNssai}
+	} else {
+		entries, err := readSubscribersFile(subscribersFile)
+		if err != nil {
+			return 0, err
+		}
+		for i, entry := range entries {
+			subscriber, ids, err := entry.subscriber(defaultNssai)
+			if err != nil {
+				return 0, fmt.Errorf("%s: subscriber %d: %v", subscribersFile, i, err)
+			}
+			for _, id := range ids {
+				subscriberMap[id] = subscriber
+			}
+		}
+	}
+
+	context.AMFSelf.ReplaceSubscribers(subscriberMap)
+	context.AMFSelf.DefaultSubscriber = defaultSubscriber
+	return len(subscriberMap), nil
+}
+
+// readSubscribersFile decodes the subscriber database, JSON if the file name ends with .json and YAML otherwise
+func readSubscribersFile(name string) ([]subscriberEntry, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var contents subscribersFileContents
+	if strings.EqualFold(filepath.Ext(name), ".json") {
+		err = json.Unmarshal(data, &contents)
+	} else {
+		err = yaml.Unmarshal(data, &contents)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return contents.Subscribers, nil
+}
+
+// subscriber returns the Subscriber of the entry and the identities it is keyed by. The IMSI is keyed both as is and
+// as an imsi- SUPI, the GCI as is, the MAC address in lower case.
+func (entry *subscriberEntry) subscriber(defaultNssai []models.SubscribedSnssai) (*context.Subscriber, []string, error) {
+	var ids []string
+	if entry.Supi != "" {
+		ids = append(ids, entry.Supi)
+	}
+	if entry.Imsi != "" {
+		ids = append(ids, entry.Imsi, "imsi-"+entry.Imsi)
+	}
+	if entry.Gci != "" {
+		ids = append(ids, entry.Gci)
+	}
+	if entry.MAC != "" {
+		mac, err := net.ParseMAC(entry.MAC)
+		if err != nil {
+			return nil, nil, err
+		}
+		ids = append(ids, mac.String())
+	}
+	if len(ids) == 0 {
+		return nil, nil, fmt.Errorf("no supi, imsi, gci nor mac")
+	}
+
+	subscriber := &context.Subscriber{
+		ID:              ids[0],
+		SubscribedNssai: defaultNssai,
+		Dnns:            entry.Dnns,
+		UeAmbrUL:        entry.UeAmbr.Uplink,
+		UeAmbrDL:        entry.UeAmbr.Downlink,
+		SessionAmbrUL:   entry.SessionAmbr.Uplink,
+		SessionAmbrDL:   entry.SessionAmbr.Downlink,
+		Barred:          entry.Barred,
+	}
+	var err error
+	if subscriber.K, err = parseKey("k", entry.K); err != nil {
+		return nil, nil, err
+	}
+	if subscriber.OPc, err = parseKey("opc", entry.OPc); err != nil {
+		return nil, nil, err
+	}
+	if len(entry.Nssai) > 0 {
+		if subscriber.SubscribedNssai, err = parseSubscribedNssai(entry.Nssai); err != nil {
+			return nil, nil, err
+		}
+	}
+	if entry.Trace != nil {
+		trace := entry.Trace
+		if subscriber.Trace, err = parseTraceSettings(trace.ID, trace.Interfaces, trace.Depth,
+			trace.CollectionEntity); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(entry.StaticIPs) > 0 {
+		subscriber.StaticIPs = make(map[string]net.IP)
+		for dnn, address := range entry.StaticIPs {
+			ip := net.ParseIP(address).To4()
+			if ip == nil {
+				return nil, nil, fmt.Errorf("invalid static IPv4 address %s of DNN %s", address, dnn)
+			}
+			subscriber.StaticIPs[dnn] = ip
+		}
+	}
+	return subscriber, ids, nil
+}
+
+// parseKey parses a 128 bits key given as 32 hex digits, empty if not given
+func parseKey(name string, s string) ([]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+	key, err := hex.DecodeString(s)
+	if err != nil || len(key) != 16 {
+		return nil, fmt.Errorf("invalid %s %s, expecting 32 hex digits", name, s)
+	}
+	return key, nil
+}
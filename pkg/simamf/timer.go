@@ -0,0 +1,143 @@
+package simamf
+
+import (
+	"fmt"
+	"time"
+
+	"free5gc/lib/aper"
+	"free5gc/lib/ngap/ngapType"
+	"sim-amf/pkg/context"
+	"sim-amf/pkg/event"
+	"sim-amf/pkg/logger"
+	"sim-amf/pkg/metrics"
+	"sim-amf/pkg/util"
+)
+
+var (
+	t3522Value            int
+	t3550Value            int
+	t3560Value            int
+	t3570Value            int
+	nasMaxRetransmissions int
+)
+
+// initNASTimers sets the network side 5GMM timers of the UE, and the ones it is given in the Registration Accept, to the
+// configured values
+func initNASTimers(ue *context.UEContext) {
+	ue.T3512Value = t3512Value
+	ue.Non3GppDeregistrationTimerValue = non3gppDeregTimer
+	ue.T3522Value = t3522Value
+	ue.T3550Value = t3550Value
+	ue.T3560Value = t3560Value
+	ue.T3570Value = t3570Value
+	ue.MaxT3522RetryTimes = nasMaxRetransmissions
+	ue.MaxT3550RetryTimes = nasMaxRetransmissions
+	ue.MaxT3560RetryTimes = nasMaxRetransmissions
+	ue.MaxT3570RetryTimes = nasMaxRetransmissions
+}
+
+// sendGuardedNAS sends the NGAP message carrying a downlink NAS message of which the reply is awaited, and starts the
+// 5GMM timer retransmitting it until the reply is received. The message is built again on each retransmission, so
+// that it is protected with a new downlink NAS COUNT and carries the current NGAP IDs of the UE.
+func sendGuardedNAS(ue *context.UEContext, timerName string, messageType uint8, build func() ([]byte, error)) error {
+	if ue.AGF == nil {
+		return fmt.Errorf("UE %d is not served by any AGF", ue.AmfUeNgapId)
+	}
+	pkt, err := build()
+	if err != nil {
+		return err
+	}
+	if _, err := SendData(ue.SCTPConn(), pkt, "Server"); err != nil {
+		return err
+	}
+	ue.StartNASTimer(timerName, nasTimerExpired(ue, messageType, build))
+	return nil
+}
+
+// nasTimerExpired returns the expiry handler of a 5GMM timer, run by the worker of the UE
+func nasTimerExpired(ue *context.UEContext, messageType uint8, build func() ([]byte, error)) func(t *context.NASTimer) {
+	procedure := util.NasMessageTypeName(messageType)
+	var expired func(t *context.NASTimer)
+	expired = func(t *context.NASTimer) {
+		dispatchUE(ue, func() {
+			running, retransmit := ue.NASTimerExpired(t)
+			if !running {
+				return
+			}
+			if !retransmit {
+				logger.MainLog.Warn("[%s] %s expired %d times, %s aborted", ue.LogTag("NAS"), t.Name,
+					t.ExpireTimes, procedure)
+				metrics.CountNASTimerExpiry(t.Name, metrics.OutcomeAborted)
+				event.Publish(ue, event.Event{
+					Type:        event.ProcedureAborted,
+					Timer:       t.Name,
+					ExpireTimes: t.ExpireTimes,
+					Procedure:   procedure,
+				})
+				abortNASProcedure(ue, t.Name)
+				return
+			}
+
+			logger.MainLog.Info("[%s] %s expired, retransmission %d of %s", ue.LogTag("NAS"), t.Name,
+				t.ExpireTimes, procedure)
+			metrics.CountNASTimerExpiry(t.Name, metrics.OutcomeRetransmitted)
+			event.Publish(ue, event.Event{
+				Type:        event.NASTimerExpired,
+				Timer:       t.Name,
+				ExpireTimes: t.ExpireTimes,
+				Procedure:   procedure,
+			})
+			if ue.AGF == nil {
+				return
+			}
+			pkt, err := build()
+			if err != nil {
+				logger.MainLog.Error("Build %s failed: %+v", procedure, err)
+				return
+			}
+			if _, err = SendData(ue.SCTPConn(), pkt, "Server"); err != nil {
+				logger.MainLog.Error("Error %v", err)
+			}
+			ue.RestartNASTimer(t, expired)
+		})
+	}
+	return expired
+}
+
+// abortNASProcedure ends the procedure of which the 5GMM timer expired after the maximum retransmissions
+//
+// TS 24.501 5.4.2.7, 5.4.3.7, 5.5.1.2.8, 5.5.2.3.5 Abnormal cases on the network side
+func abortNASProcedure(ue *context.UEContext, timerName string) {
+	switch timerName {
+	case context.T3550:
+		// the UE is considered registered
+		ue.RegistrationStartTime = time.Time{}
+	case context.T3560, context.T3570:
+		if timerName == context.T3560 && ue.PreviousSecurityContext != nil {
+			abortRekeying(ue, "T3560 expired")
+			return
+		}
+		gmmEvent(ue, context.GmmEventRegistrationRejected)
+		sendUEContextReleaseCommand(ue, ngapType.CauseNasPresentUnspecified)
+	case context.T3522:
+		ue.SetAttached(0)
+		gmmEvent(ue, context.GmmEventDeregistered)
+		sendUEContextReleaseCommand(ue, ngapType.CauseNasPresentDeregister)
+	}
+}
+
+// sendUEContextReleaseCommand releases the NG connection of the UE with a NAS cause
+func sendUEContextReleaseCommand(ue *context.UEContext, causeValue aper.Enumerated) {
+	if ue.AGF == nil {
+		return
+	}
+	cause, _ := util.NgapCause(ngapType.CausePresentNas, causeValue)
+	pkt, err := BuildUEContextReleaseCommand(ue, cause)
+	if err != nil {
+		logger.MainLog.Error("Error %v", err)
+		return
+	}
+	if _, err = SendData(ue.SCTPConn(), pkt, "Server"); err != nil {
+		logger.MainLog.Error("Error %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package simamf
+
+import (
+	"bytes"
+	gocontext "context"
+	"testing"
+	"time"
+
+	lib_nas "free5gc/lib/nas"
+	"free5gc/lib/nas/nasMessage"
+	"free5gc/lib/nas/nasTestpacket"
+	"sim-amf/pkg/api"
+	"sim-amf/pkg/context"
+	"sim-amf/pkg/event"
+	"sim-amf/pkg/recording"
+)
+
+// timerOptions are the options of the timer tests: T3560 of 1 second and a single retransmission
+func timerOptions() Options {
+	opts := DefaultOptions()
+	opts.T3560 = 1
+	opts.NASRetransmissions = 1
+	return opts
+}
+
+// downlinkNASCount returns the NAS COUNT of the security protected NAS message carried by a Downlink NAS Transport
+func (rg *testRG) downlinkNASCount() uint8 {
+	rg.agf.t.Helper()
+	nasPdus := recording.NASPDUs(rg.receive("DownlinkNASTransport"))
+	if len(nasPdus) == 0 || len(nasPdus[0].Value) < 7 {
+		rg.agf.t.Fatalf("DownlinkNASTransport without security protected NAS-PDU")
+	}
+	return nasPdus[0].Value[6]
+}
+
+// waitEvent returns the next event of the type published, failing the test after 5 seconds
+func waitEvent(t *testing.T, events <-chan event.Event, eventType event.Type) event.Event {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-events:
+			if e.Type == eventType {
+				return e
+			}
+		case <-timeout:
+			t.Fatalf("no %s event", eventType)
+		}
+	}
+}
+
+func TestSecurityModeCommandRetransmission(t *testing.T) {
+	a := newTestAGF(t, timerOptions())
+	rg := a.newRG(1)
+	rg.initialUEMessage(nasTestpacket.GetRegistrationRequestWith5GMM(nasMessage.RegistrationType5GSInitialRegistration,
+		testSuci, nil, nil, testSecurityCapability))
+	authenticationRequest := rg.receiveNAS("DownlinkNASTransport", lib_nas.MsgTypeAuthenticationRequest)
+	rg.uplinkNAS(rg.authenticate(authenticationRequest.AuthenticationRequest))
+	rg.receiveNAS("DownlinkNASTransport", lib_nas.MsgTypeSecurityModeCommand)
+	count := rg.dlCount
+
+	// the retransmission on the T3560 expiry is protected with the next downlink NAS COUNT
+	rg.receiveNAS("DownlinkNASTransport", lib_nas.MsgTypeSecurityModeCommand)
+	if rg.dlCount != count+1 {
+		t.Errorf("retransmitted Security Mode Command NAS COUNT = %d, want %d", rg.dlCount-1, count)
+	}
+	ue := rg.ue()
+	if ue.T3560 == nil || ue.T3560.ExpireTimes != 1 {
+		t.Fatalf("T3560 = %+v after the retransmission, want running with 1 expiry", ue.T3560)
+	}
+
+	// the registration goes on with the reply to the retransmission
+	rg.uplinkNAS(rg.protect(nasTestpacket.GetSecurityModeComplete(nil),
+		lib_nas.SecurityHeaderTypeIntegrityProtectedAndCipheredWithNew5gNasSecurityContext))
+	rg.receive("InitialContextSetupRequest")
+	if ue = rg.ue(); ue.T3560 != nil {
+		t.Errorf("T3560 running after the Security Mode Complete")
+	}
+}
+
+func TestSecurityModeCommandAborted(t *testing.T) {
+	a := newTestAGF(t, timerOptions())
+	events, unsubscribe := event.Subscribe(16)
+	defer unsubscribe()
+	rg := a.newRG(1)
+	rg.initialUEMessage(nasTestpacket.GetRegistrationRequestWith5GMM(nasMessage.RegistrationType5GSInitialRegistration,
+		testSuci, nil, nil, testSecurityCapability))
+	authenticationRequest := rg.receiveNAS("DownlinkNASTransport", lib_nas.MsgTypeAuthenticationRequest)
+	rg.uplinkNAS(rg.authenticate(authenticationRequest.AuthenticationRequest))
+	first := rg.downlinkNASCount()
+	if retransmitted := rg.downlinkNASCount(); retransmitted != first+1 {
+		t.Errorf("retransmitted Security Mode Command NAS COUNT = %d, want %d", retransmitted, first+1)
+	}
+
+	// the registration is aborted on the expiry following the last retransmission
+	rg.receive("UEContextReleaseCommand")
+	if e := waitEvent(t, events, event.ProcedureAborted); e.Timer != context.T3560 || e.ExpireTimes != 2 {
+		t.Errorf("%s aborted on %s expiry %d, want %s expiry 2", e.Procedure, e.Timer, e.ExpireTimes, context.T3560)
+	}
+	ue := rg.ue()
+	if ue.StateMachineIndex != context.GmmDeregistered || ue.T3560 != nil {
+		t.Errorf("UE %s, T3560 running %v after the registration aborted, want %s", ue.StateMachineIndex,
+			ue.T3560 != nil, context.GmmDeregistered)
+	}
+	a.silent()
+}
+
+func TestRekeyingAborted(t *testing.T) {
+	a := newTestAGF(t, timerOptions())
+	rg := a.newRG(1)
+	ue := rg.register()
+	previous := ue.CurrentNASSecurityContext()
+	events, unsubscribe := event.Subscribe(16)
+	defer unsubscribe()
+
+	req := &api.RekeyNASRequest{UESelector: api.UESelector{AmfUeNgapID: ue.AmfUeNgapId}, NewNgKsi: true}
+	if _, err := new(apiServer).RekeyNAS(gocontext.Background(), req); err != nil {
+		t.Fatalf("RekeyNAS() error = %v", err)
+	}
+	first := rg.downlinkNASCount()
+	if retransmitted := rg.downlinkNASCount(); retransmitted != first+1 {
+		t.Errorf("retransmitted Security Mode Command NAS COUNT = %d, want %d", retransmitted, first+1)
+	}
+
+	// the UE stays registered with the NAS security context in use before the rekeying, its NG connection kept
+	waitEvent(t, events, event.NASSecurityRekeyingFailed)
+	a.silent()
+	ue = rg.ue()
+	if !ue.Registered() || ue.T3560 != nil {
+		t.Fatalf("UE %s, T3560 running %v after the rekeying aborted, want %s", ue.StateMachineIndex,
+			ue.T3560 != nil, context.GmmRegistered)
+	}
+	if !bytes.Equal(ue.Kamf, previous.Kamf) || ue.NgKsi != previous.NgKsi {
+		t.Errorf("KAMF %x ngKSI %+v after the rekeying aborted, want %x %+v", ue.Kamf, ue.NgKsi, previous.Kamf,
+			previous.NgKsi)
+	}
+}
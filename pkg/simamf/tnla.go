@@ -0,0 +1,244 @@
+package simamf
+
+import (
+	"net"
+	"strings"
+
+	"free5gc/lib/ngap/ngapConvert"
+	"free5gc/lib/ngap/ngapType"
+	"sim-amf/pkg/context"
+	"sim-amf/pkg/logger"
+
+	"gitlab.casa-systems.com/opensource/sctp"
+)
+
+// acceptTNLAs accepts the additional TNL associations of the AGFs to an endpoint of the AMF. An association joins the
+// AGF which completed the NG Setup from the same IP address, the other ones are closed.
+//
+// TS 38.412 7 Transport layer
+func acceptTNLAs(amf *context.AMFContext, listener *sctp.SCTPListener) {
+	for {
+		conn, err := acceptSCTP(listener)
+		if err != nil {
+			if isStopping() {
+				return
+			}
+			continue
+		}
+		remoteAddr := conn.RemoteAddr().String()
+		host, _, _ := net.SplitHostPort(remoteAddr)
+
+		var agf *context.AGFContext
+		amf.RangeAGFContext(func(a *context.AGFContext) bool {
+			if h, _, _ := net.SplitHostPort(a.SCTPAddr); h == host && a.NGSetupDone {
+				agf = a
+				return false
+			}
+			return true
+		})
+		if agf == nil {
+			logger.MainLog.Warn("TNL association from %s to AMF[%s] of no AGF", remoteAddr, amf.AMFName.Value)
+			conn.Close()
+			continue
+		}
+		agf.StoreTNLA(conn)
+		logger.MainLog.Info("AGF[%s] TNL association %s connected", agf.SCTPAddr, remoteAddr)
+
+		serving.Add(1)
+		go func() {
+			defer serving.Done()
+			serveTNLA(agf, conn)
+		}()
+	}
+}
+
+// serveTNLA reads the NGAP messages of an additional TNL association of the AGF until it goes down, the UEs bound to
+// it being bound again to the first association of the AGF
+func serveTNLA(agf *context.AGFContext, conn *sctp.SCTPConn) {
+	defer func() {
+		conn.Close()
+		agf.DeleteTNLA(conn)
+		agf.RangeUEContext(func(ue *context.UEContext) bool {
+			dispatchUE(ue, func() {
+				if ue.TNLA == conn {
+					ue.TNLA = nil
+				}
+			})
+			return true
+		})
+		logger.MainLog.Info("AGF[%s] TNL association %s disconnected", agf.SCTPAddr, conn.RemoteAddr())
+	}()
+
+	readNGAP(agf, conn)
+}
+
+// bindUETNLA binds the UE addressed by a UE-associated NGAP message to the TNL association it was received on, the
+// UE-associated messages of the AMF following it
+//
+// TS 38.412 7 Transport layer
+func bindUETNLA(agf *context.AGFContext, conn *sctp.SCTPConn, pdu *ngapType.NGAPPDU) {
+	amfUeNgapId, ranUeNgapId := ueNGAPIDs(pdu)
+	var ue *context.UEContext
+	switch {
+	case amfUeNgapId != context.AmfUeNgapIdUnspecified:
+		ue, _ = agf.AMF.LoadUEContextAMFUENGAPID(amfUeNgapId)
+	case ranUeNgapId != context.RanUeNgapIdUnspecified:
+		ue, _ = agf.LoadUEContextRANUENGAPID(ranUeNgapId)
+	}
+	if ue == nil || ue.AGF != agf {
+		return
+	}
+	if conn == agf.SCTPConn {
+		ue.TNLA = nil
+	} else {
+		ue.TNLA = conn
+	}
+}
+
+// advertiseTNLEndpoints sends the AGF an AMF Configuration Update of the endpoints advertised by the AMF, if any, once
+// the NG Setup is completed
+func advertiseTNLEndpoints(agf *context.AGFContext) {
+	items := agf.AMF.AMFTNLAssociationItems()
+	if len(items) == 0 {
+		return
+	}
+	pkt, err := BuildAMFConfigurationUpdate(items, nil, nil)
+	if err != nil {
+		logger.MainLog.Error("Build AMF Configuration Update failed: %+v", err)
+		return
+	}
+	if _, err := SendData(agf.SCTPConn, pkt, "Server"); err != nil {
+		logger.MainLog.Error("Error %v", err)
+	}
+}
+
+// updateTNLEndpoints advertises, removes and updates endpoints of the AMF and sends an AMF Configuration Update of
+// them to all its AGFs. The TNL associations to the removed endpoints are aborted if abortRemoved is set, instead of
+// being removed by the AGFs.
+//
+// TS 38.413 8.7.3 AMF Configuration Update
+func updateTNLEndpoints(amf *context.AMFContext, toAdd, toRemove, toUpdate []*context.AMFTNLAssociationItem,
+	abortRemoved bool) error {
+	pkt, err := BuildAMFConfigurationUpdate(toAdd, toRemove, toUpdate)
+	if err != nil {
+		return err
+	}
+	for _, item := range toAdd {
+		amf.StoreAMFTNLAssociationItem(item)
+	}
+	for _, item := range toUpdate {
+		amf.StoreAMFTNLAssociationItem(item)
+	}
+	for _, item := range toRemove {
+		amf.DeleteAMFTNLAssociationItem(item.CPTransportLayerInformation())
+	}
+
+	amf.RangeAGFContext(func(agf *context.AGFContext) bool {
+		if !agf.NGSetupDone {
+			return true
+		}
+		if _, err := SendData(agf.SCTPConn, pkt, "Server"); err != nil {
+			logger.MainLog.Error("Send AMF Configuration Update to AGF[%s] failed: %v", agf.SCTPAddr, err)
+		}
+		if !abortRemoved {
+			return true
+		}
+		agf.RangeTNLA(func(conn *sctp.SCTPConn) bool {
+			for _, item := range toRemove {
+				if sctpAddrHasIP(conn.LocalAddr(), item.Ipv4+item.Ipv6) {
+					logger.MainLog.Info("AGF[%s] abort TNL association %s", agf.SCTPAddr, conn.RemoteAddr())
+					conn.Close()
+				}
+			}
+			return true
+		})
+		return true
+	})
+	return nil
+}
+
+// agfOfConn returns the AGF a TNL association belongs to, nil if none
+func agfOfConn(conn *sctp.SCTPConn) (agf *context.AGFContext) {
+	context.RangeSetAGFContext(func(a *context.AGFContext) bool {
+		if a.SCTPConn == conn {
+			agf = a
+		} else {
+			a.RangeTNLA(func(tnla *sctp.SCTPConn) bool {
+				if tnla == conn {
+					agf = a
+				}
+				return agf == nil
+			})
+		}
+		return agf == nil
+	})
+	return agf
+}
+
+// agfSCTPAddr returns the SCTP address of the AGF a TNL association belongs to, empty if none
+func agfSCTPAddr(conn *sctp.SCTPConn) string {
+	if agf := agfOfConn(conn); agf != nil {
+		return agf.SCTPAddr
+	}
+	return ""
+}
+
+// sctpAddrHasIP reports whether an SCTP address, made of the IP addresses of a multi-homed endpoint separated by
+// slashes followed by the port, has the IP address ip
+func sctpAddrHasIP(addr net.Addr, ip string) bool {
+	if addr == nil {
+		return false
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return false
+	}
+	for _, h := range strings.Split(host, "/") {
+		if h == ip {
+			return true
+		}
+	}
+	return false
+}
+
+func handleAMFConfigurationUpdateAcknowledge(agf *context.AGFContext, pdu *ngapType.NGAPPDU) {
+	aMFConfigurationUpdateAcknowledge := pdu.SuccessfulOutcome.Value.AMFConfigurationUpdateAcknowledge
+	if aMFConfigurationUpdateAcknowledge == nil {
+		logger.MainLog.Error("AMFConfigurationUpdateAcknowledge is nil")
+		return
+	}
+	for _, ie := range aMFConfigurationUpdateAcknowledge.ProtocolIEs.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDAMFTNLAssociationSetupList:
+			if ie.Value.AMFTNLAssociationSetupList == nil {
+				break
+			}
+			for _, item := range ie.Value.AMFTNLAssociationSetupList.List {
+				v4, v6 := ngapConvert.IPAddressToString(*item.AMFTNLAssociationAddress.EndpointIPAddress)
+				logger.MainLog.Info("AGF[%s] set up TNL association to %s%s", agf.SCTPAddr, v4, v6)
+			}
+		case ngapType.ProtocolIEIDAMFTNLAssociationFailedToSetupList:
+			if ie.Value.AMFTNLAssociationFailedToSetupList == nil {
+				break
+			}
+			for _, item := range ie.Value.AMFTNLAssociationFailedToSetupList.List {
+				v4, v6 := ngapConvert.IPAddressToString(*item.TNLAssociationAddress.EndpointIPAddress)
+				logger.MainLog.Warn("AGF[%s] failed to set up TNL association to %s%s, cause %+v", agf.SCTPAddr,
+					v4, v6, item.Cause)
+			}
+		}
+	}
+}
+
+func handleAMFConfigurationUpdateFailure(agf *context.AGFContext, pdu *ngapType.NGAPPDU) {
+	aMFConfigurationUpdateFailure := pdu.UnsuccessfulOutcome.Value.AMFConfigurationUpdateFailure
+	if aMFConfigurationUpdateFailure == nil {
+		logger.MainLog.Error("AMFConfigurationUpdateFailure is nil")
+		return
+	}
+	for _, ie := range aMFConfigurationUpdateFailure.ProtocolIEs.List {
+		if ie.Id.Value == ngapType.ProtocolIEIDCause && ie.Value.Cause != nil {
+			logger.MainLog.Warn("AGF[%s] AMF Configuration Update failed, cause %+v", agf.SCTPAddr, *ie.Value.Cause)
+		}
+	}
+}
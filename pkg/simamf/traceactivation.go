@@ -0,0 +1,183 @@
+package simamf
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+
+	"free5gc/lib/aper"
+	"free5gc/lib/ngap/ngapConvert"
+	"free5gc/lib/ngap/ngapType"
+	"sim-amf/pkg/context"
+	"sim-amf/pkg/event"
+	"sim-amf/pkg/logger"
+	"sim-amf/pkg/util"
+)
+
+var traceInterfaces = map[string]uint8{
+	"ng-c": context.TraceInterfaceNGC,
+	"xn-c": context.TraceInterfaceXnC,
+	"uu":   context.TraceInterfaceUu,
+	"f1-c": context.TraceInterfaceF1C,
+	"e1":   context.TraceInterfaceE1,
+}
+
+var traceDepths = map[string]aper.Enumerated{
+	"minimum": ngapType.TraceDepthPresentMinimum,
+	"medium":  ngapType.TraceDepthPresentMedium,
+	"maximum": ngapType.TraceDepthPresentMaximum,
+	"minimum-without-vendor-specific-extension": ngapType.TraceDepthPresentMinimumWithoutVendorSpecificExtension,
+	"medium-without-vendor-specific-extension":  ngapType.TraceDepthPresentMediumWithoutVendorSpecificExtension,
+	"maximum-without-vendor-specific-extension": ngapType.TraceDepthPresentMaximumWithoutVendorSpecificExtension,
+}
+
+// traceEntry is the trace session of a subscriber, activated in the AGF on the Initial Context Setup, e.g.
+//
+//	trace: {id: 02f8390000010001, interfaces: [ng-c], depth: maximum, collectionEntity: 10.100.200.1}
+type traceEntry struct {
+	ID               string   `yaml:"id" json:"id"`
+	Interfaces       []string `yaml:"interfaces,omitempty" json:"interfaces,omitempty"`
+	Depth            string   `yaml:"depth,omitempty" json:"depth,omitempty"`
+	CollectionEntity string   `yaml:"collectionEntity" json:"collectionEntity"`
+}
+
+// parseTraceSettings parses the parameters of a trace session: the NG-RAN Trace ID as 16 hex digits, the interfaces to
+// trace among ng-c, xn-c, uu, f1-c and e1, NG-C if none, the trace depth, minimum if empty, and the IP address of the
+// trace collection entity
+func parseTraceSettings(id string, interfaces []string, depth string, collectionEntity string) (*context.TraceSettings,
+	error) {
+	trace := &context.TraceSettings{Depth: ngapType.TraceDepthPresentMinimum}
+	var err error
+	if trace.TraceID, err = hex.DecodeString(id); err != nil || len(trace.TraceID) != 8 {
+		return nil, fmt.Errorf("invalid trace ID %s, expecting 16 hex digits", id)
+	}
+	for _, name := range interfaces {
+		bit, ok := traceInterfaces[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("invalid interface to trace %s, expecting ng-c, xn-c, uu, f1-c or e1", name)
+		}
+		trace.InterfacesToTrace |= bit
+	}
+	if trace.InterfacesToTrace == 0 {
+		trace.InterfacesToTrace = context.TraceInterfaceNGC
+	}
+	if depth != "" {
+		var ok bool
+		if trace.Depth, ok = traceDepths[strings.ToLower(depth)]; !ok {
+			return nil, fmt.Errorf("invalid trace depth %s", depth)
+		}
+	}
+	if trace.CollectionEntity = net.ParseIP(collectionEntity); trace.CollectionEntity == nil {
+		return nil, fmt.Errorf("invalid trace collection entity IP address %s", collectionEntity)
+	}
+	return trace, nil
+}
+
+// handleTraceFailureIndication ends the trace session the AGF failed to start or deactivate
+//
+// TS 38.413 8.12.2 Trace Failure Indication
+func handleTraceFailureIndication(agf *context.AGFContext, pdu *ngapType.NGAPPDU) {
+	var aMFUENGAPID *ngapType.AMFUENGAPID
+	var rANUENGAPID *ngapType.RANUENGAPID
+	var nGRANTraceID *ngapType.NGRANTraceID
+	var cause *ngapType.Cause
+
+	traceFailureIndication := pdu.InitiatingMessage.Value.TraceFailureIndication
+	if traceFailureIndication == nil {
+		logger.MainLog.Error("TraceFailureIndication is nil")
+		return
+	}
+	for _, ie := range traceFailureIndication.ProtocolIEs.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDAMFUENGAPID:
+			aMFUENGAPID = ie.Value.AMFUENGAPID
+		case ngapType.ProtocolIEIDRANUENGAPID:
+			rANUENGAPID = ie.Value.RANUENGAPID
+		case ngapType.ProtocolIEIDNGRANTraceID:
+			nGRANTraceID = ie.Value.NGRANTraceID
+		case ngapType.ProtocolIEIDCause:
+			cause = ie.Value.Cause
+		}
+	}
+
+	ue := findUEContext(agf, aMFUENGAPID, rANUENGAPID)
+	if ue == nil {
+		return
+	}
+	var traceID []byte
+	if nGRANTraceID != nil {
+		traceID = nGRANTraceID.Value
+	}
+	detail := fmt.Sprintf("trace ID %s", hex.EncodeToString(traceID))
+	if cause != nil {
+		detail += ", cause " + util.NgapCauseString(cause)
+	}
+	logger.MainLog.Warn("[%s] Trace Failure Indication, %s", ue.LogTag("NGAP"), detail)
+	if ue.Trace != nil && string(ue.Trace.TraceID) == string(traceID) {
+		ue.Trace = nil
+	}
+	event.Publish(ue, event.Event{Type: event.TraceFailure, Detail: detail})
+}
+
+// handleCellTrafficTrace reports the trace recording session of the UE started by the AGF, the NG-RAN CGI being the
+// W-AGF identity of the line for a wireline access
+//
+// TS 38.413 8.12.4 Cell Traffic Trace
+func handleCellTrafficTrace(agf *context.AGFContext, pdu *ngapType.NGAPPDU) {
+	var aMFUENGAPID *ngapType.AMFUENGAPID
+	var rANUENGAPID *ngapType.RANUENGAPID
+	var nGRANTraceID *ngapType.NGRANTraceID
+	var nGRANCGI *ngapType.NGRANCGI
+	var collectionEntity *ngapType.TransportLayerAddress
+
+	cellTrafficTrace := pdu.InitiatingMessage.Value.CellTrafficTrace
+	if cellTrafficTrace == nil {
+		logger.MainLog.Error("CellTrafficTrace is nil")
+		return
+	}
+	for _, ie := range cellTrafficTrace.ProtocolIEs.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDAMFUENGAPID:
+			aMFUENGAPID = ie.Value.AMFUENGAPID
+		case ngapType.ProtocolIEIDRANUENGAPID:
+			rANUENGAPID = ie.Value.RANUENGAPID
+		case ngapType.ProtocolIEIDNGRANTraceID:
+			nGRANTraceID = ie.Value.NGRANTraceID
+		case ngapType.ProtocolIEIDNGRANCGI:
+			nGRANCGI = ie.Value.NGRANCGI
+		case ngapType.ProtocolIEIDTraceCollectionEntityIPAddress:
+			collectionEntity = ie.Value.TraceCollectionEntityIPAddress
+		}
+	}
+
+	ue := findUEContext(agf, aMFUENGAPID, rANUENGAPID)
+	if ue == nil {
+		return
+	}
+	var details []string
+	if nGRANTraceID != nil {
+		details = append(details, "trace ID "+hex.EncodeToString(nGRANTraceID.Value))
+	}
+	if nGRANCGI != nil {
+		details = append(details, "CGI "+ngranCGIString(nGRANCGI))
+	}
+	if collectionEntity != nil {
+		ipv4, ipv6 := ngapConvert.IPAddressToString(*collectionEntity)
+		details = append(details, "collection entity "+ipv4+ipv6)
+	}
+	detail := strings.Join(details, ", ")
+	logger.MainLog.Info("[%s] Cell Traffic Trace, %s", ue.LogTag("NGAP"), detail)
+	event.Publish(ue, event.Event{Type: event.CellTrafficTrace, Detail: detail})
+}
+
+// ngranCGIString returns the PLMN identity and the cell identity of an NG-RAN CGI in hex
+func ngranCGIString(cgi *ngapType.NGRANCGI) string {
+	switch cgi.Present {
+	case ngapType.NGRANCGIPresentNRCGI:
+		return fmt.Sprintf("NR %x-%x", cgi.NRCGI.PLMNIdentity.Value, cgi.NRCGI.NRCellIdentity.Value.Bytes)
+	case ngapType.NGRANCGIPresentEUTRACGI:
+		return fmt.Sprintf("E-UTRA %x-%x", cgi.EUTRACGI.PLMNIdentity.Value, cgi.EUTRACGI.EUTRACellIdentity.Value.Bytes)
+	}
+	return "none"
+}
@@ -0,0 +1,277 @@
+// Package suci deconceals the Subscription Concealed Identifiers sent by the 5G-RGs into their SUPI
+//
+// TS 33.501 6.12.2 Subscription identifier de-concealing function, Annex C Protection schemes for concealing the
+// subscription permanent identifier
+package suci
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"math/bits"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// Protection scheme identifiers, TS 33.501 Annex C.1
+const (
+	NullScheme uint8 = 0
+	ProfileA   uint8 = 1
+	ProfileB   uint8 = 2
+)
+
+// SUPI types of the SUCI in NAI format, TS 23.003 28.7.3
+const (
+	SupiTypeImsi = 0
+	SupiTypeNsi  = 1 // network specific identifier
+	SupiTypeGli  = 2 // Global Line Identifier, FN-RG
+	SupiTypeGci  = 3 // Global Cable Identifier, FN-CRG
+)
+
+const (
+	encKeyLen = 16 // octets
+	icbLen    = 16
+	macKeyLen = 32
+	macLen    = 8
+
+	profileAPublicKeyLen = 32
+	profileBPublicKeyLen = 33 // compressed point
+)
+
+// HomeNetworkKey is a private key of the home network the SUCIs are concealed with
+type HomeNetworkKey struct {
+	ID         uint8 // home network public key identifier
+	Scheme     uint8 // ProfileA or ProfileB
+	PrivateKey []byte
+}
+
+var (
+	suciRegexp = regexp.MustCompile(`^suci-0-([0-9]{3})-([0-9]{2,3})-([0-9]{1,4})-([0-9a-f]+)-([0-9]+)-([0-9a-fA-F]*)$`)
+	naiRegexp  = regexp.MustCompile(`^type([0-3])\.rid([0-9]{1,4})\.schid([0-9]+)\.(.*)@(.+)$`)
+	realmPlmn  = regexp.MustCompile(`mnc([0-9]{2,3})\.mcc([0-9]{3})`)
+)
+
+// ToSupi deconceals a SUCI in IMSI format, as converted by nasConvert.SuciToString, e.g.
+// suci-0-208-93-0-0-0-00007487, or in NAI format, e.g. type1.rid0.schid0.useridrg1@example.com, into the SUPI, e.g.
+// imsi-2089300007487 or nai-rg1@example.com. The keys are the home network private keys by identifier.
+func ToSupi(suci string, keys map[uint8]HomeNetworkKey) (string, error) {
+	if match := suciRegexp.FindStringSubmatch(suci); match != nil {
+		scheme, err := strconv.ParseUint(match[4], 16, 8)
+		if err != nil {
+			return "", fmt.Errorf("invalid protection scheme in SUCI %s", suci)
+		}
+		keyID, err := strconv.ParseUint(match[5], 10, 8)
+		if err != nil {
+			return "", fmt.Errorf("invalid home network public key identifier in SUCI %s", suci)
+		}
+		msin := match[6]
+		if uint8(scheme) != NullScheme {
+			output, err := hex.DecodeString(match[6])
+			if err != nil {
+				return "", fmt.Errorf("invalid scheme output in SUCI %s", suci)
+			}
+			plaintext, err := deconceal(uint8(scheme), uint8(keyID), output, keys)
+			if err != nil {
+				return "", err
+			}
+			msin = bcdToString(plaintext)
+		}
+		return "imsi-" + match[1] + match[2] + msin, nil
+	}
+
+	match := naiRegexp.FindStringSubmatch(suci)
+	if match == nil {
+		return "", fmt.Errorf("invalid SUCI %s", suci)
+	}
+	supiType, realm := match[1][0]-'0', match[5]
+	scheme, err := strconv.ParseUint(match[3], 10, 8)
+	if err != nil {
+		return "", fmt.Errorf("invalid protection scheme in SUCI %s", suci)
+	}
+	username, err := naiUsername(uint8(scheme), match[4], keys)
+	if err != nil {
+		return "", fmt.Errorf("SUCI %s: %v", suci, err)
+	}
+	switch supiType {
+	case SupiTypeImsi:
+		plmn := realmPlmn.FindStringSubmatch(realm)
+		if plmn == nil {
+			return "", fmt.Errorf("no PLMN in the realm of SUCI %s", suci)
+		}
+		if uint8(scheme) != NullScheme {
+			// the concealed MSIN is BCD encoded as in the IMSI format
+			username = bcdToString([]byte(username))
+		}
+		return "imsi-" + plmn[2] + plmn[1] + username, nil
+	case SupiTypeGli:
+		return "gli-" + username + "@" + realm, nil
+	case SupiTypeGci:
+		return "gci-" + username + "@" + realm, nil
+	default:
+		return "nai-" + username + "@" + realm, nil
+	}
+}
+
+// naiUsername returns the username of a SUCI in NAI format, userid<username> with the null scheme, or
+// hnkey<key id>.ecckey<ephemeral public key>.cip<ciphertext>.mac<MAC tag> concealed with a profile
+func naiUsername(scheme uint8, fields string, keys map[uint8]HomeNetworkKey) (string, error) {
+	if scheme == NullScheme {
+		if !strings.HasPrefix(fields, "userid") {
+			return "", fmt.Errorf("missing userid")
+		}
+		return strings.TrimPrefix(fields, "userid"), nil
+	}
+
+	var keyID uint64
+	var output []byte
+	for _, field := range strings.Split(fields, ".") {
+		var err error
+		var value []byte
+		switch {
+		case strings.HasPrefix(field, "hnkey"):
+			keyID, err = strconv.ParseUint(strings.TrimPrefix(field, "hnkey"), 10, 8)
+		case strings.HasPrefix(field, "ecckey"):
+			value, err = hex.DecodeString(strings.TrimPrefix(field, "ecckey"))
+		case strings.HasPrefix(field, "cip"):
+			value, err = hex.DecodeString(strings.TrimPrefix(field, "cip"))
+		case strings.HasPrefix(field, "mac"):
+			value, err = hex.DecodeString(strings.TrimPrefix(field, "mac"))
+		default:
+			err = fmt.Errorf("unexpected field %s", field)
+		}
+		if err != nil {
+			return "", err
+		}
+		// the scheme output is the ephemeral public key, the ciphertext and the MAC tag in turn
+		output = append(output, value...)
+	}
+	plaintext, err := deconceal(scheme, uint8(keyID), output, keys)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// deconceal checks the MAC tag and decrypts the ciphertext of a scheme output concealed with the ECIES profile A or B
+//
+// TS 33.501 C.3.3 Processing on home network side
+func deconceal(scheme, keyID uint8, output []byte, keys map[uint8]HomeNetworkKey) ([]byte, error) {
+	key, ok := keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown home network public key identifier %d", keyID)
+	}
+	if key.Scheme != scheme {
+		return nil, fmt.Errorf("home network key %d is not of protection scheme %d", keyID, scheme)
+	}
+
+	var publicKey, sharedKey []byte
+	switch scheme {
+	case ProfileA:
+		if len(output) < profileAPublicKeyLen+macLen {
+			return nil, fmt.Errorf("profile A scheme output too short")
+		}
+		publicKey = output[:profileAPublicKeyLen]
+		var err error
+		if sharedKey, err = curve25519.X25519(key.PrivateKey, publicKey); err != nil {
+			return nil, err
+		}
+	case ProfileB:
+		if len(output) < profileBPublicKeyLen+macLen {
+			return nil, fmt.Errorf("profile B scheme output too short")
+		}
+		publicKey = output[:profileBPublicKeyLen]
+		x, y := elliptic.UnmarshalCompressed(elliptic.P256(), publicKey)
+		if x == nil {
+			return nil, fmt.Errorf("invalid profile B ephemeral public key")
+		}
+		sharedX, _ := elliptic.P256().ScalarMult(x, y, key.PrivateKey)
+		sharedKey = sharedX.FillBytes(make([]byte, 32))
+	default:
+		return nil, fmt.Errorf("unsupported protection scheme %d", scheme)
+	}
+
+	ciphertext := output[len(publicKey) : len(output)-macLen]
+	kdfKey := ansiX963KDF(sharedKey, publicKey, encKeyLen+icbLen+macKeyLen)
+	encKey, icb, macKey := kdfKey[:encKeyLen], kdfKey[encKeyLen:encKeyLen+icbLen], kdfKey[encKeyLen+icbLen:]
+
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(ciphertext)
+	if !bytes.Equal(mac.Sum(nil)[:macLen], output[len(output)-macLen:]) {
+		return nil, fmt.Errorf("MAC tag mismatch")
+	}
+
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCTR(block, icb).XORKeyStream(plaintext, ciphertext)
+	return plaintext, nil
+}
+
+// ansiX963KDF derives keyLen octets from the shared key and the ephemeral public key as shared info
+//
+// SEC 1 3.6.1 ANSI-X9.63-KDF with SHA-256
+func ansiX963KDF(sharedKey, publicKey []byte, keyLen int) []byte {
+	var key []byte
+	counter := make([]byte, 4)
+	for i := uint32(1); len(key) < keyLen; i++ {
+		binary.BigEndian.PutUint32(counter, i)
+		h := sha256.New()
+		h.Write(sharedKey)
+		h.Write(counter)
+		h.Write(publicKey)
+		key = h.Sum(key)
+	}
+	return key[:keyLen]
+}
+
+// bcdToString returns the digits of a TBCD string, the filler digit removed
+func bcdToString(bcd []byte) string {
+	digits := make([]byte, len(bcd))
+	for i, b := range bcd {
+		digits[i] = bits.RotateLeft8(b, 4)
+	}
+	return strings.TrimRight(hex.EncodeToString(digits), "f")
+}
+
+// ParseHomeNetworkKey parses a home network private key given as its identifier, an equal sign, the profile A or B
+// and the private key in hex, e.g. 1=A:c53c22208b61860b06c62e5406a7b330c2b577aa5558981510d128247d38bd1d
+func ParseHomeNetworkKey(s string) (HomeNetworkKey, error) {
+	var key HomeNetworkKey
+	i := strings.Index(s, "=")
+	j := strings.Index(s, ":")
+	if i <= 0 || j != i+2 {
+		return key, fmt.Errorf("invalid home network key %s, expecting <id>=<A|B>:<private key>", s)
+	}
+	id, err := strconv.ParseUint(s[:i], 10, 8)
+	if err != nil {
+		return key, fmt.Errorf("invalid home network key identifier %s", s[:i])
+	}
+	key.ID = uint8(id)
+	switch strings.ToUpper(s[i+1 : j]) {
+	case "A":
+		key.Scheme = ProfileA
+	case "B":
+		key.Scheme = ProfileB
+	default:
+		return key, fmt.Errorf("invalid home network key profile %s, expecting A or B", s[i+1:j])
+	}
+	if key.PrivateKey, err = hex.DecodeString(s[j+1:]); err != nil || len(key.PrivateKey) != 32 {
+		return key, fmt.Errorf("invalid home network private key of identifier %d, expecting 32 octets in hex", id)
+	}
+	if key.Scheme == ProfileB && new(big.Int).SetBytes(key.PrivateKey).Cmp(elliptic.P256().Params().N) >= 0 {
+		return key, fmt.Errorf("invalid profile B home network private key of identifier %d", id)
+	}
+	return key, nil
+}
@@ -0,0 +1,97 @@
+package suci
+
+import (
+	"testing"
+)
+
+// home network keys and scheme outputs of TS 33.501 C.4.3 Test data for Profile A and C.4.4 Test data for Profile B,
+// concealing the MSIN 001002086 of the IMSI 274012001002086
+const (
+	profileAPrivateKey   = "c53c22208b61860b06c62e5406a7b330c2b577aa5558981510d128247d38bd1d"
+	profileAPublicKey    = "b2e92f836055a255837debf850b528997ce0201cb82adfe4be1f587d07d8457d"
+	profileACiphertext   = "cb02352410"
+	profileAMAC          = "cddd9e730ef3fa87"
+	profileBPrivateKey   = "F1AB1074477EBCC7F554EA1C5FC368B1616730155E0041AC447D6301975FECDA"
+	profileBPublicKey    = "039aab8376597021e855679a9778ea0b67396e68c66df32c0f41e9acca2da9b9d1"
+	profileBCiphertext   = "46a33fc271"
+	profileBMAC          = "6ac7dae96aa30a4d"
+	profileAOutput       = profileAPublicKey + profileACiphertext + profileAMAC
+	profileBOutput       = profileBPublicKey + profileBCiphertext + profileBMAC
+	profileBOutputBadMAC = profileBPublicKey + profileBCiphertext + "6ac7dae96aa30a4e"
+)
+
+func TestToSupi(t *testing.T) {
+	keys := make(map[uint8]HomeNetworkKey)
+	for _, s := range []string{"1=A:" + profileAPrivateKey, "2=B:" + profileBPrivateKey, "3=A:" + profileBPrivateKey} {
+		key, err := ParseHomeNetworkKey(s)
+		if err != nil {
+			t.Fatalf("ParseHomeNetworkKey(%q) error = %v", s, err)
+		}
+		keys[key.ID] = key
+	}
+	tests := []struct {
+		suci    string
+		supi    string
+		wantErr bool
+	}{
+		{suci: "suci-0-208-93-0-0-0-00007487", supi: "imsi-2089300007487"},
+		{suci: "suci-0-274-012-678-1-1-" + profileAOutput, supi: "imsi-274012001002086"},
+		{suci: "suci-0-274-012-678-2-2-" + profileBOutput, supi: "imsi-274012001002086"},
+		{suci: "suci-0-274-012-678-2-2-" + profileBOutputBadMAC, wantErr: true},
+		{suci: "suci-0-274-012-678-1-2-" + profileAOutput, wantErr: true},    // key of profile B
+		{suci: "suci-0-274-012-678-1-3-" + profileAOutput, wantErr: true},    // other private key
+		{suci: "suci-0-274-012-678-1-9-" + profileAOutput, wantErr: true},    // unknown key
+		{suci: "suci-0-274-012-678-1-1-" + profileAPublicKey, wantErr: true}, // no MAC tag
+		{suci: "suci-0-274-012-678-3-1-" + profileAOutput, wantErr: true},    // unsupported scheme
+		{suci: "type1.rid0.schid0.useridrg1@example.com", supi: "nai-rg1@example.com"},
+		{suci: "type2.rid0.schid0.userid0a0b0c@example.com", supi: "gli-0a0b0c@example.com"},
+		{suci: "type3.rid0.schid0.userid0a0b0c@example.com", supi: "gci-0a0b0c@example.com"},
+		{suci: "type0.rid678.schid0.userid001002086@nai.5gc.mnc012.mcc274.3gppnetwork.org",
+			supi: "imsi-274012001002086"},
+		{suci: "type0.rid678.schid1.hnkey1.ecckey" + profileAPublicKey + ".cip" + profileACiphertext + ".mac" +
+			profileAMAC + "@nai.5gc.mnc012.mcc274.3gppnetwork.org", supi: "imsi-274012001002086"},
+		{suci: "type0.rid678.schid2.hnkey2.ecckey" + profileBPublicKey + ".cip" + profileBCiphertext + ".mac" +
+			profileAMAC + "@nai.5gc.mnc012.mcc274.3gppnetwork.org", wantErr: true},
+		{suci: "type0.rid0.schid0.userid001002086@example.com", wantErr: true}, // no PLMN in the realm
+		{suci: "type1.rid0.schid0.rg1@example.com", wantErr: true},
+		{suci: "imsi-274012001002086", wantErr: true},
+	}
+	for _, tt := range tests {
+		supi, err := ToSupi(tt.suci, keys)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ToSupi(%q) error = %v, wantErr %v", tt.suci, err, tt.wantErr)
+			continue
+		}
+		if supi != tt.supi {
+			t.Errorf("ToSupi(%q) = %q, want %q", tt.suci, supi, tt.supi)
+		}
+	}
+}
+
+func TestParseHomeNetworkKey(t *testing.T) {
+	tests := []struct {
+		s       string
+		id      uint8
+		scheme  uint8
+		wantErr bool
+	}{
+		{s: "1=A:" + profileAPrivateKey, id: 1, scheme: ProfileA},
+		{s: "255=b:" + profileBPrivateKey, id: 255, scheme: ProfileB},
+		{s: "256=A:" + profileAPrivateKey, wantErr: true},
+		{s: "1=C:" + profileAPrivateKey, wantErr: true},
+		{s: "1=A:" + profileAPrivateKey[:62], wantErr: true},
+		{s: "1=B:ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", wantErr: true},
+		{s: "A:" + profileAPrivateKey, wantErr: true},
+	}
+	for _, tt := range tests {
+		key, err := ParseHomeNetworkKey(tt.s)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseHomeNetworkKey(%q) error = %v, wantErr %v", tt.s, err, tt.wantErr)
+			continue
+		}
+		if err == nil && (key.ID != tt.id || key.Scheme != tt.scheme || len(key.PrivateKey) != 32) {
+			t.Errorf("ParseHomeNetworkKey(%q) = %d, %d, %d octets, want %d, %d, 32 octets", tt.s, key.ID,
+				key.Scheme, len(key.PrivateKey), tt.id, tt.scheme)
+		}
+	}
+}
@@ -0,0 +1,353 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+
+	"free5gc/lib/aper"
+	"free5gc/lib/nas"
+	"free5gc/lib/nas/nasConvert"
+	"free5gc/lib/nas/nasMessage"
+	"free5gc/lib/nas/nasType"
+	"free5gc/lib/ngap/ngapConvert"
+	"free5gc/lib/ngap/ngapType"
+)
+
+// member is a named value of an object, kept in the order of the ASN.1 or NAS definition
+type member struct {
+	Name  string
+	Value interface{}
+}
+
+// object renders as a JSON object which keeps the order of its members
+type object []member
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(m.Name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(m.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// transferTypes are the NGAP transfers carried as encoded OCTET STRINGs, by IE name
+//
+// TS 38.413 9.3.4 PDU Session Resource related IEs
+var transferTypes = map[string]reflect.Type{}
+
+func init() {
+	for _, transfer := range []interface{}{
+		ngapType.PDUSessionResourceSetupRequestTransfer{},
+		ngapType.PDUSessionResourceSetupResponseTransfer{},
+		ngapType.PDUSessionResourceSetupUnsuccessfulTransfer{},
+		ngapType.PDUSessionResourceModifyRequestTransfer{},
+		ngapType.PDUSessionResourceModifyResponseTransfer{},
+		ngapType.PDUSessionResourceModifyUnsuccessfulTransfer{},
+		ngapType.PDUSessionResourceModifyIndicationTransfer{},
+		ngapType.PDUSessionResourceModifyConfirmTransfer{},
+		ngapType.PDUSessionResourceReleaseCommandTransfer{},
+		ngapType.PDUSessionResourceReleaseResponseTransfer{},
+		ngapType.PDUSessionResourceNotifyTransfer{},
+		ngapType.PDUSessionResourceNotifyReleasedTransfer{},
+	} {
+		t := reflect.TypeOf(transfer)
+		transferTypes[t.Name()] = t
+	}
+}
+
+var (
+	nasPDUType               = reflect.TypeOf(ngapType.NASPDU{})
+	plmnIdentityType         = reflect.TypeOf(ngapType.PLMNIdentity{})
+	transportLayerAddrType   = reflect.TypeOf(ngapType.TransportLayerAddress{})
+	mobileIdentity5GSType    = reflect.TypeOf(nasType.MobileIdentity5GS{})
+	protocolIEContainerField = "ProtocolIEs"
+)
+
+// renderNGAP returns the procedure name, the message name and the IEs of an NGAP PDU
+func renderNGAP(pdu *ngapType.NGAPPDU) (procedureCode int64, message string, ies object) {
+	var value reflect.Value
+	switch {
+	case pdu.InitiatingMessage != nil:
+		procedureCode = pdu.InitiatingMessage.ProcedureCode.Value
+		value = reflect.ValueOf(pdu.InitiatingMessage.Value)
+	case pdu.SuccessfulOutcome != nil:
+		procedureCode = pdu.SuccessfulOutcome.ProcedureCode.Value
+		value = reflect.ValueOf(pdu.SuccessfulOutcome.Value)
+	case pdu.UnsuccessfulOutcome != nil:
+		procedureCode = pdu.UnsuccessfulOutcome.ProcedureCode.Value
+		value = reflect.ValueOf(pdu.UnsuccessfulOutcome.Value)
+	default:
+		return -1, "Unknown", nil
+	}
+
+	// the message is the field selected by Present, as for the aper encoding
+	present := int(value.FieldByName("Present").Int())
+	if present <= 0 || present >= value.NumField() || value.Field(present).IsNil() {
+		return procedureCode, "Unknown", nil
+	}
+	message = value.Type().Field(present).Name
+	ies = renderIEs(value.Field(present).Elem().FieldByName(protocolIEContainerField))
+	return
+}
+
+// renderIEs renders a ProtocolIE-Container as the IEs named after the field selected in each IE value
+func renderIEs(container reflect.Value) object {
+	if !container.IsValid() {
+		return nil
+	}
+	list := container.FieldByName("List")
+	ies := object{}
+	for i := 0; i < list.Len(); i++ {
+		value := list.Index(i).FieldByName("Value")
+		present := int(value.FieldByName("Present").Int())
+		if present <= 0 || present >= value.NumField() {
+			ies = append(ies, member{fmt.Sprintf("IE-%d", list.Index(i).FieldByName("Id").Field(0).Int()), nil})
+			continue
+		}
+		name := value.Type().Field(present).Name
+		ies = append(ies, member{name, renderField(name, value.Field(present))})
+	}
+	return ies
+}
+
+// renderField renders a field, decoding the transfers carried as OCTET STRINGs
+func renderField(name string, v reflect.Value) interface{} {
+	if transferType, ok := transferTypes[name]; ok {
+		for v.Kind() == reflect.Ptr && !v.IsNil() {
+			v = v.Elem()
+		}
+		if v.Type() == aper.OctetStringType {
+			transfer := reflect.New(transferType)
+			if err := aper.UnmarshalWithParams(v.Bytes(), transfer.Interface(), "valueExt"); err == nil {
+				return render(transfer.Elem())
+			}
+		}
+	}
+	return render(v)
+}
+
+// render renders an ASN.1 value with its decoded value instead of the Go representation
+func render(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		return render(v.Elem())
+	}
+
+	switch v.Type() {
+	case aper.OctetStringType:
+		return "0x" + hex.EncodeToString(v.Bytes())
+	case aper.BitStringType:
+		bitString := v.Interface().(aper.BitString)
+		return fmt.Sprintf("0x%s/%d", hex.EncodeToString(bitString.Bytes), bitString.BitLength)
+	case aper.EnumeratedType:
+		return v.Uint()
+	case nasPDUType:
+		return renderNASPDU(v.Interface().(ngapType.NASPDU).Value)
+	case plmnIdentityType:
+		plmnID := ngapConvert.PlmnIdToModels(v.Interface().(ngapType.PLMNIdentity))
+		return plmnID.Mcc + "-" + plmnID.Mnc
+	case transportLayerAddrType:
+		ipv4, ipv6 := ngapConvert.IPAddressToString(v.Interface().(ngapType.TransportLayerAddress))
+		return strings.Trim(ipv4+" "+ipv6, " ")
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		return renderStruct(v)
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if v.Kind() == reflect.Array {
+				b := make([]byte, v.Len())
+				reflect.Copy(reflect.ValueOf(b), v)
+				return "0x" + hex.EncodeToString(b)
+			}
+			return "0x" + hex.EncodeToString(v.Bytes())
+		}
+		list := make([]interface{}, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			list[i] = render(v.Index(i))
+		}
+		return list
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint()
+	default:
+		return v.Interface()
+	}
+}
+
+func renderStruct(v reflect.Value) interface{} {
+	t := v.Type()
+
+	// CHOICE
+	if t.NumField() > 0 && t.Field(0).Name == "Present" {
+		present := int(v.Field(0).Int())
+		if present <= 0 || present >= v.NumField() {
+			return nil
+		}
+		name := t.Field(present).Name
+		return object{{name, renderField(name, v.Field(present))}}
+	}
+	// single value types and SEQUENCE OF
+	if t.NumField() == 1 && (t.Field(0).Name == "Value" || t.Field(0).Name == "List") {
+		return render(v.Field(0))
+	}
+	if t.NumField() == 1 && t.Field(0).Name == protocolIEContainerField {
+		return renderIEs(v.Field(0))
+	}
+
+	o := object{}
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Ptr && field.IsNil() {
+			continue
+		}
+		name := t.Field(i).Name
+		if name == protocolIEContainerField {
+			o = append(o, member{name, renderIEs(field)})
+			continue
+		}
+		o = append(o, member{name, renderField(name, field)})
+	}
+	return o
+}
+
+// renderNASPDU renders a plain NAS message, and the security header of a security protected NAS message
+//
+// TS 24.501 9.1.1 NAS message format
+func renderNASPDU(payload []byte) interface{} {
+	if len(payload) < 3 {
+		return "0x" + hex.EncodeToString(payload)
+	}
+	securityHeaderType := nas.GetSecurityHeaderType(payload) & 0x0f
+	if payload[0] != nasMessage.Epd5GSMobilityManagementMessage || securityHeaderType == nas.SecurityHeaderTypePlainNas {
+		msg := new(nas.Message)
+		plain := append([]byte{}, payload...)
+		if err := msg.PlainNasDecode(&plain); err != nil {
+			return "0x" + hex.EncodeToString(payload)
+		}
+		message, ies := renderNAS(msg)
+		return object{{message, ies}}
+	}
+	if len(payload) < 7 {
+		return "0x" + hex.EncodeToString(payload)
+	}
+	return object{
+		{"SecurityHeaderType", securityHeaderType},
+		{"MessageAuthenticationCode", "0x" + hex.EncodeToString(payload[2:6])},
+		{"SequenceNumber", payload[6]},
+		{"Protected", "0x" + hex.EncodeToString(payload[7:])},
+	}
+}
+
+// renderNAS returns the name and the IEs of a plain 5GMM or 5GSM message
+func renderNAS(msg *nas.Message) (message string, ies object) {
+	var v reflect.Value
+	switch {
+	case msg.GmmMessage != nil:
+		v = reflect.ValueOf(msg.GmmMessage).Elem()
+	case msg.GsmMessage != nil:
+		v = reflect.ValueOf(msg.GsmMessage).Elem()
+	default:
+		return "Unknown", nil
+	}
+
+	// the message is the only non-nil embedded message after the header
+	for i := 1; i < v.NumField(); i++ {
+		if v.Field(i).Kind() != reflect.Ptr || v.Field(i).IsNil() {
+			continue
+		}
+		message = v.Type().Field(i).Name
+		body := v.Field(i).Elem()
+		ies = object{}
+		for j := 0; j < body.NumField(); j++ {
+			field := body.Field(j)
+			if field.Kind() == reflect.Ptr && field.IsNil() {
+				continue
+			}
+			name := body.Type().Field(j).Name
+			if name == "PayloadContainer" {
+				// N1 SM information, TS 24.501 9.11.3.39
+				container := reflect.Indirect(field).Interface().(nasType.PayloadContainer)
+				if len(container.Buffer) > 0 && container.Buffer[0] == nasMessage.Epd5GSSessionManagementMessage {
+					ies = append(ies, member{name, renderNASPDU(container.Buffer)})
+					continue
+				}
+			}
+			ies = append(ies, member{name, renderNASIE(field)})
+		}
+		return
+	}
+	return "Unknown", nil
+}
+
+// renderNASIE renders the value of a NAS IE, leaving out its IEI and length
+//
+// TS 24.501 9.11 Information elements
+func renderNASIE(v reflect.Value) interface{} {
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Type() == mobileIdentity5GSType {
+		mobileIdentity5GS := v.Interface().(nasType.MobileIdentity5GS)
+		return renderMobileIdentity5GS(mobileIdentity5GS.GetMobileIdentity5GSContents())
+	}
+	if v.Kind() != reflect.Struct {
+		return render(v)
+	}
+	if field := v.FieldByName("Buffer"); field.IsValid() {
+		return render(field)
+	}
+	if field := v.FieldByName("Octet"); field.IsValid() {
+		return render(field)
+	}
+	return render(v)
+}
+
+// renderMobileIdentity5GS renders a 5GS mobile identity as a string
+//
+// TS 24.501 9.11.3.4 5GS mobile identity
+func renderMobileIdentity5GS(contents []byte) interface{} {
+	if len(contents) == 0 {
+		return nil
+	}
+	switch contents[0] & 0x07 {
+	case nasMessage.MobileIdentity5GSTypeSuci:
+		if (contents[0]&0x70)>>4 == nasMessage.SupiFormatImsi {
+			suci, _ := nasConvert.SuciToString(contents)
+			return suci
+		}
+		return string(contents[1:])
+	case nasMessage.MobileIdentity5GSType5gGuti:
+		_, guti := nasConvert.GutiToString(contents)
+		return guti
+	case nasMessage.MobileIdentity5GSTypeMacAddress:
+		if len(contents) >= 7 {
+			return net.HardwareAddr(contents[1:7]).String()
+		}
+	}
+	return "0x" + hex.EncodeToString(contents)
+}
@@ -0,0 +1,206 @@
+// Package trace writes a human readable trace of the NGAP PDUs and NAS messages exchanged with the AGFs, with the
+// procedure, message and IE names and the decoded IE values.
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"free5gc/lib/nas"
+	"free5gc/lib/ngap/ngapType"
+
+	"sim-amf/pkg/context"
+	"sim-amf/pkg/util"
+)
+
+// Output formats
+const (
+	FormatText string = "text" // indented text tree
+	FormatJSON string = "json" // JSON lines
+)
+
+// Global is the tracer of sim-amf, nil if tracing is disabled
+var Global *Tracer
+
+// Tracer writes the trace records of the selected UEs and procedures, it is safe for concurrent use. A nil Tracer
+// traces nothing.
+type Tracer struct {
+	mu         sync.Mutex
+	out        io.Writer
+	format     string
+	procedures map[string]bool // NGAP procedure or NAS message type names, empty for all
+	ues        map[string]bool // AMF UE NGAP IDs or MAC addresses, empty for all
+}
+
+type record struct {
+	Time      time.Time   `json:"time"`
+	UE        string      `json:"ue,omitempty"`
+	Direction string      `json:"direction"`
+	Protocol  string      `json:"protocol"`
+	Procedure string      `json:"procedure"`
+	Message   string      `json:"message"`
+	IEs       interface{} `json:"ies"`
+}
+
+func NewTracer(out io.Writer, format string) (*Tracer, error) {
+	switch format {
+	case FormatText, FormatJSON:
+	default:
+		return nil, fmt.Errorf("trace format %s not supported", format)
+	}
+	return &Tracer{
+		out:        out,
+		format:     format,
+		procedures: make(map[string]bool),
+		ues:        make(map[string]bool),
+	}, nil
+}
+
+// SetProcedures restricts the trace to the NGAP procedures and NAS message types with the names used by the metrics,
+// e.g. initial_context_setup or registration_request. No name traces all of them.
+func (t *Tracer) SetProcedures(names []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.procedures = make(map[string]bool)
+	for _, name := range names {
+		t.procedures[name] = true
+	}
+}
+
+// SetUEs restricts the trace to the UEs with the AMF UE NGAP IDs or MAC addresses. No UE traces all of them, and the
+// non UE associated messages.
+func (t *Tracer) SetUEs(ues []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ues = make(map[string]bool)
+	for _, ue := range ues {
+		t.ues[strings.ToLower(ue)] = true
+	}
+}
+
+// EnableUE adds or removes a UE from the traced UEs
+func (t *Tracer) EnableUE(ue *context.UEContext, enable bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := strconv.FormatInt(ue.AmfUeNgapId, 10)
+	if enable {
+		t.ues[key] = true
+	} else {
+		delete(t.ues, key)
+		delete(t.ues, strings.ToLower(ue.MAC))
+	}
+}
+
+// NGAP traces an NGAP PDU sent to or received from the AGF serving the UE, ue is nil for non UE associated messages
+func (t *Tracer) NGAP(ue *context.UEContext, direction string, pdu *ngapType.NGAPPDU) {
+	if t == nil || pdu == nil {
+		return
+	}
+	procedureCode, message, ies := renderNGAP(pdu)
+	t.write(ue, record{
+		Direction: direction,
+		Protocol:  "NGAP",
+		Procedure: util.NgapProcedureName(procedureCode),
+		Message:   message,
+		IEs:       ies,
+	})
+}
+
+// NAS traces a plain NAS message of the UE, the security protected ones being traced after decryption
+func (t *Tracer) NAS(ue *context.UEContext, direction string, msg *nas.Message) {
+	if t == nil || msg == nil {
+		return
+	}
+	var procedure string
+	switch {
+	case msg.GmmMessage != nil:
+		procedure = util.NasMessageTypeName(msg.GmmMessage.GetMessageType())
+	case msg.GsmMessage != nil:
+		procedure = util.NasMessageTypeName(msg.GsmMessage.GetMessageType())
+	default:
+		return
+	}
+	message, ies := renderNAS(msg)
+	t.write(ue, record{
+		Direction: direction,
+		Protocol:  "NAS",
+		Procedure: procedure,
+		Message:   message,
+		IEs:       ies,
+	})
+}
+
+func (t *Tracer) write(ue *context.UEContext, r record) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.procedures) > 0 && !t.procedures[r.Procedure] {
+		return
+	}
+	if len(t.ues) > 0 {
+		if ue == nil || !(t.ues[strconv.FormatInt(ue.AmfUeNgapId, 10)] || t.ues[strings.ToLower(ue.MAC)]) {
+			return
+		}
+	}
+
+	r.Time = time.Now()
+	if ue != nil {
+		r.UE = ue.LogTag(r.Protocol)
+	}
+	switch t.format {
+	case FormatJSON:
+		line, err := json.Marshal(r)
+		if err != nil {
+			return
+		}
+		t.out.Write(append(line, '\n'))
+	case FormatText:
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s %s %s %s %s %s\n", r.Time.Format(time.RFC3339Nano), r.UE, r.Direction, r.Protocol,
+			r.Procedure, r.Message)
+		writeTree(&b, r.IEs, 1)
+		io.WriteString(t.out, b.String())
+	}
+}
+
+// writeTree writes a rendered value as an indented tree
+func writeTree(b *strings.Builder, value interface{}, depth int) {
+	indent := strings.Repeat("  ", depth)
+	switch v := value.(type) {
+	case object:
+		for _, m := range v {
+			if isLeaf(m.Value) {
+				fmt.Fprintf(b, "%s%s: %v\n", indent, m.Name, m.Value)
+				continue
+			}
+			fmt.Fprintf(b, "%s%s:\n", indent, m.Name)
+			writeTree(b, m.Value, depth+1)
+		}
+	case []interface{}:
+		for i, item := range v {
+			if isLeaf(item) {
+				fmt.Fprintf(b, "%s[%d]: %v\n", indent, i, item)
+				continue
+			}
+			fmt.Fprintf(b, "%s[%d]:\n", indent, i)
+			writeTree(b, item, depth+1)
+		}
+	default:
+		if value != nil {
+			fmt.Fprintf(b, "%s%v\n", indent, value)
+		}
+	}
+}
+
+func isLeaf(value interface{}) bool {
+	switch value.(type) {
+	case object, []interface{}:
+		return false
+	}
+	return true
+}
@@ -1,13 +1,19 @@
 package types
 
+import (
+	"encoding/base64"
+	"encoding/hex"
+)
+
 type RGType string
 
 const (
 	RGType_FN_RG    RGType = "FN_RG"
 	RGType_FIVEG_RG RGType = "5G_RG"
 
-	LineType_DSL string = "DSL"
-	LineType_PON string = "PON"
+	LineType_DSL   string = "DSL"
+	LineType_PON   string = "PON"
+	LineType_CABLE string = "CABLE" // CableLabs FN-CRG, TS 23.316 4.7.3
 )
 
 type RGContext struct {
@@ -17,6 +23,8 @@ type RGContext struct {
 	LineID           string
 	CircuitID        string
 	RemoteID         string
+	CableID          string // Global Cable Identifier of the FN-CRG
+	HFCNodeID        string // HFC node ID, 4 octets in hex
 	UpBindAddr       string
 	CreatePDUSession bool
 	PDUSessionType   string
@@ -29,10 +37,61 @@ func (ctx *RGContext) Valid() bool {
 		return false
 	}
 
-	if ctx.LineType != LineType_PON && ctx.LineType != LineType_DSL {
+	switch ctx.LineType {
+	case LineType_DSL, LineType_PON:
+		if !ctx.validLineID() {
+			return false
+		}
+	case LineType_CABLE:
+		if !ctx.validCableID() {
+			return false
+		}
+	default:
+		return false
+	}
+
+	if ctx.MAC == "" {
+		return false
+	}
+
+	switch ctx.PDUSessionType {
+	case PDUSessionTypeIPv4:
+	case PDUSessionTypeIPv6:
+	case PDUSessionTypeIPv4v6:
+	case PDUSessionTypeUnstructured:
+	case PDUSessionTypeEthernet:
+	case PDUSessionTypeReserved:
+	default:
+		return false
+	}
+
+	return true
+}
+
+// ValidGlobalLineID tells whether a Global Line Identifier reported by a W-AGF is well-formed: the 5 digits of the AGF
+// Operator Administered Source ID followed by a valid Line ID. The GLI is base64 encoded in the User Location
+// Information, as done by context.InitGlobalLineID, the raw GLI is accepted too.
+//
+// TS 23.003 28.16 Global Line Identifier (GLI), TR-470 Figure 18
+func ValidGlobalLineID(gli []byte) bool {
+	if decoded, err := base64.StdEncoding.DecodeString(string(gli)); err == nil {
+		gli = decoded
+	}
+	if len(gli) < 5+2 {
 		return false
 	}
+	for _, value := range gli[:5] {
+		// Permissible values 0x30-0x39
+		if value < 0x30 || value > 0x39 {
+			return false
+		}
+	}
+	ctx := RGContext{LineID: string(gli[5:])}
+	return ctx.validLineID()
+}
 
+// validLineID tells whether the Line ID, or the Circuit ID and Remote ID it is built from, of a DSL or PON line is valid
+func (ctx *RGContext) validLineID() bool {
 	if len(ctx.LineID) == 0 && len(ctx.CircuitID) == 0 && len(ctx.RemoteID) == 0 {
 		return false
 	}
@@ -50,6 +109,9 @@ func (ctx *RGContext) Valid() bool {
 
 			for key, value := range ctx.LineID[2:] {
 				if value == 0x02 {
+					if key+4 > len(ctx.LineID) {
+						return false
+					}
 					components = append(components, ctx.LineID[2:key+2])
 					components = append(components, ctx.LineID[key+4:])
 
@@ -125,22 +187,26 @@ func (ctx *RGContext) Valid() bool {
 		}
 	}
 
-	if ctx.MAC == "" {
-		return false
-	}
+	return true
+}
 
-	switch ctx.PDUSessionType {
-	case PDUSessionTypeIPv4:
-	case PDUSessionTypeIPv6:
-	case PDUSessionTypeIPv4v6:
-	case PDUSessionTypeUnstructured:
-	case PDUSessionTypeEthernet:
-	case PDUSessionTypeReserved:
-	default:
+// validCableID tells whether the Global Cable Identifier and HFC node ID of a cable line are valid. The GCI is the
+// username of the SUCI and SUPI of the FN-CRG in NAI format.
+//
+// TS 23.003 28.15.4 Global Cable Identifier (GCI), TS 38.413 9.3.1.16 User Location Information
+func (ctx *RGContext) validCableID() bool {
+	if len(ctx.CableID) == 0 || len(ctx.CableID) > 0xfd {
 		return false
 	}
+	for _, value := range ctx.CableID {
+		// Permissible values 0x20-0x7e, the realm separator excluded
+		if value < 0x20 || value > 0x7e || value == '@' {
+			return false
+		}
+	}
 
-	return true
+	hfcNodeID, err := hex.DecodeString(ctx.HFCNodeID)
+	return err == nil && len(hfcNodeID) == 4
 }
 
 type WAgfInfo struct {
@@ -11,6 +11,7 @@ import (
 	"free5gc/lib/ngap/ngapConvert"
 	"free5gc/lib/ngap/ngapType"
 	"free5gc/lib/openapi/models"
+	"math"
 	"strings"
 )
 
@@ -31,6 +32,14 @@ const (
 	GPRSTimer2UintDeactivated                       uint8 = 0x07 << 5
 )
 
+// TS 24.501 Table 9.11.4.14.1: Session-AMBR information element
+//
+// Each unit value multiplies the previous one by 4, starting from 1 Kbps
+const (
+	SessionAMBRUnit1Kbps uint8 = 0x01
+	SessionAMBRUnitMax   uint8 = 0x19
+)
+
 func PlmnIdToNgap(pmcc string, pmnc string) (ngapPlmnId ngapType.PLMNIdentity) {
 	var hexString string
 	mcc := strings.Split(pmcc, "")
@@ -167,6 +176,120 @@ func NasRejectedNssaiToModels(nasNssai *nasType.RejectedNSSAI) (nssaiInPlmn []mo
 
 }
 
+// AllowedNssaiToNas encodes an Allowed NSSAI IE of at most 8 S-NSSAIs
+//
+// TS 24.501 9.11.3.37 NSSAI
+func AllowedNssaiToNas(iei uint8, nssai []models.Snssai) *nasType.AllowedNSSAI {
+	var buf []uint8
+	for i, snssai := range nssai {
+		if i == 8 {
+			break
+		}
+		buf = append(buf, nasConvert.SnssaiToNas(snssai)...)
+	}
+	allowedNssai := nasType.NewAllowedNSSAI(iei)
+	allowedNssai.SetLen(uint8(len(buf)))
+	allowedNssai.SetSNSSAIValue(buf)
+	return allowedNssai
+}
+
+// ConfiguredNssaiToNas encodes a Configured NSSAI IE of at most 16 S-NSSAIs
+//
+// TS 24.501 9.11.3.37 NSSAI
+func ConfiguredNssaiToNas(iei uint8, nssai []models.Snssai) *nasType.ConfiguredNSSAI {
+	var buf []uint8
+	for i, snssai := range nssai {
+		if i == 16 {
+			break
+		}
+		buf = append(buf, nasConvert.SnssaiToNas(snssai)...)
+	}
+	configuredNssai := nasType.NewConfiguredNSSAI(iei)
+	configuredNssai.SetLen(uint8(len(buf)))
+	configuredNssai.SetSNSSAIValue(buf)
+	return configuredNssai
+}
+
+// RejectedNssaiToNas encodes a Rejected NSSAI IE of at most 8 S-NSSAIs, the ones not available in the current PLMN
+// followed by the ones not available in the current registration area
+//
+// TS 24.501 9.11.3.46 Rejected NSSAI
+func RejectedNssaiToNas(iei uint8, nssaiInPlmn []models.Snssai, nssaiInTai []models.Snssai) *nasType.RejectedNSSAI {
+	var buf []uint8
+	total := 0
+	for _, snssai := range nssaiInPlmn {
+		if total == 8 {
+			break
+		}
+		buf = append(buf, nasConvert.RejectedSnssaiToNas(snssai, nasMessage.RejectedSnssaiCauseNotAvailableInCurrentPlmn)...)
+		total++
+	}
+	for _, snssai := range nssaiInTai {
+		if total == 8 {
+			break
+		}
+		buf = append(buf, nasConvert.RejectedSnssaiToNas(snssai, nasMessage.RejectedSnssaiCauseNotAvailableInCurrentRegistrationArea)...)
+		total++
+	}
+	rejectedNssai := nasType.NewRejectedNSSAI(iei)
+	rejectedNssai.SetLen(uint8(len(buf)))
+	rejectedNssai.SetRejectedNSSAIContents(buf)
+	return rejectedNssai
+}
+
+// SnssaiToNas encodes an S-NSSAI IE
+//
+// TS 24.501 9.11.2.8 S-NSSAI
+func SnssaiToNas(iei uint8, snssai models.Snssai) *nasType.SNSSAI {
+	buf := nasConvert.SnssaiToNas(snssai)
+	nasSnssai := nasType.NewSNSSAI(iei)
+	nasSnssai.SetLen(buf[0])
+	copy(nasSnssai.Octet[:], buf[1:])
+	return nasSnssai
+}
+
+// NasSnssaiIEToModels decodes an S-NSSAI IE, ignoring the mapped HPLMN S-NSSAI
+func NasSnssaiIEToModels(nasSnssai *nasType.SNSSAI) (snssai models.Snssai) {
+	snssai.Sst = int32(nasSnssai.GetSST())
+	if nasSnssai.GetLen() >= 4 {
+		sd := nasSnssai.GetSD()
+		snssai.Sd = hex.EncodeToString(sd[:])
+	}
+	return
+}
+
+// NasDnnToModels decodes a DNN IE, encoded as the labels of an APN or, as sent by some UEs, as a plain string
+//
+// TS 24.501 9.11.2.1B DNN, TS 23.003 9.1 Structure of APN
+func NasDnnToModels(dnn []byte) string {
+	var labels []string
+	for offset := 0; offset < len(dnn); {
+		length := int(dnn[offset])
+		if length == 0 || offset+1+length > len(dnn) {
+			return string(dnn)
+		}
+		labels = append(labels, string(dnn[offset+1:offset+1+length]))
+		offset += 1 + length
+	}
+	return strings.Join(labels, ".")
+}
+
+// AllowedNssaiToNgap encodes an Allowed NSSAI IE of at most 8 S-NSSAIs
+//
+// TS 38.413 9.3.1.31 Allowed NSSAI
+func AllowedNssaiToNgap(nssai []models.Snssai) *ngapType.AllowedNSSAI {
+	allowedNssai := new(ngapType.AllowedNSSAI)
+	for i, snssai := range nssai {
+		if i == 8 {
+			break
+		}
+		allowedNssai.List = append(allowedNssai.List, ngapType.AllowedNSSAIItem{
+			SNSSAI: ngapConvert.SNssaiToNgap(snssai),
+		})
+	}
+	return allowedNssai
+}
+
 func NgapAllowedNssaiToModels(ngapNssai *ngapType.AllowedNSSAI) (nssai []models.Snssai) {
 	for _, item := range ngapNssai.List {
 		snssai := ngapConvert.SNssaiToModels(item.SNSSAI)
@@ -205,7 +328,7 @@ func NasRejectedSnssaiToModels(buf []byte) (snssai models.Snssai, length int, ca
 	case 0x02, 0x03, 0x04: // sst + sd
 		snssai.Sst = int32(buf[1])
 		offset := int(lengthOfSnssaiContents) + 1
-		if offset >= lengthOfBuf {
+		if offset <= lengthOfBuf {
 			snssai.Sd = hex.EncodeToString(buf[2:offset])
 		} else {
 			snssai.Sd = hex.EncodeToString(buf[2:])
@@ -286,3 +409,57 @@ func GPRSTimer2ContentToSeconds(content uint8) int {
 		return int(content&GPRSTimer2ValueMask) * SecondsPerMinute
 	}
 }
+
+// BitRateToNasAMBR converts a bit rate in bps to the unit and value of a Session-AMBR, using the finest unit the value
+// fits in
+//
+// TS 24.501 9.11.4.14 Session-AMBR
+func BitRateToNasAMBR(bitRate int64) (unit uint8, value [2]uint8) {
+	rate := bitRate / 1000
+	unit = SessionAMBRUnit1Kbps
+	for rate > math.MaxUint16 && unit < SessionAMBRUnitMax {
+		rate /= 4
+		unit++
+	}
+	binary.BigEndian.PutUint16(value[:], uint16(rate))
+	return
+}
+
+// NgapCause builds the Cause IE from the cause group and the value within that group
+//
+// TS 38.413 9.3.1.2 Cause
+func NgapCause(causePresent int, causeValue aper.Enumerated) (cause ngapType.Cause, err error) {
+	cause.Present = causePresent
+	switch causePresent {
+	case ngapType.CausePresentRadioNetwork:
+		cause.RadioNetwork = &ngapType.CauseRadioNetwork{Value: causeValue}
+	case ngapType.CausePresentTransport:
+		cause.Transport = &ngapType.CauseTransport{Value: causeValue}
+	case ngapType.CausePresentNas:
+		cause.Nas = &ngapType.CauseNas{Value: causeValue}
+	case ngapType.CausePresentProtocol:
+		cause.Protocol = &ngapType.CauseProtocol{Value: causeValue}
+	case ngapType.CausePresentMisc:
+		cause.Misc = &ngapType.CauseMisc{Value: causeValue}
+	default:
+		err = fmt.Errorf("Cause Present %d is unknown", causePresent)
+	}
+	return
+}
+
+// NgapCauseString returns the cause group and the value within that group, e.g. radioNetwork 26
+func NgapCauseString(cause *ngapType.Cause) string {
+	switch cause.Present {
+	case ngapType.CausePresentRadioNetwork:
+		return fmt.Sprintf("radioNetwork %d", cause.RadioNetwork.Value)
+	case ngapType.CausePresentTransport:
+		return fmt.Sprintf("transport %d", cause.Transport.Value)
+	case ngapType.CausePresentNas:
+		return fmt.Sprintf("nas %d", cause.Nas.Value)
+	case ngapType.CausePresentProtocol:
+		return fmt.Sprintf("protocol %d", cause.Protocol.Value)
+	case ngapType.CausePresentMisc:
+		return fmt.Sprintf("misc %d", cause.Misc.Value)
+	}
+	return fmt.Sprintf("unknown group %d", cause.Present)
+}
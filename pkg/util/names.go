@@ -0,0 +1,131 @@
+package util
+
+import (
+	"fmt"
+
+	"free5gc/lib/nas"
+	"free5gc/lib/ngap/ngapType"
+)
+
+var procedureNames = map[int64]string{
+	ngapType.ProcedureCodeAMFConfigurationUpdate:                "amf_configuration_update",
+	ngapType.ProcedureCodeAMFCPRelocationIndication:             "amf_cp_relocation_indication",
+	ngapType.ProcedureCodeAMFStatusIndication:                   "amf_status_indication",
+	ngapType.ProcedureCodeCellTrafficTrace:                      "cell_traffic_trace",
+	ngapType.ProcedureCodeDeactivateTrace:                       "deactivate_trace",
+	ngapType.ProcedureCodeDownlinkNASTransport:                  "downlink_nas_transport",
+	ngapType.ProcedureCodeDownlinkNonUEAssociatedNRPPaTransport: "downlink_non_ue_associated_nrppa_transport",
+	ngapType.ProcedureCodeDownlinkRANConfigurationTransfer:      "downlink_ran_configuration_transfer",
+	ngapType.ProcedureCodeDownlinkRANStatusTransfer:             "downlink_ran_status_transfer",
+	ngapType.ProcedureCodeDownlinkUEAssociatedNRPPaTransport:    "downlink_ue_associated_nrppa_transport",
+	ngapType.ProcedureCodeErrorIndication:                       "error_indication",
+	ngapType.ProcedureCodeHandoverCancel:                        "handover_cancel",
+	ngapType.ProcedureCodeHandoverNotification:                  "handover_notification",
+	ngapType.ProcedureCodeHandoverPreparation:                   "handover_preparation",
+	ngapType.ProcedureCodeHandoverResourceAllocation:            "handover_resource_allocation",
+	ngapType.ProcedureCodeInitialContextSetup:                   "initial_context_setup",
+	ngapType.ProcedureCodeInitialUEMessage:                      "initial_ue_message",
+	ngapType.ProcedureCodeLocationReportingControl:              "location_reporting_control",
+	ngapType.ProcedureCodeLocationReportingFailureIndication:    "location_reporting_failure_indication",
+	ngapType.ProcedureCodeLocationReport:                        "location_report",
+	ngapType.ProcedureCodeNASNonDeliveryIndication:              "nas_non_delivery_indication",
+	ngapType.ProcedureCodeNGReset:                               "ng_reset",
+	ngapType.ProcedureCodeNGSetup:                               "ng_setup",
+	ngapType.ProcedureCodeOverloadStart:                         "overload_start",
+	ngapType.ProcedureCodeOverloadStop:                          "overload_stop",
+	ngapType.ProcedureCodePaging:                                "paging",
+	ngapType.ProcedureCodePathSwitchRequest:                     "path_switch_request",
+	ngapType.ProcedureCodePDUSessionResourceModify:              "pdu_session_resource_modify",
+	ngapType.ProcedureCodePDUSessionResourceModifyIndication:    "pdu_session_resource_modify_indication",
+	ngapType.ProcedureCodePDUSessionResourceRelease:             "pdu_session_resource_release",
+	ngapType.ProcedureCodePDUSessionResourceSetup:               "pdu_session_resource_setup",
+	ngapType.ProcedureCodePDUSessionResourceNotify:              "pdu_session_resource_notify",
+	ngapType.ProcedureCodePrivateMessage:                        "private_message",
+	ngapType.ProcedureCodePWSCancel:                             "pws_cancel",
+	ngapType.ProcedureCodePWSFailureIndication:                  "pws_failure_indication",
+	ngapType.ProcedureCodePWSRestartIndication:                  "pws_restart_indication",
+	ngapType.ProcedureCodeRANConfigurationUpdate:                "ran_configuration_update",
+	ngapType.ProcedureCodeRerouteNASRequest:                     "reroute_nas_request",
+	ngapType.ProcedureCodeRRCInactiveTransitionReport:           "rrc_inactive_transition_report",
+	ngapType.ProcedureCodeTraceFailureIndication:                "trace_failure_indication",
+	ngapType.ProcedureCodeTraceStart:                            "trace_start",
+	ngapType.ProcedureCodeUEContextModification:                 "ue_context_modification",
+	ngapType.ProcedureCodeUEContextRelease:                      "ue_context_release",
+	ngapType.ProcedureCodeUEContextReleaseRequest:               "ue_context_release_request",
+	ngapType.ProcedureCodeUERadioCapabilityCheck:                "ue_radio_capability_check",
+	ngapType.ProcedureCodeUERadioCapabilityInfoIndication:       "ue_radio_capability_info_indication",
+	ngapType.ProcedureCodeUETNLABindingRelease:                  "ue_tnla_binding_release",
+	ngapType.ProcedureCodeUplinkNASTransport:                    "uplink_nas_transport",
+	ngapType.ProcedureCodeUplinkNonUEAssociatedNRPPaTransport:   "uplink_non_ue_associated_nrppa_transport",
+	ngapType.ProcedureCodeUplinkRANConfigurationTransfer:        "uplink_ran_configuration_transfer",
+	ngapType.ProcedureCodeUplinkRANStatusTransfer:               "uplink_ran_status_transfer",
+	ngapType.ProcedureCodeUplinkUEAssociatedNRPPaTransport:      "uplink_ue_associated_nrppa_transport",
+	ngapType.ProcedureCodeWriteReplaceWarning:                   "write_replace_warning",
+}
+
+var nasMessageTypeNames = map[uint8]string{
+	nas.MsgTypeRegistrationRequest:                              "registration_request",
+	nas.MsgTypeRegistrationAccept:                               "registration_accept",
+	nas.MsgTypeRegistrationComplete:                             "registration_complete",
+	nas.MsgTypeRegistrationReject:                               "registration_reject",
+	nas.MsgTypeDeregistrationRequestUEOriginatingDeregistration: "deregistration_request_ue_originating_deregistration",
+	nas.MsgTypeDeregistrationAcceptUEOriginatingDeregistration:  "deregistration_accept_ue_originating_deregistration",
+	nas.MsgTypeDeregistrationRequestUETerminatedDeregistration:  "deregistration_request_ue_terminated_deregistration",
+	nas.MsgTypeDeregistrationAcceptUETerminatedDeregistration:   "deregistration_accept_ue_terminated_deregistration",
+	nas.MsgTypeServiceRequest:                                   "service_request",
+	nas.MsgTypeServiceReject:                                    "service_reject",
+	nas.MsgTypeServiceAccept:                                    "service_accept",
+	nas.MsgTypeConfigurationUpdateCommand:                       "configuration_update_command",
+	nas.MsgTypeConfigurationUpdateComplete:                      "configuration_update_complete",
+	nas.MsgTypeAuthenticationRequest:                            "authentication_request",
+	nas.MsgTypeAuthenticationResponse:                           "authentication_response",
+	nas.MsgTypeAuthenticationReject:                             "authentication_reject",
+	nas.MsgTypeAuthenticationFailure:                            "authentication_failure",
+	nas.MsgTypeAuthenticationResult:                             "authentication_result",
+	nas.MsgTypeIdentityRequest:                                  "identity_request",
+	nas.MsgTypeIdentityResponse:                                 "identity_response",
+	nas.MsgTypeSecurityModeCommand:                              "security_mode_command",
+	nas.MsgTypeSecurityModeComplete:                             "security_mode_complete",
+	nas.MsgTypeSecurityModeReject:                               "security_mode_reject",
+	nas.MsgTypeStatus5GMM:                                       "5gmm_status",
+	nas.MsgTypeNotification:                                     "notification",
+	nas.MsgTypeNotificationResponse:                             "notification_response",
+	nas.MsgTypeULNASTransport:                                   "ulnas_transport",
+	nas.MsgTypeDLNASTransport:                                   "dlnas_transport",
+	nas.MsgTypePDUSessionEstablishmentRequest:                   "pdu_session_establishment_request",
+	nas.MsgTypePDUSessionEstablishmentAccept:                    "pdu_session_establishment_accept",
+	nas.MsgTypePDUSessionEstablishmentReject:                    "pdu_session_establishment_reject",
+	nas.MsgTypePDUSessionAuthenticationCommand:                  "pdu_session_authentication_command",
+	nas.MsgTypePDUSessionAuthenticationComplete:                 "pdu_session_authentication_complete",
+	nas.MsgTypePDUSessionAuthenticationResult:                   "pdu_session_authentication_result",
+	nas.MsgTypePDUSessionModificationRequest:                    "pdu_session_modification_request",
+	nas.MsgTypePDUSessionModificationReject:                     "pdu_session_modification_reject",
+	nas.MsgTypePDUSessionModificationCommand:                    "pdu_session_modification_command",
+	nas.MsgTypePDUSessionModificationComplete:                   "pdu_session_modification_complete",
+	nas.MsgTypePDUSessionModificationCommandReject:              "pdu_session_modification_command_reject",
+	nas.MsgTypePDUSessionReleaseRequest:                         "pdu_session_release_request",
+	nas.MsgTypePDUSessionReleaseReject:                          "pdu_session_release_reject",
+	nas.MsgTypePDUSessionReleaseCommand:                         "pdu_session_release_command",
+	nas.MsgTypePDUSessionReleaseComplete:                        "pdu_session_release_complete",
+	nas.MsgTypeStatus5GSM:                                       "5gsm_status",
+}
+
+// NgapProcedureName returns the name of an NGAP elementary procedure
+//
+// TS 38.413 9.4.7 Constant Definitions
+func NgapProcedureName(procedureCode int64) string {
+	if name, ok := procedureNames[procedureCode]; ok {
+		return name
+	}
+	return fmt.Sprintf("procedure_%d", procedureCode)
+}
+
+// NasMessageTypeName returns the name of a 5GMM or 5GSM message type
+//
+// TS 24.501 9.7 Message type
+func NasMessageTypeName(messageType uint8) string {
+	if name, ok := nasMessageTypeNames[messageType]; ok {
+		return name
+	}
+	return fmt.Sprintf("message_type_%d", messageType)
+}